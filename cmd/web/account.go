@@ -0,0 +1,420 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/providers"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// accountExport is everything we hold about a user, as they download it.
+// Tokens and password hashes are left out: they're secrets, not data about
+// the user.
+type accountExport struct {
+	ExportedAt          time.Time               `json:"exported_at"`
+	Profile             exportProfile           `json:"profile"`
+	Groups              []apiGroup              `json:"groups"`
+	AppointmentRequests []apiAppointmentRequest `json:"appointment_requests"`
+	Appointments        []apiAppointment        `json:"appointments"`
+	AppointmentEvents   []exportEvent           `json:"appointment_events"`
+	LinkedCalendars     []exportLinkedCalendar  `json:"linked_calendars"`
+	SignInAccounts      []exportSignInAccount   `json:"sign_in_accounts"`
+}
+
+type exportProfile struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Activated bool      `json:"activated"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportEvent struct {
+	AppointmentID   int    `json:"appointment_id"`
+	Provider        string `json:"provider"`
+	ProviderEventID string `json:"provider_event_id"`
+}
+
+type exportLinkedCalendar struct {
+	Provider  string    `json:"provider"`
+	Scope     string    `json:"scope"`
+	TokenType string    `json:"token_type"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+type exportSignInAccount struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportFile is one file of the zip archive of an export.
+type exportFile struct {
+	name  string
+	value any
+}
+
+// files returns the parts of the export as the files of the zip archive.
+func (e *accountExport) files() []exportFile {
+	return []exportFile{
+		{"profile.json", e.Profile},
+		{"groups.json", e.Groups},
+		{"appointment_requests.json", e.AppointmentRequests},
+		{"appointments.json", e.Appointments},
+		{"appointment_events.json", e.AppointmentEvents},
+		{"linked_calendars.json", e.LinkedCalendars},
+		{"sign_in_accounts.json", e.SignInAccounts},
+	}
+}
+
+// exportAccount gathers the user's data.
+func (app *application) exportAccount(userID int) (*accountExport, error) {
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &accountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: exportProfile{
+			ID:        user.ID,
+			Name:      user.Name,
+			Email:     user.Email,
+			Activated: user.Activated,
+			CreatedAt: user.Created,
+		},
+		Groups:              []apiGroup{},
+		AppointmentRequests: []apiAppointmentRequest{},
+		Appointments:        []apiAppointment{},
+		AppointmentEvents:   []exportEvent{},
+		LinkedCalendars:     []exportLinkedCalendar{},
+		SignInAccounts:      []exportSignInAccount{},
+	}
+
+	groups, err := app.models.Groups.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		export.Groups = append(export.Groups, newAPIGroup(g))
+	}
+
+	// Requests the user sent, then those they were asked to, each only once.
+	outgoing, err := app.models.AppointmentRequests.GetOutgoingForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	incoming, err := app.models.AppointmentRequests.GetForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	for _, r := range append(outgoing, incoming...) {
+		if seen[r.RequestID] {
+			continue
+		}
+		seen[r.RequestID] = true
+		export.AppointmentRequests = append(export.AppointmentRequests, newAPIAppointmentRequest(r))
+	}
+
+	appointments, err := app.models.Appointments.GetForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range appointments {
+		export.Appointments = append(export.Appointments, newAPIAppointment(a))
+	}
+
+	events, err := app.models.AppointmentEvents.GetForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		export.AppointmentEvents = append(export.AppointmentEvents, exportEvent{
+			AppointmentID:   e.AppointmentID,
+			Provider:        e.ProviderName,
+			ProviderEventID: e.ProviderEventID,
+		})
+	}
+
+	tokens, err := app.models.AuthTokens.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		export.LinkedCalendars = append(export.LinkedCalendars, exportLinkedCalendar{
+			Provider:  t.AuthProvider,
+			Scope:     t.Scope,
+			TokenType: t.TokenType,
+			Expiry:    t.Expiry,
+		})
+	}
+
+	identities, err := app.models.Identities.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range identities {
+		export.SignInAccounts = append(export.SignInAccounts, exportSignInAccount{
+			Provider:  i.Provider,
+			Subject:   i.Subject,
+			Email:     i.Email,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+
+	return export, nil
+}
+
+// downloadAccountData sends the user all their data, as a single JSON
+// document or, with ?format=zip, as a zip archive of one JSON file per part.
+func (app *application) downloadAccountData(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		app.clientError(w, http.StatusBadRequest, "Format must be json or zip")
+		return
+	}
+
+	export, err := app.exportAccount(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	filename := fmt.Sprintf("calendar-app-%s", export.ExportedAt.Format("2006-01-02"))
+
+	if format == "json" {
+		js, err := json.MarshalIndent(export, "", "\t")
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		w.Write(append(js, '\n'))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+
+	// The headers are sent with the first file, so a failure after that
+	// can only be logged.
+	zw := zip.NewWriter(w)
+	for _, file := range export.files() {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err == nil {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "\t")
+			err = enc.Encode(file.value)
+		}
+		if err != nil {
+			app.errorLog.Printf("Error writing data export of user %d: %v\n", userID, err)
+			return
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		app.errorLog.Printf("Error writing data export of user %d: %v\n", userID, err)
+	}
+}
+
+type deleteAccountForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.User = user
+	templateData.Form = deleteAccountForm{}
+	app.render(w, http.StatusOK, "account-delete.tmpl", templateData)
+}
+
+// deleteAccountPost deletes the user, who must give their password unless
+// they signed up with a provider and never chose one, and everything of
+// theirs. Their events are removed from every calendar they're
+// in, their provider accounts are unlinked, they're logged out everywhere,
+// and the people whose plans they were part of are told.
+func (app *application) deleteAccountPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form deleteAccountForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Users who signed up with a provider only know the password they've
+	// set themselves, so without one the session has to do.
+	if user.PasswordSet {
+		form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	}
+
+	if user.PasswordSet && form.Valid() {
+		_, err = app.models.Users.Authenticate(user.Email, form.Password)
+		if err != nil {
+			if !errors.Is(err, data.ErrInvalidCredentials) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("password", "Your password is incorrect")
+		}
+	}
+
+	if !form.Valid() {
+		templateData := app.newTemplateData(r)
+		templateData.User = user
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "account-delete.tmpl", templateData)
+		return
+	}
+
+	// Who to tell has to be worked out while the appointments are still
+	// there.
+	counterparts, err := app.models.Users.GetCounterparts(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.removeAccountEvents(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	for _, name := range []string{"google", "microsoft"} {
+		err = app.revokeCalendar(user.ID, name)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	err = app.models.UserSessions.DeleteAllForUser(user.ID, 0)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.models.Users.Delete(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.infoLog.Printf("Deleted user %d\n", user.ID)
+
+	err = app.logOut(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The account is gone whether or not the emails go out.
+	for _, counterpart := range counterparts {
+		err = app.sendAccountDeletedEmail(counterpart, user)
+		if err != nil {
+			app.errorLog.Printf("Error telling user %d that user %d was deleted: %v\n", counterpart.ID, user.ID, err)
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// removeAccountEvents removes the events of the user's appointments from
+// every calendar they were added to. Events in other people's calendars are
+// left to the outbox worker; those in the user's own calendars are removed
+// now, while their tokens are still here. Failing to remove one only leaves
+// it behind, so failures are logged.
+func (app *application) removeAccountEvents(userID int) error {
+	ops, err := app.models.ProviderOperations.RemoveUserEvents(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		err = app.deleteProviderEvent(op)
+		if err != nil {
+			app.errorLog.Printf("Error deleting %s event %s of user %d: %v\n", op.ProviderName, op.ProviderEventID, userID, err)
+		}
+	}
+
+	return nil
+}
+
+// revokeCalendar gives up the access to a linked calendar, where the
+// provider allows it, and unlinks it.
+func (app *application) revokeCalendar(userID int, name string) error {
+	p, err := app.linkedProvider(userID, name)
+	if err != nil || p == nil {
+		return err
+	}
+
+	if revoker, ok := p.(providers.Revoker); ok {
+		token, err := app.models.AuthTokens.Token(userID, name)
+		if err != nil {
+			return err
+		}
+
+		client, err := providers.GetClient(p, userID, &app.models)
+		if err != nil {
+			return err
+		}
+
+		// Failing to revoke still leaves the user able to remove our access
+		// from their account, so it doesn't stop the deletion.
+		err = revoker.Revoke(client, token)
+		if err != nil {
+			app.errorLog.Printf("Error revoking %s token of user %d: %v\n", name, userID, err)
+		}
+	}
+
+	return app.unlinkCalendar(userID, name, p)
+}
+
+// sendAccountDeletedEmail tells a user that someone they had plans with has
+// deleted their account.
+func (app *application) sendAccountDeletedEmail(recipient, deleted *data.User) error {
+	type EmailData struct {
+		Name            string
+		DeletedName     string
+		AppointmentsURL string
+	}
+
+	return app.mailer.Send(recipient.Email, "account-deleted.tmpl", EmailData{
+		Name:            recipient.Name,
+		DeletedName:     deleted.Name,
+		AppointmentsURL: app.baseURL + "/appointments",
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestDownloadAccountData(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.AuthTokens.(*mocks.AuthTokenModel).Linked = []string{"google"}
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	login(t, ts, ts.Client())
+
+	code, header, body := ts.get(t, "/settings/export")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, header.Get("Content-Disposition"), ".json")
+
+	var export accountExport
+	err := json.Unmarshal([]byte(body), &export)
+	assert.NilError(t, err)
+	assert.Equal(t, export.Profile.Email, "alice@example.com")
+	assert.Equal(t, len(export.AppointmentEvents), 1)
+	assert.Equal(t, len(export.LinkedCalendars), 1)
+	assert.Equal(t, export.LinkedCalendars[0].Provider, "google")
+
+	// Tokens are secrets, not data about the user.
+	if strings.Contains(body, "refresh-token") || strings.Contains(body, "access-token") {
+		t.Error("export contains a token")
+	}
+
+	code, header, body = ts.get(t, "/settings/export?format=zip")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/zip")
+
+	archive, err := zip.NewReader(bytes.NewReader([]byte(body)), int64(len(body)))
+	assert.NilError(t, err)
+	assert.Equal(t, len(archive.File), len(export.files()))
+	assert.Equal(t, archive.File[0].Name, "profile.json")
+
+	code, _, _ = ts.get(t, "/settings/export?format=xml")
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	app := newTestApplication(t)
+	mailer := &recordingMailer{}
+	app.mailer = mailer
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := login(t, ts, ts.Client())
+	other := ts.newClient(t)
+	login(t, ts, other)
+
+	users := app.models.Users.(*mocks.UserModel)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+	form.Add("password", "wrong")
+
+	code, _, body := ts.postForm(t, "/settings/delete", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Your password is incorrect")
+	assert.Equal(t, len(users.Deleted), 0)
+
+	form.Set("password", "pa$$word")
+
+	code, header, _ := ts.postForm(t, "/settings/delete", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/")
+
+	assert.Equal(t, len(users.Deleted), 1)
+	assert.Equal(t, users.Deleted[0], 1)
+
+	// The events of Alice's appointments are removed before she is.
+	removed := app.models.ProviderOperations.(*mocks.ProviderOperationModel).Removed
+	assert.Equal(t, len(removed), 1)
+	assert.Equal(t, removed[0], 1)
+
+	// Bob had plans with her, so he's told.
+	assert.Equal(t, len(mailer.sent), 1)
+	assert.Equal(t, mailer.sent[0].recipient, "bob@example.com")
+	assert.Equal(t, mailer.sent[0].templateFile, "account-deleted.tmpl")
+
+	// Both of her sessions are logged out.
+	assert.Equal(t, getWith(t, ts, ts.Client(), "/settings"), http.StatusSeeOther)
+	assert.Equal(t, getWith(t, ts, other, "/settings"), http.StatusSeeOther)
+}
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(2, app.routes())))
+	defer ts.Close()
+
+	// Bob signed up with Google, so he has no password to give.
+	_, _, body := ts.get(t, "/settings/delete")
+	validCSRFToken := extractCSRFToken(t, body)
+	if strings.Contains(body, `name="password"`) {
+		t.Error("asked for a password")
+	}
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, header, _ := ts.postForm(t, "/settings/delete", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/")
+
+	users := app.models.Users.(*mocks.UserModel)
+	assert.Equal(t, len(users.Deleted), 1)
+	assert.Equal(t, users.Deleted[0], 2)
+}
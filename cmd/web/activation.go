@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// activationTokenTTL is how long the link in an activation email works for.
+const activationTokenTTL = 3 * 24 * time.Hour
+
+// sendActivationEmail emails the user a link to confirm their address.
+func (app *application) sendActivationEmail(userID int, name, email string) error {
+	token, err := app.models.Tokens.New(userID, data.TokenScopeActivation, activationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	type EmailData struct {
+		Name          string
+		ActivationURL string
+		Days          int
+	}
+
+	return app.mailer.Send(email, "user-activation.tmpl", EmailData{
+		Name:          name,
+		ActivationURL: app.baseURL + "/user/activate?token=" + url.QueryEscape(token.Plaintext),
+		Days:          int(activationTokenTTL.Hours() / 24),
+	})
+}
+
+type activationForm struct {
+	Token               string `form:"token"`
+	validator.Validator `form:"-"`
+}
+
+// userActivate shows the page the activation email links to. The address
+// is only confirmed once the form on it is sent, so a mail scanner following
+// the link doesn't use up the token.
+func (app *application) userActivate(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+	templateData.Form = activationForm{Token: r.URL.Query().Get("token")}
+	app.render(w, http.StatusOK, "activate.tmpl", templateData)
+}
+
+func (app *application) userActivatePost(w http.ResponseWriter, r *http.Request) {
+	var form activationForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Token), "token", "This link is incomplete")
+
+	var userID int
+	if form.Valid() {
+		userID, err = app.models.Tokens.Use(data.TokenScopeActivation, form.Token)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("token", "This link is invalid or has expired")
+		}
+	}
+
+	if !form.Valid() {
+		templateData := app.newTemplateData(r)
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "activate.tmpl", templateData)
+		return
+	}
+
+	err = app.models.Users.Activate(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Now that the address is known to be theirs, the user joins the
+	// organisation at its domain, then the groups it was invited to before
+	// they signed up.
+	app.joinOrganisationByDomain(userID)
+	if app.joinInvitedGroups(userID) > 0 {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is confirmed, and you've joined the groups you were invited to.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is confirmed.")
+	}
+
+	if !app.isAuthenticated(r) {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// resendActivation emails the user a new activation link, in place of any
+// they were sent before.
+func (app *application) resendActivation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if user.Activated {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already confirmed.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.TokenScopeActivation, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sendActivationEmail(user.ID, user.Name, user.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "We've sent you a new link to confirm your email address.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
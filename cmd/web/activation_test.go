@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+// recordingMailer keeps the emails it's asked to send.
+type recordingMailer struct {
+	sent []sentEmail
+}
+
+type sentEmail struct {
+	recipient    string
+	templateFile string
+	data         any
+}
+
+func (m *recordingMailer) Send(recipient, templateFile string, data any) error {
+	m.sent = append(m.sent, sentEmail{recipient, templateFile, data})
+	return nil
+}
+
+// loginAs logs every request in as the user, like mockAuthentication.
+func (app *application) loginAs(userID int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestUserSignupSendsActivationEmail(t *testing.T) {
+	app := newTestApplication(t)
+	mailer := &recordingMailer{}
+	app.mailer = mailer
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/signup")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("name", "Dave")
+	form.Add("email", "dave@example.com")
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", validCSRFToken)
+
+	code, header, _ := ts.postForm(t, "/user/signup", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	tokens := app.models.Tokens.(*mocks.TokenModel)
+	assert.Equal(t, len(tokens.Created), 1)
+	assert.Equal(t, tokens.Created[0].UserID, 4)
+	assert.Equal(t, tokens.Created[0].Scope, data.TokenScopeActivation)
+
+	assert.Equal(t, len(mailer.sent), 1)
+	assert.Equal(t, mailer.sent[0].recipient, "dave@example.com")
+	assert.Equal(t, mailer.sent[0].templateFile, "user-activation.tmpl")
+}
+
+func TestUserActivate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/user/activate?token="+mocks.MockActivationToken)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `value="`+mocks.MockActivationToken+`"`)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		token        string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Valid token",
+			token:        mocks.MockActivationToken,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:     "Unknown token",
+			token:    "expired-token",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This link is invalid or has expired",
+		},
+		{
+			name:     "No token",
+			token:    "",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This link is incomplete",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("token", tt.token)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, body := ts.postForm(t, "/user/activate", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	// Once her address is confirmed, Carol joins the organisation at its
+	// domain and the groups it was invited to.
+	joined := app.models.Organisations.(*mocks.OrganisationModel).Joined
+	assert.Equal(t, len(joined), 1)
+	assert.Equal(t, joined[0], 3)
+
+	accepted := app.models.GroupInvitations.(*mocks.GroupInvitationModel).AcceptedEmails
+	assert.Equal(t, len(accepted), 1)
+	assert.Equal(t, accepted[0], "carol@example.com")
+}
+
+func TestResendActivation(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     int
+		wantEmails int
+	}{
+		{"Unconfirmed user", 3, 1},
+		{"Confirmed user", 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			mailer := &recordingMailer{}
+			app.mailer = mailer
+			ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(tt.userID, app.routes())))
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/settings")
+			validCSRFToken := extractCSRFToken(t, body)
+
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, _ := ts.postForm(t, "/user/activate/resend", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/settings")
+
+			assert.Equal(t, len(mailer.sent), tt.wantEmails)
+			if tt.wantEmails > 0 {
+				assert.Equal(t, mailer.sent[0].recipient, "carol@example.com")
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// adminListLimit is how many entries the admin pages show of the sync
+// errors, mail failures and audit log.
+const adminListLimit = 100
+
+// adminConsole lists the users of the instance, with whether they've
+// confirmed their email address, been disabled or linked a calendar.
+func (app *application) adminConsole(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	var v validator.Validator
+	filters := data.Filters{
+		Page:     readInt(qs, "page", 1, &v),
+		PageSize: 50,
+	}
+	data.ValidateFilters(&v, filters)
+	if !v.Valid() {
+		app.clientError(w, http.StatusBadRequest, "Invalid page")
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAllForAdmin(qs.Get("query"), filters)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.Users = users
+	templateData.Metadata = metadata
+	templateData.Query = qs.Get("query")
+	app.render(w, http.StatusOK, "admin.tmpl", templateData)
+}
+
+// adminViewUser shows a user's account to an admin: the calendars they've
+// linked, and what admins have done to it.
+func (app *application) adminViewUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid user ID in URL")
+		return
+	}
+
+	user, err := app.service.GetUser(int(userID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.User = user
+
+	templateData.AuthTokens, err = app.models.AuthTokens.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData.AuditEntries, err = app.models.AuditLog.GetForUser(user.ID, adminListLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, http.StatusOK, "admin-user.tmpl", templateData)
+}
+
+func (app *application) adminDisableUser(w http.ResponseWriter, r *http.Request) {
+	app.adminSetUserDisabled(w, r, true)
+}
+
+func (app *application) adminEnableUser(w http.ResponseWriter, r *http.Request) {
+	app.adminSetUserDisabled(w, r, false)
+}
+
+// adminSetUserDisabled disables or enables a user's account. Disabled users
+// are logged out everywhere and their API tokens stop working.
+func (app *application) adminSetUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid user ID in URL")
+		return
+	}
+
+	err = app.service.SetUserDisabled(adminID, int(userID), disabled)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	if disabled {
+		app.sessionManager.Put(r.Context(), "flash", "Account disabled.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Account enabled.")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", userID), http.StatusSeeOther)
+}
+
+// adminImpersonateUser lets an admin act as another user, to see what they
+// see. The session stays the admin's own, so ending it from their sessions
+// page or disabling them ends the impersonation too.
+func (app *application) adminImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid user ID in URL")
+		return
+	}
+
+	user, err := app.service.StartImpersonation(adminID, int(userID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "impersonatorID", adminID)
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", user.ID)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You're now acting as %s.", user.Name))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// stopImpersonating takes an admin back to their own account.
+func (app *application) stopImpersonating(w http.ResponseWriter, r *http.Request) {
+	adminID := app.sessionManager.GetInt(r.Context(), "impersonatorID")
+	if adminID == 0 {
+		app.clientError(w, http.StatusBadRequest, "You aren't impersonating anyone")
+		return
+	}
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err := app.service.RecordAdminAction(adminID, userID, data.AuditStopImpersonating, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", adminID)
+	app.sessionManager.Remove(r.Context(), "impersonatorID")
+
+	app.sessionManager.Put(r.Context(), "flash", "You're back in your own account.")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", userID), http.StatusSeeOther)
+}
+
+type relinkForm struct {
+	Provider string `form:"provider"`
+}
+
+// adminRelinkUser forgets a user's calendar and its tokens, e.g. when they're
+// stuck, so the user has to link it again. They're sent an email saying so.
+func (app *application) adminRelinkUser(w http.ResponseWriter, r *http.Request) {
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid user ID in URL")
+		return
+	}
+
+	var form relinkForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	title, ok := map[string]string{"google": "Google", "microsoft": "Microsoft"}[form.Provider]
+	if !ok {
+		app.clientError(w, http.StatusUnprocessableEntity, "Unknown provider")
+		return
+	}
+
+	user, err := app.service.GetUser(int(userID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	p, err := app.linkedProvider(user.ID, form.Provider)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if p == nil {
+		app.clientError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s hasn't linked a %s account", user.Name, title))
+		return
+	}
+
+	err = app.unlinkCalendar(user.ID, form.Provider, p)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.service.RecordAdminAction(adminID, user.ID, data.AuditRelink, form.Provider)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The calendar is already unlinked, and the user sees that in their
+	// settings, so a failure here is only logged.
+	err = app.sendRelinkEmail(user, title)
+	if err != nil {
+		app.errorLog.Printf("Error telling user %d to link their %s account again: %v\n", user.ID, form.Provider, err)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s will have to link their %s account again.", user.Name, title))
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+func (app *application) sendRelinkEmail(user *data.User, title string) error {
+	type EmailData struct {
+		Name        string
+		Provider    string
+		SettingsURL string
+	}
+
+	return app.mailer.Send(user.Email, "calendar-relink.tmpl", EmailData{
+		Name:        user.Name,
+		Provider:    title,
+		SettingsURL: app.baseURL + "/settings",
+	})
+}
+
+// adminSyncErrors shows the calendars that failed to sync, and the events
+// that couldn't be created in or removed from them.
+func (app *application) adminSyncErrors(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+
+	var err error
+	templateData.CalendarSyncs, err = app.models.CalendarSyncs.GetFailing(adminListLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData.ProviderOperations, err = app.models.ProviderOperations.GetFailed(adminListLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, http.StatusOK, "admin-sync-errors.tmpl", templateData)
+}
+
+func (app *application) adminMailFailures(w http.ResponseWriter, r *http.Request) {
+	failures, err := app.models.MailFailures.GetRecent(adminListLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.MailFailures = failures
+	app.render(w, http.StatusOK, "admin-mail-failures.tmpl", templateData)
+}
+
+func (app *application) adminAuditLog(w http.ResponseWriter, r *http.Request) {
+	entries, err := app.models.AuditLog.GetRecent(adminListLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.AuditEntries = entries
+	app.render(w, http.StatusOK, "admin-audit.tmpl", templateData)
+}
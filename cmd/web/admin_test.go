@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestAdminPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   int
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Users", 1, "/admin", http.StatusOK, "Not confirmed"},
+		{"Linked calendars", 1, "/admin?query=bob", http.StatusOK, "google"},
+		{"Second page", 1, "/admin?page=2", http.StatusOK, "No users found."},
+		{"Invalid page", 1, "/admin?page=0", http.StatusBadRequest, ""},
+		{"User", 1, "/admin/users/2", http.StatusOK, "/admin/users/2/impersonate"},
+		{"Missing user", 1, "/admin/users/99", http.StatusNotFound, ""},
+		{"Sync errors", 1, "/admin/sync-errors", http.StatusOK, "graph: 403 Forbidden"},
+		{"Mail failures", 1, "/admin/mail-failures", http.StatusOK, "550 mailbox unavailable"},
+		{"Audit log", 1, "/admin/audit", http.StatusOK, "Nothing yet."},
+		{"Not an admin", 2, "/admin", http.StatusForbidden, ""},
+		{"Not an admin's sync errors", 2, "/admin/sync-errors", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(tt.userID, app.routes())))
+			defer ts.Close()
+
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	app := newTestApplication(t)
+	users := app.models.Users.(*mocks.UserModel)
+	audit := app.models.AuditLog.(*mocks.AuditLogModel)
+
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/admin/users/2")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantDisabled bool
+		wantEntries  int
+	}{
+		{"Disable", "/admin/users/2/disable", http.StatusSeeOther, true, 1},
+		{"Enable", "/admin/users/2/enable", http.StatusSeeOther, false, 2},
+		{"Own account", "/admin/users/1/disable", http.StatusUnprocessableEntity, false, 2},
+		{"Missing user", "/admin/users/99/disable", http.StatusNotFound, false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, users.Disabled[2], tt.wantDisabled)
+			assert.Equal(t, len(audit.Entries), tt.wantEntries)
+		})
+	}
+
+	assert.Equal(t, audit.Entries[0].Action, data.AuditDisable)
+	assert.Equal(t, audit.Entries[1].Action, data.AuditEnable)
+	assert.Equal(t, users.Disabled[1], false)
+}
+
+func TestAdminImpersonation(t *testing.T) {
+	app := newTestApplication(t)
+	audit := app.models.AuditLog.(*mocks.AuditLogModel)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := login(t, ts, ts.Client())
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ := ts.postForm(t, "/admin/users/1/impersonate", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	code, header, _ := ts.postForm(t, "/admin/users/2/impersonate", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/")
+
+	// Alice now sees Bob's account, and can't use the admin pages.
+	code, _, body := ts.get(t, "/settings")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "acting as Bob")
+	assert.StringContains(t, body, "Stop impersonating")
+
+	code, _, _ = ts.get(t, "/admin")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// Nor can she use Bob's credentials and security settings, and what she
+	// tries to change is recorded.
+	form.Set("csrf_token", extractCSRFToken(t, body))
+	code, _, _ = ts.postForm(t, "/settings/tokens", form)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, _, _ = ts.get(t, "/user/2fa")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, _, _ = ts.get(t, "/webhooks")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// Nor download everything of his.
+	code, _, _ = ts.get(t, "/settings/export")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, header, _ = ts.postForm(t, "/admin/impersonation/stop", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/admin/users/2")
+
+	code, _, body = ts.get(t, "/admin/users/2")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "stop_impersonating")
+
+	assert.Equal(t, len(audit.Entries), 3)
+	assert.Equal(t, audit.Entries[0].Action, data.AuditImpersonate)
+	assert.Equal(t, audit.Entries[0].AdminID, 1)
+	assert.Equal(t, audit.Entries[0].UserID, 2)
+	assert.Equal(t, audit.Entries[1].Action, data.AuditImpersonatedRequest)
+	assert.Equal(t, audit.Entries[1].Details, "POST /settings/tokens")
+	assert.Equal(t, audit.Entries[1].AdminID, 1)
+	assert.Equal(t, audit.Entries[1].UserID, 2)
+	assert.Equal(t, audit.Entries[2].Action, data.AuditStopImpersonating)
+
+	// Not impersonating anyone any more.
+	form.Set("csrf_token", extractCSRFToken(t, body))
+	code, _, _ = ts.postForm(t, "/admin/impersonation/stop", form)
+	assert.Equal(t, code, http.StatusBadRequest)
+}
+
+func TestAdminRelinkUser(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.AuthTokens = &mocks.AuthTokenModel{Linked: []string{"google"}}
+	syncs := app.models.CalendarSyncs.(*mocks.CalendarSyncModel)
+	audit := app.models.AuditLog.(*mocks.AuditLogModel)
+	mailer := &recordingMailer{}
+	app.mailer = mailer
+
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/admin/users/1")
+	validCSRFToken := extractCSRFToken(t, body)
+	assert.StringContains(t, body, "Force re-link")
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		provider    string
+		wantCode    int
+		wantDeleted int
+	}{
+		{"Linked account", "/admin/users/1/relink", "google", http.StatusSeeOther, 1},
+		{"Account not linked", "/admin/users/1/relink", "microsoft", http.StatusUnprocessableEntity, 1},
+		{"Unknown provider", "/admin/users/1/relink", "apple", http.StatusUnprocessableEntity, 1},
+		{"Missing user", "/admin/users/99/relink", "google", http.StatusNotFound, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+			form.Add("provider", tt.provider)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, len(syncs.Deleted), tt.wantDeleted)
+		})
+	}
+
+	assert.Equal(t, len(audit.Entries), 1)
+	assert.Equal(t, audit.Entries[0].Action, data.AuditRelink)
+	assert.Equal(t, audit.Entries[0].Details, "google")
+
+	assert.Equal(t, len(mailer.sent), 1)
+	assert.Equal(t, mailer.sent[0].recipient, "alice@example.com")
+	assert.Equal(t, mailer.sent[0].templateFile, "calendar-relink.tmpl")
+}
+
+func TestDisabledUserLogin(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", "dave@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, body := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.StringContains(t, body, "This account has been disabled.")
+}
+
+// failingMailer fails to send every email.
+type failingMailer struct {
+	err error
+}
+
+func (m *failingMailer) Send(recipient, templateFile string, data any) error {
+	return m.err
+}
+
+func TestFailureLoggingMailer(t *testing.T) {
+	failures := &mocks.MailFailureModel{}
+	m := &failureLoggingMailer{
+		mailer:   &failingMailer{errors.New("550 mailbox unavailable")},
+		failures: failures,
+		errorLog: log.New(io.Discard, "", 0),
+	}
+
+	err := m.Send("bob@example.com", "group-invitation.tmpl", nil)
+	assert.Equal(t, err.Error(), "550 mailbox unavailable")
+	assert.Equal(t, len(failures.Inserted), 1)
+	assert.Equal(t, failures.Inserted[0], "bob@example.com")
+
+	m.mailer = mocks.NewMockMailer()
+	err = m.Send("bob@example.com", "group-invitation.tmpl", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(failures.Inserted), 1)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/service"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// apiListAppointmentRequests lists the requests sent to the user, or with
+// ?direction=outgoing the ones they have sent.
+func (app *application) apiListAppointmentRequests(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+	qs := r.URL.Query()
+
+	var v validator.Validator
+	filters := readFilters(qs, &v)
+	direction := qs.Get("direction")
+	if direction == "" {
+		direction = "incoming"
+	}
+	v.CheckField(validator.PermittedValue(direction, "incoming", "outgoing"), "direction", "must be incoming or outgoing")
+	if !v.Valid() {
+		app.apiFailedValidation(w, v.FieldErrors)
+		return
+	}
+
+	var (
+		requests []*data.AppointmentRequest
+		metadata data.Metadata
+		err      error
+	)
+	if direction == "outgoing" {
+		requests, metadata, err = app.models.AppointmentRequests.GetAllOutgoingForUser(userID, filters)
+	} else {
+		requests, metadata, err = app.models.AppointmentRequests.GetAllForUser(userID, filters)
+	}
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	out := make([]apiAppointmentRequest, 0, len(requests))
+	for _, request := range requests {
+		out = append(out, newAPIAppointmentRequest(request))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointment_requests": out, "metadata": metadata}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiCreateAppointmentRequest(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var input apiAppointmentRequestInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, err)
+		return
+	}
+
+	request, err := app.service.CreateAppointmentRequest(userID, service.NewAppointmentRequest{
+		TargetUserID:    input.TargetUserID,
+		GroupID:         input.GroupID,
+		Title:           input.Title,
+		Description:     input.Description,
+		Location:        input.Location,
+		StartTime:       input.StartTime,
+		EndTime:         input.EndTime,
+		QuorumRule:      input.QuorumRule,
+		QuorumCount:     input.QuorumCount,
+		OptionalUserIDs: input.OptionalUserIDs,
+		ResourceIDs:     input.ResourceIDs,
+	})
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	app.requestChanged(data.EventRequestCreated, request.RequestID)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/appointment-requests/%d", request.RequestID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"appointment_request": newAPIAppointmentRequest(request)}, headers)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiShowAppointmentRequest(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	request, err := app.service.GetAppointmentRequest(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointment_request": newAPIAppointmentRequest(request)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+// apiRespondToAppointmentRequest records the user's response and reports
+// what became of the request.
+func (app *application) apiRespondToAppointmentRequest(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	var input apiResponseInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, err)
+		return
+	}
+
+	if !validator.PermittedValue(input.Response, data.ParticipantAccepted, data.ParticipantDeclined, data.ParticipantTentative) {
+		app.apiFailedValidation(w, map[string]string{
+			"response": fmt.Sprintf("must be one of %s, %s or %s", data.ParticipantAccepted, data.ParticipantDeclined, data.ParticipantTentative),
+		})
+		return
+	}
+
+	outcome, err := app.service.RespondToAppointmentRequest(userID, int(id), input.Response, strings.TrimSpace(input.Reason))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	app.requestChanged(outcomeEvent(outcome), int(id))
+
+	request, err := app.service.GetAppointmentRequest(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"outcome": outcome, "appointment_request": newAPIAppointmentRequest(request)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiCancelAppointmentRequest(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	err = app.service.CancelAppointmentRequest(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	app.requestChanged(data.EventRequestCancelled, int(id))
+
+	request, err := app.service.GetAppointmentRequest(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointment_request": newAPIAppointmentRequest(request)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
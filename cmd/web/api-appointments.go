@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+func (app *application) apiListAppointments(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+	if !v.Valid() {
+		app.apiFailedValidation(w, v.FieldErrors)
+		return
+	}
+
+	appointments, metadata, err := app.models.Appointments.GetAllForUser(userID, filters)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	out := make([]apiAppointment, 0, len(appointments))
+	for _, appointment := range appointments {
+		out = append(out, newAPIAppointment(appointment))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointments": out, "metadata": metadata}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiShowAppointment(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	appointment, err := app.service.GetAppointment(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointment": newAPIAppointment(appointment)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiDeleteAppointment(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	appointment, err := app.service.DeleteAppointment(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	app.appointmentChanged(data.EventAppointmentDeleted, appointment)
+
+	w.WriteHeader(http.StatusNoContent)
+}
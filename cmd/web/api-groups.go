@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+func (app *application) apiListGroups(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var v validator.Validator
+	filters := readFilters(r.URL.Query(), &v)
+	if !v.Valid() {
+		app.apiFailedValidation(w, v.FieldErrors)
+		return
+	}
+
+	groups, err := app.models.Groups.GetAllForUser(userID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	groups, metadata := data.Page(groups, filters)
+
+	out := make([]apiGroup, 0, len(groups))
+	for _, group := range groups {
+		out = append(out, newAPIGroup(group))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"groups": out, "metadata": metadata}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiCreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	var input apiGroupInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, err)
+		return
+	}
+
+	groupID, err := app.service.CreateGroup(userID, input.Name, input.Description)
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	group, err := app.service.GetGroup(userID, groupID)
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/groups/%d", groupID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"group": newAPIGroup(group)}, headers)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiShowGroup(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	group, err := app.service.GetGroup(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": newAPIGroup(group)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+// apiListGroupAppointments lists the upcoming appointments in a group's
+// shared calendar.
+func (app *application) apiListGroupAppointments(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	appointments, err := app.service.GetUpcomingGroupAppointments(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	out := make([]apiAppointment, 0, len(appointments))
+	for _, a := range appointments {
+		out = append(out, newAPIAppointment(a))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"appointments": out}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiInviteToGroup(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	var input apiGroupInvitationInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiBadRequest(w, err)
+		return
+	}
+
+	inv, err := app.service.InviteToGroup(userID, int(id), input.Email)
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.sendGroupInvitationEmail(inv)
+	if err != nil {
+		app.errorLog.Printf("Error sending invitation %d to group %d: %v\n", inv.ID, inv.GroupID, err)
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invitation": newAPIGroupInvitation(inv)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	invitations, err := app.service.GetMyGroupInvitations(userID)
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	res := []apiGroupInvitation{}
+	for _, inv := range invitations {
+		res = append(res, newAPIGroupInvitation(inv))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invitations": res}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	inv, err := app.service.AcceptGroupInvitation(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	group, err := app.service.GetGroup(userID, inv.GroupID)
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": newAPIGroup(group)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	err = app.service.DeclineGroupInvitation(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
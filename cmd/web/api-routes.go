@@ -0,0 +1,223 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/service"
+)
+
+// apiRoute is one endpoint of the JSON API. The same list is used to
+// register the routes and to write the OpenAPI document, so the two can't
+// drift apart.
+type apiRoute struct {
+	Method  string
+	Path    string // in httprouter syntax, e.g. /api/v1/users/:id
+	Handler http.HandlerFunc
+	Summary string
+	Params  []apiParam
+	// Request is the zero value of the request body, or nil if there isn't
+	// one.
+	Request any
+	// Status is the status code of a successful response, and Response its
+	// body, or nil if it doesn't have one.
+	Status   int
+	Response envelope
+}
+
+// apiParam is a query string parameter.
+type apiParam struct {
+	Name        string
+	Type        string // integer, string or date-time
+	Description string
+	Enum        []string
+}
+
+var (
+	pageParams = []apiParam{
+		{Name: "page", Type: "integer", Description: "Page number, starting from 1."},
+		{Name: "page_size", Type: "integer", Description: "Records per page, up to 100. Defaults to 20."},
+	}
+	rangeParams = []apiParam{
+		{Name: "from", Type: "date-time", Description: "Only include records ending after this time, given in RFC 3339 format or as a date."},
+		{Name: "to", Type: "date-time", Description: "Only include records starting before this time, given in RFC 3339 format or as a date."},
+	}
+)
+
+func params(lists ...[]apiParam) []apiParam {
+	var out []apiParam
+	for _, list := range lists {
+		out = append(out, list...)
+	}
+	return out
+}
+
+func (app *application) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/users",
+			Handler:  app.apiListUsers,
+			Summary:  "Search for users by name or email",
+			Params:   params([]apiParam{{Name: "q", Type: "string", Description: "Text to search for."}}, pageParams),
+			Status:   http.StatusOK,
+			Response: envelope{"users": []apiUser{}, "metadata": data.Metadata{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/users/:id",
+			Handler:  app.apiShowUser,
+			Summary:  "Get a user",
+			Status:   http.StatusOK,
+			Response: envelope{"user": apiUser{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/users/:id/availability",
+			Handler:  app.apiUserAvailability,
+			Summary:  "Get the times a user is busy, by default over the next two weeks",
+			Params:   rangeParams,
+			Status:   http.StatusOK,
+			Response: envelope{"from": time.Time{}, "to": time.Time{}, "busy": []apiBusyPeriod{}},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/v1/appointment-requests",
+			Handler: app.apiListAppointmentRequests,
+			Summary: "List the appointment requests sent to or by you",
+			Params: params([]apiParam{{
+				Name:        "direction",
+				Type:        "string",
+				Description: "Whether to list the requests sent to you (the default) or by you.",
+				Enum:        []string{"incoming", "outgoing"},
+			}}, pageParams, rangeParams),
+			Status:   http.StatusOK,
+			Response: envelope{"appointment_requests": []apiAppointmentRequest{}, "metadata": data.Metadata{}},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/appointment-requests",
+			Handler:  app.apiCreateAppointmentRequest,
+			Summary:  "Send an appointment request to a user or a group",
+			Request:  apiAppointmentRequestInput{},
+			Status:   http.StatusCreated,
+			Response: envelope{"appointment_request": apiAppointmentRequest{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/appointment-requests/:id",
+			Handler:  app.apiShowAppointmentRequest,
+			Summary:  "Get an appointment request",
+			Status:   http.StatusOK,
+			Response: envelope{"appointment_request": apiAppointmentRequest{}},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/appointment-requests/:id/respond",
+			Handler:  app.apiRespondToAppointmentRequest,
+			Summary:  "Accept, decline or tentatively accept an appointment request",
+			Request:  apiResponseInput{},
+			Status:   http.StatusOK,
+			Response: envelope{"outcome": service.OutcomeRecorded, "appointment_request": apiAppointmentRequest{}},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/appointment-requests/:id/cancel",
+			Handler:  app.apiCancelAppointmentRequest,
+			Summary:  "Cancel an appointment request you have sent",
+			Status:   http.StatusOK,
+			Response: envelope{"appointment_request": apiAppointmentRequest{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/appointments",
+			Handler:  app.apiListAppointments,
+			Summary:  "List your appointments",
+			Params:   params(pageParams, rangeParams),
+			Status:   http.StatusOK,
+			Response: envelope{"appointments": []apiAppointment{}, "metadata": data.Metadata{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/appointments/:id",
+			Handler:  app.apiShowAppointment,
+			Summary:  "Get an appointment",
+			Status:   http.StatusOK,
+			Response: envelope{"appointment": apiAppointment{}},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/api/v1/appointments/:id",
+			Handler: app.apiDeleteAppointment,
+			Summary: "Delete an appointment and remove it from everyone's calendars",
+			Status:  http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/groups",
+			Handler:  app.apiListGroups,
+			Summary:  "List the groups you are a member of",
+			Params:   pageParams,
+			Status:   http.StatusOK,
+			Response: envelope{"groups": []apiGroup{}, "metadata": data.Metadata{}},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/groups",
+			Handler:  app.apiCreateGroup,
+			Summary:  "Create a group",
+			Request:  apiGroupInput{},
+			Status:   http.StatusCreated,
+			Response: envelope{"group": apiGroup{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/groups/:id",
+			Handler:  app.apiShowGroup,
+			Summary:  "Get a group and its members",
+			Status:   http.StatusOK,
+			Response: envelope{"group": apiGroup{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/groups/:id/appointments",
+			Handler:  app.apiListGroupAppointments,
+			Summary:  "List the upcoming appointments in a group's shared calendar",
+			Status:   http.StatusOK,
+			Response: envelope{"appointments": []apiAppointment{}},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/groups/:id/invitations",
+			Handler:  app.apiInviteToGroup,
+			Summary:  "Invite an email address to a group, which emails it links to accept or decline",
+			Request:  apiGroupInvitationInput{},
+			Status:   http.StatusCreated,
+			Response: envelope{"invitation": apiGroupInvitation{}},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/invitations",
+			Handler:  app.apiListInvitations,
+			Summary:  "List the invitations to groups you haven't answered yet",
+			Status:   http.StatusOK,
+			Response: envelope{"invitations": []apiGroupInvitation{}},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/invitations/:id/accept",
+			Handler:  app.apiAcceptInvitation,
+			Summary:  "Accept an invitation and join its group",
+			Status:   http.StatusOK,
+			Response: envelope{"group": apiGroup{}},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/v1/invitations/:id/decline",
+			Handler: app.apiDeclineInvitation,
+			Summary: "Decline an invitation",
+			Status:  http.StatusNoContent,
+		},
+	}
+}
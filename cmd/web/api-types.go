@@ -0,0 +1,226 @@
+package main
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// The types below are what the JSON API sends and accepts. They are kept
+// apart from the data types so that changing the database can't change the
+// API by accident.
+
+type apiUser struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func newAPIUser(u *data.User) apiUser {
+	return apiUser{ID: u.ID, Name: u.Name, Email: u.Email}
+}
+
+type apiBusyPeriod struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+type apiResource struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`
+	Capacity   int      `json:"capacity"`
+	Location   string   `json:"location"`
+	Attributes []string `json:"attributes"`
+}
+
+func newAPIResources(resources []*data.Resource) []apiResource {
+	out := make([]apiResource, 0, len(resources))
+	for _, r := range resources {
+		out = append(out, apiResource{
+			ID:         r.ID,
+			Name:       r.Name,
+			Kind:       r.Kind,
+			Capacity:   r.Capacity,
+			Location:   r.Location,
+			Attributes: r.Attributes,
+		})
+	}
+	return out
+}
+
+type apiParticipant struct {
+	UserID      int        `json:"user_id"`
+	Name        string     `json:"name"`
+	Required    bool       `json:"required"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason,omitempty"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+type apiAppointmentRequest struct {
+	ID            int              `json:"id"`
+	RequesterID   int              `json:"requester_id"`
+	TargetUserID  int              `json:"target_user_id"`
+	GroupID       int              `json:"group_id,omitempty"`
+	Title         string           `json:"title"`
+	Description   string           `json:"description"`
+	Location      string           `json:"location"`
+	StartTime     time.Time        `json:"start_time"`
+	EndTime       time.Time        `json:"end_time"`
+	Status        string           `json:"status"`
+	DeclineReason string           `json:"decline_reason,omitempty"`
+	QuorumRule    string           `json:"quorum_rule"`
+	QuorumCount   int              `json:"quorum_count,omitempty"`
+	AppointmentID int              `json:"appointment_id,omitempty"`
+	Participants  []apiParticipant `json:"participants"`
+	Resources     []apiResource    `json:"resources"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+func newAPIAppointmentRequest(r *data.AppointmentRequest) apiAppointmentRequest {
+	participants := make([]apiParticipant, 0, len(r.Participants))
+	for _, p := range r.Participants {
+		participant := apiParticipant{
+			UserID:   p.UserID,
+			Name:     p.Name,
+			Required: p.Required,
+			Status:   p.Status,
+			Reason:   p.Reason,
+		}
+		if !p.RespondedAt.IsZero() {
+			participant.RespondedAt = &p.RespondedAt
+		}
+		participants = append(participants, participant)
+	}
+
+	return apiAppointmentRequest{
+		ID:            r.RequestID,
+		RequesterID:   r.RequesterID,
+		TargetUserID:  r.TargetUserID,
+		GroupID:       r.GroupID,
+		Title:         r.Title,
+		Description:   r.Description,
+		Location:      r.Location,
+		StartTime:     r.StartTime,
+		EndTime:       r.EndTime,
+		Status:        r.Status,
+		DeclineReason: r.DeclineReason,
+		QuorumRule:    r.QuorumRule,
+		QuorumCount:   r.QuorumCount,
+		AppointmentID: r.AppointmentID,
+		Participants:  participants,
+		Resources:     newAPIResources(r.Resources),
+		CreatedAt:     r.CreatedAt,
+	}
+}
+
+type apiAppointment struct {
+	ID          int           `json:"id"`
+	CreatorID   int           `json:"creator_id"`
+	TargetID    int           `json:"target_id"`
+	GroupID     int           `json:"group_id,omitempty"`
+	Type        string        `json:"type"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Location    string        `json:"location"`
+	StartTime   time.Time     `json:"start_time"`
+	EndTime     time.Time     `json:"end_time"`
+	Status      string        `json:"status"`
+	Resources   []apiResource `json:"resources"`
+}
+
+func newAPIAppointment(a *data.Appointment) apiAppointment {
+	return apiAppointment{
+		ID:          a.ID,
+		CreatorID:   a.CreatorID,
+		TargetID:    a.TargetID,
+		GroupID:     a.GroupID,
+		Type:        a.AppointmentType,
+		Title:       a.Title,
+		Description: a.Description,
+		Location:    a.Location,
+		StartTime:   a.StartTime,
+		EndTime:     a.EndTime,
+		Status:      a.Status,
+		Resources:   newAPIResources(a.Resources),
+	}
+}
+
+type apiGroup struct {
+	ID              int              `json:"id"`
+	Name            string           `json:"name"`
+	Description     string           `json:"description"`
+	CalendarEnabled bool             `json:"calendar_enabled"`
+	Members         []apiGroupMember `json:"members,omitempty"`
+}
+
+type apiGroupMember struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role" enum:"owner,admin,member"`
+}
+
+func newAPIGroup(g *data.Group) apiGroup {
+	group := apiGroup{ID: g.ID, Name: g.Name, Description: g.Description, CalendarEnabled: g.CalendarEnabled}
+	for _, m := range g.Members {
+		group.Members = append(group.Members, apiGroupMember{ID: m.ID, Name: m.Name, Email: m.Email, Role: m.Role})
+	}
+	return group
+}
+
+type apiGroupInvitation struct {
+	ID          int       `json:"id"`
+	GroupID     int       `json:"group_id"`
+	GroupName   string    `json:"group_name"`
+	Email       string    `json:"email"`
+	InviterID   int       `json:"inviter_id"`
+	InviterName string    `json:"inviter_name"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func newAPIGroupInvitation(inv *data.GroupInvitation) apiGroupInvitation {
+	return apiGroupInvitation{
+		ID:          inv.ID,
+		GroupID:     inv.GroupID,
+		GroupName:   inv.GroupName,
+		Email:       inv.Email,
+		InviterID:   inv.InviterID,
+		InviterName: inv.InviterName,
+		CreatedAt:   inv.CreatedAt,
+		ExpiresAt:   inv.ExpiresAt,
+	}
+}
+
+// Request bodies. Fields without omitempty are required, which is what the
+// OpenAPI document says too; the enum tag lists the values a field accepts.
+
+type apiAppointmentRequestInput struct {
+	TargetUserID    int       `json:"target_user_id"`
+	GroupID         int       `json:"group_id,omitempty"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	Location        string    `json:"location,omitempty"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	QuorumRule      string    `json:"quorum_rule,omitempty" enum:"all,majority,count"`
+	QuorumCount     int       `json:"quorum_count,omitempty"`
+	OptionalUserIDs []int     `json:"optional_user_ids,omitempty"`
+	ResourceIDs     []int     `json:"resource_ids,omitempty"`
+}
+
+type apiResponseInput struct {
+	Response string `json:"response" enum:"accepted,declined,tentative"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type apiGroupInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type apiGroupInvitationInput struct {
+	Email string `json:"email"`
+}
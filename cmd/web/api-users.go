@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+func (app *application) apiListUsers(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+	qs := r.URL.Query()
+
+	var v validator.Validator
+	filters := readFilters(qs, &v)
+	if !v.Valid() {
+		app.apiFailedValidation(w, v.FieldErrors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(userID, qs.Get("q"), filters)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	out := make([]apiUser, 0, len(users))
+	for _, user := range users {
+		out = append(out, newAPIUser(user))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": out, "metadata": metadata}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+func (app *application) apiShowUser(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	user, err := app.service.GetVisibleUser(userID, int(id))
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": newAPIUser(user)}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+// apiUserAvailability returns when the user is busy, without saying what
+// they're busy with. It defaults to the next two weeks.
+func (app *application) apiUserAvailability(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.apiNotFound(w)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	var v validator.Validator
+	from := readTime(qs, "from", &v)
+	to := readTime(qs, "to", &v)
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 14)
+	}
+	v.CheckField(from.Before(to), "to", "must be after from")
+	v.CheckField(to.Sub(from) <= 90*24*time.Hour, "to", "must be no more than 90 days after from")
+	if !v.Valid() {
+		app.apiFailedValidation(w, v.FieldErrors)
+		return
+	}
+
+	events, err := app.service.Busy(userID, int(id), from, to)
+	if err != nil {
+		app.apiServiceError(w, err)
+		return
+	}
+
+	busy := make([]apiBusyPeriod, 0, len(events))
+	for _, event := range events {
+		busy = append(busy, apiBusyPeriod{StartTime: event.StartTime, EndTime: event.EndTime})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"from": from, "to": to, "busy": busy}, nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/service"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// envelope wraps every JSON response in an object, e.g. {"user": {...}}.
+type envelope map[string]any
+
+// apiError is the body of every JSON error response, under the "error" key.
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// readJSON decodes a single JSON object from the request body into dst,
+// returning errors with messages that are safe to send back to the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		case strings.Contains(err.Error(), "parsing time"):
+			return errors.New("times must be in RFC 3339 format, e.g. 2024-05-11T19:00:00Z")
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+func (app *application) apiErrorResponse(w http.ResponseWriter, status int, code, message string, fields map[string]string) {
+	err := app.writeJSON(w, status, envelope{"error": apiError{Code: code, Message: message, Fields: fields}}, nil)
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// apiServerError is the JSON version of serverError.
+func (app *application) apiServerError(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.errorLog.Output(2, trace)
+
+	app.apiErrorResponse(w, http.StatusInternalServerError, "server_error", "the server encountered a problem and could not process your request", nil)
+}
+
+func (app *application) apiBadRequest(w http.ResponseWriter, err error) {
+	app.apiErrorResponse(w, http.StatusBadRequest, "bad_request", err.Error(), nil)
+}
+
+func (app *application) apiNotFound(w http.ResponseWriter) {
+	app.apiErrorResponse(w, http.StatusNotFound, "not_found", "the requested resource could not be found", nil)
+}
+
+func (app *application) apiMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	app.apiErrorResponse(w, http.StatusMethodNotAllowed, "method_not_allowed", fmt.Sprintf("the %s method is not supported for this resource", r.Method), nil)
+}
+
+func (app *application) apiFailedValidation(w http.ResponseWriter, fields map[string]string) {
+	app.apiErrorResponse(w, http.StatusUnprocessableEntity, "validation_failed", "the request contains invalid values", fields)
+}
+
+// apiServiceError is the JSON version of serviceError.
+func (app *application) apiServiceError(w http.ResponseWriter, err error) {
+	var serviceErr *service.Error
+
+	switch {
+	case errors.Is(err, data.ErrInvalidTransition):
+		app.apiErrorResponse(w, http.StatusConflict, "conflict", "the appointment request is no longer pending", nil)
+	case errors.As(err, &serviceErr):
+		status := serviceErrorStatus(serviceErr)
+		code := map[int]string{
+			http.StatusNotFound:            "not_found",
+			http.StatusForbidden:           "forbidden",
+			http.StatusConflict:            "conflict",
+			http.StatusUnprocessableEntity: "validation_failed",
+		}[status]
+		app.apiErrorResponse(w, status, code, serviceErr.Message, serviceErr.Fields)
+	default:
+		app.apiServerError(w, err)
+	}
+}
+
+// requireAPIAuthentication is the JSON API's requireAuthentication: clients
+// get a 401 response instead of being redirected to the login page.
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.apiErrorResponse(w, http.StatusUnauthorized, "unauthorized", "you must be authenticated to access this resource", nil)
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPITwoFactorEnrolment is the JSON API's requireTwoFactorEnrolment
+// for requests from a logged in browser. API tokens can only be created once
+// two-factor authentication is set up, so requests with one are let through.
+func (app *application) requireAPITwoFactorEnrolment(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(apiTokenContextKey).(*data.APIToken); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		enrolled, err := app.twoFactorEnrolled(r)
+		if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+
+		if !enrolled {
+			app.apiErrorResponse(w, http.StatusForbidden, "two_factor_required", "you must set up two-factor authentication before using the API", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateToken is authenticate for requests sent with a personal API
+// token in an "Authorization: Bearer" header. A request with a bad token is
+// rejected rather than treated as anonymous, so a revoked or expired token
+// gives a clear error.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, plaintext, ok := strings.Cut(authorizationHeader, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || plaintext == "" {
+			app.apiInvalidToken(w)
+			return
+		}
+
+		token, err := app.models.APITokens.Authenticate(plaintext)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.apiInvalidToken(w)
+			} else {
+				app.apiServerError(w, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, apiTokenContextKey, token)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *application) apiInvalidToken(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	app.apiErrorResponse(w, http.StatusUnauthorized, "invalid_token", "the API token is invalid, expired or revoked", nil)
+}
+
+// requireTokenScope checks that a request sent with an API token is allowed
+// by the token's scopes: reading needs the read scope and anything else the
+// write scope. Requests from a logged in browser can do everything.
+func (app *application) requireTokenScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := r.Context().Value(apiTokenContextKey).(*data.APIToken)
+		if ok {
+			scope := data.ScopeWrite
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = data.ScopeRead
+			}
+
+			if !token.HasScope(scope) {
+				app.apiErrorResponse(w, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("this API token doesn't have the %s scope", scope), nil)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireJSON rejects POST requests that aren't JSON. The API doesn't use
+// CSRF tokens, and browsers won't send JSON to another site without asking
+// it first, so this keeps other sites from posting forms to it.
+func requireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if mediaType != "application/json" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				w.Write([]byte(`{"error":{"code":"unsupported_media_type","message":"the request body must be application/json"}}` + "\n"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readInt returns the integer in the query string, or the default if it
+// isn't there.
+func readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddFieldError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readTime returns the time in the query string, given either in RFC 3339
+// format or as a date, or the zero time if it isn't there.
+func readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+
+	v.AddFieldError(key, "must be an RFC 3339 time or a date, e.g. 2024-05-11")
+	return time.Time{}
+}
+
+// readFilters reads the pagination and date range parameters shared by the
+// API's list endpoints.
+func readFilters(qs url.Values, v *validator.Validator) data.Filters {
+	filters := data.Filters{
+		Page:     readInt(qs, "page", 1, v),
+		PageSize: readInt(qs, "page_size", 20, v),
+		From:     readTime(qs, "from", v),
+		To:       readTime(qs, "to", v),
+	}
+
+	data.ValidateFilters(v, filters)
+
+	return filters
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestAPIRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.requestJSON(t, http.MethodGet, "/api/v1/appointments", "")
+
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+	assert.Equal(t, header.Get("WWW-Authenticate"), "Bearer")
+	assert.StringContains(t, body, `"code": "unauthorized"`)
+}
+
+func TestAPIGet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "List users",
+			urlPath:  "/api/v1/users",
+			wantCode: http.StatusOK,
+			wantBody: `"total_records": 2`,
+		},
+		{
+			name:     "Second page of users",
+			urlPath:  "/api/v1/users?page=2&page_size=1",
+			wantCode: http.StatusOK,
+			wantBody: `"name": "Bob"`,
+		},
+		{
+			name:     "Invalid page size",
+			urlPath:  "/api/v1/users?page_size=1000",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"page_size"`,
+		},
+		{
+			name:     "Show user",
+			urlPath:  "/api/v1/users/2",
+			wantCode: http.StatusOK,
+			wantBody: `"email": "bob@example.com"`,
+		},
+		{
+			name:     "Missing user",
+			urlPath:  "/api/v1/users/99",
+			wantCode: http.StatusNotFound,
+			wantBody: `"code": "not_found"`,
+		},
+		{
+			name:     "User availability",
+			urlPath:  "/api/v1/users/2/availability",
+			wantCode: http.StatusOK,
+			wantBody: `"busy"`,
+		},
+		{
+			name:     "Availability range backwards",
+			urlPath:  "/api/v1/users/2/availability?from=2024-05-11&to=2024-05-10",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"to": "must be after from"`,
+		},
+		{
+			name:     "List incoming appointment requests",
+			urlPath:  "/api/v1/appointment-requests",
+			wantCode: http.StatusOK,
+			wantBody: `"appointment_requests"`,
+		},
+		{
+			name:     "Invalid direction",
+			urlPath:  "/api/v1/appointment-requests?direction=sideways",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"direction"`,
+		},
+		{
+			name:     "Show appointment request",
+			urlPath:  "/api/v1/appointment-requests/1",
+			wantCode: http.StatusOK,
+			wantBody: `"target_user_id": 2`,
+		},
+		{
+			name:     "List appointments",
+			urlPath:  "/api/v1/appointments",
+			wantCode: http.StatusOK,
+			wantBody: `"appointments"`,
+		},
+		{
+			name:     "Missing appointment",
+			urlPath:  "/api/v1/appointments/99",
+			wantCode: http.StatusNotFound,
+			wantBody: `"code": "not_found"`,
+		},
+		{
+			name:     "Show group",
+			urlPath:  "/api/v1/groups/1",
+			wantCode: http.StatusOK,
+			wantBody: `"name": "Test Group"`,
+		},
+		{
+			name:     "Group calendar",
+			urlPath:  "/api/v1/groups/3/appointments",
+			wantCode: http.StatusOK,
+			wantBody: `"title": "Team Standup"`,
+		},
+		{
+			name:     "Group without a calendar",
+			urlPath:  "/api/v1/groups/1/appointments",
+			wantCode: http.StatusNotFound,
+			wantBody: `"code": "not_found"`,
+		},
+		{
+			name:     "Unknown route",
+			urlPath:  "/api/v1/nothing",
+			wantCode: http.StatusNotFound,
+			wantBody: `"code": "not_found"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.requestJSON(t, http.MethodGet, tt.urlPath, "")
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Content-Type"), "application/json")
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAPIListMetadata(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.requestJSON(t, http.MethodGet, "/api/v1/users?page_size=1", "")
+
+	var response struct {
+		Users    []apiUser `json:"users"`
+		Metadata struct {
+			CurrentPage  int `json:"current_page"`
+			LastPage     int `json:"last_page"`
+			TotalRecords int `json:"total_records"`
+		} `json:"metadata"`
+	}
+	err := json.Unmarshal([]byte(body), &response)
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(response.Users), 1)
+	assert.Equal(t, response.Metadata.CurrentPage, 1)
+	assert.Equal(t, response.Metadata.LastPage, 2)
+	assert.Equal(t, response.Metadata.TotalRecords, 2)
+}
+
+func TestAPIWrite(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Create appointment request",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/appointment-requests",
+			body:     `{"target_user_id": 2, "title": "Catch up", "description": "Coffee", "start_time": "2030-05-11T10:00:00Z", "end_time": "2030-05-11T11:00:00Z"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"title": "Catch up"`,
+		},
+		{
+			name:     "Create appointment request with missing fields",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/appointment-requests",
+			body:     `{"target_user_id": 2}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"title": "This field cannot be blank"`,
+		},
+		{
+			name:     "Create appointment request with a bad time",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/appointment-requests",
+			body:     `{"target_user_id": 2, "start_time": "tomorrow"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "RFC 3339",
+		},
+		{
+			name:     "Unknown field",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/groups",
+			body:     `{"name": "Team", "colour": "red"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `unknown key \"colour\"`,
+		},
+		{
+			name:     "Respond to someone else's request",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/appointment-requests/1/respond",
+			body:     `{"response": "accepted"}`,
+			wantCode: http.StatusForbidden,
+			wantBody: `"code": "forbidden"`,
+		},
+		{
+			name:     "Respond with an invalid response",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/appointment-requests/1/respond",
+			body:     `{"response": "maybe"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"response"`,
+		},
+		{
+			name:     "Cancel own request",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/appointment-requests/1/cancel",
+			body:     `{}`,
+			wantCode: http.StatusOK,
+			wantBody: `"appointment_request"`,
+		},
+		{
+			name:     "Invite existing member",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/groups/1/invitations",
+			body:     `{"email": "alice@example.com"}`,
+			wantCode: http.StatusConflict,
+			wantBody: `"code": "conflict"`,
+		},
+		{
+			name:     "Invite address without an account",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/groups/1/invitations",
+			body:     `{"email": "nobody@example.com"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `"invitation"`,
+		},
+		{
+			name:     "Decline someone else's invitation",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/invitations/1/decline",
+			body:     `{}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Delete appointment",
+			method:   http.MethodDelete,
+			urlPath:  "/api/v1/appointments/1",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Method not allowed",
+			method:   http.MethodPut,
+			urlPath:  "/api/v1/appointments/1",
+			body:     `{}`,
+			wantCode: http.StatusMethodNotAllowed,
+			wantBody: `"code": "method_not_allowed"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.requestJSON(t, tt.method, tt.urlPath, tt.body)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAPIRequiresJSON(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	form := url.Values{}
+	form.Add("name", "Team")
+	form.Add("description", "A form post from another site")
+
+	code, _, body := ts.postForm(t, "/api/v1/groups", form)
+
+	assert.Equal(t, code, http.StatusUnsupportedMediaType)
+	assert.StringContains(t, body, "unsupported_media_type")
+}
+
+func TestAPITokenAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Read with read token",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/appointments",
+			token:    mocks.MockReadToken,
+			wantCode: http.StatusOK,
+			wantBody: `"appointments"`,
+		},
+		{
+			name:     "Write with read token",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/groups",
+			body:     `{"name": "Team", "description": "From CI"}`,
+			token:    mocks.MockReadToken,
+			wantCode: http.StatusForbidden,
+			wantBody: `"code": "insufficient_scope"`,
+		},
+		{
+			name:     "Write with write token",
+			method:   http.MethodDelete,
+			urlPath:  "/api/v1/appointments/1",
+			token:    mocks.MockWriteToken,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Unknown token",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/appointments",
+			token:    "cal_revoked",
+			wantCode: http.StatusUnauthorized,
+			wantBody: `"code": "invalid_token"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.requestJSONWithToken(t, tt.method, tt.urlPath, tt.body, tt.token)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAPITokenNotAcceptedByPages(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/appointments", nil)
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer "+mocks.MockWriteToken)
+
+	rs, err := ts.Client().Do(req)
+	assert.NilError(t, err)
+	defer rs.Body.Close()
+
+	assert.Equal(t, rs.StatusCode, http.StatusSeeOther)
+	assert.Equal(t, rs.Header.Get("Location"), "/user/login")
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/tmgasek/calendar-app/internal/data"
-	"github.com/tmgasek/calendar-app/internal/providers"
+	"github.com/tmgasek/calendar-app/internal/service"
 	"github.com/tmgasek/calendar-app/internal/validator"
 )
 
@@ -19,6 +21,10 @@ type appointmentRequestCreateForm struct {
 	EndTime             string `form:"end_time"`
 	Location            string `form:"location"`
 	GroupID             int    `form:"group_id"`
+	QuorumRule          string `form:"quorum_rule"`
+	QuorumCount         int    `form:"quorum_count"`
+	OptionalUserIDs     []int  `form:"optional_user_ids"`
+	ResourceIDs         []int  `form:"resource_ids"`
 	validator.Validator `form:"-"`
 }
 
@@ -31,11 +37,24 @@ func isUserAvailable(events []*data.Event, startTime, endTime time.Time) bool {
 	return true
 }
 
+// parseFormTime parses the value of a datetime-local input. A blank value
+// gives the zero time, which the service layer reports as missing.
+func parseFormTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02T15:04", value)
+}
+
 func (app *application) createAppointmentRequest(w http.ResponseWriter, r *http.Request) {
 	// Get the authenticated user ID
 	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 	// Get the target user ID from the URL
 	targetUserID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid user ID in URL")
+		return
+	}
 
 	var form appointmentRequestCreateForm
 
@@ -45,133 +64,37 @@ func (app *application) createAppointmentRequest(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Validate the form.
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Description), "description", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.StartTime), "start_time", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.EndTime), "end_time", "This field cannot be blank")
-
-	if !form.Valid() {
-		app.clientError(w, http.StatusUnprocessableEntity, "Invalid form data")
-		return
-	}
-
 	// Parse the start and end times
-	startTime, err := time.Parse("2006-01-02T15:04", form.StartTime)
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
-	endTime, err := time.Parse("2006-01-02T15:04", form.EndTime)
+	startTime, err := parseFormTime(form.StartTime)
 	if err != nil {
-		app.serverError(w, err)
+		app.clientError(w, http.StatusUnprocessableEntity, "Invalid start time")
 		return
 	}
-
-	// Determine if dealing with a group or individual appointment.
-	var appointmentType string
-	if form.GroupID == 0 {
-		appointmentType = "individual"
-	} else {
-		appointmentType = "group"
-	}
-
-	requestee, err := app.models.Users.Get(userID)
+	endTime, err := parseFormTime(form.EndTime)
 	if err != nil {
-		app.serverError(w, err)
+		app.clientError(w, http.StatusUnprocessableEntity, "Invalid end time")
 		return
 	}
 
-	type EmailData struct {
-		RequesteeName string
-		GroupName     string
-	}
-
-	// Create the appointment request.
-	appointmentRequest := &data.AppointmentRequest{
-		RequesterID:     int(userID),
+	request, err := app.service.CreateAppointmentRequest(userID, service.NewAppointmentRequest{
 		TargetUserID:    int(targetUserID),
-		GroupID:         int(form.GroupID),
-		AppointmentType: appointmentType,
+		GroupID:         form.GroupID,
 		Title:           form.Title,
 		Description:     form.Description,
+		Location:        form.Location,
 		StartTime:       startTime,
 		EndTime:         endTime,
-		Location:        form.Location,
-		Status:          "pending",
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-	}
-
-	emailData := EmailData{
-		RequesteeName: requestee.Name,
-	}
-
-	// Check if all the involved users are available at the requested time.
-	if appointmentType == "individual" {
-		userIds := []int{userID, int(targetUserID)}
-		// Get all the events for the users
-		for _, userID := range userIds {
-			events, err := app.fetchEventsForUser(userID)
-			if err != nil {
-				app.serverError(w, err)
-				return
-			}
-
-			if !isUserAvailable(events, startTime, endTime) {
-				app.clientError(w, http.StatusConflict, "One or more users are not available at the requested time")
-				return
-			}
-		}
-
-	} else if appointmentType == "group" {
-		// Get the group from the database.
-		group, err := app.models.Groups.Get(form.GroupID)
-		if err != nil {
-			app.serverError(w, err)
-			return
-		}
-		emailData.GroupName = group.Name
-
-		// Get all users in the group.
-		userIds := []int{int(targetUserID)}
-		for _, member := range group.Members {
-			userIds = append(userIds, member.ID)
-		}
-
-		// Check if everyone is available.
-		for _, userID := range userIds {
-			events, err := app.fetchEventsForUser(userID)
-			if err != nil {
-				app.serverError(w, err)
-				return
-			}
-
-			if !isUserAvailable(events, startTime, endTime) {
-				app.clientError(w, http.StatusConflict, "One or more users are not available at the requested time")
-				return
-			}
-		}
-	}
-
-	err = app.models.AppointmentRequests.Insert(appointmentRequest)
+		QuorumRule:      form.QuorumRule,
+		QuorumCount:     form.QuorumCount,
+		OptionalUserIDs: form.OptionalUserIDs,
+		ResourceIDs:     form.ResourceIDs,
+	})
 	if err != nil {
-		app.serverError(w, err)
+		app.serviceError(w, err)
 		return
 	}
 
-	// Get the target user from the database.
-	targetUser, err := app.models.Users.Get(int(targetUserID))
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
-	// Send an email to the target user.
-	err = app.mailer.Send(targetUser.Email, "confirm-appointment.tmpl", emailData)
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
+	app.requestChanged(data.EventRequestCreated, request.RequestID)
 
 	app.sessionManager.Put(r.Context(), "flash", "Appointment request sent!")
 	http.Redirect(w, r, fmt.Sprintf("/users/profile/%d", targetUserID), http.StatusSeeOther)
@@ -191,144 +114,110 @@ func (app *application) viewAppointmentRequests(w http.ResponseWriter, r *http.R
 	app.render(w, http.StatusOK, "appointment-requests.tmpl", data)
 }
 
-func (app *application) updateAppointmentRequest(w http.ResponseWriter, r *http.Request) {
-	currUserID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
-	fmt.Printf("userID: %v\n", currUserID)
+func (app *application) viewOutgoingAppointmentRequests(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	requestID, err := app.readIDParam(r)
-	fmt.Printf("requestID: %v\n", requestID)
+	appointmentRequests, err := app.models.AppointmentRequests.GetOutgoingForUser(userID)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest, "Invalid request ID in URL")
+		app.serverError(w, err)
 		return
 	}
 
-	action := r.FormValue("action")
-	if action != "confirmed" && action != "declined" {
-		app.clientError(w, http.StatusBadRequest, "Invalid action")
+	data.AppointmentRequests = appointmentRequests
+	app.render(w, http.StatusOK, "outgoing-requests.tmpl", data)
+}
+
+// requestTransitionError writes the response for a failed status change. A
+// request that has already moved on, e.g. because the button was clicked
+// twice, isn't treated as an error: we just redirect back to the list.
+func (app *application) requestTransitionError(w http.ResponseWriter, r *http.Request, err error, redirectTo string) {
+	if errors.Is(err, data.ErrInvalidTransition) {
+		app.sessionManager.Put(r.Context(), "flash", "This request is no longer pending.")
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
 		return
 	}
+	app.serviceError(w, err)
+}
 
-	fmt.Printf("action: %v\n", action)
+func (app *application) cancelAppointmentRequest(w http.ResponseWriter, r *http.Request) {
+	currUserID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	if action == "declined" {
-		app.infoLog.Println("Declining appointment request")
-		err := app.models.AppointmentRequests.Delete(int(requestID))
-		if err != nil {
-			app.serverError(w, err)
-			return
-		}
-		http.Redirect(w, r, "/requests", http.StatusSeeOther)
+	requestID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid request ID in URL")
 		return
 	}
 
-	// Retrieve the appointment request from the database
-	request, err := app.models.AppointmentRequests.Get(int(requestID))
+	err = app.service.CancelAppointmentRequest(currUserID, int(requestID))
 	if err != nil {
-		app.serverError(w, err)
+		app.requestTransitionError(w, r, err, "/requests/outgoing")
 		return
 	}
 
-	fmt.Printf("request: %v\n", request)
+	app.requestChanged(data.EventRequestCancelled, int(requestID))
 
-	// Create a new event struct.
-	newEventData := providers.NewEventData{
-		Title:       request.Title,
-		Description: request.Description,
-		StartTime:   request.StartTime,
-		EndTime:     request.EndTime,
-		Location:    request.Location,
-	}
+	app.sessionManager.Put(r.Context(), "flash", "Appointment request cancelled.")
+	http.Redirect(w, r, "/requests/outgoing", http.StatusSeeOther)
+}
+
+func (app *application) updateAppointmentRequest(w http.ResponseWriter, r *http.Request) {
+	currUserID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	newAppointment := &data.Appointment{
-		CreatorID:       request.RequesterID,
-		AppointmentType: request.AppointmentType,
-		GroupID:         request.GroupID,
-		TargetID:        request.TargetUserID,
-		Title:           request.Title,
-		Description:     request.Description,
-		StartTime:       request.StartTime,
-		EndTime:         request.EndTime,
-		Location:        request.Location,
+	response, ok := map[string]string{
+		"confirmed": data.ParticipantAccepted,
+		"declined":  data.ParticipantDeclined,
+		"tentative": data.ParticipantTentative,
+	}[r.FormValue("action")]
+	if !ok {
+		app.clientError(w, http.StatusBadRequest, "Invalid action")
+		return
 	}
 
-	// Save the appointment to the database
-	newAppointmentID, err := app.models.Appointments.Insert(newAppointment)
-	if err != nil || newAppointmentID == 0 {
-		app.serverError(w, err)
+	requestID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid request ID in URL")
 		return
 	}
 
-	// Store all the user IDs that need to be processed.
-	var userIDs []int
+	reason := strings.TrimSpace(r.FormValue("decline_reason"))
 
-	if newAppointment.AppointmentType == "group" {
-		// Get all the users in the group.
-		groupMembers, err := app.models.Groups.Get(newAppointment.GroupID)
-		if err != nil {
-			app.serverError(w, err)
-			return
-		}
-		for _, member := range groupMembers.Members {
-			userIDs = append(userIDs, member.ID)
-		}
-		userIDs = append(userIDs, currUserID)
+	outcome, err := app.service.RespondToAppointmentRequest(currUserID, int(requestID), response, reason)
+	if err != nil {
+		app.requestTransitionError(w, r, err, "/requests")
+		return
+	}
 
-	} else if newAppointment.AppointmentType == "individual" {
-		userIDs = []int{request.RequesterID, currUserID}
+	app.requestChanged(outcomeEvent(outcome), int(requestID))
 
-	} else {
-		app.serverError(w, fmt.Errorf("invalid appointment type"))
-		return
+	switch outcome {
+	case service.OutcomeConfirmed:
+		app.sessionManager.Put(r.Context(), "flash", "Appointment confirmed!")
+	case service.OutcomeDeclined:
+		app.sessionManager.Put(r.Context(), "flash", "Appointment request declined.")
+	case service.OutcomeResourceTaken:
+		app.sessionManager.Put(r.Context(), "flash", "A requested resource has been booked in the meantime, so the request was declined.")
+	default:
+		app.sessionManager.Put(r.Context(), "flash", "Your response has been recorded.")
 	}
 
-	// log out the userIDs
-	fmt.Printf("userIDs: %v\n", userIDs)
+	http.Redirect(w, r, "/requests", http.StatusSeeOther)
+}
+
+// expireAppointmentRequests periodically moves pending requests whose start
+// time has passed to the expired status. It blocks, so run it in a goroutine.
+func (app *application) expireAppointmentRequests(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	// Process appointments for both users.
-	for _, userID := range userIDs {
-		linkedProviders, err := providers.GetLinkedProviders(userID, &app.models, app.googleOAuthConfig, app.azureOAuth2Config)
+	for range ticker.C {
+		n, err := app.models.AppointmentRequests.ExpirePast()
 		if err != nil {
-			app.serverError(w, err)
-			return
+			app.errorLog.Printf("Error expiring appointment requests: %v\n", err)
+			continue
 		}
-
-		for _, p := range linkedProviders {
-			app.infoLog.Printf("Creating event from provider %s for user %d\n", p.Name(), userID)
-
-			client, err := providers.GetClient(p, userID, &app.models)
-			if err != nil {
-				app.serverError(w, err)
-				return
-			}
-			eventID, err := p.CreateEvent(userID, client, newEventData)
-			if err != nil {
-				app.errorLog.Fatalf("Error creating event: %v\n", err)
-				return
-			}
-
-			appointmentEvent := &data.AppointmentEvent{
-				AppointmentID:   newAppointmentID,
-				UserID:          userID,
-				ProviderName:    p.Name(),
-				ProviderEventID: eventID,
-			}
-			err = app.models.AppointmentEvents.Insert(appointmentEvent)
-			if err != nil {
-				app.serverError(w, err)
-				return
-			}
-
-			app.infoLog.Printf("Provider: %s, Event ID: %s\n", p.Name(), eventID)
+		if n > 0 {
+			app.infoLog.Printf("Expired %d appointment requests\n", n)
 		}
 	}
-
-	// Delete the appointment request
-	err = app.models.AppointmentRequests.Delete(int(requestID))
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
-
-	app.sessionManager.Put(r.Context(), "flash", "Appointment confirmed!")
-	http.Redirect(w, r, "/requests", http.StatusSeeOther)
 }
@@ -126,3 +126,101 @@ func TestCreateAppointmentRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestViewOutgoingAppointmentRequests(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/requests/outgoing")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Sent to: Bob (bob@example.com)")
+	assert.StringContains(t, body, "/requests/1/cancel")
+}
+
+func TestCancelAppointmentRequest(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/requests/outgoing")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Own request",
+			urlPath:  "/requests/1/cancel",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Non-existent request",
+			urlPath:  "/requests/2/cancel",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid ID",
+			urlPath:  "/requests/abc/cancel",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestUpdateAppointmentRequest(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/requests")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		action   string
+		wantCode int
+	}{
+		{
+			name:     "Invalid action",
+			urlPath:  "/requests/1/update",
+			action:   "maybe",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Not a participant",
+			urlPath:  "/requests/1/update",
+			action:   "declined",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent request",
+			urlPath:  "/requests/2/update",
+			action:   "declined",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+			form.Add("action", tt.action)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
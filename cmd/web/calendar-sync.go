@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/providers"
+)
+
+// calendarPollInterval is how often calendars without a notification channel
+// are synced, e.g. when the app isn't reachable from the internet.
+const calendarPollInterval = 15 * time.Minute
+
+// channelRenewWindow is how long before it expires a channel is renewed.
+const channelRenewWindow = 24 * time.Hour
+
+// fetchEventsForUser returns the events in the calendars the user has linked.
+// They come from the copy kept by the calendar sync, which is brought up to
+// date first if a provider has told us a calendar changed.
+func (app *application) fetchEventsForUser(userID int) ([]*data.Event, error) {
+	var allEvents []*data.Event
+	linkedProviders, err := providers.GetLinkedProviders(userID, &app.models, app.googleOAuthConfig, app.azureOAuth2Config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range linkedProviders {
+		events, err := app.calendarEvents(userID, p)
+		if err != nil {
+			return nil, err
+		}
+		allEvents = append(allEvents, events...)
+	}
+
+	return allEvents, nil
+}
+
+// calendarEvents returns the events in one of the user's calendars, syncing
+// it if the copy is out of date. A calendar seen for the first time is also
+// watched for changes.
+func (app *application) calendarEvents(userID int, p providers.CalendarProvider) ([]*data.Event, error) {
+	sync, err := app.models.CalendarSyncs.Get(userID, p.Name())
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if sync != nil && !sync.NeedsSync(calendarPollInterval) {
+		return app.models.CalendarSyncs.GetEvents(userID, p.Name())
+	}
+
+	events, err := app.syncCalendar(userID, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if sync == nil {
+		err = app.watchCalendar(userID, p)
+		if err != nil {
+			app.errorLog.Printf("Error watching %s calendar of user %d: %v\n", p.Name(), userID, err)
+		}
+	}
+
+	return events, nil
+}
+
+// syncCalendar fetches the events in one of the user's calendars and saves
+// them as the calendar's copy. Failures to reach the provider are recorded
+// for admins to look into.
+func (app *application) syncCalendar(userID int, p providers.CalendarProvider) ([]*data.Event, error) {
+	started := time.Now()
+
+	client, err := providers.GetClient(p, userID, &app.models)
+	if err != nil {
+		app.recordSyncError(userID, p.Name(), err)
+		return nil, err
+	}
+
+	app.infoLog.Printf("Syncing events from provider %s for user %d\n", p.Name(), userID)
+
+	events, err := p.FetchEvents(userID, client)
+	if err != nil {
+		app.recordSyncError(userID, p.Name(), err)
+		return nil, err
+	}
+
+	err = app.models.CalendarSyncs.SaveEvents(userID, p.Name(), events, started)
+	if err != nil {
+		return nil, err
+	}
+
+	allEvents := make([]*data.Event, 0, len(events))
+	for _, event := range events {
+		// Make copy to avoid overwriting.
+		eventCopy := event
+		allEvents = append(allEvents, &eventCopy)
+	}
+
+	return allEvents, nil
+}
+
+// recordSyncError records why a sync of one of the user's calendars failed.
+// The caller handles the error itself, so failing to record it is only
+// logged.
+func (app *application) recordSyncError(userID int, name string, syncErr error) {
+	err := app.models.CalendarSyncs.RecordError(userID, name, syncErr.Error())
+	if err != nil {
+		app.errorLog.Printf("Error recording failed sync of %s calendar of user %d: %v\n", name, userID, err)
+	}
+}
+
+// watchCalendar opens a notification channel for one of the user's calendars,
+// if the provider supports them.
+func (app *application) watchCalendar(userID int, p providers.CalendarProvider) error {
+	watcher, ok := p.(providers.Watcher)
+	if !ok {
+		return nil
+	}
+
+	client, err := providers.GetClient(p, userID, &app.models)
+	if err != nil {
+		return err
+	}
+
+	channel, err := providers.NewChannel(app.baseURL + "/notifications/" + p.Name())
+	if err != nil {
+		return err
+	}
+
+	err = watcher.Watch(client, channel)
+	if err != nil {
+		return err
+	}
+
+	return app.models.CalendarSyncs.SaveChannel(&data.CalendarSync{
+		UserID:     userID,
+		Provider:   p.Name(),
+		ChannelID:  channel.ID,
+		ResourceID: channel.ResourceID,
+		Expiry:     channel.Expiry,
+	}, channel.Token)
+}
+
+// stopCalendarChannel closes the notification channel of a calendar, if it
+// has one.
+func (app *application) stopCalendarChannel(sync *data.CalendarSync, p providers.CalendarProvider) error {
+	watcher, ok := p.(providers.Watcher)
+	if !ok || sync.ChannelID == "" {
+		return nil
+	}
+
+	client, err := providers.GetClient(p, sync.UserID, &app.models)
+	if err != nil {
+		return err
+	}
+
+	return watcher.StopWatch(client, &providers.Channel{ID: sync.ChannelID, ResourceID: sync.ResourceID})
+}
+
+// renewCalendarChannel extends a channel that is about to expire. Channels
+// that can't be extended, and calendars without one, get a new channel, and
+// the old one is stopped.
+func (app *application) renewCalendarChannel(sync *data.CalendarSync, p providers.CalendarProvider) error {
+	watcher, ok := p.(providers.Watcher)
+	if !ok {
+		return nil
+	}
+
+	if sync.ChannelID != "" {
+		client, err := providers.GetClient(p, sync.UserID, &app.models)
+		if err != nil {
+			return err
+		}
+
+		channel := &providers.Channel{ID: sync.ChannelID, ResourceID: sync.ResourceID}
+
+		err = watcher.Renew(client, channel)
+		if err == nil {
+			sync.Expiry = channel.Expiry
+			return app.models.CalendarSyncs.SaveChannel(sync, "")
+		}
+		if !errors.Is(err, providers.ErrRenewUnsupported) {
+			return err
+		}
+	}
+
+	err := app.watchCalendar(sync.UserID, p)
+	if err != nil {
+		return err
+	}
+
+	// Notifications may still arrive down the old channel until it's stopped,
+	// but they'll be turned away as its ID is no longer recorded.
+	err = app.stopCalendarChannel(sync, p)
+	if err != nil {
+		app.errorLog.Printf("Error stopping old %s channel of user %d: %v\n", p.Name(), sync.UserID, err)
+	}
+
+	return nil
+}
+
+// linkedCalendar syncs a calendar that has just been linked and watches it
+// for changes. Failures are only logged: the calendar is synced again when
+// it's next needed, and the renewal worker retries the watch.
+func (app *application) linkedCalendar(userID int, name string) {
+	p, err := app.linkedProvider(userID, name)
+	if err != nil || p == nil {
+		app.errorLog.Printf("Error getting %s provider for user %d: %v\n", name, userID, err)
+		return
+	}
+
+	_, err = app.syncCalendar(userID, p)
+	if err != nil {
+		app.errorLog.Printf("Error syncing %s calendar of user %d: %v\n", name, userID, err)
+	}
+
+	err = app.watchCalendar(userID, p)
+	if err != nil {
+		app.errorLog.Printf("Error watching %s calendar of user %d: %v\n", name, userID, err)
+	}
+}
+
+// linkedProvider returns the provider of a calendar, or nil if the account
+// is no longer linked.
+func (app *application) linkedProvider(userID int, name string) (providers.CalendarProvider, error) {
+	token, err := app.models.AuthTokens.Token(userID, name)
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	return providers.GetProviderByName(userID, name, &app.models, app.googleOAuthConfig, app.azureOAuth2Config)
+}
+
+// syncProvider returns the provider of a calendar for the workers. Calendars
+// of accounts that are no longer linked are forgotten.
+func (app *application) syncProvider(sync *data.CalendarSync) (providers.CalendarProvider, bool) {
+	p, err := app.linkedProvider(sync.UserID, sync.Provider)
+	if err != nil {
+		app.errorLog.Printf("Error getting %s provider for user %d: %v\n", sync.Provider, sync.UserID, err)
+		return nil, false
+	}
+
+	if p == nil {
+		err = app.models.CalendarSyncs.Delete(sync.UserID, sync.Provider)
+		if err != nil {
+			app.errorLog.Printf("Error forgetting %s calendar of user %d: %v\n", sync.Provider, sync.UserID, err)
+		}
+		return nil, false
+	}
+
+	return p, true
+}
+
+// runCalendarSync resyncs the calendars that have changed, and polls those
+// without a channel, every interval. It blocks, so run it in a goroutine.
+func (app *application) runCalendarSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		syncs, err := app.models.CalendarSyncs.GetStale(20, calendarPollInterval)
+		if err != nil {
+			app.errorLog.Printf("Error getting calendars to sync: %v\n", err)
+			continue
+		}
+
+		for _, sync := range syncs {
+			p, ok := app.syncProvider(sync)
+			if !ok {
+				continue
+			}
+
+			_, err = app.syncCalendar(sync.UserID, p)
+			if err != nil {
+				app.errorLog.Printf("Error syncing %s calendar of user %d: %v\n", sync.Provider, sync.UserID, err)
+				continue
+			}
+
+			app.availabilityChanged(sync.UserID)
+		}
+	}
+}
+
+// renewCalendarChannels renews the channels that expire soon, and tries again
+// to watch calendars without one, every interval. It blocks, so run it in a
+// goroutine.
+func (app *application) renewCalendarChannels(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		syncs, err := app.models.CalendarSyncs.GetExpiring(time.Now().Add(channelRenewWindow), 20)
+		if err != nil {
+			app.errorLog.Printf("Error getting calendar channels to renew: %v\n", err)
+			continue
+		}
+
+		for _, sync := range syncs {
+			p, ok := app.syncProvider(sync)
+			if !ok {
+				continue
+			}
+
+			err = app.renewCalendarChannel(sync, p)
+			if err != nil {
+				app.errorLog.Printf("Error renewing %s channel of user %d: %v\n", sync.Provider, sync.UserID, err)
+			}
+		}
+	}
+}
+
+// googleNotification receives the notifications of Google Calendar channels.
+// They carry no details of the change, so the calendar is just marked for a
+// resync by runCalendarSync.
+func (app *application) googleNotification(w http.ResponseWriter, r *http.Request) {
+	channelID := r.Header.Get("X-Goog-Channel-ID")
+	token := r.Header.Get("X-Goog-Channel-Token")
+
+	userID, err := app.models.CalendarSyncs.MarkChanged("google", channelID, token)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "Unknown channel")
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	app.infoLog.Printf("Google calendar of user %d changed (%s)\n", userID, r.Header.Get("X-Goog-Resource-State"))
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// microsoftNotification receives the notifications of Microsoft Graph
+// subscriptions, and answers the validation request Graph sends when one is
+// created.
+func (app *application) microsoftNotification(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("validationToken"); token != "" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(token))
+		return
+	}
+
+	var input struct {
+		Value []struct {
+			SubscriptionID string `json:"subscriptionId"`
+			ClientState    string `json:"clientState"`
+			ChangeType     string `json:"changeType"`
+		} `json:"value"`
+	}
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1_048_576)).Decode(&input)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid notification")
+		return
+	}
+
+	// Graph batches notifications, so one with an unknown subscription or
+	// the wrong client state doesn't stop the rest.
+	for _, n := range input.Value {
+		userID, err := app.models.CalendarSyncs.MarkChanged("microsoft", n.SubscriptionID, n.ClientState)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverError(w, err)
+				return
+			}
+			app.errorLog.Printf("Ignoring notification for unknown Graph subscription %q\n", n.SubscriptionID)
+			continue
+		}
+
+		app.infoLog.Printf("Microsoft calendar of user %d changed (%s)\n", userID, n.ChangeType)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// unlinkProvider unlinks the user's Google or Microsoft account, closing its
+// notification channel and forgetting its events.
+func (app *application) unlinkProvider(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	name := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+
+	title, ok := map[string]string{"google": "Google", "microsoft": "Microsoft"}[name]
+	if !ok {
+		app.clientError(w, http.StatusNotFound, "Unknown provider")
+		return
+	}
+
+	p, err := app.linkedProvider(userID, name)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if p == nil {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Your %s account isn't linked.", title))
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	err = app.unlinkCalendar(userID, name, p)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s account unlinked.", title))
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// unlinkCalendar forgets a linked calendar and the account's tokens.
+func (app *application) unlinkCalendar(userID int, name string, p providers.CalendarProvider) error {
+	// Stop the channel while there's still a token to do it with. Failing to
+	// only means the provider keeps notifying until the channel expires.
+	sync, err := app.models.CalendarSyncs.Get(userID, name)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+	if sync != nil {
+		err = app.stopCalendarChannel(sync, p)
+		if err != nil {
+			app.errorLog.Printf("Error stopping %s channel of user %d: %v\n", name, userID, err)
+		}
+	}
+
+	err = app.models.CalendarSyncs.Delete(userID, name)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.AuthTokens.Delete(userID, name)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+
+	return nil
+}
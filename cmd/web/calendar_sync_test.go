@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+// notify posts a notification the way a calendar provider would.
+func (ts *testServer) notify(t *testing.T, urlPath string, header http.Header, body string) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, string(b)
+}
+
+func TestGoogleNotification(t *testing.T) {
+	tests := []struct {
+		name        string
+		channelID   string
+		token       string
+		wantCode    int
+		wantChanged int
+	}{
+		{"Valid channel", mocks.MockGoogleChannel, mocks.MockGoogleChannelToken, http.StatusOK, 1},
+		{"Wrong token", mocks.MockGoogleChannel, "guess", http.StatusNotFound, 0},
+		{"Unknown channel", "other", mocks.MockGoogleChannelToken, http.StatusNotFound, 0},
+		{"No headers", "", "", http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			header := http.Header{}
+			header.Set("X-Goog-Channel-ID", tt.channelID)
+			header.Set("X-Goog-Channel-Token", tt.token)
+			header.Set("X-Goog-Resource-State", "exists")
+
+			code, _ := ts.notify(t, "/notifications/google", header, "")
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, len(app.models.CalendarSyncs.(*mocks.CalendarSyncModel).Changed), tt.wantChanged)
+		})
+	}
+}
+
+func TestMicrosoftNotification(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	syncs := app.models.CalendarSyncs.(*mocks.CalendarSyncModel)
+
+	t.Run("Validation request", func(t *testing.T) {
+		code, body := ts.notify(t, "/notifications/microsoft?validationToken=abc%20123", nil, "")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, body, "abc 123")
+		assert.Equal(t, len(syncs.Changed), 0)
+	})
+
+	t.Run("Batch with a bad client state", func(t *testing.T) {
+		body := `{"value": [
+			{"subscriptionId": "` + mocks.MockGraphSubscription + `", "clientState": "` + mocks.MockGraphClientState + `", "changeType": "updated"},
+			{"subscriptionId": "` + mocks.MockGraphSubscription + `", "clientState": "guess", "changeType": "deleted"}
+		]}`
+
+		code, _ := ts.notify(t, "/notifications/microsoft", http.Header{"Content-Type": {"application/json"}}, body)
+
+		assert.Equal(t, code, http.StatusAccepted)
+		assert.Equal(t, len(syncs.Changed), 1)
+	})
+
+	t.Run("Invalid body", func(t *testing.T) {
+		code, _ := ts.notify(t, "/notifications/microsoft", nil, "not json")
+
+		assert.Equal(t, code, http.StatusBadRequest)
+	})
+}
+
+func TestUnlinkProvider(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.AuthTokens = &mocks.AuthTokenModel{Linked: []string{"microsoft"}}
+	syncs := app.models.CalendarSyncs.(*mocks.CalendarSyncModel)
+
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/settings")
+	validCSRFToken := extractCSRFToken(t, body)
+	assert.StringContains(t, body, "Unlink Microsoft")
+
+	tests := []struct {
+		name        string
+		provider    string
+		wantCode    int
+		wantDeleted int
+	}{
+		{"Linked account", "microsoft", http.StatusSeeOther, 1},
+		{"Account not linked", "google", http.StatusSeeOther, 1},
+		{"Unknown provider", "apple", http.StatusNotFound, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, "/oauth/"+tt.provider+"/unlink", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, len(syncs.Deleted), tt.wantDeleted)
+		})
+	}
+}
@@ -3,3 +3,7 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// apiTokenContextKey holds the *data.APIToken a request was authenticated
+// with, if it was sent with one instead of a session cookie.
+const apiTokenContextKey = contextKey("apiToken")
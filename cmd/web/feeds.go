@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/ical"
+)
+
+// icalEvent converts an appointment to an iCalendar event. The UID only
+// depends on the appointment's ID, so calendar apps update their copy when
+// it changes.
+func icalEvent(a *data.Appointment) ical.Event {
+	event := ical.Event{
+		UID:         fmt.Sprintf("appointment-%d@calendar-app", a.ID),
+		Summary:     a.Title,
+		Description: a.Description,
+		Location:    a.Location,
+		Start:       a.StartTime,
+		End:         a.EndTime,
+		Created:     a.CreatedAt,
+		Modified:    a.UpdatedAt,
+	}
+
+	if a.Status == data.AppointmentConfirmed {
+		event.Status = "CONFIRMED"
+	}
+
+	return event
+}
+
+func writeCalendar(w http.ResponseWriter, calendar ical.Calendar) error {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	return calendar.Write(w)
+}
+
+// viewCalendarFeed serves a user's appointments to calendar apps that have
+// subscribed to their feed. The secret token in the URL is the only
+// authentication, as calendar apps can't log in.
+func (app *application) viewCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	token, ok := strings.CutSuffix(params.ByName("token"), ".ics")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	feed, err := app.models.CalendarFeeds.GetByToken(token)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(feed.UserID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	appointments, err := app.models.Appointments.GetForFeed(feed.UserID, feed.IncludeGroups)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	calendar := ical.Calendar{Name: user.Name + "'s appointments"}
+	for _, a := range appointments {
+		calendar.Events = append(calendar.Events, icalEvent(a))
+	}
+
+	// The URL is a secret, so it shouldn't be kept by shared caches.
+	w.Header().Set("Cache-Control", "private, max-age=300")
+
+	err = writeCalendar(w, calendar)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+}
+
+// downloadAppointment sends a single appointment as an .ics file, for
+// adding it to a calendar by hand.
+func (app *application) downloadAppointment(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	appointmentID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid appointment ID in URL")
+		return
+	}
+
+	appointment, err := app.service.GetAppointment(userID, int(appointmentID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="appointment-%d.ics"`, appointment.ID))
+
+	err = writeCalendar(w, ical.Calendar{Events: []ical.Event{icalEvent(appointment)}})
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+}
+
+// createCalendarFeed turns on the user's feed, or gives it a new URL if it's
+// already on. Like a new API token, the URL is shown straight away as it
+// can't be shown again.
+func (app *application) createCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	feed, err := app.models.CalendarFeeds.New(userID, r.PostForm.Get("include_groups") == "true")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData, err := app.settingsData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	templateData.NewFeedURL = app.baseURL + "/feeds/" + feed.Token + ".ics"
+
+	app.render(w, http.StatusCreated, "settings.tmpl", templateData)
+}
+
+func (app *application) deleteCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err := app.models.CalendarFeeds.Delete(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Calendar feed turned off.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
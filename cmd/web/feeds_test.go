@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestViewCalendarFeed(t *testing.T) {
+	app := newTestApplication(t)
+	// Calendar apps don't have a session.
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid token",
+			urlPath:  "/feeds/" + mocks.MockFeedToken + ".ics",
+			wantCode: http.StatusOK,
+			wantBody: "UID:appointment-1@calendar-app",
+		},
+		{
+			name:     "Revoked token",
+			urlPath:  "/feeds/oldtoken.ics",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Missing extension",
+			urlPath:  "/feeds/" + mocks.MockFeedToken,
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, header.Get("Content-Type"), "text/calendar; charset=utf-8")
+				assert.StringContains(t, body, "X-WR-CALNAME:Alice's appointments")
+			}
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestDownloadAppointment(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/appointments/ics/1")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Disposition"), `attachment; filename="appointment-1.ics"`)
+	assert.StringContains(t, body, "BEGIN:VEVENT")
+
+	code, _, _ = ts.get(t, "/appointments/ics/99")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	_, _, body = ts.get(t, "/appointments")
+	assert.StringContains(t, body, `href="/appointments/ics/1"`)
+}
+
+func TestCreateCalendarFeed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/settings")
+	assert.StringContains(t, body, "Your feed is on")
+
+	form := url.Values{}
+	form.Add("include_groups", "true")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, body := ts.postForm(t, "/settings/feed", form)
+
+	assert.Equal(t, code, http.StatusCreated)
+	assert.StringContains(t, body, "https://calendar.example.com/feeds/newfeedtoken.ics")
+}
@@ -48,6 +48,8 @@ func (app *application) handleGoogleCalendarCallback(w http.ResponseWriter, r *h
 		return
 	}
 
+	app.linkedCalendar(userID, "google")
+
 	app.sessionManager.Put(r.Context(), "flash", "Google account linked successfully!")
 	// Redirect back to homepage.
 	http.Redirect(w, r, "/", http.StatusSeeOther)
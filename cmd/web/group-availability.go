@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/service"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// The range of a group's availability shown when none is picked.
+const (
+	defaultGroupAvailabilityDays = 7
+	defaultGroupStartHour        = 7
+	defaultGroupEndHour          = 23
+)
+
+// groupHeatmap is a group's availability laid out for the page: a row for
+// each hour, with a cell for each day.
+type groupHeatmap struct {
+	*service.GroupAvailability
+	From      string
+	Days      []time.Time
+	DayCount  int
+	StartHour int
+	EndHour   int
+	Rows      []groupHeatmapRow
+	// Included are the members whose availability is combined.
+	Included map[int]bool
+	// TargetUserID is who a request for a slot is sent to, with the rest of
+	// the group, or 0 if there's nobody else in it.
+	TargetUserID int
+	// RequestOptional are the members a request for a slot marks as
+	// optional: those picked as optional, and those left out.
+	RequestOptional map[int]bool
+}
+
+type groupHeatmapRow struct {
+	Hour  int
+	Cells []groupHeatmapCell
+}
+
+type groupHeatmapCell struct {
+	service.GroupSlot
+	// URL is the page again, with a request for the slot filled in.
+	URL string
+	// Level is how free the slot is, from 0 (nobody) to 4 (everybody).
+	Level int
+}
+
+// readInts returns the integers of a query string parameter that can be
+// given more than once.
+func readInts(qs url.Values, key string, v *validator.Validator) []int {
+	var ints []int
+	for _, s := range qs[key] {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			v.AddFieldError(key, "must be an integer value")
+			return nil
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
+
+// viewGroupAvailability shows how many of a group's members are free in each
+// hour of a range of days. Members can be left out or marked as optional,
+// and picking a slot fills in a request for it to the group.
+func (app *application) viewGroupAvailability(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	qs := r.URL.Query()
+
+	var v validator.Validator
+	q := service.GroupAvailabilityQuery{
+		From:        readTime(qs, "from", &v),
+		Days:        readInt(qs, "days", defaultGroupAvailabilityDays, &v),
+		StartHour:   readInt(qs, "start_hour", defaultGroupStartHour, &v),
+		EndHour:     readInt(qs, "end_hour", defaultGroupEndHour, &v),
+		MemberIDs:   readInts(qs, "member", &v),
+		OptionalIDs: readInts(qs, "optional", &v),
+	}
+	if q.From.IsZero() {
+		q.From = time.Now().UTC()
+	}
+
+	var slot time.Time
+	if s := qs.Get("slot"); s != "" {
+		var err error
+		slot, err = time.Parse("2006-01-02T15:04", s)
+		if err != nil {
+			v.AddFieldError("slot", "must be a time, e.g. 2024-05-11T10:00")
+		}
+	}
+
+	if !v.Valid() {
+		app.clientError(w, http.StatusBadRequest, "Invalid query string")
+		return
+	}
+
+	availability, err := app.service.GroupAvailability(userID, int(groupID), q)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	heatmap := &groupHeatmap{
+		GroupAvailability: availability,
+		From:              q.From.Format("2006-01-02"),
+		DayCount:          q.Days,
+		StartHour:         q.StartHour,
+		EndHour:           q.EndHour,
+		Included:          map[int]bool{},
+		RequestOptional:   map[int]bool{},
+	}
+
+	for _, member := range availability.Members {
+		heatmap.Included[member.ID] = true
+	}
+
+	for _, member := range availability.Group.Members {
+		if member.ID == userID {
+			continue
+		}
+		if !heatmap.Included[member.ID] || availability.Optional[member.ID] {
+			heatmap.RequestOptional[member.ID] = true
+		}
+	}
+
+	// The request goes to someone who has to come, if there is anyone.
+	for _, member := range availability.Group.Members {
+		if member.ID != userID && !heatmap.RequestOptional[member.ID] {
+			heatmap.TargetUserID = member.ID
+			break
+		}
+	}
+	if heatmap.TargetUserID == 0 {
+		for _, member := range availability.Group.Members {
+			if member.ID != userID {
+				heatmap.TargetUserID = member.ID
+				delete(heatmap.RequestOptional, member.ID)
+				break
+			}
+		}
+	}
+
+	for _, day := range availability.Slots {
+		if len(day) > 0 {
+			heatmap.Days = append(heatmap.Days, day[0].Start)
+		}
+	}
+
+	for hour := 0; hour < q.EndHour-q.StartHour; hour++ {
+		row := groupHeatmapRow{Hour: q.StartHour + hour}
+		for _, day := range availability.Slots {
+			cell := groupHeatmapCell{GroupSlot: day[hour]}
+			if cell.Total > 0 {
+				cell.Level = cell.Free * 4 / cell.Total
+			}
+
+			qs.Set("slot", cell.Start.Format("2006-01-02T15:04"))
+			cell.URL = fmt.Sprintf("/groups/availability/%d?%s#request", groupID, qs.Encode())
+
+			row.Cells = append(row.Cells, cell)
+		}
+		heatmap.Rows = append(heatmap.Rows, row)
+	}
+
+	form := appointmentRequestCreateForm{GroupID: availability.Group.ID}
+	if !slot.IsZero() {
+		form.StartTime = slot.Format("2006-01-02T15:04")
+		form.EndTime = slot.Add(time.Hour).Format("2006-01-02T15:04")
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.Group = availability.Group
+	templateData.GroupHeatmap = heatmap
+	templateData.Form = form
+	app.render(w, http.StatusOK, "group-availability.tmpl", templateData)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/ical"
+)
+
+type groupCalendarForm struct {
+	Enabled bool `form:"enabled"`
+}
+
+// setGroupCalendar turns a group's shared calendar on or off.
+func (app *application) setGroupCalendar(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	var form groupCalendarForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.SetGroupCalendar(userID, int(groupID), form.Enabled)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	if form.Enabled {
+		app.sessionManager.Put(r.Context(), "flash", "Group calendar turned on.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Group calendar turned off.")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
+}
+
+// createGroupCalendarFeed gives the user a feed of a group's calendar, or a
+// new URL for theirs. As with their own feed, the URL is shown straight away
+// as it can't be shown again.
+func (app *application) createGroupCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	feed, err := app.service.CreateGroupCalendarFeed(userID, int(groupID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	templateData, err := app.groupPageData(r, userID, int(groupID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+	templateData.NewFeedURL = app.baseURL + "/groups/feeds/" + feed.Token + ".ics"
+
+	app.render(w, http.StatusCreated, "group.tmpl", templateData)
+}
+
+func (app *application) deleteGroupCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	err = app.service.DeleteGroupCalendarFeed(userID, int(groupID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Group calendar feed turned off.")
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
+}
+
+// viewGroupCalendarFeed serves a group's shared calendar to the calendar app
+// of a member who has subscribed to it. Like viewCalendarFeed, the secret
+// token in the URL is the only authentication. Feeds are deleted when their
+// member leaves or the calendar is turned off.
+func (app *application) viewGroupCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	token, ok := strings.CutSuffix(params.ByName("token"), ".ics")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	feed, err := app.models.GroupCalendarFeeds.GetByToken(token)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	group, err := app.models.Groups.Get(feed.GroupID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !group.CalendarEnabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	appointments, err := app.models.Appointments.GetForGroup(group.ID, time.Now().AddDate(-1, 0, 0))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	calendar := ical.Calendar{Name: group.Name}
+	for _, a := range appointments {
+		calendar.Events = append(calendar.Events, icalEvent(a))
+	}
+
+	// The URL is a secret, so it shouldn't be kept by shared caches.
+	w.Header().Set("Cache-Control", "private, max-age=300")
+
+	err = writeCalendar(w, calendar)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/service"
+)
+
+// sendGroupInvitationEmail emails the invitee links to accept or decline the
+// invitation without logging in.
+func (app *application) sendGroupInvitationEmail(inv *data.GroupInvitation) error {
+	type EmailData struct {
+		InviterName string
+		GroupName   string
+		AcceptURL   string
+		DeclineURL  string
+		SignupURL   string
+		Days        int
+	}
+
+	respondURL := app.baseURL + "/invitations/respond?token=" + url.QueryEscape(inv.Plaintext)
+
+	return app.mailer.Send(inv.Email, "group-invitation.tmpl", EmailData{
+		InviterName: inv.InviterName,
+		GroupName:   inv.GroupName,
+		AcceptURL:   respondURL + "&response=" + service.InvitationAccept,
+		DeclineURL:  respondURL + "&response=" + service.InvitationDecline,
+		SignupURL:   app.baseURL + "/user/signup",
+		Days:        int(service.GroupInvitationTTL.Hours() / 24),
+	})
+}
+
+// joinInvitedGroups adds a user who has just confirmed their email address
+// to the groups it was invited to, and returns how many they joined. The
+// user can still be invited again, so a failure is only logged.
+func (app *application) joinInvitedGroups(userID int) int {
+	n, err := app.service.JoinInvitedGroups(userID)
+	if err != nil {
+		app.errorLog.Printf("Error joining user %d to the groups they were invited to: %v\n", userID, err)
+	}
+	return n
+}
+
+// viewInvitationsPage lists the invitations to the user's groups they haven't
+// answered yet.
+func (app *application) viewInvitationsPage(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	invitations, err := app.service.GetMyGroupInvitations(userID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.GroupInvitations = invitations
+	app.render(w, http.StatusOK, "invitations.tmpl", templateData)
+}
+
+func (app *application) acceptGroupInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	invitationID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid invitation ID in URL")
+		return
+	}
+
+	inv, err := app.service.AcceptGroupInvitation(userID, int(invitationID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You've joined %s.", inv.GroupName))
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", inv.GroupID), http.StatusSeeOther)
+}
+
+func (app *application) declineGroupInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	invitationID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid invitation ID in URL")
+		return
+	}
+
+	err = app.service.DeclineGroupInvitation(userID, int(invitationID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Invitation declined.")
+	http.Redirect(w, r, "/invitations", http.StatusSeeOther)
+}
+
+// cancelGroupInvitationForm picks the invitation to a group to withdraw.
+type cancelGroupInvitationForm struct {
+	InvitationID int `form:"invitation_id"`
+}
+
+func (app *application) cancelGroupInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	var form cancelGroupInvitationForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.CancelGroupInvitation(userID, int(groupID), form.InvitationID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Invitation cancelled.")
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
+}
+
+type invitationResponseForm struct {
+	Token    string `form:"token"`
+	Response string `form:"response"`
+	// HasAccount is whether the invited address has an account yet. Without
+	// one the invitation can only be declined.
+	HasAccount bool `form:"-"`
+}
+
+// respondToInvitation shows the page the links in an invitation email lead
+// to. The answer is only recorded once the form on it is sent, so a mail
+// scanner following the links doesn't answer for the invitee.
+func (app *application) respondToInvitation(w http.ResponseWriter, r *http.Request) {
+	form := invitationResponseForm{
+		Token:    r.URL.Query().Get("token"),
+		Response: r.URL.Query().Get("response"),
+	}
+
+	inv, err := app.service.GetGroupInvitationByToken(form.Token)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(inv.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) && !errors.Is(err, sql.ErrNoRows) {
+		app.serverError(w, err)
+		return
+	}
+	form.HasAccount = err == nil
+
+	templateData := app.newTemplateData(r)
+	templateData.Form = form
+	templateData.GroupInvitation = inv
+	app.render(w, http.StatusOK, "invitation-respond.tmpl", templateData)
+}
+
+func (app *application) respondToInvitationPost(w http.ResponseWriter, r *http.Request) {
+	var form invitationResponseForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	inv, err := app.service.RespondToGroupInvitationByToken(form.Token, form.Response)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	if form.Response == service.InvitationDecline {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You've declined the invitation to %s.", inv.GroupName))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You've joined %s.", inv.GroupName))
+
+	if !app.isAuthenticated(r) {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/groups", http.StatusSeeOther)
+}
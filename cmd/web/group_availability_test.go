@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestGroupAvailability(t *testing.T) {
+	app := newTestApplication(t)
+	// Alice owns group 3, with Bob and Carol in it.
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/groups/availability/3?from=2030-05-11&days=2&start_hour=9&end_hour=11&optional=3&slot=2030-05-11T09:00")
+	assert.Equal(t, code, http.StatusOK)
+
+	// Every member is free, and picking a slot keeps the filters.
+	assert.StringContains(t, body, "3/3")
+	assert.StringContains(t, body, "slot=2030-05-12T10%3A00")
+	assert.StringContains(t, body, "optional=3")
+
+	// The picked slot is filled in, for Bob with Carol optional.
+	assert.StringContains(t, body, `action="/appointments/create/2"`)
+	assert.StringContains(t, body, `value="2030-05-11T09:00"`)
+	assert.StringContains(t, body, `value="2030-05-11T10:00"`)
+	assert.StringContains(t, body, `name="optional_user_ids" value="3" checked`)
+
+	// Leaving Bob out makes him optional too.
+	_, _, body = ts.get(t, "/groups/availability/3?member=1&member=3")
+	assert.StringContains(t, body, "2/2")
+	assert.StringContains(t, body, `action="/appointments/create/3"`)
+	assert.StringContains(t, body, `name="optional_user_ids" value="2" checked`)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Bad days", "/groups/availability/3?days=abc", http.StatusBadRequest},
+		{"Bad slot", "/groups/availability/3?slot=noon", http.StatusBadRequest},
+		{"Too many days", "/groups/availability/3?days=100", http.StatusUnprocessableEntity},
+		{"Non-member", "/groups/availability/3?member=4", http.StatusUnprocessableEntity},
+		{"Unknown group", "/groups/availability/2", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestViewGroupCalendarFeed(t *testing.T) {
+	app := newTestApplication(t)
+	// Calendar apps don't have a session.
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/groups/feeds/"+mocks.MockGroupFeedToken+".ics")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "text/calendar; charset=utf-8")
+	assert.StringContains(t, body, "X-WR-CALNAME:Team")
+	assert.StringContains(t, body, "UID:appointment-2@calendar-app")
+
+	code, _, _ = ts.get(t, "/groups/feeds/oldtoken.ics")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// The group feed tokens aren't personal feed tokens.
+	code, _, _ = ts.get(t, "/feeds/"+mocks.MockGroupFeedToken+".ics")
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestGroupCalendar(t *testing.T) {
+	app := newTestApplication(t)
+	// Carol is a plain member of group 3, which has a calendar.
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(3, app.routes())))
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/groups/view/3")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Team Standup")
+	assert.StringContains(t, body, "Subscribe to this calendar")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	// Members can download the group's appointments they aren't part of.
+	code, _, _ = ts.get(t, "/appointments/ics/2")
+	assert.Equal(t, code, http.StatusOK)
+
+	groups := app.models.Groups.(*mocks.GroupModel)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		enabled  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Subscribe",
+			urlPath:  "/groups/feed/3",
+			wantCode: http.StatusCreated,
+			wantBody: "https://calendar.example.com/groups/feeds/newgroupfeedtoken.ics",
+		},
+		{"Turn off feed", "/groups/delete-feed/3", "", http.StatusSeeOther, ""},
+		{"Member turns off calendar", "/groups/calendar/3", "false", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+			form.Add("enabled", tt.enabled)
+
+			code, _, body := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	assert.Equal(t, len(groups.Calendars), 0)
+}
+
+func TestSetGroupCalendar(t *testing.T) {
+	app := newTestApplication(t)
+	// Alice owns group 1, which has no calendar.
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/groups/view/1")
+	assert.StringContains(t, body, "doesn't have a shared calendar")
+	assert.StringContains(t, body, "Turn on calendar")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ := ts.postForm(t, "/groups/feed/1", form)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	form.Add("enabled", "true")
+	code, _, _ = ts.postForm(t, "/groups/calendar/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	groups := app.models.Groups.(*mocks.GroupModel)
+	assert.Equal(t, groups.Calendars[1], true)
+}
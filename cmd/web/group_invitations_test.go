@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestInviteToGroup(t *testing.T) {
+	app := newTestApplication(t)
+	mailer := &recordingMailer{}
+	app.mailer = mailer
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	// Alice owns group 1, which has invitations out to Bob and Dave.
+	_, _, body := ts.get(t, "/groups/view/1")
+	assert.StringContains(t, body, "Pending Invitations")
+	assert.StringContains(t, body, "dave@example.com")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+	}{
+		{"Address without an account", "erin@example.com", http.StatusSeeOther},
+		{"Existing member", "alice@example.com", http.StatusConflict},
+		{"Invalid address", "erin", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+			form.Add("email", tt.email)
+
+			code, _, _ := ts.postForm(t, "/groups/invite/1", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	// Nobody is added until they accept.
+	invitations := app.models.GroupInvitations.(*mocks.GroupInvitationModel)
+	assert.Equal(t, len(invitations.Inserted), 1)
+	assert.Equal(t, len(invitations.Accepted), 0)
+
+	assert.Equal(t, len(mailer.sent), 1)
+	assert.Equal(t, mailer.sent[0].recipient, "erin@example.com")
+	assert.Equal(t, mailer.sent[0].templateFile, "group-invitation.tmpl")
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+	form.Add("invitation_id", "2")
+
+	code, header, _ := ts.postForm(t, "/groups/cancel-invitation/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/groups/view/1")
+	assert.Equal(t, len(invitations.Deleted), 1)
+	assert.Equal(t, invitations.Deleted[0], 2)
+}
+
+func TestInvitationsInbox(t *testing.T) {
+	app := newTestApplication(t)
+	// Bob has been invited to group 1.
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(2, app.routes())))
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/invitations")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Test Group")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Accept", "/invitations/accept/1", http.StatusSeeOther, "/groups/view/1"},
+		{"Decline someone else's", "/invitations/decline/2", http.StatusNotFound, ""},
+		{"Decline", "/invitations/decline/1", http.StatusSeeOther, "/invitations"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	invitations := app.models.GroupInvitations.(*mocks.GroupInvitationModel)
+	assert.Equal(t, len(invitations.Accepted), 1)
+	assert.Equal(t, len(invitations.Deleted), 1)
+}
+
+func TestRespondToInvitation(t *testing.T) {
+	app := newTestApplication(t)
+	// Following the emailed links doesn't need a login.
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/invitations/respond?response=accept&token="+mocks.MockGroupInvitationToken)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Join Test Group?")
+	assert.StringContains(t, body, `value="accept"`)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	// Dave has no account, so he can only sign up or decline.
+	_, _, body = ts.get(t, "/invitations/respond?response=accept&token="+mocks.MockGroupInvitationTokenNoUser)
+	assert.StringContains(t, body, "Sign up")
+	if strings.Contains(body, `value="accept"`) {
+		t.Error("an invitation to an address without an account can be accepted")
+	}
+
+	code, _, _ = ts.get(t, "/invitations/respond?token=unknown")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	tests := []struct {
+		name         string
+		token        string
+		response     string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Accept", mocks.MockGroupInvitationToken, "accept", http.StatusSeeOther, "/user/login"},
+		{"Accept without an account", mocks.MockGroupInvitationTokenNoUser, "accept", http.StatusUnprocessableEntity, ""},
+		{"Decline without an account", mocks.MockGroupInvitationTokenNoUser, "decline", http.StatusSeeOther, "/"},
+		{"Unknown token", "unknown", "decline", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+			form.Add("token", tt.token)
+			form.Add("response", tt.response)
+
+			code, header, _ := ts.postForm(t, "/invitations/respond", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	invitations := app.models.GroupInvitations.(*mocks.GroupInvitationModel)
+	assert.Equal(t, len(invitations.Accepted), 1)
+	assert.Equal(t, invitations.Accepted[0], 1)
+	assert.Equal(t, len(invitations.Deleted), 1)
+	assert.Equal(t, invitations.Deleted[0], 2)
+}
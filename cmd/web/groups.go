@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
+	"github.com/tmgasek/calendar-app/internal/data"
 	"github.com/tmgasek/calendar-app/internal/validator"
 )
 
@@ -32,7 +34,6 @@ func (app *application) viewGroupsPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) viewOneGroupPage(w http.ResponseWriter, r *http.Request) {
-	templateData := app.newTemplateData(r)
 	userID := app.sessionManager.Get(r.Context(), "authenticatedUserID").(int)
 
 	groupID, err := app.readIDParam(r)
@@ -41,34 +42,53 @@ func (app *application) viewOneGroupPage(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	group, err := app.models.Groups.Get(int(groupID))
+	templateData, err := app.groupPageData(r, userID, int(groupID))
 	if err != nil {
-		// app.serverError(w, err)
-		app.clientError(w, http.StatusNotFound, "Group not found")
+		app.serviceError(w, err)
 		return
 	}
 
-	// Check if user is in group.Members
-	isMember := false
+	app.render(w, http.StatusOK, "group.tmpl", templateData)
+}
+
+// groupPageData gathers what the group page shows the user: the group, their
+// role in it, and depending on those its pending invitations and its shared
+// calendar.
+func (app *application) groupPageData(r *http.Request, userID, groupID int) (*templateData, error) {
+	templateData := app.newTemplateData(r)
+
+	group, err := app.service.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	templateData.Group = group
 	for _, member := range group.Members {
 		if member.ID == userID {
-			isMember = true
-			break
+			templateData.GroupRole = member.Role
 		}
 	}
 
-	if !isMember {
-		app.clientError(w, http.StatusForbidden, "You are not a member of this group")
-		return
+	if templateData.GroupRole == data.GroupRoleOwner || templateData.GroupRole == data.GroupRoleAdmin {
+		templateData.GroupInvitations, err = app.service.GetGroupInvitations(userID, group.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if group == nil {
-		app.clientError(w, http.StatusNotFound, "Group not found")
-		return
+	if group.CalendarEnabled {
+		templateData.GroupAppointments, err = app.service.GetUpcomingGroupAppointments(userID, group.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		templateData.GroupCalendarFeed, err = app.service.GetGroupCalendarFeed(userID, group.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	templateData.Group = group
-	app.render(w, http.StatusOK, "group.tmpl", templateData)
+	return templateData, nil
 }
 
 // include struct tags to tell the decoder how to map HTML form vals to
@@ -89,20 +109,9 @@ func (app *application) createGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate the form.
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Name, 50), "name", "This field is too long")
-	form.CheckField(validator.NotBlank(form.Description), "description", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Description, 1000), "description", "This field is too long")
-
-	if !form.Valid() {
-		app.clientError(w, http.StatusUnprocessableEntity, "Invalid form data")
-		return
-	}
-
-	_, err = app.models.Groups.Insert(userID, form.Name, form.Description)
+	_, err = app.service.CreateGroup(userID, form.Name, form.Description)
 	if err != nil {
-		app.serverError(w, err)
+		app.serviceError(w, err)
 		return
 	}
 
@@ -130,30 +139,163 @@ func (app *application) inviteUserToGroup(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get the group by ID.
-	group, err := app.models.Groups.Get(int(groupID))
-	// Check if the currUser is a member of the group.
-	isMember := false
-	for _, member := range group.Members {
-		if member.ID == currUserID {
-			isMember = true
-			break
-		}
+	inv, err := app.service.InviteToGroup(currUserID, int(groupID), form.Email)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	// The invitation shows in the inbox of an existing account either way,
+	// and inviting the address again sends a new email, so a failure here is
+	// only logged.
+	err = app.sendGroupInvitationEmail(inv)
+	if err != nil {
+		app.errorLog.Printf("Error sending invitation %d to group %d: %v\n", inv.ID, inv.GroupID, err)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Invitation sent to %s.", inv.Email))
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
+}
+
+func (app *application) editGroup(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
 	}
-	if !isMember {
-		app.clientError(w, http.StatusForbidden, "You are not a member of this group, can't invite!")
+
+	var form createGroupForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
-	// Get the user by email.
-	user, err := app.models.Users.GetByEmail(form.Email)
-	err = app.models.Groups.AddMember(int(groupID), user.ID)
+	err = app.service.UpdateGroup(userID, int(groupID), form.Name, form.Description)
 	if err != nil {
-		app.serverError(w, err)
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Group updated.")
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
+}
+
+func (app *application) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	err = app.service.DeleteGroup(userID, int(groupID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Group deleted.")
+	http.Redirect(w, r, "/groups", http.StatusSeeOther)
+}
+
+func (app *application) leaveGroup(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	err = app.service.LeaveGroup(userID, int(groupID))
+	if err != nil {
+		app.serviceError(w, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "User invited to group successfully!")
+	app.sessionManager.Put(r.Context(), "flash", "You've left the group.")
 	http.Redirect(w, r, "/groups", http.StatusSeeOther)
+}
+
+// groupMemberForm picks a member of a group to act on, and for role changes
+// their new role.
+type groupMemberForm struct {
+	UserID int    `form:"user_id"`
+	Role   string `form:"role"`
+}
+
+func (app *application) removeGroupMember(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	var form groupMemberForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.RemoveGroupMember(userID, int(groupID), form.UserID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Member removed from the group.")
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
+}
+
+func (app *application) setGroupMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	var form groupMemberForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.SetGroupMemberRole(userID, int(groupID), form.UserID, form.Role)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Member's role changed.")
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
+}
+
+func (app *application) transferGroupOwnership(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid group ID in URL")
+		return
+	}
+
+	var form groupMemberForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.TransferGroupOwnership(userID, int(groupID), form.UserID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
 
+	app.sessionManager.Put(r.Context(), "flash", "Ownership of the group transferred.")
+	http.Redirect(w, r, fmt.Sprintf("/groups/view/%d", groupID), http.StatusSeeOther)
 }
@@ -3,9 +3,11 @@ package main
 import (
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
 )
 
 func TestAuthedGroupView(t *testing.T) {
@@ -133,3 +135,94 @@ func TestGroupCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestGroupViewByRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     int
+		wantBody   []string
+		hiddenBody []string
+	}{
+		{
+			name:       "Owner",
+			userID:     1,
+			wantBody:   []string{"/groups/invite/3", "/groups/delete/3", "/groups/transfer/3", "Bob (bob@example.com) - admin"},
+			hiddenBody: []string{"/groups/leave/3"},
+		},
+		{
+			name:       "Admin",
+			userID:     2,
+			wantBody:   []string{"/groups/invite/3", "/groups/edit/3", "/groups/remove/3", "/groups/leave/3"},
+			hiddenBody: []string{"/groups/delete/3", "/groups/transfer/3"},
+		},
+		{
+			name:       "Member",
+			userID:     3,
+			wantBody:   []string{"/groups/leave/3"},
+			hiddenBody: []string{"/groups/invite/3", "/groups/edit/3", "/groups/remove/3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(tt.userID, app.routes())))
+			defer ts.Close()
+
+			code, _, body := ts.get(t, "/groups/view/3")
+			assert.Equal(t, code, http.StatusOK)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+			for _, hidden := range tt.hiddenBody {
+				if strings.Contains(body, hidden) {
+					t.Errorf("body contains %q", hidden)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupMemberManagement(t *testing.T) {
+	app := newTestApplication(t)
+	// Bob is an admin of group 3.
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(2, app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/groups/view/3")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	groups := app.models.Groups.(*mocks.GroupModel)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		userID   string
+		wantCode int
+	}{
+		{"Remove member", "/groups/remove/3", "3", http.StatusSeeOther},
+		{"Remove owner", "/groups/remove/3", "1", http.StatusForbidden},
+		{"Make admin", "/groups/role/3", "3", http.StatusForbidden},
+		{"Transfer ownership", "/groups/transfer/3", "3", http.StatusForbidden},
+		{"Delete group", "/groups/delete/3", "", http.StatusForbidden},
+		{"Leave group", "/groups/leave/3", "", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+			form.Add("user_id", tt.userID)
+			form.Add("role", "admin")
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	// Carol was removed, then Bob left.
+	assert.Equal(t, len(groups.Removed), 2)
+	assert.Equal(t, groups.Removed[0], 3)
+	assert.Equal(t, groups.Removed[1], 2)
+	assert.Equal(t, len(groups.Deleted), 0)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/tmgasek/calendar-app/internal/data"
@@ -67,10 +68,39 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked out logins are turned away before the password is checked, as
+	// checking it is the expensive part.
+	lockedUntil, err := app.loginLockedUntil(r, form.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		err = app.loginFailed(r, form.Email, data.LoginFailureLockedOut)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.loginLockedOut(w, r, form, lockedUntil)
+		return
+	}
+
 	// Check if credentials are valid. If not, add generic non field err.
 	id, err := app.models.Users.Authenticate(form.Email, form.Password)
 	if err != nil {
-		if errors.Is(err, data.ErrInvalidCredentials) {
+		if errors.Is(err, data.ErrUserDisabled) {
+			form.AddNonFieldError("This account has been disabled. Please contact your administrator.")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusForbidden, "login.tmpl", data)
+		} else if errors.Is(err, data.ErrInvalidCredentials) {
+			err = app.loginFailed(r, form.Email, data.LoginFailureWrongPassword)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
 			form.AddNonFieldError("Email or password is incorrect")
 
 			data := app.newTemplateData(r)
@@ -82,19 +112,106 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Change session ID. Good practice to do when auth / privilege state changes.
-	err = app.sessionManager.RenewToken(r.Context())
+	// Users with two-factor authentication still have to enter a code before
+	// they are logged in. Their failures are only forgotten once they have, so
+	// the code can't be guessed by logging in again between tries.
+	twoFactor, err := app.hasTwoFactor(id)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	if twoFactor {
+		err = app.startTwoFactorLogin(r, id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
 
-	// Add ID of current user to session, so they are now "logged in".
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	err = app.models.LoginThrottles.Reset(accountLoginKey(form.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// hasTwoFactor reports whether the user has to enter a code to log in.
+func (app *application) hasTwoFactor(userID int) (bool, error) {
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return tf.Enabled(), nil
+}
+
+// logIn starts an authenticated session for the user.
+func (app *application) logIn(r *http.Request, userID int) error {
+	// Change session ID. Good practice to do when auth / privilege state changes.
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// Record where the user logged in, so they can see the session and end
+	// it. The session is only logged in while the record is there.
+	session := &data.UserSession{
+		UserID:    userID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: time.Now().Add(app.sessionManager.Lifetime),
+	}
+
+	err = app.models.UserSessions.Insert(session)
+	if err != nil {
+		return err
+	}
+
+	// Add ID of current user to session, so they are now "logged in".
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+	app.sessionManager.Put(r.Context(), "sessionID", session.ID)
+
+	return nil
+}
+
+// logOut ends the session of the request, if it's logged in. An admin
+// impersonating someone ends their own session.
+func (app *application) logOut(r *http.Request) error {
+	userID := app.sessionOwnerID(r)
+	sessionID := app.sessionManager.GetInt(r.Context(), "sessionID")
+
+	if userID != 0 && sessionID != 0 {
+		err := app.models.UserSessions.Delete(sessionID, userID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "sessionID")
+	app.sessionManager.Remove(r.Context(), "impersonatorID")
+
+	return nil
+}
+
 type userSignupForm struct {
 	Name                string `form:"name"`
 	Email               string `form:"email"`
@@ -130,7 +247,7 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Users.Insert(form.Name, form.Email, form.Password)
+	id, err := app.models.Users.Insert(form.Name, form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, data.ErrDuplicateEmail) {
 			form.AddFieldError("email", "Email address already in use!")
@@ -144,19 +261,25 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Signup successful! Please login.")
+	// The account exists either way, and another email can be sent from the
+	// settings page, so a failure here is only logged.
+	err = app.sendActivationEmail(id, form.Name, form.Email)
+	if err != nil {
+		app.errorLog.Printf("Error sending activation email to user %d: %v\n", id, err)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Signup successful! Check your email for a link to confirm your address, then login.")
 
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	err := app.sessionManager.RenewToken(r.Context())
+	err := app.logOut(r)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
 	app.sessionManager.Put(r.Context(), "flash", "Log out successful!")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -9,16 +9,32 @@ import (
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/service"
 )
 
 // returns pointer to templateData struct inited with curr year.
 func (app *application) newTemplateData(r *http.Request) *templateData {
-	return &templateData{
+	td := &templateData{
 		IsAuthenticated: app.isAuthenticated(r),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		CSRFToken:       nosurf.Token(r),
 		UserId:          app.sessionManager.GetInt(r.Context(), "authenticatedUserID"),
+		ImpersonatorID:  app.sessionManager.GetInt(r.Context(), "impersonatorID"),
+		LoginProviders:  app.loginProviders,
 	}
+
+	// The count in the nav is only a hint, so the page is still shown
+	// without it.
+	if td.IsAuthenticated {
+		count, err := app.models.AppointmentRequests.CountPendingForUser(td.UserId)
+		if err != nil {
+			app.errorLog.Printf("Error counting pending requests for user %d: %v\n", td.UserId, err)
+		}
+		td.PendingRequests = count
+	}
+
+	return td
 }
 
 // Easily render templates from the cache
@@ -81,6 +97,31 @@ func (app *application) clientError(w http.ResponseWriter, status int, message s
 	app.render(w, status, "error.tmpl", &templateData{ErrorData: data})
 }
 
+// serviceErrorStatus returns the HTTP status for an error the service layer
+// blames on the caller.
+func serviceErrorStatus(err *service.Error) int {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// serviceError writes the error page for an error from the service layer.
+func (app *application) serviceError(w http.ResponseWriter, err error) {
+	var serviceErr *service.Error
+	if errors.As(err, &serviceErr) {
+		app.clientError(w, serviceErrorStatus(serviceErr), serviceErr.Message)
+		return
+	}
+	app.serverError(w, err)
+}
+
 // DST is target destination that we want to decode the form data into.
 func (app *application) decodePostForm(r *http.Request, dst any) error {
 	err := r.ParseForm()
@@ -104,6 +145,27 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// authenticatedUserID returns the ID of the user making the request, whether
+// they sent a session cookie or an API token.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if token, ok := r.Context().Value(apiTokenContextKey).(*data.APIToken); ok {
+		return token.UserID
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
+// sessionOwnerID returns the ID of the user whose session the request is
+// in: the admin while they're impersonating someone, else the logged in
+// user.
+func (app *application) sessionOwnerID(r *http.Request) int {
+	if adminID := app.sessionManager.GetInt(r.Context(), "impersonatorID"); adminID != 0 {
+		return adminID
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
 // Return true if curr req is coming from an authenticated user, else false.
 func (app *application) isAuthenticated(r *http.Request) bool {
 	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
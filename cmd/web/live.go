@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// liveHeartbeat is how often a comment is sent down an idle event stream, so
+// proxies don't close it.
+const liveHeartbeat = 30 * time.Second
+
+// requestChanged lets everyone on an appointment request know it changed:
+// the event, unless it's "", goes to their webhooks, and their open pages are
+// updated. A confirmed request, or one whose appointment was rolled back,
+// also changes their availability.
+func (app *application) requestChanged(event string, requestID int) {
+	request, err := app.models.AppointmentRequests.Get(requestID)
+	if err != nil {
+		app.errorLog.Printf("Error loading appointment request %d after a change: %v\n", requestID, err)
+		return
+	}
+
+	userIDs := []int{request.RequesterID}
+	for _, p := range request.Participants {
+		userIDs = append(userIDs, p.UserID)
+	}
+
+	if event != "" {
+		app.emitWebhookEvent(event, userIDs, request.GroupID, envelope{"appointment_request": newAPIAppointmentRequest(request)})
+	}
+
+	for _, userID := range userIDs {
+		count, err := app.models.AppointmentRequests.CountPendingForUser(userID)
+		if err != nil {
+			app.errorLog.Printf("Error counting pending requests for user %d: %v\n", userID, err)
+			continue
+		}
+		app.publish(userID, "requests", envelope{"request_id": request.RequestID, "status": request.Status, "pending": count})
+	}
+
+	if request.AppointmentID != 0 {
+		app.availabilityChanged(userIDs...)
+	}
+}
+
+// appointmentChanged sends the event for an appointment to the webhooks of
+// its creator, its target and its group, and updates their availability.
+func (app *application) appointmentChanged(event string, appointment *data.Appointment) {
+	userIDs := []int{appointment.CreatorID, appointment.TargetID}
+	app.emitWebhookEvent(event, userIDs, appointment.GroupID, envelope{"appointment": newAPIAppointment(appointment)})
+	app.availabilityChanged(userIDs...)
+}
+
+// availabilityChanged tells those looking at the users' availability to
+// reload it. Only the connected users who can find a user are told, so
+// nobody hears about people in organisations they can't see.
+func (app *application) availabilityChanged(userIDs ...int) {
+	viewerIDs := app.hub.Subscribers()
+	if len(viewerIDs) == 0 {
+		return
+	}
+
+	for _, userID := range userIDs {
+		reachers, err := app.models.Users.Reachers(userID, viewerIDs)
+		if err != nil {
+			app.errorLog.Printf("Error finding who can see user %d's availability: %v\n", userID, err)
+			continue
+		}
+
+		for _, viewerID := range reachers {
+			app.publish(viewerID, "availability", envelope{"user_id": userID})
+		}
+	}
+}
+
+func (app *application) publish(userID int, name string, payload envelope) {
+	err := app.hub.Publish(userID, name, payload)
+	if err != nil {
+		app.errorLog.Printf("Error publishing %s event: %v\n", name, err)
+	}
+}
+
+// liveEvents streams the user's events to the page as server-sent events.
+// Browsers reconnect on their own and send the ID of the last event they got,
+// so the ones missed in between are replayed.
+func (app *application) liveEvents(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var lastID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			app.clientError(w, http.StatusBadRequest, "Invalid Last-Event-ID header")
+			return
+		}
+		lastID = id
+	}
+
+	// The stream stays open far longer than the server's write timeout.
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	replay, events, cancel := app.hub.Subscribe(userID, lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriter(w)
+	send := func() error {
+		err := bw.Flush()
+		if err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	bw.WriteString("retry: 5000\n\n")
+	for _, e := range replay {
+		e.WriteTo(bw)
+	}
+	if send() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			// The hub dropped us for falling behind; the browser will
+			// reconnect and replay what it missed.
+			if !ok {
+				return
+			}
+			e.WriteTo(bw)
+		case <-heartbeat.C:
+			bw.WriteString(": ping\n\n")
+		}
+
+		if send() != nil {
+			return
+		}
+	}
+}
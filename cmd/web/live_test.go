@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+// readEvents reads n events from an event stream, skipping comments and the
+// retry field, and returns their lines joined by "|".
+func readEvents(t *testing.T, sc *bufio.Scanner, n int) []string {
+	var events []string
+	var lines []string
+
+	for len(events) < n && sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if len(lines) > 0 {
+				events = append(events, strings.Join(lines, "|"))
+				lines = nil
+			}
+		case strings.HasPrefix(line, ":"), strings.HasPrefix(line, "retry:"):
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func TestLiveEvents(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	app.hub.Publish(2, "requests", envelope{"pending": 1})
+	app.hub.Publish(1, "requests", envelope{"pending": 0})
+	app.hub.Publish(0, "availability", envelope{"user_id": 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "1")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	assert.Equal(t, rs.StatusCode, http.StatusOK)
+	assert.Equal(t, rs.Header.Get("Content-Type"), "text/event-stream")
+
+	sc := bufio.NewScanner(rs.Body)
+
+	// The missed events for user 1 are replayed, then new ones follow.
+	events := readEvents(t, sc, 2)
+	assert.Equal(t, len(events), 2)
+	assert.Equal(t, events[0], `id: 2|event: requests|data: {"pending":0}`)
+	assert.Equal(t, events[1], `id: 3|event: availability|data: {"user_id":2}`)
+
+	app.hub.Publish(2, "requests", envelope{"pending": 2})
+	app.hub.Publish(1, "requests", envelope{"pending": 1})
+
+	events = readEvents(t, sc, 1)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0], `id: 5|event: requests|data: {"pending":1}`)
+}
+
+func TestLiveEventsInvalidLastEventID(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "abc")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	assert.Equal(t, rs.StatusCode, http.StatusBadRequest)
+}
+
+func TestCancelRequestPublishesLiveEvent(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, bob, cancel := app.hub.Subscribe(2, 0)
+	defer cancel()
+
+	_, _, body := ts.get(t, "/requests/outgoing")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ := ts.postForm(t, "/requests/1/cancel", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	select {
+	case e := <-bob:
+		assert.Equal(t, e.Name, "requests")
+		assert.StringContains(t, string(e.Data), `"pending":1`)
+	default:
+		t.Fatal("no event published for the participant")
+	}
+}
+
+func TestAvailabilityChanged(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, alice, cancel := app.hub.Subscribe(1, 0)
+	defer cancel()
+	_, oscar, cancelOscar := app.hub.Subscribe(5, 0)
+	defer cancelOscar()
+
+	// Bob is in Alice's organisation and Oscar in another one, so each is
+	// only told about their own side.
+	app.availabilityChanged(2, 5)
+
+	assert.Equal(t, len(alice), 1)
+	e := <-alice
+	assert.Equal(t, e.Name, "availability")
+	assert.Equal(t, string(e.Data), `{"user_id":2}`)
+
+	assert.Equal(t, len(oscar), 1)
+	e = <-oscar
+	assert.Equal(t, string(e.Data), `{"user_id":5}`)
+}
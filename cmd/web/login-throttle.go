@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// Limits on failed logins, which are counted across every instance of the
+// app. An account is locked out after a few, so its password can't be
+// guessed; an address after many more, so it can't try lots of accounts or
+// tie up the CPU hashing passwords.
+var (
+	accountLoginLimit = data.LoginLimit{Threshold: 5, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour}
+	ipLoginLimit      = data.LoginLimit{Threshold: 50, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour}
+)
+
+// clientIP returns the address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Keys failed logins are counted under. Emails are counted whether or not
+// there's an account, so lockouts don't give away which addresses have one.
+func accountLoginKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockedUntil returns when the lockout of the login's account or
+// address ends, or the zero time if neither is locked out.
+func (app *application) loginLockedUntil(r *http.Request, email string) (time.Time, error) {
+	return app.models.LoginThrottles.LockedUntil(ipLoginKey(clientIP(r)), accountLoginKey(email))
+}
+
+// loginFailed records a failed login in the audit log. Wrong passwords and
+// two-factor codes are also counted towards a lockout, and the user is emailed when their account
+// is first locked out. Tries while locked out aren't counted, or anyone could
+// keep an account locked forever.
+func (app *application) loginFailed(r *http.Request, email, reason string) error {
+	ip := clientIP(r)
+
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		user = nil
+	}
+
+	failure := &data.LoginFailure{Email: email, IP: ip, Reason: reason}
+	if user != nil {
+		failure.UserID = user.ID
+	}
+
+	err = app.models.LoginThrottles.LogFailure(failure)
+	if err != nil {
+		return err
+	}
+
+	if reason != data.LoginFailureWrongPassword && reason != data.LoginFailureWrongCode {
+		return nil
+	}
+
+	_, _, err = app.models.LoginThrottles.Fail(ipLoginKey(ip), ipLoginLimit)
+	if err != nil {
+		return err
+	}
+
+	failures, lockedUntil, err := app.models.LoginThrottles.Fail(accountLoginKey(email), accountLoginLimit)
+	if err != nil {
+		return err
+	}
+
+	// The email is only a warning, so failing to send it doesn't fail the
+	// login any more than it already has.
+	if user != nil && failures == accountLoginLimit.Threshold {
+		err = app.sendLoginFailuresEmail(user, failures, ip, lockedUntil)
+		if err != nil {
+			app.errorLog.Printf("Error sending login failures email to user %d: %v\n", user.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// sendLoginFailuresEmail warns the user that their account has been locked
+// out after failed logins, in case someone is guessing their password.
+func (app *application) sendLoginFailuresEmail(user *data.User, failures int, ip string, lockedUntil time.Time) error {
+	type EmailData struct {
+		Name        string
+		Failures    int
+		IP          string
+		LockedFor   string
+		PasswordURL string
+	}
+
+	return app.mailer.Send(user.Email, "login-failures.tmpl", EmailData{
+		Name:        user.Name,
+		Failures:    failures,
+		IP:          ip,
+		LockedFor:   humanMinutes(time.Until(lockedUntil)),
+		PasswordURL: app.baseURL + "/user/password/forgot",
+	})
+}
+
+// humanMinutes returns the duration in whole minutes, rounded up.
+func humanMinutes(d time.Duration) string {
+	minutes := int(math.Ceil(d.Minutes()))
+	if minutes <= 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// loginLockedOut tells the user to wait until the lockout ends before
+// trying again.
+func (app *application) loginLockedOut(w http.ResponseWriter, r *http.Request, form userLoginForm, lockedUntil time.Time) {
+	wait := time.Until(lockedUntil)
+
+	form.AddNonFieldError("Too many failed attempts. Please try again in " + humanMinutes(wait) + ".")
+
+	templateData := app.newTemplateData(r)
+	templateData.Form = form
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	app.render(w, http.StatusTooManyRequests, "login.tmpl", templateData)
+}
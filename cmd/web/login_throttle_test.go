@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func postLogin(t *testing.T, ts *testServer, email, password string) (int, http.Header, string) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	return ts.postForm(t, "/user/login", form)
+}
+
+func TestLoginLockout(t *testing.T) {
+	app := newTestApplication(t)
+	mailer := &recordingMailer{}
+	app.mailer = mailer
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	throttles := app.models.LoginThrottles.(*mocks.LoginThrottleModel)
+
+	for i := 1; i < accountLoginLimit.Threshold; i++ {
+		code, _, _ := postLogin(t, ts, "alice@example.com", "wrong")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+	assert.Equal(t, len(mailer.sent), 0)
+
+	// The last failure locks the account and tells its user.
+	code, _, _ := postLogin(t, ts, "alice@example.com", "wrong")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, len(mailer.sent), 1)
+	assert.Equal(t, mailer.sent[0].recipient, "alice@example.com")
+	assert.Equal(t, mailer.sent[0].templateFile, "login-failures.tmpl")
+
+	// Even the right password is turned away now.
+	code, header, body := postLogin(t, ts, "alice@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, header.Get("Retry-After"), "60")
+	assert.StringContains(t, body, "Too many failed attempts. Please try again in 1 minute.")
+
+	// Every failure is audited, including tries while locked out.
+	assert.Equal(t, len(throttles.Logged), accountLoginLimit.Threshold+1)
+	last := throttles.Logged[len(throttles.Logged)-1]
+	assert.Equal(t, last.UserID, 1)
+	assert.Equal(t, last.Reason, data.LoginFailureLockedOut)
+
+	// Tries while locked out don't lengthen the lockout or send more emails.
+	postLogin(t, ts, "alice@example.com", "wrong")
+	assert.Equal(t, len(mailer.sent), 1)
+
+	// Other accounts aren't affected.
+	code, _, _ = postLogin(t, ts, "bob@example.com", "wrong")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+}
+
+func TestLoginLockoutUnknownEmail(t *testing.T) {
+	app := newTestApplication(t)
+	mailer := &recordingMailer{}
+	app.mailer = mailer
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Addresses without accounts are locked out the same way, so lockouts
+	// don't give away which have one.
+	for i := 0; i < accountLoginLimit.Threshold; i++ {
+		postLogin(t, ts, "nobody@example.com", "wrong")
+	}
+
+	code, _, _ := postLogin(t, ts, "nobody@example.com", "wrong")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, len(mailer.sent), 0)
+
+	logged := app.models.LoginThrottles.(*mocks.LoginThrottleModel).Logged
+	assert.Equal(t, logged[0].UserID, 0)
+	assert.Equal(t, logged[0].IP, "127.0.0.1")
+}
+
+func TestLoginLockoutIP(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	throttles := app.models.LoginThrottles.(*mocks.LoginThrottleModel)
+	for i := 1; i < ipLoginLimit.Threshold; i++ {
+		_, _, err := throttles.Fail(ipLoginKey("127.0.0.1"), ipLoginLimit)
+		assert.NilError(t, err)
+	}
+
+	code, _, _ := postLogin(t, ts, "bob@example.com", "wrong")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	// The address is locked out for every account.
+	code, _, _ = postLogin(t, ts, "alice@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusTooManyRequests)
+}
+
+func TestLoginResetsFailures(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	for i := 1; i < accountLoginLimit.Threshold; i++ {
+		postLogin(t, ts, "alice@example.com", "wrong")
+	}
+
+	code, _, _ := postLogin(t, ts, "alice@example.com", "pa$$word")
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// The count starts again after a good login.
+	code, _, _ = postLogin(t, ts, "alice@example.com", "wrong")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+}
+
+func TestLoginLockoutTwoFactor(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled = true
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	throttles := app.models.LoginThrottles.(*mocks.LoginThrottleModel)
+
+	// Entering the password again between wrong codes doesn't start the
+	// count again.
+	for i := 1; i < accountLoginLimit.Threshold; i++ {
+		code, _ := enterPassword(t, ts)
+		assert.Equal(t, code, http.StatusSeeOther)
+
+		code, _, _ = enterCode(t, ts, "000000")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	enterPassword(t, ts)
+	code, _, _ := enterCode(t, ts, "000000")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	// The last wrong code locks the account, even for the right code.
+	code, header, _ := enterCode(t, ts, currentCode(t, mocks.MockTOTPSecret))
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	code, _ = enterPassword(t, ts)
+	assert.Equal(t, code, http.StatusTooManyRequests)
+
+	assert.Equal(t, throttles.Logged[0].Reason, data.LoginFailureWrongCode)
+	assert.Equal(t, throttles.Logged[0].UserID, 1)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/mailer"
+)
+
+// failureLoggingMailer sends emails with another mailer, and records the ones
+// it couldn't send for admins to look into. The error is still returned, as
+// callers may want to tell the user.
+type failureLoggingMailer struct {
+	mailer   mailer.MailerInterface
+	failures data.MailFailureModelInterface
+	errorLog *log.Logger
+}
+
+func (m *failureLoggingMailer) Send(recipient, templateFile string, data any) error {
+	err := m.mailer.Send(recipient, templateFile, data)
+	if err != nil {
+		logErr := m.failures.Insert(recipient, templateFile, err.Error())
+		if logErr != nil {
+			m.errorLog.Printf("Error recording failure to send %s to %s: %v\n", templateFile, recipient, logErr)
+		}
+	}
+	return err
+}
@@ -3,17 +3,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
 	_ "github.com/lib/pq"
 	"github.com/tmgasek/calendar-app/internal/data"
 	"github.com/tmgasek/calendar-app/internal/mailer"
+	"github.com/tmgasek/calendar-app/internal/service"
+	"github.com/tmgasek/calendar-app/internal/sse"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/microsoft"
@@ -27,9 +31,10 @@ import (
 // Struct to hold all config settings for the app.
 // Will read in these settings from cmd flags.
 type config struct {
-	addr string
-	env  string
-	db   struct {
+	addr    string
+	env     string
+	baseURL string
+	db      struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -42,6 +47,11 @@ type config struct {
 		password string
 		sender   string
 	}
+	// requireTwoFactor makes every user set up two-factor authentication.
+	requireTwoFactor bool
+	// adminEmail is the email address of a user to make an instance admin
+	// at startup, as there's no other way to get the first one.
+	adminEmail string
 }
 
 // App struct to hold the app-wide dependencies.
@@ -55,6 +65,12 @@ type application struct {
 	googleOAuthConfig *oauth2.Config
 	azureOAuth2Config *oauth2.Config
 	mailer            mailer.MailerInterface
+	service           *service.Service
+	baseURL           string
+	hub               *sse.Hub
+	requireTwoFactor  bool
+	loginProviders    []*loginProvider
+	webhookClient     *http.Client
 }
 
 func main() {
@@ -68,6 +84,9 @@ func main() {
 
 	flag.StringVar(&cfg.addr, "addr", ":8080", "HTTP network address")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.baseURL, "base-url", "http://localhost:8080", "URL the app is reached at, for links used outside the browser")
+	flag.BoolVar(&cfg.requireTwoFactor, "require-2fa", false, "Require every user to set up two-factor authentication")
+	flag.StringVar(&cfg.adminEmail, "admin-email", "", "Make the user with this email address an instance admin")
 
 	// DB.
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "Postgresql DSN")
@@ -106,16 +125,40 @@ func main() {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
+	models := data.NewModels(db)
+
+	// The user has to have signed up already. If they haven't, they can do
+	// so and the app be restarted.
+	if cfg.adminEmail != "" {
+		err = models.Users.GrantAdmin(cfg.adminEmail)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			errorLog.Printf("No user with the email address %s to make an admin", cfg.adminEmail)
+		} else if err != nil {
+			errorLog.Fatal(err)
+		} else {
+			infoLog.Printf("%s is an admin", cfg.adminEmail)
+		}
+	}
+
 	app := &application{
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		models:         data.NewModels(db),
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username,
-			cfg.smtp.password, cfg.smtp.sender),
+		errorLog:         errorLog,
+		infoLog:          infoLog,
+		models:           models,
+		templateCache:    templateCache,
+		formDecoder:      formDecoder,
+		sessionManager:   sessionManager,
+		baseURL:          strings.TrimSuffix(cfg.baseURL, "/"),
+		hub:              sse.NewHub(1000),
+		requireTwoFactor: cfg.requireTwoFactor,
+		webhookClient:    newWebhookClient(),
+		mailer: &failureLoggingMailer{
+			mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username,
+				cfg.smtp.password, cfg.smtp.sender),
+			failures: models.MailFailures,
+			errorLog: errorLog,
+		},
 	}
+	app.service = service.New(app.models, app.mailer, app.fetchEventsForUser)
 
 	srv := &http.Server{
 		Addr:         cfg.addr,
@@ -128,6 +171,13 @@ func main() {
 
 	app.initGoogleAuthConfig()
 	app.initAzureAuthConfig()
+	app.initLoginProviders()
+
+	go app.expireAppointmentRequests(time.Minute)
+	go app.runProviderOperations(5 * time.Second)
+	go app.runWebhookDeliveries(5 * time.Second)
+	go app.runCalendarSync(30 * time.Second)
+	go app.renewCalendarChannels(time.Hour)
 
 	infoLog.Printf("Starting server on %s", cfg.addr)
 	err = srv.ListenAndServe()
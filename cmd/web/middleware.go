@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/justinas/nosurf"
+	"github.com/tmgasek/calendar-app/internal/data"
 )
 
 // secureHeaders -> servemux -> app handler
@@ -74,6 +77,117 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdmin only lets administrators through. It must come after
+// requireAuthentication in the chain.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+		user, err := app.models.Users.Get(userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if !user.IsAdmin {
+			app.clientError(w, http.StatusForbidden, "Only administrators can do that")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordImpersonation adds every change an admin makes while impersonating
+// someone to the audit log, before it's made. It must come after
+// requireAuthentication in the chain.
+func (app *application) recordImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminID := app.sessionManager.GetInt(r.Context(), "impersonatorID")
+		if adminID == 0 || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+		err := app.service.RecordAdminAction(adminID, userID, data.AuditImpersonatedRequest, r.Method+" "+r.URL.Path)
+		if err != nil {
+			if isAPIRequest(r) {
+				app.apiServerError(w, err)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refuseWhileImpersonating keeps admins who are impersonating someone from
+// their credentials and security settings, such as their password, API
+// tokens and linked calendars, which only the user should change.
+func (app *application) refuseWhileImpersonating(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.sessionManager.GetInt(r.Context(), "impersonatorID") != 0 {
+			app.clientError(w, http.StatusForbidden, "You can't do that while impersonating someone")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireTwoFactorEnrolment sends users without two-factor authentication to
+// set it up first, if the instance requires it. It must come after
+// requireAuthentication in the chain.
+func (app *application) requireTwoFactorEnrolment(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/user/2fa") || strings.HasPrefix(r.URL.Path, "/user/logout") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		enrolled, err := app.twoFactorEnrolled(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if enrolled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", "Please set up two-factor authentication to continue.")
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+	})
+}
+
+// twoFactorEnrolled reports whether the logged in user has set up two-factor
+// authentication, or doesn't have to. The answer is kept in the session once
+// they have.
+func (app *application) twoFactorEnrolled(r *http.Request) (bool, error) {
+	if !app.requireTwoFactor || app.sessionManager.GetBool(r.Context(), "twoFactorEnrolled") {
+		return true, nil
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if tf != nil && tf.Enabled() {
+		app.sessionManager.Put(r.Context(), "twoFactorEnrolled", true)
+		return true, nil
+	}
+
+	return false, nil
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Retrieve the authenticatedUserID value from the session using the
@@ -85,20 +199,27 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		// Otherwise, we check to see if a user with that ID exists in our
-		// database.
-		exists, err := app.models.Users.Exists(id)
+		// Otherwise, we check that the session hasn't been ended from
+		// another device. Sessions are deleted along with their user, so this
+		// also checks the user still exists in our database. An admin
+		// impersonating someone is still in their own session.
+		active, err := app.models.UserSessions.Touch(app.sessionManager.GetInt(r.Context(), "sessionID"), app.sessionOwnerID(r))
 		if err != nil {
 			app.serverError(w, err)
 			return
 		}
-		// If a matching user is found, we know that the request is
-		// coming from an authenticated user who exists in our database. We
-		// create a new copy of the request (with an isAuthenticatedContextKey
-		// value of true in the request context) and assign it to r.
-		if exists {
+		// If the session is active, we know that the request is coming from
+		// an authenticated user who exists in our database. We create a new
+		// copy of the request (with an isAuthenticatedContextKey value of true
+		// in the request context) and assign it to r. Otherwise the session
+		// is logged out.
+		if active {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
 			r = r.WithContext(ctx)
+		} else {
+			app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+			app.sessionManager.Remove(r.Context(), "sessionID")
+			app.sessionManager.Remove(r.Context(), "impersonatorID")
 		}
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
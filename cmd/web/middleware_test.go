@@ -68,3 +68,46 @@ func TestSecureHeaders(t *testing.T) {
 
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestRequireAdmin(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	tests := []struct {
+		name     string
+		userID   int
+		wantCode int
+	}{
+		{
+			name:     "Admin",
+			userID:   1,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not an admin",
+			userID:   2,
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				app.sessionManager.Put(r.Context(), "authenticatedUserID", tt.userID)
+				app.requireAdmin(next).ServeHTTP(w, r)
+			})
+
+			rr := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/admin/resources", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			app.sessionManager.LoadAndSave(login).ServeHTTP(rr, r)
+			assert.Equal(t, rr.Result().StatusCode, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Where the providers publish their ID token issuers and signing keys.
+const (
+	googleIssuer     = "https://accounts.google.com"
+	googleJWKSURL    = "https://www.googleapis.com/oauth2/v3/certs"
+	microsoftIssuer  = "https://login.microsoftonline.com/" + oidc.TenantPlaceholder + "/v2.0"
+	microsoftJWKSURL = "https://login.microsoftonline.com/common/discovery/v2.0/keys"
+)
+
+// errUnverifiedEmail is returned when a new account would be made, or an
+// existing one linked, for an email address the provider hasn't verified.
+var errUnverifiedEmail = errors.New("email address not verified")
+
+// loginProvider is an OpenID Connect provider users can sign in with. The
+// same consent covers their calendar there, so signing in links it too.
+type loginProvider struct {
+	// Name is the provider's name for linked calendars, and Title is shown
+	// on the sign in buttons.
+	Name     string
+	Title    string
+	config   *oauth2.Config
+	verifier *oidc.Verifier
+}
+
+// initLoginProviders sets up sign in with each provider whose calendars can
+// be linked, if it has a client ID. The login callbacks must be registered as
+// redirect URLs with the providers, alongside the calendar ones.
+func (app *application) initLoginProviders() {
+	if app.googleOAuthConfig.ClientID != "" {
+		app.loginProviders = append(app.loginProviders,
+			app.newLoginProvider("google", "Google", app.googleOAuthConfig, googleIssuer, googleJWKSURL))
+	}
+	if app.azureOAuth2Config.ClientID != "" {
+		app.loginProviders = append(app.loginProviders,
+			app.newLoginProvider("microsoft", "Microsoft", app.azureOAuth2Config, microsoftIssuer, microsoftJWKSURL))
+	}
+}
+
+// newLoginProvider returns a login provider with the client of the calendar
+// config, asking for the user's identity on top of the calendar scopes.
+func (app *application) newLoginProvider(name, title string, calendarConfig *oauth2.Config, issuer, jwksURL string) *loginProvider {
+	config := *calendarConfig
+	config.RedirectURL = app.baseURL + "/user/oidc/" + name + "/callback"
+	config.Scopes = append([]string{"openid", "email", "profile"}, calendarConfig.Scopes...)
+
+	return &loginProvider{
+		Name:     name,
+		Title:    title,
+		config:   &config,
+		verifier: oidc.NewVerifier(issuer, jwksURL, config.ClientID),
+	}
+}
+
+// loginProviderFromParams returns the provider named in the URL, or nil if
+// there's no such provider set up.
+func (app *application) loginProviderFromParams(r *http.Request) *loginProvider {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+
+	for _, p := range app.loginProviders {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// randomState returns a random value for the state and nonce parameters.
+func randomState() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// oidcLogin sends the user to the provider to sign in. The state and nonce
+// are kept in the session, so the callback only accepts the answer to this
+// request.
+func (app *application) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	provider := app.loginProviderFromParams(r)
+	if provider == nil {
+		app.clientError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	state, err := randomState()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	nonce, err := randomState()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "oidcProvider", provider.Name)
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+
+	url := provider.config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("nonce", nonce))
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// oidcLoginFailed sends the user back to the login page with the message.
+func (app *application) oidcLoginFailed(w http.ResponseWriter, r *http.Request, message string) {
+	app.sessionManager.Put(r.Context(), "flash", message)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// oidcLoginCallback logs in the user the provider has signed in, making them
+// an account if they don't have one yet, and links their calendar.
+func (app *application) oidcLoginCallback(w http.ResponseWriter, r *http.Request) {
+	provider := app.loginProviderFromParams(r)
+	if provider == nil {
+		app.clientError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	// The state and nonce are only good for one try.
+	name := app.sessionManager.PopString(r.Context(), "oidcProvider")
+	state := app.sessionManager.PopString(r.Context(), "oidcState")
+	nonce := app.sessionManager.PopString(r.Context(), "oidcNonce")
+
+	query := r.URL.Query()
+
+	if name != provider.Name || state == "" || query.Get("state") != state {
+		app.clientError(w, http.StatusBadRequest, "This sign in link has expired. Please try again.")
+		return
+	}
+
+	if query.Get("error") != "" {
+		app.oidcLoginFailed(w, r, "Sign in with "+provider.Title+" was cancelled.")
+		return
+	}
+
+	token, err := provider.config.Exchange(r.Context(), query.Get("code"))
+	if err != nil {
+		app.errorLog.Printf("Error exchanging %s login code: %v\n", provider.Name, err)
+		app.oidcLoginFailed(w, r, "Sign in with "+provider.Title+" failed. Please try again.")
+		return
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+
+	claims, err := provider.verifier.Verify(r.Context(), rawIDToken, nonce)
+	if err != nil {
+		app.errorLog.Printf("Error verifying %s ID token: %v\n", provider.Name, err)
+		app.oidcLoginFailed(w, r, "Sign in with "+provider.Title+" failed. Please try again.")
+		return
+	}
+
+	userID, err := app.oidcUser(provider, claims)
+	if err != nil {
+		if errors.Is(err, errUnverifiedEmail) {
+			app.oidcLoginFailed(w, r, "Your "+provider.Title+" account's email address isn't verified, so it can't be used to sign in.")
+			return
+		}
+		if errors.Is(err, data.ErrUserDisabled) {
+			app.oidcLoginFailed(w, r, "This account has been disabled. Please contact your administrator.")
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	twoFactor, err := app.hasTwoFactor(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The calendar isn't linked until the user is fully logged in. Users with
+	// two-factor authentication can link it from their settings afterwards.
+	if twoFactor {
+		err = app.startTwoFactorLogin(r, userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = app.logIn(r, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Providers only hand out a refresh token the first time the user
+	// consents, so later sign ins keep the calendar link there is.
+	if token.RefreshToken != "" {
+		err = app.models.AuthTokens.SaveToken(userID, provider.Name, token)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.linkedCalendar(userID, provider.Name)
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// oidcUser returns the user who signs in with the provider's account. An
+// account that hasn't been used before is linked to the user with the same
+// email address, or else to a new user, but only if the provider has
+// verified the address. Disabled users get ErrUserDisabled.
+func (app *application) oidcUser(provider *loginProvider, claims *oidc.Claims) (int, error) {
+	userID, err := app.models.Identities.GetUserID(provider.Name, claims.Subject)
+	if err == nil {
+		user, err := app.models.Users.Get(userID)
+		if err != nil {
+			return 0, err
+		}
+		if user.Disabled {
+			return 0, data.ErrUserDisabled
+		}
+		return userID, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	if !claims.EmailVerified {
+		return 0, errUnverifiedEmail
+	}
+
+	identity := &data.Identity{
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err := app.models.Users.GetByEmail(claims.Email)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) && !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+
+		name := strings.TrimSpace(claims.Name)
+		if name == "" {
+			name, _, _ = strings.Cut(claims.Email, "@")
+		}
+
+		userID, err = app.models.Identities.InsertUser(name, identity)
+		if err != nil {
+			return 0, err
+		}
+
+		app.joinOrganisationByDomain(userID)
+		app.joinInvitedGroups(userID)
+		return userID, nil
+	}
+
+	if user.Disabled {
+		return 0, data.ErrUserDisabled
+	}
+
+	identity.UserID = user.ID
+
+	// The provider has confirmed the address, so there's no need for the
+	// user to confirm it again. Until now, though, anyone could have
+	// registered it, so the account is claimed from them.
+	if !user.Activated {
+		err = app.models.Identities.Claim(identity)
+		if err != nil {
+			return 0, err
+		}
+
+		app.joinOrganisationByDomain(user.ID)
+		app.joinInvitedGroups(user.ID)
+		return user.ID, nil
+	}
+
+	err = app.models.Identities.Link(identity)
+	if err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+	"github.com/tmgasek/calendar-app/internal/oidc"
+	"golang.org/x/oauth2"
+)
+
+// fakeIdentityProvider signs users in with whatever claims the test sets,
+// issuing ID tokens for them from its token endpoint.
+type fakeIdentityProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+}
+
+func newFakeIdentityProvider(t *testing.T) *fakeIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakeIdentityProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-token",
+			"refresh_token": "refresh-token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"id_token":      p.sign(t),
+		})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func (p *fakeIdentityProvider) sign(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "key-1"})
+	payload, _ := json.Marshal(p.claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// loginProvider returns a Google login provider that uses the fake.
+func (p *fakeIdentityProvider) loginProvider() *loginProvider {
+	return &loginProvider{
+		Name:  "google",
+		Title: "Google",
+		config: &oauth2.Config{
+			ClientID:     "client-id",
+			ClientSecret: "client-secret",
+			Endpoint:     oauth2.Endpoint{AuthURL: p.URL + "/auth", TokenURL: p.URL + "/token"},
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+		verifier: oidc.NewVerifier(p.URL, p.URL+"/keys", "client-id"),
+	}
+}
+
+// signIn goes through the sign in flow, with the provider signing in the
+// account with the subject and email. The change function can alter the
+// claims before they're signed. It returns the response to the callback and
+// its path.
+func (p *fakeIdentityProvider) signIn(t *testing.T, ts *testServer, subject, email string, change func(map[string]any)) (int, http.Header, string) {
+	code, header, _ := ts.get(t, "/user/oidc/google")
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	authURL, err := url.Parse(header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authURL.Query()
+
+	p.claims = map[string]any{
+		"iss":            p.URL,
+		"aud":            "client-id",
+		"sub":            subject,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          params.Get("nonce"),
+		"email":          email,
+		"email_verified": true,
+		"name":           "Dave",
+	}
+	if change != nil {
+		change(p.claims)
+	}
+
+	callback := "/user/oidc/google/callback?code=auth-code&state=" + url.QueryEscape(params.Get("state"))
+
+	code, header, _ = ts.get(t, callback)
+	return code, header, callback
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+
+	tests := []struct {
+		name         string
+		subject      string
+		email        string
+		change       func(map[string]any)
+		disabled     int
+		wantLocation string
+		wantLinked   int
+		wantClaimed  bool
+	}{
+		{
+			name:         "Linked account",
+			subject:      mocks.MockIdentitySubject,
+			email:        "bob@example.com",
+			wantLocation: "/",
+		},
+		{
+			name:         "New user",
+			subject:      "new-subject",
+			email:        "dave@example.com",
+			wantLocation: "/",
+			wantLinked:   4,
+		},
+		{
+			name:         "Existing user",
+			subject:      "new-subject",
+			email:        "bob@example.com",
+			wantLocation: "/",
+			wantLinked:   2,
+		},
+		{
+			name:         "Existing user who hasn't confirmed their email",
+			subject:      "new-subject",
+			email:        "carol@example.com",
+			wantLocation: "/",
+			wantLinked:   3,
+			wantClaimed:  true,
+		},
+		{
+			name:         "Existing user with two-factor authentication",
+			subject:      "new-subject",
+			email:        "alice@example.com",
+			wantLocation: "/user/login/2fa",
+			wantLinked:   1,
+		},
+		{
+			name:         "Existing user who has been disabled",
+			subject:      "new-subject",
+			email:        "carol@example.com",
+			disabled:     3,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Unverified email",
+			subject:      "new-subject",
+			email:        "carol@example.com",
+			change:       func(c map[string]any) { c["email_verified"] = false },
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Wrong nonce",
+			subject:      mocks.MockIdentitySubject,
+			email:        "bob@example.com",
+			change:       func(c map[string]any) { c["nonce"] = "another-nonce" },
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Issued to another client",
+			subject:      mocks.MockIdentitySubject,
+			email:        "bob@example.com",
+			change:       func(c map[string]any) { c["aud"] = "another-client" },
+			wantLocation: "/user/login",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.loginProviders = []*loginProvider{idp.loginProvider()}
+			app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled = true
+			if tt.disabled != 0 {
+				app.models.Users.(*mocks.UserModel).SetDisabled(tt.disabled, true)
+			}
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, header, _ := idp.signIn(t, ts, tt.subject, tt.email, tt.change)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+
+			linked := app.models.Identities.(*mocks.IdentityModel).Linked
+			if tt.wantLinked == 0 {
+				assert.Equal(t, len(linked), 0)
+			} else {
+				assert.Equal(t, len(linked), 1)
+				assert.Equal(t, linked[0].UserID, tt.wantLinked)
+				assert.Equal(t, linked[0].Subject, tt.subject)
+			}
+
+			claimed := app.models.Identities.(*mocks.IdentityModel).Claimed
+			assert.Equal(t, len(claimed) == 1, tt.wantClaimed)
+
+			// The mock users don't include the new one, so only existing
+			// users can be checked for a session.
+			if tt.wantLinked != 4 {
+				wantCode := http.StatusSeeOther
+				if tt.wantLocation == "/" {
+					wantCode = http.StatusOK
+				}
+				code, _, _ = ts.get(t, "/settings")
+				assert.Equal(t, code, wantCode)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+
+	app := newTestApplication(t)
+	app.loginProviders = []*loginProvider{idp.loginProvider()}
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, _ := ts.get(t, "/user/oidc/github")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// A callback that wasn't asked for is turned away.
+	code, _, _ = ts.get(t, "/user/oidc/google/callback?code=auth-code&state=made-up")
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	_, _, body := ts.get(t, "/user/login")
+	assert.StringContains(t, body, "Sign in with Google")
+
+	code, header, callback := idp.signIn(t, ts, mocks.MockIdentitySubject, "bob@example.com", nil)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/")
+
+	// Nor can the answer be replayed.
+	code, _, _ = ts.get(t, callback)
+	assert.Equal(t, code, http.StatusBadRequest)
+}
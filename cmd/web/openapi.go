@@ -0,0 +1,275 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tmgasek/calendar-app/internal/service"
+)
+
+// openAPIEnums lists the values of string types whose values are fixed.
+var openAPIEnums = map[reflect.Type][]string{
+	reflect.TypeOf(service.Outcome("")): {
+		string(service.OutcomeRecorded),
+		string(service.OutcomeConfirmed),
+		string(service.OutcomeDeclined),
+		string(service.OutcomeResourceTaken),
+	},
+}
+
+// apiOpenAPI serves the OpenAPI 3 document describing the JSON API. It
+// doesn't need authentication, so clients can be generated from it.
+func (app *application) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, openAPIDocument(app.apiRoutes()), nil)
+	if err != nil {
+		app.apiServerError(w, err)
+	}
+}
+
+// openAPIDocument describes the routes. The schemas are worked out from the
+// Go types of the request and response bodies, using their json tags.
+func openAPIDocument(routes []apiRoute) envelope {
+	schemas := map[string]any{}
+	schemaFor(reflect.TypeOf(apiError{}), schemas)
+
+	paths := map[string]map[string]any{}
+
+	for _, route := range routes {
+		path, parameters := openAPIPath(route.Path)
+		for _, p := range route.Params {
+			parameters = append(parameters, openAPIParameter(p))
+		}
+
+		operation := map[string]any{
+			"operationId": operationID(route.Handler),
+			"summary":     route.Summary,
+			"responses": map[string]any{
+				"default": map[string]any{"$ref": "#/components/responses/Error"},
+			},
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if route.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": schemaFor(reflect.TypeOf(route.Request), schemas),
+					},
+				},
+			}
+		}
+
+		response := map[string]any{"description": http.StatusText(route.Status)}
+		if route.Response != nil {
+			response["content"] = map[string]any{
+				"application/json": map[string]any{
+					"schema": envelopeSchema(route.Response, schemas),
+				},
+			}
+		}
+		operation["responses"].(map[string]any)[strconv.Itoa(route.Status)] = response
+
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	return envelope{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Calendar App API",
+			"version":     "1.0.0",
+			"description": "Every response is a JSON object. Errors are sent as {\"error\": {...}} with a machine-readable code.",
+		},
+		"paths": paths,
+		"security": []map[string][]string{
+			{"bearerAuth": {}},
+			{"sessionCookie": {}},
+		},
+		"components": map[string]any{
+			"schemas": schemas,
+			"responses": map[string]any{
+				"Error": map[string]any{
+					"description": "Something went wrong",
+					"content": map[string]any{
+						"application/json": map[string]any{
+							"schema": map[string]any{
+								"type":       "object",
+								"required":   []string{"error"},
+								"properties": map[string]any{"error": map[string]any{"$ref": "#/components/schemas/Error"}},
+							},
+						},
+					},
+				},
+			},
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A personal API token, created on the settings page.",
+				},
+				"sessionCookie": map[string]any{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "session",
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts an httprouter path to an OpenAPI one, returning the
+// parameters in it. All of our path parameters are IDs.
+func openAPIPath(path string) (string, []any) {
+	var parameters []any
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "integer", "minimum": 1},
+			})
+		}
+	}
+
+	return strings.Join(segments, "/"), parameters
+}
+
+func openAPIParameter(p apiParam) map[string]any {
+	schema := map[string]any{"type": p.Type}
+	if p.Type == "date-time" {
+		schema = map[string]any{"type": "string", "format": "date-time"}
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+
+	return map[string]any{
+		"name":        p.Name,
+		"in":          "query",
+		"description": p.Description,
+		"schema":      schema,
+	}
+}
+
+// operationID names an operation after its handler, e.g. apiListUsers
+// becomes listUsers.
+func operationID(handler http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	name = strings.TrimPrefix(name, "api")
+
+	return string(unicode.ToLower(rune(name[0]))) + name[1:]
+}
+
+func envelopeSchema(e envelope, schemas map[string]any) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for key, value := range e {
+		properties[key] = schemaFor(reflect.TypeOf(value), schemas)
+		required = append(required, key)
+	}
+	slices.Sort(required)
+
+	return map[string]any{
+		"type":       "object",
+		"required":   required,
+		"properties": properties,
+	}
+}
+
+// schemaFor returns the schema of a Go type. Structs are added to schemas
+// and referred to by name.
+func schemaFor(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem(), schemas)
+	case reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "api")
+		if _, ok := schemas[name]; !ok {
+			// Reserve the name first in case the type refers to itself.
+			schemas[name] = nil
+			schemas[name] = objectSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.String:
+		schema := map[string]any{"type": "string"}
+		if enum, ok := openAPIEnums[t]; ok {
+			schema["enum"] = enum
+		}
+		return schema
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	default:
+		return map[string]any{}
+	}
+}
+
+// objectSchema describes a struct's JSON encoding. Fields without omitempty
+// are always sent, so they're required.
+func objectSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaFor(field.Type, schemas)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+var refRX = regexp.MustCompile(`"\$ref": "#/components/(\w+)/(\w+)"`)
+
+type openAPISpec struct {
+	OpenAPI    string                               `json:"openapi"`
+	Paths      map[string]map[string]map[string]any `json:"paths"`
+	Components struct {
+		Schemas map[string]any `json:"schemas"`
+	} `json:"components"`
+}
+
+func getOpenAPISpec(t *testing.T, ts *testServer) (openAPISpec, string) {
+	code, header, body := ts.get(t, "/api/v1/openapi.json")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+
+	var spec openAPISpec
+	err := json.Unmarshal([]byte(body), &spec)
+	assert.NilError(t, err)
+
+	return spec, body
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	app := newTestApplication(t)
+	// No mockAuthentication: the document is public.
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	spec, body := getOpenAPISpec(t, ts)
+
+	assert.Equal(t, spec.OpenAPI, "3.0.3")
+	assert.Equal(t, len(spec.Paths) > 0, true)
+
+	for _, name := range []string{"Error", "User", "AppointmentRequest", "AppointmentRequestInput", "Metadata"} {
+		t.Run("Schema "+name, func(t *testing.T) {
+			_, ok := spec.Components.Schemas[name]
+			assert.Equal(t, ok, true)
+		})
+	}
+
+	// Every reference should point at a schema that's in the document.
+	for _, ref := range refRX.FindAllStringSubmatch(body, -1) {
+		if ref[1] == "responses" {
+			continue
+		}
+		_, ok := spec.Components.Schemas[ref[2]]
+		if !ok {
+			t.Errorf("missing schema %q", ref[2])
+		}
+	}
+
+	// Enums come from the enum tags on request types.
+	responseInput := spec.Components.Schemas["ResponseInput"].(map[string]any)
+	response := responseInput["properties"].(map[string]any)["response"].(map[string]any)
+	assert.Equal(t, len(response["enum"].([]any)), 3)
+}
+
+// TestOpenAPIMatchesRoutes checks the document against the routes the
+// router actually has, using the Allow header it sends in response to
+// OPTIONS requests.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	spec, _ := getOpenAPISpec(t, ts)
+
+	for path, operations := range spec.Paths {
+		t.Run(path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodOptions, ts.URL+strings.ReplaceAll(path, "{id}", "1"), nil)
+			assert.NilError(t, err)
+
+			rs, err := ts.Client().Do(req)
+			assert.NilError(t, err)
+			rs.Body.Close()
+
+			var routed []string
+			for _, method := range strings.Split(rs.Header.Get("Allow"), ", ") {
+				if method != http.MethodOptions {
+					routed = append(routed, method)
+				}
+			}
+
+			var documented []string
+			for method, operation := range operations {
+				documented = append(documented, strings.ToUpper(method))
+				assert.Equal(t, operation["summary"] != "", true)
+				assert.Equal(t, operation["operationId"] != "", true)
+			}
+
+			slices.Sort(routed)
+			slices.Sort(documented)
+			assert.Equal(t, strings.Join(routed, ", "), strings.Join(documented, ", "))
+		})
+	}
+
+	// The document itself is the only API route that isn't described in it.
+	for _, route := range app.apiRoutes() {
+		path, _ := openAPIPath(route.Path)
+		_, ok := spec.Paths[path][strings.ToLower(route.Method)]
+		assert.Equal(t, ok, true)
+	}
+}
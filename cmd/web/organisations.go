@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tmgasek/calendar-app/internal/service"
+)
+
+// joinOrganisationByDomain puts a user who has just confirmed their email
+// address in the organisation at its domain. It runs before they join the
+// groups they were invited to, so invitations from inside the organisation
+// count as reachable. An admin can still add them by hand, so a failure is
+// only logged.
+func (app *application) joinOrganisationByDomain(userID int) {
+	_, err := app.service.JoinOrganisationByDomain(userID)
+	if err != nil {
+		app.errorLog.Printf("Error joining user %d to the organisation at their domain: %v\n", userID, err)
+	}
+}
+
+// viewMyOrganisation sends the user to the page of their organisation, if
+// they're in one.
+func (app *application) viewMyOrganisation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.service.GetUser(userID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	if user.OrganisationID != 0 {
+		http.Redirect(w, r, fmt.Sprintf("/organisations/view/%d", user.OrganisationID), http.StatusSeeOther)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.User = user
+	app.render(w, http.StatusOK, "organisation.tmpl", templateData)
+}
+
+// viewOrganisation shows an organisation's members and who it shares with,
+// and to its admins the controls to manage them.
+func (app *application) viewOrganisation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid organisation ID in URL")
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+
+	templateData.Organisation, err = app.service.GetOrganisation(userID, int(orgID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	templateData.OrganisationMembers, err = app.service.GetOrganisationMembers(userID, int(orgID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	templateData.OrganisationShares, err = app.service.GetOrganisationShares(userID, int(orgID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	user, err := app.service.GetUser(userID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+	templateData.User = user
+	templateData.CanManageOrganisation = service.CanManageOrganisation(user, int(orgID))
+
+	// Admins pick which organisation to share with from the full list.
+	if templateData.CanManageOrganisation {
+		templateData.Organisations, err = app.models.Organisations.GetAll()
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.render(w, http.StatusOK, "organisation.tmpl", templateData)
+}
+
+type organisationMemberForm struct {
+	Email  string `form:"email"`
+	UserID int    `form:"user_id"`
+	Role   string `form:"role"`
+}
+
+func (app *application) addOrganisationMember(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid organisation ID in URL")
+		return
+	}
+
+	var form organisationMemberForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.AddOrganisationMember(userID, int(orgID), form.Email)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Member added to the organisation.")
+	http.Redirect(w, r, fmt.Sprintf("/organisations/view/%d", orgID), http.StatusSeeOther)
+}
+
+func (app *application) removeOrganisationMember(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid organisation ID in URL")
+		return
+	}
+
+	var form organisationMemberForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.RemoveOrganisationMember(userID, int(orgID), form.UserID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Member removed from the organisation.")
+	http.Redirect(w, r, fmt.Sprintf("/organisations/view/%d", orgID), http.StatusSeeOther)
+}
+
+func (app *application) setOrganisationMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid organisation ID in URL")
+		return
+	}
+
+	var form organisationMemberForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.SetOrganisationMemberRole(userID, int(orgID), form.UserID, form.Role)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Member's role changed.")
+	http.Redirect(w, r, fmt.Sprintf("/organisations/view/%d", orgID), http.StatusSeeOther)
+}
+
+type organisationShareForm struct {
+	OrganisationID int `form:"organisation_id"`
+}
+
+func (app *application) shareOrganisation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid organisation ID in URL")
+		return
+	}
+
+	var form organisationShareForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.ShareOrganisation(userID, int(orgID), form.OrganisationID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Organisation shared.")
+	http.Redirect(w, r, fmt.Sprintf("/organisations/view/%d", orgID), http.StatusSeeOther)
+}
+
+func (app *application) unshareOrganisation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid organisation ID in URL")
+		return
+	}
+
+	var form organisationShareForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err = app.service.UnshareOrganisation(userID, int(orgID), form.OrganisationID)
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Organisation no longer shared.")
+	http.Redirect(w, r, fmt.Sprintf("/organisations/view/%d", orgID), http.StatusSeeOther)
+}
+
+// manageOrganisations lists every organisation for instance admins, with a
+// form to create one.
+func (app *application) manageOrganisations(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+
+	organisations, err := app.models.Organisations.GetAll()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData.Organisations = organisations
+	app.render(w, http.StatusOK, "admin-organisations.tmpl", templateData)
+}
+
+type createOrganisationForm struct {
+	Name       string `form:"name"`
+	Domain     string `form:"domain"`
+	AdminEmail string `form:"admin_email"`
+}
+
+func (app *application) createOrganisation(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form createOrganisationForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	orgID, err := app.service.CreateOrganisation(userID, service.NewOrganisation{
+		Name:       form.Name,
+		Domain:     form.Domain,
+		AdminEmail: form.AdminEmail,
+	})
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Organisation created!")
+	http.Redirect(w, r, fmt.Sprintf("/organisations/view/%d", orgID), http.StatusSeeOther)
+}
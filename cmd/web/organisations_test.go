@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestOrganisationIsolation(t *testing.T) {
+	app := newTestApplication(t)
+	// Alice is in Example, which Oscar's Globex doesn't share with.
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/users/search?query=o")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Bob")
+	if strings.Contains(body, "Oscar") {
+		t.Errorf("search shows a user from another organisation")
+	}
+
+	code, _, _ = ts.get(t, "/users/profile/5")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, _ = ts.get(t, "/api/v1/users/5")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, _ = ts.get(t, "/api/v1/users/5/availability")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	_, _, body = ts.get(t, "/users/profile/2")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("title", "Catch up")
+	form.Add("description", "Catch up")
+	form.Add("start_time", "2023-06-01T10:00")
+	form.Add("end_time", "2023-06-01T11:00")
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ = ts.postForm(t, "/appointments/create/5", form)
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestViewOrganisation(t *testing.T) {
+	tests := []struct {
+		name         string
+		userID       int
+		urlPath      string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"Own organisation", 2, "/organisation", http.StatusSeeOther, "/organisations/view/1", ""},
+		{"Member", 2, "/organisations/view/1", http.StatusOK, "", "Carol (carol@example.com)"},
+		{"Other organisation", 2, "/organisations/view/2", http.StatusNotFound, "", ""},
+		{"Organisation admin", 5, "/organisations/view/2", http.StatusOK, "", "/organisations/share/2"},
+		{"Instance admin", 1, "/organisations/view/2", http.StatusOK, "", "Oscar (oscar@globex.example)"},
+		{"Instance admin page", 2, "/admin/organisations", http.StatusForbidden, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(tt.userID, app.routes())))
+			defer ts.Close()
+
+			code, header, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestManageOrganisation(t *testing.T) {
+	app := newTestApplication(t)
+	// Bob is a plain member of Example, and Alice its admin.
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.loginAs(2, app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/organisations/view/1")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+	form.Add("user_id", "3")
+	form.Add("role", "admin")
+
+	code, _, _ := ts.postForm(t, "/organisations/role/1", form)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	admin := newTestApplication(t)
+	ts = newTestServer(t, admin.sessionManager.LoadAndSave(admin.mockAuthentication(admin.routes())))
+	defer ts.Close()
+
+	_, _, body = ts.get(t, "/organisations/view/1")
+	validCSRFToken = extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		form     url.Values
+		wantCode int
+	}{
+		{"Make admin", "/organisations/role/1", url.Values{"user_id": {"3"}, "role": {"admin"}}, http.StatusSeeOther},
+		{"Invalid role", "/organisations/role/1", url.Values{"user_id": {"3"}, "role": {"owner"}}, http.StatusUnprocessableEntity},
+		{"Demote self", "/organisations/role/1", url.Values{"user_id": {"1"}, "role": {"member"}}, http.StatusUnprocessableEntity},
+		{"Remove member", "/organisations/remove/1", url.Values{"user_id": {"2"}}, http.StatusSeeOther},
+		{"Remove non-member", "/organisations/remove/1", url.Values{"user_id": {"5"}}, http.StatusNotFound},
+		{"Add member", "/organisations/members/1", url.Values{"email": {"oscar@globex.example"}}, http.StatusSeeOther},
+		{"Add unknown member", "/organisations/members/1", url.Values{"email": {"nobody@example.com"}}, http.StatusUnprocessableEntity},
+		{"Share", "/organisations/share/1", url.Values{"organisation_id": {"2"}}, http.StatusSeeOther},
+		{"Share with itself", "/organisations/share/1", url.Values{"organisation_id": {"1"}}, http.StatusUnprocessableEntity},
+		{"Unshare", "/organisations/unshare/1", url.Values{"organisation_id": {"2"}}, http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, tt.form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	orgs := admin.models.Organisations.(*mocks.OrganisationModel)
+	assert.Equal(t, orgs.Roles[3], "admin")
+	assert.Equal(t, len(orgs.Removed), 1)
+	assert.Equal(t, len(orgs.Added), 1)
+	assert.Equal(t, len(orgs.Shared), 1)
+	assert.Equal(t, len(orgs.Unshared), 1)
+}
+
+func TestCreateOrganisation(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/admin/organisations")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Globex")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		orgName    string
+		domain     string
+		adminEmail string
+		wantCode   int
+	}{
+		{"Valid", "Initech", "initech.example", "bob@example.com", http.StatusSeeOther},
+		{"No domain", "Hooli", "", "", http.StatusSeeOther},
+		{"Blank name", "", "", "", http.StatusUnprocessableEntity},
+		{"Invalid domain", "Acme", "not a domain", "", http.StatusUnprocessableEntity},
+		{"Taken domain", "Acme", "globex.example", "", http.StatusUnprocessableEntity},
+		{"Unknown admin", "Acme", "", "nobody@example.com", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+			form.Add("name", tt.orgName)
+			form.Add("domain", tt.domain)
+			form.Add("admin_email", tt.adminEmail)
+
+			code, _, _ := ts.postForm(t, "/admin/organisations", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+
+	orgs := app.models.Organisations.(*mocks.OrganisationModel)
+	assert.Equal(t, len(orgs.Inserted), 2)
+	assert.Equal(t, len(orgs.Added), 1)
+}
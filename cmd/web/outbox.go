@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/providers"
+)
+
+// permanentError marks a provider operation failure that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// errNotLinked is the cause of the permanent failure of an operation for an
+// account the user has since unlinked.
+var errNotLinked = errors.New("account is no longer linked")
+
+// retryBackoff returns how long to wait before the next attempt of an
+// operation that has failed the given number of times: 30s, 1m, 2m, ... up to
+// an hour.
+func retryBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= time.Hour {
+			return time.Hour
+		}
+	}
+	return backoff
+}
+
+// runProviderOperations works through the outbox of calendar provider calls
+// every interval. It blocks, so run it in a goroutine.
+func (app *application) runProviderOperations(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := app.models.ProviderOperations.ReleaseStale(10 * time.Minute)
+		if err != nil {
+			app.errorLog.Printf("Error releasing stale provider operations: %v\n", err)
+		}
+
+		ops, err := app.models.ProviderOperations.ClaimDue(20)
+		if err != nil {
+			app.errorLog.Printf("Error claiming provider operations: %v\n", err)
+			continue
+		}
+
+		for _, op := range ops {
+			app.processProviderOperation(op)
+		}
+	}
+}
+
+// processProviderOperation carries out a claimed operation. Failures are
+// retried with backoff until the operation runs out of attempts; a create that
+// fails for good rolls back the whole appointment, and declines its request.
+// A user who has unlinked their calendar just doesn't get the event.
+func (app *application) processProviderOperation(op *data.ProviderOperation) {
+	var err error
+
+	switch op.Operation {
+	case data.OperationCreateEvent:
+		err = app.createProviderEvent(op)
+	case data.OperationDeleteEvent:
+		err = app.deleteProviderEvent(op)
+	default:
+		err = &permanentError{fmt.Errorf("unknown operation %q", op.Operation)}
+	}
+
+	if err == nil {
+		return
+	}
+
+	app.errorLog.Printf("Provider operation %d (%s for user %d on %s) failed: %v\n", op.ID, op.Operation, op.UserID, op.ProviderName, err)
+
+	if op.Operation == data.OperationCreateEvent && errors.Is(err, errNotLinked) {
+		err = app.models.ProviderOperations.Skip(op, err.Error())
+		if err != nil {
+			app.errorLog.Printf("Error skipping provider operation %d: %v\n", op.ID, err)
+		}
+		return
+	}
+
+	var permErr *permanentError
+	if !errors.As(err, &permErr) && op.Attempts < op.MaxAttempts {
+		err = app.models.ProviderOperations.Retry(op.ID, err.Error(), time.Now().Add(retryBackoff(op.Attempts)))
+		if err != nil {
+			app.errorLog.Printf("Error rescheduling provider operation %d: %v\n", op.ID, err)
+		}
+		return
+	}
+
+	err = app.models.ProviderOperations.Fail(op.ID, err.Error())
+	if err != nil {
+		app.errorLog.Printf("Error failing provider operation %d: %v\n", op.ID, err)
+		return
+	}
+
+	if op.Operation == data.OperationCreateEvent {
+		app.infoLog.Printf("Rolling back appointment %d\n", op.AppointmentID)
+
+		requestID, err := app.models.ProviderOperations.Compensate(op.AppointmentID)
+		if err != nil {
+			app.errorLog.Printf("Error rolling back appointment %d: %v\n", op.AppointmentID, err)
+			return
+		}
+		if requestID != 0 {
+			app.requestChanged(data.EventRequestDeclined, requestID)
+		}
+	}
+}
+
+// providerClient returns the provider and HTTP client to use for an
+// operation. An account that is no longer linked is a permanent failure.
+func (app *application) providerClient(op *data.ProviderOperation) (providers.CalendarProvider, error) {
+	token, err := app.models.AuthTokens.Token(op.UserID, op.ProviderName)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, &permanentError{fmt.Errorf("%s %w", op.ProviderName, errNotLinked)}
+	}
+
+	provider, err := providers.GetProviderByName(op.UserID, op.ProviderName, &app.models, app.googleOAuthConfig, app.azureOAuth2Config)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, &permanentError{fmt.Errorf("unknown provider %q", op.ProviderName)}
+	}
+
+	return provider, nil
+}
+
+func (app *application) createProviderEvent(op *data.ProviderOperation) error {
+	appointment, err := app.models.Appointments.Get(op.AppointmentID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return app.models.ProviderOperations.Cancel(op.ID)
+		}
+		return err
+	}
+
+	// The appointment was rolled back while this operation was queued.
+	if appointment.Status == data.AppointmentFailed {
+		return app.models.ProviderOperations.Cancel(op.ID)
+	}
+
+	provider, err := app.providerClient(op)
+	if err != nil {
+		return err
+	}
+
+	client, err := providers.GetClient(provider, op.UserID, &app.models)
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("Creating event from provider %s for user %d\n", provider.Name(), op.UserID)
+
+	eventID, err := provider.CreateEvent(op.UserID, client, providers.NewEventData{
+		Title:          appointment.Title,
+		Description:    appointment.Description,
+		StartTime:      appointment.StartTime,
+		EndTime:        appointment.EndTime,
+		Location:       appointment.Location,
+		IdempotencyKey: op.IdempotencyKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("Provider: %s, Event ID: %s\n", provider.Name(), eventID)
+
+	return app.models.ProviderOperations.CompleteCreate(op, eventID)
+}
+
+func (app *application) deleteProviderEvent(op *data.ProviderOperation) error {
+	provider, err := app.providerClient(op)
+	if err != nil {
+		return err
+	}
+
+	client, err := providers.GetClient(provider, op.UserID, &app.models)
+	if err != nil {
+		return err
+	}
+
+	err = provider.DeleteEvent(op.UserID, client, op.ProviderName, op.ProviderEventID)
+	if err != nil {
+		return err
+	}
+
+	return app.models.ProviderOperations.Complete(op.ID)
+}
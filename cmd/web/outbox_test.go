@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 20, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, retryBackoff(tt.attempts), tt.want)
+	}
+}
+
+func TestProcessProviderOperation(t *testing.T) {
+	tests := []struct {
+		name            string
+		linked          []string
+		op              *data.ProviderOperation
+		wantFailed      int
+		wantSkipped     int
+		wantCompensated int
+		wantEvents      []string
+	}{
+		{
+			name: "Create for unlinked account",
+			op: &data.ProviderOperation{
+				ID:            1,
+				Operation:     data.OperationCreateEvent,
+				AppointmentID: 1,
+				UserID:        1,
+				ProviderName:  "google",
+				Attempts:      1,
+				MaxAttempts:   5,
+			},
+			wantSkipped: 1,
+		},
+		{
+			name:   "Create for unknown provider",
+			linked: []string{"apple"},
+			op: &data.ProviderOperation{
+				ID:            4,
+				Operation:     data.OperationCreateEvent,
+				AppointmentID: 1,
+				UserID:        1,
+				ProviderName:  "apple",
+				Attempts:      1,
+				MaxAttempts:   5,
+			},
+			wantFailed:      1,
+			wantCompensated: 1,
+			wantEvents:      []string{data.EventRequestDeclined},
+		},
+		{
+			name: "Delete for unlinked account",
+			op: &data.ProviderOperation{
+				ID:              2,
+				Operation:       data.OperationDeleteEvent,
+				AppointmentID:   1,
+				UserID:          1,
+				ProviderName:    "google",
+				ProviderEventID: "event_1",
+				Attempts:        1,
+				MaxAttempts:     5,
+			},
+			wantFailed:      1,
+			wantCompensated: 0,
+		},
+		{
+			name: "Unknown operation",
+			op: &data.ProviderOperation{
+				ID:          3,
+				Operation:   "update_event",
+				Attempts:    1,
+				MaxAttempts: 5,
+			},
+			wantFailed:      1,
+			wantCompensated: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.models.AuthTokens = &mocks.AuthTokenModel{Linked: tt.linked}
+			ops := app.models.ProviderOperations.(*mocks.ProviderOperationModel)
+			webhooks := app.models.Webhooks.(*mocks.WebhookModel)
+
+			app.processProviderOperation(tt.op)
+
+			assert.Equal(t, len(ops.Retried), 0)
+			assert.Equal(t, len(ops.Failed), tt.wantFailed)
+			assert.Equal(t, len(ops.Skipped), tt.wantSkipped)
+			assert.Equal(t, len(ops.Compensated), tt.wantCompensated)
+			assert.Equal(t, len(webhooks.Enqueued), len(tt.wantEvents))
+			for i := range tt.wantEvents {
+				assert.Equal(t, webhooks.Enqueued[i], tt.wantEvents[i])
+			}
+		})
+	}
+}
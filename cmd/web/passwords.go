@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// passwordResetTokenTTL is how long the link in a password reset email works
+// for.
+const passwordResetTokenTTL = time.Hour
+
+// logoutOtherSessions ends every session of the user except the one of the
+// request, e.g. once their password has changed.
+func (app *application) logoutOtherSessions(r *http.Request, userID int) error {
+	current := 0
+	if app.sessionManager.GetInt(r.Context(), "authenticatedUserID") == userID {
+		current = app.sessionManager.GetInt(r.Context(), "sessionID")
+	}
+
+	return app.models.UserSessions.DeleteAllForUser(userID, current)
+}
+
+// checkNewPassword checks the new password, and that it was typed the same
+// twice.
+func checkNewPassword(v *validator.Validator, password, confirmation string) {
+	v.CheckField(validator.NotBlank(password), "new_password", "This field cannot be blank")
+	v.CheckField(validator.MinChars(password, 8), "new_password", "This field must be at least 8 characters long")
+	v.CheckField(password == confirmation, "new_password_confirmation", "Passwords don't match")
+}
+
+type forgotPasswordForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+	templateData.Form = forgotPasswordForm{}
+	app.render(w, http.StatusOK, "password-forgot.tmpl", templateData)
+}
+
+// forgotPasswordPost emails a link to reset the password to the address, if
+// there's an account for it. The response is the same either way, so the form
+// can't be used to find out who has an account.
+func (app *application) forgotPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form forgotPasswordForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		templateData := app.newTemplateData(r)
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "password-forgot.tmpl", templateData)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) && !errors.Is(err, sql.ErrNoRows) {
+		app.serverError(w, err)
+		return
+	}
+
+	// A failure to send is only logged, as an error page would give away
+	// that there's an account.
+	if err == nil {
+		err = app.sendPasswordResetEmail(user)
+		if err != nil {
+			app.errorLog.Printf("Error sending a password reset email to user %d: %v\n", user.ID, err)
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If there's an account for that address, we've emailed it a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// sendPasswordResetEmail emails the user a link to reset their password, in
+// place of any they were sent before.
+func (app *application) sendPasswordResetEmail(user *data.User) error {
+	err := app.models.Tokens.DeleteAllForUser(data.TokenScopePasswordReset, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.models.Tokens.New(user.ID, data.TokenScopePasswordReset, passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	type EmailData struct {
+		Name     string
+		ResetURL string
+		Minutes  int
+	}
+
+	return app.mailer.Send(user.Email, "password-reset.tmpl", EmailData{
+		Name:     user.Name,
+		ResetURL: app.baseURL + "/user/password/reset?token=" + url.QueryEscape(token.Plaintext),
+		Minutes:  int(passwordResetTokenTTL.Minutes()),
+	})
+}
+
+type resetPasswordForm struct {
+	Token                   string `form:"token"`
+	NewPassword             string `form:"new_password"`
+	NewPasswordConfirmation string `form:"new_password_confirmation"`
+	validator.Validator     `form:"-"`
+}
+
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+	templateData.Form = resetPasswordForm{Token: r.URL.Query().Get("token")}
+	app.render(w, http.StatusOK, "password-reset.tmpl", templateData)
+}
+
+// resetPasswordPost sets a new password with a token from a reset email, and
+// logs the user out everywhere.
+func (app *application) resetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form resetPasswordForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Token), "token", "This link is incomplete")
+	checkNewPassword(&form.Validator, form.NewPassword, form.NewPasswordConfirmation)
+
+	// The token is only used up once the password has been changed.
+	var userID int
+	if form.Valid() {
+		userID, err = app.models.Users.ResetPassword(form.Token, form.NewPassword)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("token", "This link is invalid or has expired")
+		}
+	}
+
+	if !form.Valid() {
+		templateData := app.newTemplateData(r)
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "password-reset.tmpl", templateData)
+		return
+	}
+
+	// Whoever guessed at the old password is no reason to keep the user
+	// locked out with the new one.
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.models.LoginThrottles.Reset(accountLoginKey(user.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	err = app.logoutOtherSessions(r, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. Please login.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type changePasswordForm struct {
+	CurrentPassword         string `form:"current_password"`
+	NewPassword             string `form:"new_password"`
+	NewPasswordConfirmation string `form:"new_password_confirmation"`
+	validator.Validator     `form:"-"`
+}
+
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+	templateData.Form = changePasswordForm{}
+	app.render(w, http.StatusOK, "password-change.tmpl", templateData)
+}
+
+// changePasswordPost sets a new password for the user, who must give their
+// current one, and logs them out everywhere else.
+func (app *application) changePasswordPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form changePasswordForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "current_password", "This field cannot be blank")
+	checkNewPassword(&form.Validator, form.NewPassword, form.NewPasswordConfirmation)
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if form.Valid() {
+		_, err = app.models.Users.Authenticate(user.Email, form.CurrentPassword)
+		if err != nil {
+			if !errors.Is(err, data.ErrInvalidCredentials) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("current_password", "Your current password is incorrect")
+		}
+	}
+
+	if !form.Valid() {
+		templateData := app.newTemplateData(r)
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "password-change.tmpl", templateData)
+		return
+	}
+
+	err = app.models.Users.UpdatePassword(user.ID, form.NewPassword)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Links to reset the old password shouldn't work any more either.
+	err = app.models.Tokens.DeleteAllForUser(data.TokenScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.logoutOtherSessions(r, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been changed, and you've been logged out everywhere else.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
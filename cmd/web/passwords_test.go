@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestForgotPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		failMail   bool
+		wantEmails int
+	}{
+		{"Known email", "alice@example.com", false, 1},
+		{"Unknown email", "nobody@example.com", false, 0},
+		{"Mail failure", "alice@example.com", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			mailer := &recordingMailer{}
+			app.mailer = mailer
+			if tt.failMail {
+				app.mailer = &failingMailer{errors.New("550 mailbox unavailable")}
+			}
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/password/forgot")
+			validCSRFToken := extractCSRFToken(t, body)
+
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("csrf_token", validCSRFToken)
+
+			// The response doesn't give away whether there's an account.
+			code, header, _ := ts.postForm(t, "/user/password/forgot", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login")
+
+			assert.Equal(t, len(mailer.sent), tt.wantEmails)
+			if tt.wantEmails > 0 {
+				assert.Equal(t, mailer.sent[0].recipient, tt.email)
+				assert.Equal(t, mailer.sent[0].templateFile, "password-reset.tmpl")
+
+				tokens := app.models.Tokens.(*mocks.TokenModel)
+				assert.Equal(t, tokens.Created[0].Scope, data.TokenScopePasswordReset)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/password/reset?token="+mocks.MockPasswordResetToken)
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		token        string
+		password     string
+		confirmation string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Valid token",
+			token:        mocks.MockPasswordResetToken,
+			password:     "newPa$$word",
+			confirmation: "newPa$$word",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Unknown token",
+			token:        "expired-token",
+			password:     "newPa$$word",
+			confirmation: "newPa$$word",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "This link is invalid or has expired",
+		},
+		{
+			name:         "Short password",
+			token:        mocks.MockPasswordResetToken,
+			password:     "pa$$",
+			confirmation: "pa$$",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "This field must be at least 8 characters long",
+		},
+		{
+			name:         "Passwords don't match",
+			token:        mocks.MockPasswordResetToken,
+			password:     "newPa$$word",
+			confirmation: "newPa$$wort",
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "Passwords don&#39;t match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("token", tt.token)
+			form.Add("new_password", tt.password)
+			form.Add("new_password_confirmation", tt.confirmation)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, body := ts.postForm(t, "/user/password/reset", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/password")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		password        string
+		wantCode        int
+		wantBody        string
+	}{
+		{"Valid submission", "pa$$word", "newPa$$word", http.StatusSeeOther, ""},
+		{"Wrong current password", "wrong", "newPa$$word", http.StatusUnprocessableEntity, "Your current password is incorrect"},
+		{"Short password", "pa$$word", "pa$$", http.StatusUnprocessableEntity, "This field must be at least 8 characters long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("current_password", tt.currentPassword)
+			form.Add("new_password", tt.password)
+			form.Add("new_password_confirmation", tt.password)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/user/password", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// login logs the client in as Alice and returns a CSRF token for its session.
+func login(t *testing.T, ts *testServer, client *http.Client) string {
+	get := func(urlPath string) string {
+		rs, err := client.Get(ts.URL + urlPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Body.Close()
+		body, err := io.ReadAll(rs.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, get("/user/login")))
+
+	rs, err := client.PostForm(ts.URL+"/user/login", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	assert.Equal(t, rs.StatusCode, http.StatusSeeOther)
+
+	return extractCSRFToken(t, get("/user/password"))
+}
+
+func TestChangePasswordLogsOutOtherSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// A second browser, with its own cookies.
+	other := ts.newClient(t)
+
+	validCSRFToken := login(t, ts, ts.Client())
+	login(t, ts, other)
+
+	form := url.Values{}
+	form.Add("current_password", "pa$$word")
+	form.Add("new_password", "newPa$$word")
+	form.Add("new_password_confirmation", "newPa$$word")
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ := ts.postForm(t, "/user/password", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	// The browser that changed the password stays logged in.
+	code, _, _ = ts.get(t, "/settings")
+	assert.Equal(t, code, http.StatusOK)
+
+	rs, err := other.Get(ts.URL + "/settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	assert.Equal(t, rs.StatusCode, http.StatusSeeOther)
+	assert.Equal(t, rs.Header.Get("Location"), "/user/login")
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+type pollCreateForm struct {
+	Title               string   `form:"title"`
+	Description         string   `form:"description"`
+	Location            string   `form:"location"`
+	GroupID             int      `form:"group_id"`
+	Emails              string   `form:"emails"`
+	OptionStarts        []string `form:"option_start"`
+	OptionEnds          []string `form:"option_end"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) viewPolls(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	polls, err := app.models.Polls.GetForUser(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	groups, err := app.models.Groups.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData.Polls = polls
+	templateData.Groups = groups
+	app.render(w, http.StatusOK, "polls.tmpl", templateData)
+}
+
+func (app *application) createPoll(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form pollCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 255), "title", "This field is too long")
+	form.CheckField(validator.MaxChars(form.Location, 255), "location", "This field is too long")
+	form.CheckField(len(form.OptionStarts) == len(form.OptionEnds), "option_start", "Every option needs a start and an end time")
+
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity, "Invalid form data")
+		return
+	}
+
+	poll := &data.Poll{
+		OrganizerID: userID,
+		GroupID:     form.GroupID,
+		Title:       form.Title,
+		Description: form.Description,
+		Location:    form.Location,
+	}
+
+	// Parse the candidate times, skipping rows of the form that were left empty.
+	for i := range form.OptionStarts {
+		if form.OptionStarts[i] == "" && form.OptionEnds[i] == "" {
+			continue
+		}
+
+		startTime, err := time.Parse("2006-01-02T15:04", form.OptionStarts[i])
+		if err != nil {
+			app.clientError(w, http.StatusUnprocessableEntity, "Invalid option start time")
+			return
+		}
+		endTime, err := time.Parse("2006-01-02T15:04", form.OptionEnds[i])
+		if err != nil {
+			app.clientError(w, http.StatusUnprocessableEntity, "Invalid option end time")
+			return
+		}
+		if !endTime.After(startTime) {
+			app.clientError(w, http.StatusUnprocessableEntity, "Options must end after they start")
+			return
+		}
+
+		poll.Options = append(poll.Options, &data.PollOption{StartTime: startTime, EndTime: endTime})
+	}
+
+	if len(poll.Options) == 0 {
+		app.clientError(w, http.StatusUnprocessableEntity, "A poll needs at least one option")
+		return
+	}
+
+	// The organizer votes too, along with the group and anyone listed by email.
+	participants := map[int]*data.PollParticipant{}
+	organizer, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	participants[organizer.ID] = &data.PollParticipant{UserID: organizer.ID, Name: organizer.Name, Email: organizer.Email}
+
+	if form.GroupID != 0 {
+		group, err := app.models.Groups.Get(form.GroupID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.clientError(w, http.StatusUnprocessableEntity, "Group not found")
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		isMember := false
+		for _, member := range group.Members {
+			if member.ID == userID {
+				isMember = true
+			}
+			participants[member.ID] = &data.PollParticipant{UserID: member.ID, Name: member.Name, Email: member.Email}
+		}
+		if !isMember {
+			app.clientError(w, http.StatusForbidden, "You are not a member of this group")
+			return
+		}
+	}
+
+	for _, email := range strings.Split(form.Emails, ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+
+		user, err := app.models.Users.GetByEmail(email)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) || errors.Is(err, sql.ErrNoRows) {
+				app.clientError(w, http.StatusUnprocessableEntity, fmt.Sprintf("No user with the email %s", email))
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		// People outside the organiser's organisation look like they don't
+		// exist.
+		ok, err := app.models.Users.Reachable(userID, user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if !ok {
+			app.clientError(w, http.StatusUnprocessableEntity, fmt.Sprintf("No user with the email %s", email))
+			return
+		}
+		participants[user.ID] = &data.PollParticipant{UserID: user.ID, Name: user.Name, Email: user.Email}
+	}
+
+	if len(participants) < 2 {
+		app.clientError(w, http.StatusUnprocessableEntity, "Invite a group or at least one other user")
+		return
+	}
+
+	for _, p := range participants {
+		poll.Participants = append(poll.Participants, p)
+	}
+
+	pollID, err := app.models.Polls.Insert(poll)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	type EmailData struct {
+		OrganizerName string
+		Title         string
+		PollID        int
+	}
+
+	for _, p := range poll.Participants {
+		if p.UserID == userID {
+			continue
+		}
+		err = app.mailer.Send(p.Email, "poll-invite.tmpl", EmailData{
+			OrganizerName: organizer.Name,
+			Title:         poll.Title,
+			PollID:        pollID,
+		})
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Poll created!")
+	http.Redirect(w, r, fmt.Sprintf("/polls/view/%d", pollID), http.StatusSeeOther)
+}
+
+// getPoll fetches the poll with the ID from the URL, writing the appropriate
+// error response and returning nil if it doesn't exist or the user wasn't
+// invited to it.
+func (app *application) getPoll(w http.ResponseWriter, r *http.Request) *data.Poll {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	pollID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid poll ID in URL")
+		return nil
+	}
+
+	poll, err := app.models.Polls.Get(int(pollID))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "Poll not found")
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	if poll.OrganizerID != userID && !poll.IsParticipant(userID) {
+		app.clientError(w, http.StatusForbidden, "You are not a participant of this poll")
+		return nil
+	}
+
+	return poll
+}
+
+func (app *application) viewPoll(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+
+	poll := app.getPoll(w, r)
+	if poll == nil {
+		return
+	}
+
+	if poll.IsOpen() {
+		app.annotatePollConflicts(poll)
+	}
+
+	templateData.Poll = poll
+	app.render(w, http.StatusOK, "poll.tmpl", templateData)
+}
+
+// annotatePollConflicts marks each option with the participants whose synced
+// calendars already have something at that time. The conflicts are only a
+// hint for voters, so a calendar that can't be read is logged and skipped.
+func (app *application) annotatePollConflicts(poll *data.Poll) {
+	for _, p := range poll.Participants {
+		events, err := app.fetchEventsForUser(p.UserID)
+		if err != nil {
+			app.errorLog.Printf("Error fetching events for user %d: %v\n", p.UserID, err)
+			continue
+		}
+
+		for _, o := range poll.Options {
+			if !isUserAvailable(events, o.StartTime, o.EndTime) {
+				o.Conflicts = append(o.Conflicts, p.Name)
+			}
+		}
+	}
+}
+
+type pollVoteForm struct {
+	Votes               map[int]string `form:"votes"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) votePoll(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	poll := app.getPoll(w, r)
+	if poll == nil {
+		return
+	}
+
+	var form pollVoteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	for optionID, vote := range form.Votes {
+		form.CheckField(poll.Option(optionID) != nil, "votes", "Unknown poll option")
+		form.CheckField(validator.PermittedValue(vote, data.VoteYes, data.VoteIfNeedBe, data.VoteNo), "votes", "Invalid vote")
+	}
+
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity, "Invalid form data")
+		return
+	}
+
+	redirectTo := fmt.Sprintf("/polls/view/%d", poll.ID)
+
+	err = app.models.Polls.Vote(poll.ID, userID, form.Votes)
+	if err != nil {
+		app.pollTransitionError(w, r, err, redirectTo)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your votes have been saved.")
+	http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+}
+
+func (app *application) finalisePoll(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	poll := app.getPoll(w, r)
+	if poll == nil {
+		return
+	}
+
+	if poll.OrganizerID != userID {
+		app.clientError(w, http.StatusForbidden, "Only the organizer can finalise a poll")
+		return
+	}
+
+	optionID, err := strconv.Atoi(r.FormValue("option_id"))
+	option := poll.Option(optionID)
+	if err != nil || option == nil {
+		app.clientError(w, http.StatusUnprocessableEntity, "Unknown poll option")
+		return
+	}
+
+	// The appointment goes in the calendars of the organizer and everyone who
+	// said they could make it.
+	userIDs := []int{poll.OrganizerID}
+	targetID := poll.OrganizerID
+	for _, p := range poll.Participants {
+		vote := option.Votes[p.UserID]
+		if p.UserID == poll.OrganizerID || (vote != data.VoteYes && vote != data.VoteIfNeedBe) {
+			continue
+		}
+		if targetID == poll.OrganizerID {
+			targetID = p.UserID
+		}
+		userIDs = append(userIDs, p.UserID)
+	}
+
+	appointmentType := "individual"
+	if poll.GroupID != 0 {
+		appointmentType = "group"
+	}
+
+	newAppointment := &data.Appointment{
+		CreatorID:       poll.OrganizerID,
+		TargetID:        targetID,
+		AppointmentType: appointmentType,
+		GroupID:         poll.GroupID,
+		Title:           poll.Title,
+		Description:     poll.Description,
+		StartTime:       option.StartTime,
+		EndTime:         option.EndTime,
+		Location:        poll.Location,
+		TimeZone:        "UTC",
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+
+	redirectTo := fmt.Sprintf("/polls/view/%d", poll.ID)
+
+	_, err = app.models.Polls.Finalise(poll.ID, option.ID, newAppointment, userIDs)
+	if err != nil {
+		app.pollTransitionError(w, r, err, redirectTo)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Poll finalised, the appointment is being added to calendars.")
+	http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+}
+
+// pollTransitionError writes the response for a vote or finalisation that
+// failed because the poll was closed in the meantime.
+func (app *application) pollTransitionError(w http.ResponseWriter, r *http.Request, err error, redirectTo string) {
+	switch {
+	case errors.Is(err, data.ErrInvalidTransition):
+		app.sessionManager.Put(r.Context(), "flash", "This poll has already been finalised.")
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.clientError(w, http.StatusForbidden, "You are not a participant of this poll")
+	default:
+		app.serverError(w, err)
+	}
+}
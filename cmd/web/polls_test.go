@@ -0,0 +1,230 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestViewPoll(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  "/polls/view/1",
+			wantCode: http.StatusOK,
+			wantBody: "Test Poll",
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/polls/view/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/polls/view/abc",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "List",
+			urlPath:  "/polls",
+			wantCode: http.StatusOK,
+			wantBody: `<a href="/polls/view/1">Test Poll</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCreatePoll(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/polls")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		title    string
+		emails   string
+		starts   []string
+		ends     []string
+		wantCode int
+	}{
+		{
+			name:     "Valid submission",
+			title:    "Team lunch",
+			emails:   "bob@example.com",
+			starts:   []string{"2023-06-01T12:00", ""},
+			ends:     []string{"2023-06-01T13:00", ""},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Empty title",
+			emails:   "bob@example.com",
+			starts:   []string{"2023-06-01T12:00"},
+			ends:     []string{"2023-06-01T13:00"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "No options",
+			title:    "Team lunch",
+			emails:   "bob@example.com",
+			starts:   []string{""},
+			ends:     []string{""},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Ends before it starts",
+			title:    "Team lunch",
+			emails:   "bob@example.com",
+			starts:   []string{"2023-06-01T12:00"},
+			ends:     []string{"2023-06-01T11:00"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Unknown email",
+			title:    "Team lunch",
+			emails:   "nobody@example.com",
+			starts:   []string{"2023-06-01T12:00"},
+			ends:     []string{"2023-06-01T13:00"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Nobody invited",
+			title:    "Team lunch",
+			starts:   []string{"2023-06-01T12:00"},
+			ends:     []string{"2023-06-01T13:00"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("emails", tt.emails)
+			form["option_start"] = tt.starts
+			form["option_end"] = tt.ends
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, "/polls", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestVotePoll(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/polls/view/1")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		votes    map[string]string
+		wantCode int
+	}{
+		{
+			name:     "Valid votes",
+			urlPath:  "/polls/1/vote",
+			votes:    map[string]string{"votes[1]": "yes", "votes[2]": "if_need_be"},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Invalid vote",
+			urlPath:  "/polls/1/vote",
+			votes:    map[string]string{"votes[1]": "maybe"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Unknown option",
+			urlPath:  "/polls/1/vote",
+			votes:    map[string]string{"votes[3]": "yes"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Non-existent poll",
+			urlPath:  "/polls/2/vote",
+			votes:    map[string]string{"votes[1]": "yes"},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			for k, v := range tt.votes {
+				form.Add(k, v)
+			}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestFinalisePoll(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/polls/view/1")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		optionID string
+		wantCode int
+	}{
+		{
+			name:     "Valid option",
+			optionID: "1",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Unknown option",
+			optionID: "3",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing option",
+			optionID: "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("option_id", tt.optionID)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, "/polls/1/finalise", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
@@ -2,10 +2,11 @@ package main
 
 import (
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/tmgasek/calendar-app/internal/data"
-	"github.com/tmgasek/calendar-app/internal/providers"
 )
 
 type HourlyAvailability struct {
@@ -50,6 +51,12 @@ func (app *application) viewUserProfile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	_, err = app.service.GetVisibleUser(currUserID, int(targetUserID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
 	allEvents, err := app.fetchEventsForUser(int(targetUserID))
 	if err != nil {
 		app.serverError(w, err)
@@ -58,11 +65,37 @@ func (app *application) viewUserProfile(w http.ResponseWriter, r *http.Request)
 
 	start := time.Now()
 	end := start.AddDate(0, 0, 14)
+
+	resources, err := app.models.Resources.GetAll()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Resources picked with ?resource_id= count towards the free slots the
+	// same way the user's own events do.
+	selectedResources := map[int]bool{}
+	for _, resource := range resources {
+		if !slices.Contains(r.URL.Query()["resource_id"], strconv.Itoa(resource.ID)) {
+			continue
+		}
+		selectedResources[resource.ID] = true
+
+		events, err := app.service.ResourceEvents(resource, start, end)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		allEvents = append(allEvents, events...)
+	}
+
 	availability := app.initHourlyAvailability(start, end, allEvents)
 
 	templateData.HourlyAvailability = availability
 	templateData.Hours = [16]int{7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22}
 	templateData.TargetUserID = int(targetUserID)
+	templateData.Resources = resources
+	templateData.SelectedResources = selectedResources
 
 	// Get the groups for the current user.
 	groups, err := app.models.Groups.GetAllForUser(currUserID)
@@ -71,38 +104,22 @@ func (app *application) viewUserProfile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	templateData.Groups = groups
-
-	app.render(w, http.StatusOK, "user-calendar.tmpl", templateData)
-}
-
-func (app *application) fetchEventsForUser(userID int) ([]*data.Event, error) {
-	var allEvents []*data.Event
-	linkedProviders, err := providers.GetLinkedProviders(userID, &app.models, app.googleOAuthConfig, app.azureOAuth2Config)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, p := range linkedProviders {
-		app.infoLog.Printf("Getting events from provider %s for user %d\n", p.Name(), userID)
-		client, err := providers.GetClient(p, userID, &app.models)
-		if err != nil {
-			return nil, err
+	// Load the members so some of them can be marked as optional when
+	// booking a group appointment.
+	for i, group := range groups {
+		if group.Members != nil {
+			continue
 		}
-
-		events, err := p.FetchEvents(userID, client)
+		groups[i], err = app.models.Groups.Get(group.ID)
 		if err != nil {
-			return nil, err
-		}
-
-		for _, event := range events {
-			// Make copy to avoid overwriting.
-			eventCopy := event
-			allEvents = append(allEvents, &eventCopy)
+			app.serverError(w, err)
+			return
 		}
 	}
 
-	return allEvents, nil
+	templateData.Groups = groups
+
+	app.render(w, http.StatusOK, "user-calendar.tmpl", templateData)
 }
 
 // initHourlyAvailability initializes a 14-day hourly availability for a user.
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+func (app *application) viewResources(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	resources, err := app.models.Resources.GetAll()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The user is needed to offer the admin page to administrators.
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData.Resources = resources
+	templateData.User = user
+	app.render(w, http.StatusOK, "resources.tmpl", templateData)
+}
+
+// getResource fetches the resource with the ID from the URL, writing the
+// appropriate error response and returning nil if that isn't possible.
+func (app *application) getResource(w http.ResponseWriter, r *http.Request) *data.Resource {
+	resourceID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid resource ID in URL")
+		return nil
+	}
+
+	resource, err := app.models.Resources.Get(int(resourceID))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "Resource not found")
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	return resource
+}
+
+func (app *application) viewResource(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+
+	resource := app.getResource(w, r)
+	if resource == nil {
+		return
+	}
+
+	start := time.Now()
+	end := start.AddDate(0, 0, 14)
+
+	events, err := app.service.ResourceEvents(resource, start, end)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData.Resource = resource
+	templateData.Events = events
+	templateData.HourlyAvailability = app.initHourlyAvailability(start, end, events)
+	templateData.Hours = [16]int{7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22}
+
+	app.render(w, http.StatusOK, "resource.tmpl", templateData)
+}
+
+func (app *application) manageResources(w http.ResponseWriter, r *http.Request) {
+	templateData := app.newTemplateData(r)
+
+	resources, err := app.models.Resources.GetAll()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData.Resources = resources
+	app.render(w, http.StatusOK, "admin-resources.tmpl", templateData)
+}
+
+type resourceForm struct {
+	Name                string `form:"name"`
+	Kind                string `form:"kind"`
+	Capacity            int    `form:"capacity"`
+	Location            string `form:"location"`
+	Attributes          string `form:"attributes"`
+	AvailableFrom       int    `form:"available_from"`
+	AvailableUntil      int    `form:"available_until"`
+	validator.Validator `form:"-"`
+}
+
+// decodeResourceForm reads and validates the resource fields shared by the
+// create and update forms, writing an error response and returning nil if
+// they aren't valid.
+func (app *application) decodeResourceForm(w http.ResponseWriter, r *http.Request) *data.Resource {
+	var form resourceForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return nil
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 255), "name", "This field is too long")
+	form.CheckField(validator.PermittedValue(form.Kind, data.ResourceRoom, data.ResourceEquipment, data.ResourceDesk), "kind", "Invalid kind of resource")
+	form.CheckField(form.Capacity >= 0, "capacity", "Capacity can't be negative")
+	form.CheckField(validator.MaxChars(form.Location, 255), "location", "This field is too long")
+	form.CheckField(0 <= form.AvailableFrom && form.AvailableFrom < form.AvailableUntil && form.AvailableUntil <= 24, "available_from", "Available hours must be between 0 and 24")
+
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity, "Invalid form data")
+		return nil
+	}
+
+	attributes := []string{}
+	for _, a := range strings.Split(form.Attributes, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			attributes = append(attributes, a)
+		}
+	}
+
+	return &data.Resource{
+		Name:           form.Name,
+		Kind:           form.Kind,
+		Capacity:       form.Capacity,
+		Location:       form.Location,
+		Attributes:     attributes,
+		AvailableFrom:  form.AvailableFrom,
+		AvailableUntil: form.AvailableUntil,
+	}
+}
+
+func (app *application) createResource(w http.ResponseWriter, r *http.Request) {
+	resource := app.decodeResourceForm(w, r)
+	if resource == nil {
+		return
+	}
+
+	_, err := app.models.Resources.Insert(resource)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Resource created!")
+	http.Redirect(w, r, "/admin/resources", http.StatusSeeOther)
+}
+
+func (app *application) updateResource(w http.ResponseWriter, r *http.Request) {
+	resourceID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid resource ID in URL")
+		return
+	}
+
+	resource := app.decodeResourceForm(w, r)
+	if resource == nil {
+		return
+	}
+	resource.ID = int(resourceID)
+
+	err = app.models.Resources.Update(resource)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "Resource not found")
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Resource updated!")
+	http.Redirect(w, r, "/admin/resources", http.StatusSeeOther)
+}
+
+func (app *application) deleteResource(w http.ResponseWriter, r *http.Request) {
+	resourceID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid resource ID in URL")
+		return
+	}
+
+	err = app.models.Resources.Delete(int(resourceID))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "Resource not found")
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Resource deleted.")
+	http.Redirect(w, r, "/admin/resources", http.StatusSeeOther)
+}
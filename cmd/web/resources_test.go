@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestViewResources(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "List",
+			urlPath:  "/resources",
+			wantCode: http.StatusOK,
+			wantBody: `<a href="/admin/resources">Manage resources</a>`,
+		},
+		{
+			name:     "Calendar",
+			urlPath:  "/resources/view/1",
+			wantCode: http.StatusOK,
+			wantBody: "Bookable between 8:00 and 18:00 UTC",
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/resources/view/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/resources/view/abc",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Admin page",
+			urlPath:  "/admin/resources",
+			wantCode: http.StatusOK,
+			wantBody: "projector, whiteboard",
+		},
+		{
+			name:     "Availability with resource",
+			urlPath:  "/users/profile/2?resource_id=1",
+			wantCode: http.StatusOK,
+			wantBody: `<input type="checkbox" name="resource_id" value="1" checked>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestManageResources(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/admin/resources")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		kind     string
+		from     string
+		until    string
+		wantCode int
+	}{
+		{
+			name:     "Create",
+			urlPath:  "/admin/resources",
+			kind:     "room",
+			from:     "8",
+			until:    "18",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Invalid kind",
+			urlPath:  "/admin/resources",
+			kind:     "car",
+			from:     "8",
+			until:    "18",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Closes before it opens",
+			urlPath:  "/admin/resources",
+			kind:     "desk",
+			from:     "18",
+			until:    "8",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Update",
+			urlPath:  "/admin/resources/1/update",
+			kind:     "equipment",
+			from:     "0",
+			until:    "24",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Update non-existent",
+			urlPath:  "/admin/resources/2/update",
+			kind:     "equipment",
+			from:     "0",
+			until:    "24",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Delete",
+			urlPath:  "/admin/resources/1/delete",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Delete non-existent",
+			urlPath:  "/admin/resources/2/delete",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", "Board Room")
+			form.Add("kind", tt.kind)
+			form.Add("capacity", "10")
+			form.Add("attributes", "projector, video")
+			form.Add("available_from", tt.from)
+			form.Add("available_until", tt.until)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestCreateAppointmentRequestWithResource(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/users/profile/2")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		resourceID string
+		startTime  string
+		endTime    string
+		wantCode   int
+	}{
+		{
+			name:       "Open resource",
+			resourceID: "1",
+			startTime:  "2023-06-01T10:00",
+			endTime:    "2023-06-01T11:00",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Resource closed",
+			resourceID: "1",
+			startTime:  "2023-06-01T19:00",
+			endTime:    "2023-06-01T20:00",
+			wantCode:   http.StatusConflict,
+		},
+		{
+			name:       "Non-existent resource",
+			resourceID: "2",
+			startTime:  "2023-06-01T10:00",
+			endTime:    "2023-06-01T11:00",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Planning")
+			form.Add("description", "Quarterly planning")
+			form.Add("start_time", tt.startTime)
+			form.Add("end_time", tt.endTime)
+			form.Add("resource_ids", tt.resourceID)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, "/appointments/create/2", form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
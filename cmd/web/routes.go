@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
@@ -13,14 +14,35 @@ func (app *application) routes() http.Handler {
 
 	// create wrapper around our NotFound() helper.
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAPIRequest(r) {
+			app.apiNotFound(w)
+			return
+		}
 		app.clientError(w, http.StatusNotFound, "Page not found")
 	})
 
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAPIRequest(r) {
+			app.apiMethodNotAllowed(w, r)
+			return
+		}
+		app.clientError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+
 	fileServer := http.FileServer(http.FS(ui.Files))
 	router.Handler(http.MethodGet, "/static/*filepath", fileServer)
 
 	router.HandlerFunc(http.MethodGet, "/ping", ping)
 
+	// Calendar feeds are fetched by calendar apps, which have no session.
+	router.HandlerFunc(http.MethodGet, "/feeds/:token", app.viewCalendarFeed)
+	router.HandlerFunc(http.MethodGet, "/groups/feeds/:token", app.viewGroupCalendarFeed)
+
+	// Calendar providers notify us of changes without a session either; the
+	// handlers check the channel tokens instead.
+	router.HandlerFunc(http.MethodPost, "/notifications/google", app.googleNotification)
+	router.HandlerFunc(http.MethodPost, "/notifications/microsoft", app.microsoftNotification)
+
 	// For dynamic routes.
 	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
 
@@ -29,18 +51,44 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactor))
+	router.Handler(http.MethodPost, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactorPost))
+	router.Handler(http.MethodGet, "/user/oidc/:provider", dynamic.ThenFunc(app.oidcLogin))
+	router.Handler(http.MethodGet, "/user/oidc/:provider/callback", dynamic.ThenFunc(app.oidcLoginCallback))
+	router.Handler(http.MethodGet, "/user/activate", dynamic.ThenFunc(app.userActivate))
+	router.Handler(http.MethodPost, "/user/activate", dynamic.ThenFunc(app.userActivatePost))
+	router.Handler(http.MethodGet, "/invitations/respond", dynamic.ThenFunc(app.respondToInvitation))
+	router.Handler(http.MethodPost, "/invitations/respond", dynamic.ThenFunc(app.respondToInvitationPost))
+	router.Handler(http.MethodGet, "/user/password/forgot", dynamic.ThenFunc(app.forgotPassword))
+	router.Handler(http.MethodPost, "/user/password/forgot", dynamic.ThenFunc(app.forgotPasswordPost))
+	router.Handler(http.MethodGet, "/user/password/reset", dynamic.ThenFunc(app.resetPassword))
+	router.Handler(http.MethodPost, "/user/password/reset", dynamic.ThenFunc(app.resetPasswordPost))
 
 	// Protected application routes.
-	protected := dynamic.Append(app.requireAuthentication)
+	protected := dynamic.Append(app.requireAuthentication, app.requireTwoFactorEnrolment, app.recordImpersonation)
+	// Credentials and security settings, which admins can't use while
+	// impersonating someone.
+	personal := protected.Append(app.refuseWhileImpersonating)
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodPost, "/user/logout/everywhere", personal.ThenFunc(app.logoutEverywhere))
+	router.Handler(http.MethodPost, "/user/activate/resend", protected.ThenFunc(app.resendActivation))
+	router.Handler(http.MethodGet, "/user/password", personal.ThenFunc(app.changePassword))
+	router.Handler(http.MethodPost, "/user/password", personal.ThenFunc(app.changePasswordPost))
+	router.Handler(http.MethodGet, "/user/2fa", personal.ThenFunc(app.viewTwoFactor))
+	router.Handler(http.MethodPost, "/user/2fa/setup", personal.ThenFunc(app.beginTwoFactor))
+	router.Handler(http.MethodPost, "/user/2fa/confirm", personal.ThenFunc(app.confirmTwoFactor))
+	router.Handler(http.MethodPost, "/user/2fa/recovery-codes", personal.ThenFunc(app.regenerateRecoveryCodes))
+	router.Handler(http.MethodPost, "/user/2fa/disable", personal.ThenFunc(app.disableTwoFactor))
 
 	// Google OAuth routes.
-	router.Handler(http.MethodGet, "/oauth/google/link", protected.ThenFunc(app.linkGoogleAccount))
-	router.Handler(http.MethodGet, "/oauth/google/callback", protected.ThenFunc(app.handleGoogleCalendarCallback))
+	router.Handler(http.MethodGet, "/oauth/google/link", personal.ThenFunc(app.linkGoogleAccount))
+	router.Handler(http.MethodGet, "/oauth/google/callback", personal.ThenFunc(app.handleGoogleCalendarCallback))
 
 	// Microsoft OAuth routes.
-	router.Handler(http.MethodGet, "/oauth/microsoft/link", protected.ThenFunc(app.redirectToMicrosoftLogin))
-	router.Handler(http.MethodGet, "/oauth/microsoft/callback", protected.ThenFunc(app.handleMicrosoftAuthCallback))
+	router.Handler(http.MethodGet, "/oauth/microsoft/link", personal.ThenFunc(app.redirectToMicrosoftLogin))
+	router.Handler(http.MethodGet, "/oauth/microsoft/callback", personal.ThenFunc(app.handleMicrosoftAuthCallback))
+
+	router.Handler(http.MethodPost, "/oauth/:provider/unlink", personal.ThenFunc(app.unlinkProvider))
 
 	// Profile views
 	router.Handler(http.MethodGet, "/users/profile", protected.ThenFunc(app.userProfile))
@@ -52,22 +100,115 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/appointments", protected.ThenFunc(app.viewAppointments))
 	router.Handler(http.MethodPost, "/appointments/create/:id", protected.ThenFunc(app.createAppointmentRequest))
 	router.Handler(http.MethodPost, "/appointments/delete/:id", protected.ThenFunc(app.deleteAppointment))
+	router.Handler(http.MethodGet, "/appointments/ics/:id", protected.ThenFunc(app.downloadAppointment))
 
 	// Appointment Requests
 	router.Handler(http.MethodGet, "/requests", protected.ThenFunc(app.viewAppointmentRequests))
+	router.Handler(http.MethodGet, "/requests/outgoing", protected.ThenFunc(app.viewOutgoingAppointmentRequests))
 	router.Handler(http.MethodPost, "/requests/:id/update", protected.ThenFunc(app.updateAppointmentRequest))
+	router.Handler(http.MethodPost, "/requests/:id/cancel", protected.ThenFunc(app.cancelAppointmentRequest))
+
+	// Live updates
+	router.Handler(http.MethodGet, "/events", protected.ThenFunc(app.liveEvents))
+
+	// Polls
+	router.Handler(http.MethodGet, "/polls", protected.ThenFunc(app.viewPolls))
+	router.Handler(http.MethodPost, "/polls", protected.ThenFunc(app.createPoll))
+	router.Handler(http.MethodGet, "/polls/view/:id", protected.ThenFunc(app.viewPoll))
+	router.Handler(http.MethodPost, "/polls/:id/vote", protected.ThenFunc(app.votePoll))
+	router.Handler(http.MethodPost, "/polls/:id/finalise", protected.ThenFunc(app.finalisePoll))
+
+	// Resources
+	router.Handler(http.MethodGet, "/resources", protected.ThenFunc(app.viewResources))
+	router.Handler(http.MethodGet, "/resources/view/:id", protected.ThenFunc(app.viewResource))
+
+	// Administration
+	admin := protected.Append(app.requireAdmin)
+	router.Handler(http.MethodGet, "/admin", admin.ThenFunc(app.adminConsole))
+	router.Handler(http.MethodGet, "/admin/users/:id", admin.ThenFunc(app.adminViewUser))
+	router.Handler(http.MethodPost, "/admin/users/:id/disable", admin.ThenFunc(app.adminDisableUser))
+	router.Handler(http.MethodPost, "/admin/users/:id/enable", admin.ThenFunc(app.adminEnableUser))
+	router.Handler(http.MethodPost, "/admin/users/:id/impersonate", admin.ThenFunc(app.adminImpersonateUser))
+	router.Handler(http.MethodPost, "/admin/users/:id/relink", admin.ThenFunc(app.adminRelinkUser))
+	router.Handler(http.MethodGet, "/admin/sync-errors", admin.ThenFunc(app.adminSyncErrors))
+	router.Handler(http.MethodGet, "/admin/mail-failures", admin.ThenFunc(app.adminMailFailures))
+	router.Handler(http.MethodGet, "/admin/audit", admin.ThenFunc(app.adminAuditLog))
+	// While impersonating, the user is the one being impersonated, so this
+	// can't require an admin, nor that they've set up two-factor login.
+	router.Handler(http.MethodPost, "/admin/impersonation/stop", dynamic.Append(app.requireAuthentication).ThenFunc(app.stopImpersonating))
+	router.Handler(http.MethodGet, "/admin/resources", admin.ThenFunc(app.manageResources))
+	router.Handler(http.MethodPost, "/admin/resources", admin.ThenFunc(app.createResource))
+	router.Handler(http.MethodPost, "/admin/resources/:id/update", admin.ThenFunc(app.updateResource))
+	router.Handler(http.MethodPost, "/admin/resources/:id/delete", admin.ThenFunc(app.deleteResource))
+	router.Handler(http.MethodGet, "/admin/organisations", admin.ThenFunc(app.manageOrganisations))
+	router.Handler(http.MethodPost, "/admin/organisations", admin.ThenFunc(app.createOrganisation))
+
+	// Organisations
+	router.Handler(http.MethodGet, "/organisation", protected.ThenFunc(app.viewMyOrganisation))
+	router.Handler(http.MethodGet, "/organisations/view/:id", protected.ThenFunc(app.viewOrganisation))
+	router.Handler(http.MethodPost, "/organisations/members/:id", protected.ThenFunc(app.addOrganisationMember))
+	router.Handler(http.MethodPost, "/organisations/remove/:id", protected.ThenFunc(app.removeOrganisationMember))
+	router.Handler(http.MethodPost, "/organisations/role/:id", protected.ThenFunc(app.setOrganisationMemberRole))
+	router.Handler(http.MethodPost, "/organisations/share/:id", protected.ThenFunc(app.shareOrganisation))
+	router.Handler(http.MethodPost, "/organisations/unshare/:id", protected.ThenFunc(app.unshareOrganisation))
 
 	// Settings
 	router.Handler(http.MethodGet, "/settings", protected.ThenFunc(app.viewSettings))
+	router.Handler(http.MethodPost, "/settings/tokens", personal.ThenFunc(app.createAPIToken))
+	router.Handler(http.MethodPost, "/settings/tokens/:id/delete", personal.ThenFunc(app.deleteAPIToken))
+	router.Handler(http.MethodPost, "/settings/feed", personal.ThenFunc(app.createCalendarFeed))
+	router.Handler(http.MethodPost, "/settings/feed/delete", personal.ThenFunc(app.deleteCalendarFeed))
+	router.Handler(http.MethodGet, "/settings/sessions", protected.ThenFunc(app.viewSessions))
+	router.Handler(http.MethodPost, "/settings/sessions/:id/delete", personal.ThenFunc(app.deleteSession))
+	router.Handler(http.MethodGet, "/settings/export", personal.ThenFunc(app.downloadAccountData))
+	router.Handler(http.MethodGet, "/settings/delete", personal.ThenFunc(app.deleteAccount))
+	router.Handler(http.MethodPost, "/settings/delete", personal.ThenFunc(app.deleteAccountPost))
+
+	router.Handler(http.MethodGet, "/webhooks", personal.ThenFunc(app.viewWebhooks))
+	router.Handler(http.MethodPost, "/webhooks", personal.ThenFunc(app.createWebhook))
+	router.Handler(http.MethodGet, "/webhooks/view/:id", personal.ThenFunc(app.viewWebhook))
+	router.Handler(http.MethodPost, "/webhooks/:id/delete", personal.ThenFunc(app.deleteWebhook))
+	router.Handler(http.MethodPost, "/webhooks/:id/redeliver", personal.ThenFunc(app.redeliverWebhook))
 
 	// Groups
 	router.Handler(http.MethodGet, "/groups", protected.ThenFunc(app.viewGroupsPage))
 	router.Handler(http.MethodGet, "/groups/view/:id", protected.ThenFunc(app.viewOneGroupPage))
+	router.Handler(http.MethodGet, "/groups/availability/:id", protected.ThenFunc(app.viewGroupAvailability))
 	router.Handler(http.MethodPost, "/groups", protected.ThenFunc(app.createGroup))
 	router.Handler(http.MethodPost, "/groups/invite/:id", protected.ThenFunc(app.inviteUserToGroup))
+	router.Handler(http.MethodPost, "/groups/edit/:id", protected.ThenFunc(app.editGroup))
+	router.Handler(http.MethodPost, "/groups/delete/:id", protected.ThenFunc(app.deleteGroup))
+	router.Handler(http.MethodPost, "/groups/leave/:id", protected.ThenFunc(app.leaveGroup))
+	router.Handler(http.MethodPost, "/groups/remove/:id", protected.ThenFunc(app.removeGroupMember))
+	router.Handler(http.MethodPost, "/groups/role/:id", protected.ThenFunc(app.setGroupMemberRole))
+	router.Handler(http.MethodPost, "/groups/transfer/:id", protected.ThenFunc(app.transferGroupOwnership))
+	router.Handler(http.MethodPost, "/groups/cancel-invitation/:id", protected.ThenFunc(app.cancelGroupInvitation))
+	router.Handler(http.MethodPost, "/groups/calendar/:id", protected.ThenFunc(app.setGroupCalendar))
+	router.Handler(http.MethodPost, "/groups/feed/:id", personal.ThenFunc(app.createGroupCalendarFeed))
+	router.Handler(http.MethodPost, "/groups/delete-feed/:id", personal.ThenFunc(app.deleteGroupCalendarFeed))
+
+	// Invitations to groups
+	router.Handler(http.MethodGet, "/invitations", protected.ThenFunc(app.viewInvitationsPage))
+	router.Handler(http.MethodPost, "/invitations/accept/:id", protected.ThenFunc(app.acceptGroupInvitation))
+	router.Handler(http.MethodPost, "/invitations/decline/:id", protected.ThenFunc(app.declineGroupInvitation))
+
+	// JSON API. It shares the session cookie with the pages above, but
+	// instead of CSRF tokens it only accepts JSON bodies. Scripts can use a
+	// personal API token instead of the cookie.
+	api := alice.New(app.sessionManager.LoadAndSave, app.authenticate, app.authenticateToken, app.requireAPIAuthentication, app.requireAPITwoFactorEnrolment, app.recordImpersonation, app.requireTokenScope, requireJSON)
+	for _, route := range app.apiRoutes() {
+		router.Handler(route.Method, route.Path, api.ThenFunc(route.Handler))
+	}
+	router.HandlerFunc(http.MethodGet, "/api/v1/openapi.json", app.apiOpenAPI)
 
 	// Create a new middleware chain.
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
 
 	return standard.Then(router)
 }
+
+// isAPIRequest reports whether the request is for the JSON API, so errors
+// from the router can be sent back as JSON.
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// describeDevice returns a short description of the browser and system of a
+// user agent, like "Firefox on Windows".
+func describeDevice(userAgent string) string {
+	var browser string
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	var system string
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		system = "iOS"
+	case strings.Contains(userAgent, "Android"):
+		system = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		system = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		system = "Linux"
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
+
+// viewSessions lists where the user is logged in.
+func (app *application) viewSessions(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessions, err := app.models.UserSessions.GetAllForUser(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.UserSessions = sessions
+	templateData.CurrentSessionID = app.sessionManager.GetInt(r.Context(), "sessionID")
+	app.render(w, http.StatusOK, "sessions.tmpl", templateData)
+}
+
+// deleteSession logs out one of the user's sessions, which may be this one.
+func (app *application) deleteSession(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	sessionID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid session ID in URL")
+		return
+	}
+
+	if int(sessionID) == app.sessionManager.GetInt(r.Context(), "sessionID") {
+		err = app.logOut(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", "You've been logged out.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	err = app.models.UserSessions.Delete(int(sessionID), userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "Session not found")
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "That device has been logged out.")
+	http.Redirect(w, r, "/settings/sessions", http.StatusSeeOther)
+}
+
+// logoutEverywhere logs out every session of the user, including this one.
+func (app *application) logoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err := app.models.UserSessions.DeleteAllForUser(userID, 0)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.logOut(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out everywhere.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
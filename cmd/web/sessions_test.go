@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0", "Firefox on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 Edg/119.0.0.0", "Edge on Windows"},
+		{"Go-http-client/1.1", "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, describeDevice(tt.userAgent), tt.want)
+	}
+}
+
+// getWith fetches the page with the client and returns the status code.
+func getWith(t *testing.T, ts *testServer, client *http.Client, urlPath string) int {
+	rs, err := client.Get(ts.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	io.Copy(io.Discard, rs.Body)
+
+	return rs.StatusCode
+}
+
+func TestViewSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	login(t, ts, ts.Client())
+	login(t, ts, ts.newClient(t))
+
+	code, _, body := ts.get(t, "/settings/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Count(body, "/delete\" method=\"post\""), 2)
+	assert.Equal(t, strings.Count(body, "This device"), 1)
+	assert.StringContains(t, body, "127.0.0.1")
+}
+
+func TestDeleteSession(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The mock numbers sessions from 100 in the order they're made.
+	validCSRFToken := login(t, ts, ts.Client())
+	other := ts.newClient(t)
+	login(t, ts, other)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ := ts.postForm(t, "/settings/sessions/101/delete", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	assert.Equal(t, getWith(t, ts, other, "/settings"), http.StatusSeeOther)
+	assert.Equal(t, getWith(t, ts, ts.Client(), "/settings"), http.StatusOK)
+
+	// Sessions that are gone, or someone else's, can't be found.
+	code, _, _ = ts.postForm(t, "/settings/sessions/101/delete", form)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// Logging out this device logs out the browser.
+	code, header, _ := ts.postForm(t, "/settings/sessions/100/delete", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	assert.Equal(t, getWith(t, ts, ts.Client(), "/settings"), http.StatusSeeOther)
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := login(t, ts, ts.Client())
+	other := ts.newClient(t)
+	login(t, ts, other)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, header, _ := ts.postForm(t, "/user/logout/everywhere", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	assert.Equal(t, getWith(t, ts, ts.Client(), "/settings"), http.StatusSeeOther)
+	assert.Equal(t, getWith(t, ts, other, "/settings"), http.StatusSeeOther)
+}
+
+func TestTwoFactorEnrolmentLogsOutOtherSessions(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.TwoFactor.(*mocks.TwoFactorModel).Begun = mocks.MockTOTPSecret
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	validCSRFToken := login(t, ts, ts.Client())
+	other := ts.newClient(t)
+	login(t, ts, other)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+	form.Add("code", currentCode(t, mocks.MockTOTPSecret))
+
+	code, _, _ := ts.postForm(t, "/user/2fa/confirm", form)
+	assert.Equal(t, code, http.StatusCreated)
+
+	assert.Equal(t, getWith(t, ts, ts.Client(), "/settings"), http.StatusOK)
+	assert.Equal(t, getWith(t, ts, other, "/settings"), http.StatusSeeOther)
+}
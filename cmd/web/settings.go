@@ -1,13 +1,17 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/tmgasek/calendar-app/internal/data"
 	"github.com/tmgasek/calendar-app/internal/providers"
+	"github.com/tmgasek/calendar-app/internal/validator"
 )
 
-func (app *application) viewSettings(w http.ResponseWriter, r *http.Request) {
+// settingsData loads everything shown on the settings page.
+func (app *application) settingsData(r *http.Request) (*templateData, error) {
 	templateData := app.newTemplateData(r)
 
 	// Get the user ID from the session.
@@ -16,21 +20,13 @@ func (app *application) viewSettings(w http.ResponseWriter, r *http.Request) {
 	// Get the user record from the database.
 	user, err := app.models.Users.Get(userID)
 	if err != nil {
-		app.serverError(w, err)
-		return
-	}
-
-	// If the user record doesn't exist, return a 404 Not Found response.
-	if user == nil {
-		app.clientError(w, http.StatusNotFound, "User not found")
-		return
+		return nil, err
 	}
 
 	// We want to show if user has linkd their Google or Microsoft account.
 	linkedProviders, err := providers.GetLinkedProviders(userID, &app.models, app.googleOAuthConfig, app.azureOAuth2Config)
 	if err != nil {
-		app.serverError(w, err)
-		return
+		return nil, err
 	}
 
 	settings := &data.Settings{}
@@ -44,10 +40,114 @@ func (app *application) viewSettings(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	tokens, err := app.models.APITokens.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := app.models.CalendarFeeds.GetForUser(userID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
 	// If the user record exists, add it to the template data.
 	templateData.User = user
+	templateData.CalendarFeed = feed
 	templateData.Settings = settings
+	templateData.APITokens = tokens
+	templateData.Form = apiTokenForm{Scopes: []string{data.ScopeRead}, ExpiryDays: 90}
+
+	return templateData, nil
+}
+
+func (app *application) viewSettings(w http.ResponseWriter, r *http.Request) {
+	templateData, err := app.settingsData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// If the user record doesn't exist, return a 404 Not Found response.
+	if templateData.User == nil {
+		app.clientError(w, http.StatusNotFound, "User not found")
+		return
+	}
 
 	// Render the profile settings page.
 	app.render(w, http.StatusOK, "settings.tmpl", templateData)
 }
+
+type apiTokenForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
+	ExpiryDays          int      `form:"expiry_days"`
+	validator.Validator `form:"-"`
+}
+
+// createAPIToken shows the new token on the settings page straight away
+// rather than redirecting, as it can't be shown again once the page is
+// left.
+func (app *application) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form apiTokenForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.ExpiryDays, 0, 30, 90, 365), "expiry_days", "Invalid expiry")
+	ttl := time.Duration(form.ExpiryDays) * 24 * time.Hour
+	data.ValidateAPIToken(&form.Validator, form.Name, form.Scopes, ttl)
+
+	if !form.Valid() {
+		templateData, err := app.settingsData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "settings.tmpl", templateData)
+		return
+	}
+
+	token, err := app.models.APITokens.New(userID, form.Name, form.Scopes, ttl)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData, err := app.settingsData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	templateData.NewAPIToken = token
+
+	app.render(w, http.StatusCreated, "settings.tmpl", templateData)
+}
+
+func (app *application) deleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	tokenID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid token ID in URL")
+		return
+	}
+
+	err = app.models.APITokens.Delete(int(tokenID), userID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "API token not found")
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "API token revoked.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"net/url"
 	"testing"
 
 	"github.com/tmgasek/calendar-app/internal/assert"
@@ -17,3 +18,113 @@ func TestAuthedSettingsPage(t *testing.T) {
 
 	assert.Equal(t, code, http.StatusOK)
 }
+
+func TestCreateAPIToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/settings")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		tokenName  string
+		scopes     []string
+		expiryDays string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:       "Valid submission",
+			tokenName:  "Deploy bot",
+			scopes:     []string{"read", "write"},
+			expiryDays: "30",
+			wantCode:   http.StatusCreated,
+			wantBody:   "cal_newtoken",
+		},
+		{
+			name:       "Blank name",
+			scopes:     []string{"read"},
+			expiryDays: "30",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot be blank",
+		},
+		{
+			name:       "No scopes",
+			tokenName:  "Deploy bot",
+			expiryDays: "30",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "Choose at least one scope",
+		},
+		{
+			name:       "Invalid scope",
+			tokenName:  "Deploy bot",
+			scopes:     []string{"admin"},
+			expiryDays: "30",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "Invalid scope",
+		},
+		{
+			name:       "Invalid expiry",
+			tokenName:  "Deploy bot",
+			scopes:     []string{"read"},
+			expiryDays: "7",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", tt.tokenName)
+			for _, scope := range tt.scopes {
+				form.Add("scopes", scope)
+			}
+			form.Add("expiry_days", tt.expiryDays)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/settings/tokens", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestDeleteAPIToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/settings")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Own token",
+			urlPath:  "/settings/tokens/1/delete",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Unknown token",
+			urlPath:  "/settings/tokens/99/delete",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/tmgasek/calendar-app/internal/data"
@@ -11,23 +12,64 @@ import (
 )
 
 type templateData struct {
-	Form                any
-	Flash               string
-	IsAuthenticated     bool
-	CSRFToken           string
-	UserId              int
-	Events              []*data.Event
-	HourlyAvailability  []HourlyAvailability
-	Hours               [16]int
-	AppointmentRequests []*data.AppointmentRequest
-	Appointments        []*data.Appointment
-	User                *data.User
-	Users               []*data.User
-	Settings            *data.Settings
-	TargetUserID        int
-	Groups              []*data.Group
-	Group               *data.Group
-	ErrorData           *ErrorData
+	Form                  any
+	Flash                 string
+	IsAuthenticated       bool
+	CSRFToken             string
+	UserId                int
+	ImpersonatorID        int
+	PendingRequests       int
+	Events                []*data.Event
+	HourlyAvailability    []HourlyAvailability
+	Hours                 [16]int
+	AppointmentRequests   []*data.AppointmentRequest
+	Appointments          []*data.Appointment
+	User                  *data.User
+	Users                 []*data.User
+	Settings              *data.Settings
+	TargetUserID          int
+	Groups                []*data.Group
+	Group                 *data.Group
+	GroupRole             string
+	GroupInvitations      []*data.GroupInvitation
+	GroupInvitation       *data.GroupInvitation
+	GroupHeatmap          *groupHeatmap
+	GroupAppointments     []*data.Appointment
+	GroupCalendarFeed     *data.GroupCalendarFeed
+	Organisations         []*data.Organisation
+	Organisation          *data.Organisation
+	OrganisationMembers   []*data.OrganisationMember
+	OrganisationShares    []*data.Organisation
+	CanManageOrganisation bool
+	Polls                 []*data.Poll
+	Poll                  *data.Poll
+	Resources             []*data.Resource
+	Resource              *data.Resource
+	SelectedResources     map[int]bool
+	APITokens             []*data.APIToken
+	NewAPIToken           *data.APIToken
+	CalendarFeed          *data.CalendarFeed
+	NewFeedURL            string
+	Webhooks              []*data.Webhook
+	Webhook               *data.Webhook
+	WebhookDeliveries     []*data.WebhookDelivery
+	WebhookEvents         []string
+	TwoFactor             *data.TwoFactor
+	TOTPURI               template.URL
+	RecoveryCodes         []string
+	RecoveryCodesLeft     int
+	RequireTwoFactor      bool
+	LoginProviders        []*loginProvider
+	UserSessions          []*data.UserSession
+	CurrentSessionID      int
+	AuditEntries          []*data.AuditEntry
+	MailFailures          []*data.MailFailure
+	CalendarSyncs         []*data.CalendarSync
+	ProviderOperations    []*data.ProviderOperation
+	AuthTokens            []*data.AuthToken
+	Metadata              data.Metadata
+	Query                 string
+	ErrorData             *ErrorData
 }
 
 func humanDate(t time.Time) string {
@@ -49,11 +91,19 @@ func formatEventTimes(start, end time.Time) string {
 	}
 }
 
+// add is for page numbers in pagination links.
+func add(a, b int) int {
+	return a + b
+}
+
 // Init empty funcMap obj and store it in a global var. String keyed map acting
 // as a lookup between the names of custom template funcs and actual funcs.
 var functions = template.FuncMap{
 	"humanDate":        humanDate,
 	"formatEventTimes": formatEventTimes,
+	"join":             strings.Join,
+	"device":           describeDevice,
+	"add":              add,
 }
 
 // Only parse files once when app starts, then store the parsed templates in
@@ -11,12 +11,15 @@ import (
 	"net/url"
 	// "os"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	"github.com/tmgasek/calendar-app/internal/data/mocks"
+	"github.com/tmgasek/calendar-app/internal/service"
+	"github.com/tmgasek/calendar-app/internal/sse"
 )
 
 var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)" />`)
@@ -42,7 +45,7 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
-	return &application{
+	app := &application{
 		errorLog:       log.New(io.Discard, "", 0),
 		infoLog:        log.New(io.Discard, "", 0),
 		models:         mocks.NewMockModels(),
@@ -50,7 +53,13 @@ func newTestApplication(t *testing.T) *application {
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
 		mailer:         mocks.NewMockMailer(),
+		baseURL:        "https://calendar.example.com",
+		hub:            sse.NewHub(100),
+		webhookClient:  newWebhookClient(),
 	}
+	app.service = service.New(app.models, app.mailer, app.fetchEventsForUser)
+
+	return app
 }
 
 type testServer struct {
@@ -74,6 +83,21 @@ func newTestServer(t *testing.T, h http.Handler) *testServer {
 	return &testServer{ts}
 }
 
+// newClient returns a client for the server with its own cookies, like a
+// second browser.
+func (ts *testServer) newClient(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Client{
+		Transport:     ts.Client().Transport,
+		Jar:           jar,
+		CheckRedirect: ts.Client().CheckRedirect,
+	}
+}
+
 func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
 	rs, err := ts.Client().Get(ts.URL + urlPath)
 	if err != nil {
@@ -106,6 +130,44 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	return rs.StatusCode, rs.Header, string(body)
 }
 
+// requestJSON sends a request with a JSON body, or no body if it's empty.
+func (ts *testServer) requestJSON(t *testing.T, method, urlPath, body string) (int, http.Header, string) {
+	return ts.requestJSONWithToken(t, method, urlPath, body, "")
+}
+
+// requestJSONWithToken is requestJSON with an API token in the
+// Authorization header.
+func (ts *testServer) requestJSONWithToken(t *testing.T, method, urlPath, body, token string) (int, http.Header, string) {
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+urlPath, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(b)
+}
+
 func (app *application) mockAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		app.sessionManager.Put(r.Context(), "authenticatedUserID", 1)
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/totp"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// totpIssuer is the name authenticator apps show next to the codes.
+const totpIssuer = "Calendar Genie"
+
+const (
+	// twoFactorLoginTimeout is how long after entering their password a
+	// user has to enter a code.
+	twoFactorLoginTimeout = 5 * time.Minute
+	// maxTwoFactorAttempts is how many wrong codes can be entered before
+	// the password has to be entered again.
+	maxTwoFactorAttempts = 5
+)
+
+// startTwoFactorLogin remembers that the user has entered their password,
+// so they can go on to enter a code. They aren't logged in until then.
+func (app *application) startTwoFactorLogin(r *http.Request, userID int) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), "twoFactorUserID", userID)
+	app.sessionManager.Put(r.Context(), "twoFactorStartedAt", time.Now().Unix())
+	app.sessionManager.Put(r.Context(), "twoFactorAttempts", 0)
+
+	return nil
+}
+
+// pendingTwoFactorUser returns the user who has entered their password and
+// still has to enter a code, or 0 if there's nobody or they took too long.
+func (app *application) pendingTwoFactorUser(r *http.Request) int {
+	userID := app.sessionManager.GetInt(r.Context(), "twoFactorUserID")
+	startedAt := app.sessionManager.GetInt64(r.Context(), "twoFactorStartedAt")
+
+	if userID == 0 || time.Since(time.Unix(startedAt, 0)) > twoFactorLoginTimeout {
+		return 0
+	}
+	return userID
+}
+
+func (app *application) clearTwoFactorLogin(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorStartedAt")
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+}
+
+// checkTwoFactorCode checks a code from the user's authenticator app, which
+// can only be used once, or else one of their recovery codes. It reports
+// whether the code was good and whether it was a recovery code.
+func (app *application) checkTwoFactorCode(tf *data.TwoFactor, code string) (ok, recovery bool, err error) {
+	code = strings.TrimSpace(code)
+
+	counter, valid := totp.Validate(tf.Secret, code, time.Now())
+	if valid {
+		err = app.models.TwoFactor.UseCounter(tf.UserID, counter)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, false, nil
+		}
+		return err == nil, false, err
+	}
+
+	err = app.models.TwoFactor.UseRecoveryCode(tf.UserID, code)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return false, false, nil
+	}
+	return err == nil, true, err
+}
+
+type twoFactorCodeForm struct {
+	Code                string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactorUser(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.Form = twoFactorCodeForm{}
+	app.render(w, http.StatusOK, "login-2fa.tmpl", templateData)
+}
+
+// userLoginTwoFactorPost logs in a user who has entered their password once
+// they've also entered a code. Wrong codes count towards a lockout like wrong
+// passwords do.
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.pendingTwoFactorUser(r)
+	if userID == 0 {
+		app.clearTwoFactorLogin(r)
+		app.sessionManager.Put(r.Context(), "flash", "Please login again.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	lockedUntil, err := app.loginLockedUntil(r, user.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		err = app.loginFailed(r, user.Email, data.LoginFailureLockedOut)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.clearTwoFactorLogin(r)
+		app.sessionManager.Put(r.Context(), "flash", "Too many failed attempts. Please try again in "+humanMinutes(time.Until(lockedUntil))+".")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	var recovery bool
+	if form.Valid() {
+		tf, err := app.models.TwoFactor.Get(userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		var ok bool
+		ok, recovery, err = app.checkTwoFactorCode(tf, form.Code)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if !ok {
+			err = app.loginFailed(r, user.Email, data.LoginFailureWrongCode)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("code", "That code isn't right")
+		}
+	}
+
+	if !form.Valid() {
+		attempts := app.sessionManager.GetInt(r.Context(), "twoFactorAttempts") + 1
+		if attempts >= maxTwoFactorAttempts {
+			app.clearTwoFactorLogin(r)
+			app.sessionManager.Put(r.Context(), "flash", "Too many wrong codes. Please login again.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", attempts)
+
+		templateData := app.newTemplateData(r)
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login-2fa.tmpl", templateData)
+		return
+	}
+
+	app.clearTwoFactorLogin(r)
+
+	err = app.models.LoginThrottles.Reset(accountLoginKey(user.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.logIn(r, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "twoFactorEnrolled", true)
+
+	if recovery {
+		app.sessionManager.Put(r.Context(), "flash", "You used a recovery code, which won't work again. Get new ones from the two-factor authentication settings if you're running low.")
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// twoFactorData loads everything shown on the two-factor authentication
+// page.
+func (app *application) twoFactorData(r *http.Request) (*templateData, error) {
+	templateData := app.newTemplateData(r)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if tf != nil && tf.Enabled() {
+		left, err := app.models.TwoFactor.CountRecoveryCodes(userID)
+		if err != nil {
+			return nil, err
+		}
+		templateData.RecoveryCodesLeft = left
+	} else if tf != nil {
+		// html/template only trusts http and https links, so mark the
+		// otpauth one as safe.
+		templateData.TOTPURI = template.URL(totp.URI(totpIssuer, user.Email, tf.Secret))
+	}
+
+	templateData.User = user
+	templateData.TwoFactor = tf
+	templateData.RequireTwoFactor = app.requireTwoFactor
+	templateData.Form = twoFactorCodeForm{}
+
+	return templateData, nil
+}
+
+func (app *application) viewTwoFactor(w http.ResponseWriter, r *http.Request) {
+	templateData, err := app.twoFactorData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, http.StatusOK, "two-factor.tmpl", templateData)
+}
+
+// beginTwoFactor makes a new secret for the user to add to their
+// authenticator app.
+func (app *application) beginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.models.TwoFactor.Begin(userID, secret)
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is already on.")
+			http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+}
+
+// confirmTwoFactor turns on two-factor authentication once the user has
+// entered a code from their app, and shows their recovery codes.
+func (app *application) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil || tf.Enabled() {
+		if err == nil || errors.Is(err, data.ErrRecordNotFound) {
+			http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	counter, ok := totp.Validate(tf.Secret, form.Code, time.Now())
+	form.CheckField(ok, "code", "That code isn't right. Check the time on your device is correct.")
+
+	if !form.Valid() {
+		templateData, err := app.twoFactorData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "two-factor.tmpl", templateData)
+		return
+	}
+
+	err = app.models.TwoFactor.Confirm(userID, counter)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "twoFactorEnrolled", true)
+
+	// Sessions from before are logged out, as they didn't need a code.
+	err = app.logoutOtherSessions(r, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderRecoveryCodes(w, r, http.StatusCreated)
+}
+
+type twoFactorPasswordForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// checkPasswordForm checks the password the user entered to confirm a change
+// to their two-factor authentication, and renders the page with an error
+// if it's wrong. It reports whether to go on.
+func (app *application) checkPasswordForm(w http.ResponseWriter, r *http.Request) bool {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form twoFactorPasswordForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return false
+	}
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return false
+	}
+
+	_, err = app.models.Users.Authenticate(user.Email, form.Password)
+	if err != nil {
+		if !errors.Is(err, data.ErrInvalidCredentials) {
+			app.serverError(w, err)
+			return false
+		}
+		form.AddFieldError("password", "Your password is incorrect")
+
+		templateData, err := app.twoFactorData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return false
+		}
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "two-factor.tmpl", templateData)
+		return false
+	}
+
+	return true
+}
+
+// renderRecoveryCodes makes new recovery codes for the user and shows them,
+// the only time they can be read.
+func (app *application) renderRecoveryCodes(w http.ResponseWriter, r *http.Request, status int) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	codes, err := app.models.TwoFactor.NewRecoveryCodes(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData, err := app.twoFactorData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	templateData.RecoveryCodes = codes
+	app.render(w, status, "two-factor.tmpl", templateData)
+}
+
+// regenerateRecoveryCodes replaces the user's recovery codes.
+func (app *application) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	tf, err := app.models.TwoFactor.Get(userID)
+	if err != nil || !tf.Enabled() {
+		if err == nil || errors.Is(err, data.ErrRecordNotFound) {
+			http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	if !app.checkPasswordForm(w, r) {
+		return
+	}
+
+	app.renderRecoveryCodes(w, r, http.StatusCreated)
+}
+
+// disableTwoFactor turns off two-factor authentication, unless the instance
+// requires it.
+func (app *application) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	if app.requireTwoFactor {
+		app.clientError(w, http.StatusForbidden, "Two-factor authentication is required for every account")
+		return
+	}
+
+	if !app.checkPasswordForm(w, r) {
+		return
+	}
+
+	err := app.models.TwoFactor.Disable(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "twoFactorEnrolled")
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication is off.")
+	http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+	"github.com/tmgasek/calendar-app/internal/totp"
+)
+
+// currentCode returns the code Alice's authenticator app shows now.
+func currentCode(t *testing.T, secret string) string {
+	code, err := totp.Code(secret, totp.Counter(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enterPassword does the first step of logging in as Alice.
+func enterPassword(t *testing.T, ts *testServer) (int, http.Header) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, header, _ := ts.postForm(t, "/user/login", form)
+	return code, header
+}
+
+func enterCode(t *testing.T, ts *testServer, code string) (int, http.Header, string) {
+	_, _, body := ts.get(t, "/user/login/2fa")
+
+	form := url.Values{}
+	form.Add("code", code)
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	return ts.postForm(t, "/user/login/2fa", form)
+}
+
+func TestLoginWithTwoFactor(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled = true
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header := enterPassword(t, ts)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login/2fa")
+
+	// The password alone doesn't log the user in.
+	code, _, _ = ts.get(t, "/settings")
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	code, _, body := enterCode(t, ts, "000000")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "That code isn&#39;t right")
+
+	totpCode := currentCode(t, mocks.MockTOTPSecret)
+
+	code, header, _ = enterCode(t, ts, totpCode)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/")
+
+	code, _, _ = ts.get(t, "/settings")
+	assert.Equal(t, code, http.StatusOK)
+
+	// The same code can't be used to login again.
+	enterPassword(t, ts)
+	code, _, _ = enterCode(t, ts, totpCode)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+}
+
+func TestLoginWithRecoveryCode(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled = true
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	enterPassword(t, ts)
+	code, header, _ := enterCode(t, ts, "ABCDE-FGHIJ")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/")
+
+	enterPassword(t, ts)
+	code, _, _ = enterCode(t, ts, mocks.MockRecoveryCode)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+}
+
+func TestLoginTwoFactorTooManyAttempts(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled = true
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	enterPassword(t, ts)
+	for i := 1; i < maxTwoFactorAttempts; i++ {
+		code, _, _ := enterCode(t, ts, "000000")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	code, header, _ := enterCode(t, ts, "000000")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	// The password has to be entered again.
+	code, header, _ = ts.get(t, "/user/login/2fa")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+}
+
+func TestTwoFactorEnrolment(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/2fa")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, header, _ := ts.postForm(t, "/user/2fa/setup", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/2fa")
+
+	secret := app.models.TwoFactor.(*mocks.TwoFactorModel).Begun
+
+	_, _, body = ts.get(t, "/user/2fa")
+	assert.StringContains(t, body, `href="otpauth://totp/Calendar%20Genie:alice@example.com?`)
+	assert.StringContains(t, body, secret)
+
+	form.Set("code", "000000")
+	code, _, body = ts.postForm(t, "/user/2fa/confirm", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "That code isn&#39;t right")
+
+	form.Set("code", currentCode(t, secret))
+	code, _, body = ts.postForm(t, "/user/2fa/confirm", form)
+	assert.Equal(t, code, http.StatusCreated)
+	assert.StringContains(t, body, mocks.MockRecoveryCode)
+	assert.Equal(t, app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled, true)
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		required    bool
+		wantCode    int
+		wantEnabled bool
+	}{
+		{"Valid password", "pa$$word", false, http.StatusSeeOther, false},
+		{"Wrong password", "wrong", false, http.StatusUnprocessableEntity, true},
+		{"Required", "pa$$word", true, http.StatusForbidden, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.requireTwoFactor = tt.required
+			twoFactor := app.models.TwoFactor.(*mocks.TwoFactorModel)
+			twoFactor.Enabled = true
+			ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/2fa")
+
+			form := url.Values{}
+			form.Add("password", tt.password)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, _ := ts.postForm(t, "/user/2fa/disable", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, twoFactor.Enabled, tt.wantEnabled)
+		})
+	}
+}
+
+func TestRequireTwoFactorEnrolment(t *testing.T) {
+	app := newTestApplication(t)
+	app.requireTwoFactor = true
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, header, _ := ts.get(t, "/settings")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/2fa")
+
+	code, _, _ = ts.get(t, "/user/2fa")
+	assert.Equal(t, code, http.StatusOK)
+
+	app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled = true
+
+	code, _, _ = ts.get(t, "/settings")
+	assert.Equal(t, code, http.StatusOK)
+}
+
+func TestRequireAPITwoFactorEnrolment(t *testing.T) {
+	app := newTestApplication(t)
+	app.requireTwoFactor = true
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, header, body := ts.requestJSON(t, http.MethodGet, "/api/v1/appointments", "")
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+	assert.StringContains(t, body, `"code": "two_factor_required"`)
+
+	// API tokens can only have been made after setting it up.
+	code, _, _ = ts.requestJSONWithToken(t, http.MethodGet, "/api/v1/appointments", "", mocks.MockReadToken)
+	assert.Equal(t, code, http.StatusOK)
+
+	app.models.TwoFactor.(*mocks.TwoFactorModel).Enabled = true
+
+	code, _, _ = ts.requestJSON(t, http.MethodGet, "/api/v1/appointments", "")
+	assert.Equal(t, code, http.StatusOK)
+}
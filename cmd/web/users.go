@@ -3,9 +3,10 @@ package main
 import "net/http"
 
 func (app *application) searchUsers(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 	query := r.FormValue("query")
 
-	users, err := app.models.Users.SearchUsers(query)
+	users, err := app.models.Users.SearchUsers(userID, query)
 	if err != nil {
 		app.serverError(w, err)
 		return
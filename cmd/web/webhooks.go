@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/service"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// errWebhookAddress is returned when a webhook's host resolves to an
+// address the server won't send deliveries to.
+var errWebhookAddress = errors.New("webhook address not allowed")
+
+// newWebhookClient returns the client that sends webhook deliveries. It
+// only connects to public addresses, so webhooks can't be used to reach the
+// server itself or services on its network, and redirects aren't followed,
+// so a delivery goes only to the URL that was registered.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: webhookDialControl,
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookDialControl refuses connections to addresses that aren't public.
+// It runs after the host name is resolved, so it also catches names that
+// point at such an address.
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", errWebhookAddress, host)
+	}
+
+	return nil
+}
+
+// isPublicIP reports whether the address is on the internet, rather than
+// loopback, private, link-local, multicast or unspecified.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// maxWebhookResponse is how much of a response body is kept in the log.
+const maxWebhookResponse = 1024
+
+// emitWebhookEvent queues the event for the webhooks of the users and of the
+// group. The payload is sent as the data of the event, in the same format as
+// the JSON API. Failing to queue it is only logged, as whatever caused the
+// event has already happened.
+func (app *application) emitWebhookEvent(event string, userIDs []int, groupID int, payload envelope) {
+	body, err := json.Marshal(envelope{
+		"event":      event,
+		"created_at": time.Now().UTC(),
+		"data":       payload,
+	})
+	if err != nil {
+		app.errorLog.Printf("Error encoding %s webhook event: %v\n", event, err)
+		return
+	}
+
+	_, err = app.models.Webhooks.Enqueue(event, body, userIDs, groupID)
+	if err != nil {
+		app.errorLog.Printf("Error queueing %s webhook event: %v\n", event, err)
+	}
+}
+
+// outcomeEvent returns the event for what became of a request after a
+// response, or "" if it's still pending.
+func outcomeEvent(outcome service.Outcome) string {
+	switch outcome {
+	case service.OutcomeConfirmed:
+		return data.EventRequestConfirmed
+	case service.OutcomeDeclined, service.OutcomeResourceTaken:
+		return data.EventRequestDeclined
+	default:
+		return ""
+	}
+}
+
+// signWebhook returns the signature of a delivery: the hex HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the webhook's secret.
+// Receivers should compute the same and check the timestamp is recent.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook posts a delivery to its webhook with the client and returns
+// the response status code and the start of the body. Anything but a 2xx
+// response is an error.
+func sendWebhook(client *http.Client, d *data.WebhookDelivery) (int, string, error) {
+	body := []byte(d.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "calendar-app-webhooks")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhook(d.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	if err != nil {
+		return resp.StatusCode, "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, string(respBody), nil
+}
+
+// runWebhookDeliveries sends the queued webhook deliveries every interval.
+// It blocks, so run it in a goroutine.
+func (app *application) runWebhookDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := app.models.Webhooks.ReleaseStale(10 * time.Minute)
+		if err != nil {
+			app.errorLog.Printf("Error releasing stale webhook deliveries: %v\n", err)
+		}
+
+		deliveries, err := app.models.Webhooks.ClaimDue(20)
+		if err != nil {
+			app.errorLog.Printf("Error claiming webhook deliveries: %v\n", err)
+			continue
+		}
+
+		for _, d := range deliveries {
+			app.processWebhookDelivery(d)
+		}
+	}
+}
+
+// processWebhookDelivery sends a claimed delivery and logs the response.
+// Failures are retried with backoff until the delivery runs out of attempts.
+func (app *application) processWebhookDelivery(d *data.WebhookDelivery) {
+	code, body, err := sendWebhook(app.webhookClient, d)
+	if err == nil {
+		err = app.models.Webhooks.Complete(d.ID, code, body)
+		if err != nil {
+			app.errorLog.Printf("Error completing webhook delivery %d: %v\n", d.ID, err)
+		}
+		return
+	}
+
+	app.errorLog.Printf("Webhook delivery %d (%s to %s) failed: %v\n", d.ID, d.Event, d.URL, err)
+
+	if d.Attempts < d.MaxAttempts {
+		err = app.models.Webhooks.Retry(d.ID, code, body, err.Error(), time.Now().Add(retryBackoff(d.Attempts)))
+		if err != nil {
+			app.errorLog.Printf("Error rescheduling webhook delivery %d: %v\n", d.ID, err)
+		}
+		return
+	}
+
+	err = app.models.Webhooks.Fail(d.ID, code, body, err.Error())
+	if err != nil {
+		app.errorLog.Printf("Error failing webhook delivery %d: %v\n", d.ID, err)
+	}
+}
+
+type webhookForm struct {
+	URL                 string   `form:"url"`
+	Events              []string `form:"events"`
+	GroupID             int      `form:"group_id"`
+	validator.Validator `form:"-"`
+}
+
+// webhooksData loads everything shown on the webhooks page.
+func (app *application) webhooksData(r *http.Request) (*templateData, error) {
+	templateData := app.newTemplateData(r)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	webhooks, err := app.models.Webhooks.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := app.models.Groups.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	templateData.Webhooks = webhooks
+	templateData.Groups = groups
+	templateData.WebhookEvents = data.WebhookEvents
+	templateData.Form = webhookForm{Events: data.WebhookEvents}
+
+	return templateData, nil
+}
+
+func (app *application) viewWebhooks(w http.ResponseWriter, r *http.Request) {
+	templateData, err := app.webhooksData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, http.StatusOK, "webhooks.tmpl", templateData)
+}
+
+func (app *application) createWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	var form webhookForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	data.ValidateWebhook(&form.Validator, form.URL, form.Events)
+
+	if form.GroupID != 0 {
+		_, err = app.service.GetGroup(userID, form.GroupID)
+		if err != nil {
+			var serviceErr *service.Error
+			if !errors.As(err, &serviceErr) {
+				app.serverError(w, err)
+				return
+			}
+			form.AddFieldError("group_id", serviceErr.Message)
+		}
+	}
+
+	if !form.Valid() {
+		templateData, err := app.webhooksData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		templateData.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "webhooks.tmpl", templateData)
+		return
+	}
+
+	id, err := app.models.Webhooks.Insert(&data.Webhook{
+		UserID:  userID,
+		GroupID: form.GroupID,
+		URL:     form.URL,
+		Events:  form.Events,
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook added.")
+	http.Redirect(w, r, fmt.Sprintf("/webhooks/view/%d", id), http.StatusSeeOther)
+}
+
+// viewWebhook shows a webhook with its signing secret and delivery log.
+func (app *application) viewWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	webhookID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound, "Invalid webhook ID in URL")
+		return
+	}
+
+	webhook, err := app.service.GetWebhook(userID, int(webhookID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	deliveries, err := app.models.Webhooks.GetDeliveries(webhook.ID, 50)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templateData := app.newTemplateData(r)
+	templateData.Webhook = webhook
+	templateData.WebhookDeliveries = deliveries
+	app.render(w, http.StatusOK, "webhook.tmpl", templateData)
+}
+
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	webhookID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound, "Invalid webhook ID in URL")
+		return
+	}
+
+	webhook, err := app.service.GetWebhook(userID, int(webhookID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	err = app.models.Webhooks.Delete(webhook.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook removed.")
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// redeliverWebhook queues another delivery of a payload from the log.
+func (app *application) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	webhookID, err := app.readIDParam(r)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound, "Invalid webhook ID in URL")
+		return
+	}
+
+	deliveryID, err := strconv.Atoi(r.FormValue("delivery_id"))
+	if err != nil || deliveryID < 1 {
+		app.clientError(w, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	webhook, err := app.service.GetWebhook(userID, int(webhookID))
+	if err != nil {
+		app.serviceError(w, err)
+		return
+	}
+
+	_, err = app.models.Webhooks.Redeliver(webhook.ID, deliveryID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.clientError(w, http.StatusNotFound, "Delivery not found")
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Delivery queued again.")
+	http.Redirect(w, r, fmt.Sprintf("/webhooks/view/%d", webhook.ID), http.StatusSeeOther)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/webhooks")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		hookURL      string
+		events       []string
+		groupID      string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Valid submission",
+			hookURL:      "https://hooks.example.com/calendar",
+			events:       []string{data.EventRequestCreated},
+			groupID:      "0",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/webhooks/view/2",
+		},
+		{
+			name:         "Group webhook",
+			hookURL:      "https://hooks.example.com/calendar",
+			events:       []string{data.EventAppointmentDeleted},
+			groupID:      "1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/webhooks/view/2",
+		},
+		{
+			name:     "Not a web URL",
+			hookURL:  "ftp://hooks.example.com",
+			events:   []string{data.EventRequestCreated},
+			groupID:  "0",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Must be an https URL",
+		},
+		{
+			name:     "Plain http",
+			hookURL:  "http://hooks.example.com/calendar",
+			events:   []string{data.EventRequestCreated},
+			groupID:  "0",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Must be an https URL",
+		},
+		{
+			name:     "No events",
+			hookURL:  "https://hooks.example.com/calendar",
+			groupID:  "0",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Choose at least one event",
+		},
+		{
+			name:     "Unknown event",
+			hookURL:  "https://hooks.example.com/calendar",
+			events:   []string{"user.created"},
+			groupID:  "0",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Invalid event",
+		},
+		{
+			name:     "Unknown group",
+			hookURL:  "https://hooks.example.com/calendar",
+			events:   []string{data.EventRequestCreated},
+			groupID:  "99",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Group not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("url", tt.hookURL)
+			for _, event := range tt.events {
+				form.Add("events", event)
+			}
+			form.Add("group_id", tt.groupID)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, header, body := ts.postForm(t, "/webhooks", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestViewWebhook(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/webhooks/view/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "whsec_mocksecret")
+	assert.StringContains(t, body, "unexpected status 500")
+
+	code, _, _ = ts.get(t, "/webhooks/view/99")
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/webhooks/view/1")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		urlPath    string
+		deliveryID string
+		wantCode   int
+	}{
+		{"Valid delivery", "/webhooks/1/redeliver", "1", http.StatusSeeOther},
+		{"Unknown delivery", "/webhooks/1/redeliver", "99", http.StatusNotFound},
+		{"Missing delivery", "/webhooks/1/redeliver", "", http.StatusBadRequest},
+		{"Unknown webhook", "/webhooks/99/redeliver", "1", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("delivery_id", tt.deliveryID)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestDeleteAppointmentEmitsWebhookEvent(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.sessionManager.LoadAndSave(app.mockAuthentication(app.routes())))
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/appointments")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("csrf_token", validCSRFToken)
+
+	code, _, _ := ts.postForm(t, "/appointments/delete/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	webhooks := app.models.Webhooks.(*mocks.WebhookModel)
+	assert.Equal(t, len(webhooks.Enqueued), 1)
+	assert.Equal(t, webhooks.Enqueued[0], data.EventAppointmentDeleted)
+}
+
+func TestProcessWebhookDelivery(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		attempts      int
+		wantCompleted int
+		wantRetried   int
+		wantFailed    int
+	}{
+		{"Success", http.StatusNoContent, 1, 1, 0, 0},
+		{"Error with attempts left", http.StatusInternalServerError, 1, 0, 1, 0},
+		{"Error on last attempt", http.StatusInternalServerError, 6, 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSignature, gotTimestamp string
+			var gotBody []byte
+
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSignature = r.Header.Get("X-Webhook-Signature")
+				gotTimestamp = r.Header.Get("X-Webhook-Timestamp")
+				gotBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			app := newTestApplication(t)
+			app.webhookClient = receiver.Client()
+			webhooks := app.models.Webhooks.(*mocks.WebhookModel)
+
+			app.processWebhookDelivery(&data.WebhookDelivery{
+				ID:          1,
+				Event:       data.EventRequestCreated,
+				Payload:     `{"event":"appointment_request.created"}`,
+				Attempts:    tt.attempts,
+				MaxAttempts: 6,
+				URL:         receiver.URL,
+				Secret:      "whsec_test",
+			})
+
+			assert.Equal(t, string(gotBody), `{"event":"appointment_request.created"}`)
+
+			// Check the signature the way a receiver would.
+			mac := hmac.New(sha256.New, []byte("whsec_test"))
+			mac.Write([]byte(gotTimestamp + "." + string(gotBody)))
+			assert.Equal(t, gotSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+			assert.Equal(t, len(webhooks.Completed), tt.wantCompleted)
+			assert.Equal(t, len(webhooks.Retried), tt.wantRetried)
+			assert.Equal(t, len(webhooks.Failed), tt.wantFailed)
+		})
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivery reached a loopback address")
+	}))
+	defer receiver.Close()
+
+	_, _, err := sendWebhook(newWebhookClient(), &data.WebhookDelivery{
+		ID:      1,
+		Event:   data.EventRequestCreated,
+		Payload: `{}`,
+		URL:     receiver.URL,
+		Secret:  "whsec_test",
+	})
+	assert.Equal(t, errors.Is(err, errWebhookAddress), true)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, isPublicIP(net.ParseIP(tt.ip)), tt.want)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Actions admins take on users' accounts.
+const (
+	AuditDisable           = "disable"
+	AuditEnable            = "enable"
+	AuditImpersonate       = "impersonate"
+	AuditStopImpersonating = "stop_impersonating"
+	AuditRelink            = "relink"
+	// AuditImpersonatedRequest is a change an admin made while
+	// impersonating the user; the details are its method and path.
+	AuditImpersonatedRequest = "impersonated_request"
+)
+
+// AuditEntry records an admin acting on a user's account. AdminID and UserID
+// are 0, and the names empty, once those accounts are deleted.
+type AuditEntry struct {
+	ID        int
+	AdminID   int
+	AdminName string
+	UserID    int
+	UserName  string
+	Action    string
+	Details   string
+	CreatedAt time.Time
+}
+
+type AuditLogModel struct {
+	DB *sql.DB
+}
+
+type AuditLogModelInterface interface {
+	Insert(e *AuditEntry) error
+	GetRecent(limit int) ([]*AuditEntry, error)
+	GetForUser(userID, limit int) ([]*AuditEntry, error)
+}
+
+// Insert records the entry and fills in its ID and time.
+func (m *AuditLogModel) Insert(e *AuditEntry) error {
+	query := `
+		INSERT INTO admin_audit_log (admin_id, user_id, action, details)
+		VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4)
+		RETURNING id, created_at
+	`
+
+	return m.DB.QueryRow(query, e.AdminID, e.UserID, e.Action, e.Details).Scan(&e.ID, &e.CreatedAt)
+}
+
+const auditEntryQuery = `
+	SELECT l.id, COALESCE(l.admin_id, 0), COALESCE(a.name, ''), COALESCE(l.user_id, 0), COALESCE(u.name, ''),
+		l.action, l.details, l.created_at
+	FROM admin_audit_log l
+	LEFT JOIN users a ON a.id = l.admin_id
+	LEFT JOIN users u ON u.id = l.user_id
+`
+
+// GetRecent returns up to limit entries, newest first.
+func (m *AuditLogModel) GetRecent(limit int) ([]*AuditEntry, error) {
+	return m.query(auditEntryQuery+`ORDER BY l.created_at DESC, l.id DESC LIMIT $1`, limit)
+}
+
+// GetForUser returns up to limit entries about the user, newest first.
+func (m *AuditLogModel) GetForUser(userID, limit int) ([]*AuditEntry, error) {
+	return m.query(auditEntryQuery+`WHERE l.user_id = $1 ORDER BY l.created_at DESC, l.id DESC LIMIT $2`, userID, limit)
+}
+
+func (m *AuditLogModel) query(query string, args ...any) ([]*AuditEntry, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+
+	for rows.Next() {
+		e := &AuditEntry{}
+		err := rows.Scan(&e.ID, &e.AdminID, &e.AdminName, &e.UserID, &e.UserName, &e.Action, &e.Details, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestAuditLogModel(t *testing.T) {
+	db := newTestDB(t)
+	m := AuditLogModel{DB: db}
+
+	err := m.Insert(&AuditEntry{AdminID: 1, UserID: 2, Action: AuditDisable})
+	assert.NilError(t, err)
+	err = m.Insert(&AuditEntry{AdminID: 1, UserID: 3, Action: AuditRelink, Details: "google"})
+	assert.NilError(t, err)
+
+	entries, err := m.GetRecent(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Action, AuditRelink)
+	assert.Equal(t, entries[0].AdminName, "Alice")
+	assert.Equal(t, entries[0].UserName, "Charlie")
+
+	entries, err = m.GetForUser(2, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Action, AuditDisable)
+
+	// The log outlives the users in it.
+	err = (&UserModel{DB: db}).Delete(2)
+	assert.NilError(t, err)
+
+	entries, err = m.GetRecent(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[1].UserID, 0)
+}
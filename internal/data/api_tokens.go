@@ -0,0 +1,207 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// Scopes a personal API token can be given. Read lets it make GET requests,
+// write lets it make everything else.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// apiTokenPrefix starts every token, so they are easy to spot if one ends up
+// in a log or a commit.
+const apiTokenPrefix = "cal_"
+
+// APIToken is a personal access token for the JSON API. Plaintext is only
+// set when the token is created; after that only its hash is known.
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Plaintext  string
+	Prefix     string
+	Scopes     []string
+	Expiry     time.Time // zero if the token never expires
+	LastUsedAt time.Time // zero if the token has never been used
+	CreatedAt  time.Time
+}
+
+// HasScope reports whether the token was given the scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the token can no longer be used.
+func (t *APIToken) IsExpired() bool {
+	return !t.Expiry.IsZero() && !t.Expiry.After(time.Now())
+}
+
+// ValidateAPIToken checks the name, scopes and expiry a token is created
+// with. A ttl of zero means the token never expires.
+func ValidateAPIToken(v *validator.Validator, name string, scopes []string, ttl time.Duration) {
+	v.CheckField(validator.NotBlank(name), "name", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(name, 100), "name", "This field is too long")
+	v.CheckField(len(scopes) > 0, "scopes", "Choose at least one scope")
+	for _, scope := range scopes {
+		v.CheckField(validator.PermittedValue(scope, ScopeRead, ScopeWrite), "scopes", "Invalid scope")
+	}
+	v.CheckField(ttl >= 0, "expiry", "Invalid expiry")
+}
+
+// generateAPIToken returns a new random token for the user.
+func generateAPIToken(userID int, name string, scopes []string, ttl time.Duration) (*APIToken, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		Plaintext: apiTokenPrefix + secret,
+		Scopes:    scopes,
+	}
+	token.Prefix = token.Plaintext[:len(apiTokenPrefix)+4]
+	if ttl > 0 {
+		token.Expiry = time.Now().Add(ttl)
+	}
+
+	return token, nil
+}
+
+type APITokenModel struct {
+	DB *sql.DB
+}
+
+type APITokenModelInterface interface {
+	New(userID int, name string, scopes []string, ttl time.Duration) (*APIToken, error)
+	GetAllForUser(userID int) ([]*APIToken, error)
+	Authenticate(plaintext string) (*APIToken, error)
+	Delete(id, userID int) error
+}
+
+// New creates a token for the user. The returned token is the only place
+// its plaintext can be read.
+func (m *APITokenModel) New(userID int, name string, scopes []string, ttl time.Duration) (*APIToken, error) {
+	token, err := generateAPIToken(userID, name, scopes, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO api_tokens (user_id, name, hash, prefix, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	expiry := sql.NullTime{Time: token.Expiry, Valid: !token.Expiry.IsZero()}
+
+	err = m.DB.QueryRow(query, userID, name, hashSecret(token.Plaintext), token.Prefix, pq.Array(scopes), expiry).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetAllForUser returns the user's tokens, newest first, including expired
+// ones so the user can see and tidy them up.
+func (m *APITokenModel) GetAllForUser(userID int) ([]*APIToken, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := m.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Authenticate returns the unexpired token with the plaintext and records
+// that it has been used. An unknown or expired token, or one of a disabled
+// user, gives ErrRecordNotFound.
+func (m *APITokenModel) Authenticate(plaintext string) (*APIToken, error) {
+	query := `
+		UPDATE api_tokens
+		SET last_used_at = now()
+		WHERE hash = $1 AND (expiry IS NULL OR expiry > now())
+		AND user_id NOT IN (SELECT id FROM users WHERE disabled)
+		RETURNING id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+	`
+
+	token, err := scanAPIToken(m.DB.QueryRow(query, hashSecret(plaintext)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Delete revokes one of the user's tokens.
+func (m *APITokenModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec("DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	token := &APIToken{}
+	var expiry, lastUsedAt sql.NullTime
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, pq.Array(&token.Scopes), &expiry, &lastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Expiry = expiry.Time
+	token.LastUsedAt = lastUsedAt.Time
+
+	return token, nil
+}
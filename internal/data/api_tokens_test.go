@@ -0,0 +1,64 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestAPITokenModelAuthenticate(t *testing.T) {
+	db := newTestDB(t)
+	m := APITokenModel{DB: db}
+
+	token, err := m.New(1, "CI", []string{ScopeRead}, time.Hour)
+	assert.NilError(t, err)
+	assert.Greater(t, token.ID, 0)
+	assert.StringContains(t, token.Plaintext, apiTokenPrefix)
+
+	// Only the hash should be stored.
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM api_tokens WHERE hash = $1 AND prefix = $2", hashSecret(token.Plaintext), token.Prefix).Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+
+	got, err := m.Authenticate(token.Plaintext)
+	assert.NilError(t, err)
+	assert.Equal(t, got.UserID, 1)
+	assert.Equal(t, got.HasScope(ScopeRead), true)
+	assert.Equal(t, got.HasScope(ScopeWrite), false)
+	assert.Equal(t, got.LastUsedAt.IsZero(), false)
+
+	_, err = m.Authenticate(token.Plaintext + "x")
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	_, err = db.Exec("UPDATE api_tokens SET expiry = now() - interval '1 minute' WHERE id = $1", token.ID)
+	assert.NilError(t, err)
+
+	_, err = m.Authenticate(token.Plaintext)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+}
+
+func TestAPITokenModelDelete(t *testing.T) {
+	db := newTestDB(t)
+	m := APITokenModel{DB: db}
+
+	token, err := m.New(1, "CI", []string{ScopeRead, ScopeWrite}, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, token.Expiry.IsZero(), true)
+
+	// Other users can't revoke the token.
+	err = m.Delete(token.ID, 2)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	tokens, err := m.GetAllForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 1)
+
+	err = m.Delete(token.ID, 1)
+	assert.NilError(t, err)
+
+	_, err = m.Authenticate(token.Plaintext)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+}
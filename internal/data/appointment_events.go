@@ -19,6 +19,7 @@ type AppointmentEventModel struct {
 type AppointmentEventModelInterface interface {
 	Insert(event *AppointmentEvent) error
 	GetByAppointmentID(appointmentID int) ([]*AppointmentEvent, error)
+	GetForUser(userID int) ([]*AppointmentEvent, error)
 }
 
 func (m *AppointmentEventModel) Insert(event *AppointmentEvent) error {
@@ -40,7 +41,22 @@ func (m *AppointmentEventModel) GetByAppointmentID(appointmentID int) ([]*Appoin
 		FROM appointment_events
 		WHERE appointment_id = $1
 	`
-	rows, err := m.DB.Query(query, appointmentID)
+	return m.query(query, appointmentID)
+}
+
+// GetForUser returns the events made in the user's own calendars.
+func (m *AppointmentEventModel) GetForUser(userID int) ([]*AppointmentEvent, error) {
+	query := `
+		SELECT id, appointment_id, user_id, provider_name, provider_event_id
+		FROM appointment_events
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	return m.query(query, userID)
+}
+
+func (m *AppointmentEventModel) query(query string, args ...any) ([]*AppointmentEvent, error) {
+	rows, err := m.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -50,3 +50,13 @@ func TestAppointmentEventModelGetByAppointmentID(t *testing.T) {
 	assert.Equal(t, events[1].ProviderName, "outlook")
 	assert.Equal(t, events[1].ProviderEventID, "event_2")
 }
+
+func TestAppointmentEventModelGetForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentEventModel{DB: db}
+
+	events, err := m.GetForUser(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].ProviderEventID, "event_2")
+}
@@ -0,0 +1,323 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Responses a participant can give to an appointment request.
+const (
+	ParticipantPending   = "pending"
+	ParticipantAccepted  = "accepted"
+	ParticipantDeclined  = "declined"
+	ParticipantTentative = "tentative"
+)
+
+// Rules deciding how many participants need to accept a request before it is
+// confirmed. Required participants always have to accept, whatever the rule.
+const (
+	QuorumAll      = "all"
+	QuorumMajority = "majority"
+	QuorumCount    = "count"
+)
+
+// QuorumOutcome is the result of checking a request's responses against its
+// quorum rule.
+type QuorumOutcome int
+
+const (
+	QuorumUndecided QuorumOutcome = iota
+	QuorumMet
+	QuorumFailed
+)
+
+type RequestParticipant struct {
+	ID        int
+	RequestID int
+	UserID    int
+	Name      string
+	Email     string
+	Required  bool
+	Status    string
+	// Reason is why the participant declined, if they said.
+	Reason      string
+	RespondedAt time.Time
+}
+
+// Participant returns the user's participant record, or nil if they weren't
+// invited to the request.
+func (r *AppointmentRequest) Participant(userID int) *RequestParticipant {
+	for _, p := range r.Participants {
+		if p.UserID == userID {
+			return p
+		}
+	}
+	return nil
+}
+
+// CountResponses returns how many participants have given the response.
+func (r *AppointmentRequest) CountResponses(status string) int {
+	n := 0
+	for _, p := range r.Participants {
+		if p.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// AcceptancesNeeded returns how many participants have to accept the request
+// for its quorum rule to be met.
+func (r *AppointmentRequest) AcceptancesNeeded() int {
+	total := len(r.Participants)
+
+	switch r.QuorumRule {
+	case QuorumMajority:
+		return total/2 + 1
+	case QuorumCount:
+		return max(1, min(r.QuorumCount, total))
+	default:
+		required := 0
+		for _, p := range r.Participants {
+			if p.Required {
+				required++
+			}
+		}
+		// If nobody is required, "all" means everyone.
+		if required == 0 {
+			return total
+		}
+		return required
+	}
+}
+
+// QuorumOutcome works out whether the responses so far confirm the request,
+// rule it out, or whether we still need to wait for more people. Tentative
+// answers count as undecided.
+func (r *AppointmentRequest) QuorumOutcome() QuorumOutcome {
+	var accepted, undecided, required, requiredAccepted int
+
+	for _, p := range r.Participants {
+		if p.Required {
+			required++
+		}
+
+		switch p.Status {
+		case ParticipantAccepted:
+			accepted++
+			if p.Required {
+				requiredAccepted++
+			}
+		case ParticipantDeclined:
+			if p.Required {
+				return QuorumFailed
+			}
+		default:
+			undecided++
+		}
+	}
+
+	needed := r.AcceptancesNeeded()
+
+	if requiredAccepted == required && accepted >= needed {
+		return QuorumMet
+	}
+	if accepted+undecided < needed {
+		return QuorumFailed
+	}
+
+	return QuorumUndecided
+}
+
+// Respond records the user's answer to a request that is still pending, with
+// the reason they gave if they declined, and settles the request if that
+// decides its quorum: a met quorum confirms it with the appointment a, as
+// Confirm does, and a failed one declines it with declineReason. It returns
+// where the quorum stands.
+//
+// It all happens in one transaction with the request row locked, so when the
+// last people respond at the same time each sees the others' answers, and an
+// answer is never saved without the request being settled by it. If a
+// requested resource has been taken, the answer is still saved but the
+// request is declined, and ErrResourceUnavailable is returned.
+func (m *AppointmentRequestModel) Respond(requestID, userID int, status, reason string, a *Appointment, declineReason string) (QuorumOutcome, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return QuorumUndecided, err
+	}
+	defer tx.Rollback()
+
+	request := &AppointmentRequest{RequestID: requestID}
+
+	query := `
+		SELECT requester_id, quorum_rule, quorum_count
+		FROM appointment_requests
+		WHERE request_id = $1 AND status = 'pending'
+		FOR UPDATE
+	`
+
+	err = tx.QueryRow(query, requestID).Scan(&request.RequesterID, &request.QuorumRule, &request.QuorumCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return QuorumUndecided, ErrInvalidTransition
+		}
+		return QuorumUndecided, err
+	}
+
+	query = `
+		UPDATE appointment_request_participants
+		SET status = $3, reason = $4, responded_at = NOW()
+		WHERE request_id = $1 AND user_id = $2
+	`
+
+	result, err := tx.Exec(query, requestID, userID, status, reason)
+	if err != nil {
+		return QuorumUndecided, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return QuorumUndecided, err
+	}
+
+	if n == 0 {
+		return QuorumUndecided, ErrInvalidTransition
+	}
+
+	rows, err := tx.Query("SELECT user_id, required, status FROM appointment_request_participants WHERE request_id = $1", requestID)
+	if err != nil {
+		return QuorumUndecided, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &RequestParticipant{RequestID: requestID}
+		err := rows.Scan(&p.UserID, &p.Required, &p.Status)
+		if err != nil {
+			return QuorumUndecided, err
+		}
+		request.Participants = append(request.Participants, p)
+	}
+	if err = rows.Err(); err != nil {
+		return QuorumUndecided, err
+	}
+
+	outcome := request.QuorumOutcome()
+	var settleErr error
+
+	switch outcome {
+	case QuorumMet:
+		// Only the appointment is rolled back if a resource was taken, so
+		// the answer is kept and the request can be declined instead.
+		_, err = tx.Exec("SAVEPOINT confirm")
+		if err != nil {
+			return outcome, err
+		}
+
+		_, err = confirm(tx, requestID, a, request.AttendeeIDs())
+		if errors.Is(err, ErrResourceUnavailable) {
+			_, err = tx.Exec("ROLLBACK TO SAVEPOINT confirm")
+			if err != nil {
+				return outcome, err
+			}
+			err = decline(tx, requestID, "A requested resource is no longer available")
+			settleErr = ErrResourceUnavailable
+		}
+	case QuorumFailed:
+		err = decline(tx, requestID, declineReason)
+	}
+	if err != nil {
+		return outcome, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return outcome, err
+	}
+
+	return outcome, settleErr
+}
+
+// AttendeeIDs returns the people who get the request's appointment in their
+// calendars: the requester and everyone who accepted.
+func (r *AppointmentRequest) AttendeeIDs() []int {
+	userIDs := []int{r.RequesterID}
+	for _, p := range r.Participants {
+		if p.Status == ParticipantAccepted {
+			userIDs = append(userIDs, p.UserID)
+		}
+	}
+	return userIDs
+}
+
+// insertParticipants adds the participants of a newly created request.
+func insertParticipants(tx *sql.Tx, requestID int, participants []*RequestParticipant) error {
+	query := `
+		INSERT INTO appointment_request_participants (request_id, user_id, required, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	for _, p := range participants {
+		if p.Status == "" {
+			p.Status = ParticipantPending
+		}
+
+		err := tx.QueryRow(query, requestID, p.UserID, p.Required, p.Status).Scan(&p.ID)
+		if err != nil {
+			return err
+		}
+		p.RequestID = requestID
+	}
+
+	return nil
+}
+
+// attachParticipants loads the participants of all the requests in one query.
+func (m *AppointmentRequestModel) attachParticipants(requests ...*AppointmentRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*AppointmentRequest, len(requests))
+	ids := make([]int64, 0, len(requests))
+	for _, r := range requests {
+		r.Participants = []*RequestParticipant{}
+		byID[r.RequestID] = r
+		ids = append(ids, int64(r.RequestID))
+	}
+
+	query := `
+		SELECT p.id, p.request_id, p.user_id, u.name, u.email, p.required, p.status, p.reason, p.responded_at
+		FROM appointment_request_participants p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.request_id = ANY($1)
+		ORDER BY p.id
+	`
+
+	rows, err := m.DB.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &RequestParticipant{}
+		var respondedAt sql.NullTime
+
+		err := rows.Scan(&p.ID, &p.RequestID, &p.UserID, &p.Name, &p.Email, &p.Required, &p.Status, &p.Reason, &respondedAt)
+		if err != nil {
+			return err
+		}
+		p.RespondedAt = respondedAt.Time
+
+		if r, ok := byID[p.RequestID]; ok {
+			r.Participants = append(r.Participants, p)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,191 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestAppointmentRequestQuorumOutcome(t *testing.T) {
+	participant := func(status string, required bool) *RequestParticipant {
+		return &RequestParticipant{Status: status, Required: required}
+	}
+
+	tests := []struct {
+		name         string
+		rule         string
+		count        int
+		participants []*RequestParticipant
+		want         QuorumOutcome
+	}{
+		{
+			name: "All accepted",
+			rule: QuorumAll,
+			participants: []*RequestParticipant{
+				participant(ParticipantAccepted, true),
+				participant(ParticipantAccepted, true),
+			},
+			want: QuorumMet,
+		},
+		{
+			name: "All still waiting",
+			rule: QuorumAll,
+			participants: []*RequestParticipant{
+				participant(ParticipantAccepted, true),
+				participant(ParticipantTentative, true),
+			},
+			want: QuorumUndecided,
+		},
+		{
+			name: "All ignores optional members",
+			rule: QuorumAll,
+			participants: []*RequestParticipant{
+				participant(ParticipantAccepted, true),
+				participant(ParticipantDeclined, false),
+			},
+			want: QuorumMet,
+		},
+		{
+			name: "Required member declined",
+			rule: QuorumMajority,
+			participants: []*RequestParticipant{
+				participant(ParticipantDeclined, true),
+				participant(ParticipantAccepted, false),
+				participant(ParticipantAccepted, false),
+			},
+			want: QuorumFailed,
+		},
+		{
+			name: "Majority reached",
+			rule: QuorumMajority,
+			participants: []*RequestParticipant{
+				participant(ParticipantAccepted, false),
+				participant(ParticipantAccepted, false),
+				participant(ParticipantPending, false),
+			},
+			want: QuorumMet,
+		},
+		{
+			name: "Majority no longer possible",
+			rule: QuorumMajority,
+			participants: []*RequestParticipant{
+				participant(ParticipantDeclined, false),
+				participant(ParticipantDeclined, false),
+				participant(ParticipantPending, false),
+			},
+			want: QuorumFailed,
+		},
+		{
+			name:  "Count waits for required members",
+			rule:  QuorumCount,
+			count: 1,
+			participants: []*RequestParticipant{
+				participant(ParticipantAccepted, false),
+				participant(ParticipantPending, true),
+			},
+			want: QuorumUndecided,
+		},
+		{
+			name:  "Count reached",
+			rule:  QuorumCount,
+			count: 2,
+			participants: []*RequestParticipant{
+				participant(ParticipantAccepted, true),
+				participant(ParticipantDeclined, false),
+				participant(ParticipantAccepted, false),
+			},
+			want: QuorumMet,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &AppointmentRequest{
+				QuorumRule:   tt.rule,
+				QuorumCount:  tt.count,
+				Participants: tt.participants,
+			}
+
+			assert.Equal(t, r.QuorumOutcome(), tt.want)
+		})
+	}
+}
+
+func TestAppointmentRequestModelRespond(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+
+	outcome, err := m.Respond(1, 2, ParticipantTentative, "", &Appointment{}, "")
+	assert.NilError(t, err)
+	assert.Equal(t, outcome, QuorumUndecided)
+
+	request, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(request.Participants), 1)
+	assert.Equal(t, request.Participant(2).Status, ParticipantTentative)
+	assert.Equal(t, request.Status, RequestStatusPending)
+
+	// Bob is the only participant, so his answer settles the request.
+	outcome, err = m.Respond(1, 2, ParticipantDeclined, "Away that week", &Appointment{}, "Away that week")
+	assert.NilError(t, err)
+	assert.Equal(t, outcome, QuorumFailed)
+
+	request, err = m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Participant(2).Reason, "Away that week")
+	assert.Equal(t, request.Status, RequestStatusDeclined)
+	assert.Equal(t, request.DeclineReason, "Away that week")
+
+	// Once it's declined, nobody can change their answer.
+	_, err = m.Respond(1, 2, ParticipantAccepted, "", &Appointment{}, "")
+	assert.Equal(t, err, ErrInvalidTransition)
+
+	// User 3 wasn't invited.
+	_, err = m.Respond(1, 3, ParticipantAccepted, "", &Appointment{}, "")
+	assert.Equal(t, err, ErrInvalidTransition)
+
+	// Request 2 isn't pending any more.
+	_, err = m.Respond(2, 2, ParticipantDeclined, "", &Appointment{}, "")
+	assert.Equal(t, err, ErrInvalidTransition)
+}
+
+func TestAppointmentRequestModelRespondConfirms(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+
+	request := &AppointmentRequest{
+		RequesterID:  1,
+		TargetUserID: 2,
+		Title:        "Future Request",
+		StartTime:    time.Now().Add(24 * time.Hour),
+		EndTime:      time.Now().Add(25 * time.Hour),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		Participants: []*RequestParticipant{
+			{UserID: 2, Required: true, Status: ParticipantPending},
+		},
+	}
+	err := m.Insert(request)
+	assert.NilError(t, err)
+
+	appointment := &Appointment{
+		CreatorID:       1,
+		TargetID:        2,
+		Title:           request.Title,
+		StartTime:       request.StartTime,
+		EndTime:         request.EndTime,
+		AppointmentType: "individual",
+	}
+
+	// The request is confirmed along with the answer that meets its quorum.
+	outcome, err := m.Respond(request.RequestID, 2, ParticipantAccepted, "", appointment, "")
+	assert.NilError(t, err)
+	assert.Equal(t, outcome, QuorumMet)
+
+	request, err = m.Get(request.RequestID)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Status, RequestStatusAccepted)
+	assert.Equal(t, request.Participant(2).Status, ParticipantAccepted)
+	assert.Equal(t, request.AppointmentID, appointment.ID)
+}
@@ -2,9 +2,24 @@ package data
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 )
 
+// Statuses an appointment request can be in. A request starts out pending and
+// moves to exactly one of the other states, after which it is never changed.
+const (
+	RequestStatusPending   = "pending"
+	RequestStatusAccepted  = "accepted"
+	RequestStatusDeclined  = "declined"
+	RequestStatusCancelled = "cancelled"
+	RequestStatusExpired   = "expired"
+)
+
+// ErrInvalidTransition is returned when a request is asked to move to a status
+// that isn't reachable from its current one, e.g. accepting a declined request.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
 type Requester struct {
 	Name  string
 	Email string
@@ -25,7 +40,39 @@ type AppointmentRequest struct {
 	UpdatedAt       time.Time
 	TimeZone        string
 	Requester       *Requester
+	Target          *Requester
 	AppointmentType string
+	AcceptedAt      time.Time
+	DeclinedAt      time.Time
+	CancelledAt     time.Time
+	ExpiredAt       time.Time
+	DeclineReason   string
+	QuorumRule      string
+	QuorumCount     int
+	Participants    []*RequestParticipant
+	Resources       []*Resource
+	AppointmentID   int
+}
+
+// IsPending reports whether the request can still be answered or cancelled.
+func (r *AppointmentRequest) IsPending() bool {
+	return r.Status == RequestStatusPending
+}
+
+// StatusChangedAt returns the time the request entered its current status.
+func (r *AppointmentRequest) StatusChangedAt() time.Time {
+	switch r.Status {
+	case RequestStatusAccepted:
+		return r.AcceptedAt
+	case RequestStatusDeclined:
+		return r.DeclinedAt
+	case RequestStatusCancelled:
+		return r.CancelledAt
+	case RequestStatusExpired:
+		return r.ExpiredAt
+	default:
+		return r.CreatedAt
+	}
 }
 
 type AppointmentRequestModel struct {
@@ -35,27 +82,69 @@ type AppointmentRequestModel struct {
 type AppointmentRequestModelInterface interface {
 	Insert(request *AppointmentRequest) error
 	GetForUser(userID int) ([]*AppointmentRequest, error)
+	GetOutgoingForUser(userID int) ([]*AppointmentRequest, error)
+	CountPendingForUser(userID int) (int, error)
+	GetAllForUser(userID int, filters Filters) ([]*AppointmentRequest, Metadata, error)
+	GetAllOutgoingForUser(userID int, filters Filters) ([]*AppointmentRequest, Metadata, error)
 	Get(requestID int) (*AppointmentRequest, error)
 	Delete(requestID int) error
+	Accept(requestID int) error
+	Decline(requestID int, reason string) error
+	Cancel(requestID int) error
+	ExpirePast() (int, error)
+	Confirm(requestID int, a *Appointment, userIDs []int) (int, error)
+	Respond(requestID, userID int, status, reason string, a *Appointment, declineReason string) (QuorumOutcome, error)
+}
+
+// appointmentRequestColumns is the column list shared by every query that
+// reads full appointment requests, in the order scanAppointmentRequest expects.
+const appointmentRequestColumns = `
+	ar.request_id, ar.requester_id, ar.target_user_id, ar.title, ar.description,
+	ar.start_time, ar.end_time, ar.location, ar.status, ar.created_at,
+	ar.updated_at, ar.time_zone, ar.group_id, ar.appointment_type,
+	ar.accepted_at, ar.declined_at, ar.cancelled_at, ar.expired_at,
+	ar.decline_reason, ar.quorum_rule, ar.quorum_count, ar.appointment_id,
+	u.name, u.email, t.name, t.email`
+
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// Upserts the appointment request.
+func scanAppointmentRequest(row rowScanner) (*AppointmentRequest, error) {
+	r := &AppointmentRequest{
+		Requester: &Requester{},
+		Target:    &Requester{},
+	}
+	var groupID, appointmentID sql.NullInt64
+	var acceptedAt, declinedAt, cancelledAt, expiredAt sql.NullTime
+
+	err := row.Scan(&r.RequestID, &r.RequesterID, &r.TargetUserID, &r.Title, &r.Description, &r.StartTime, &r.EndTime, &r.Location, &r.Status, &r.CreatedAt, &r.UpdatedAt, &r.TimeZone, &groupID, &r.AppointmentType, &acceptedAt, &declinedAt, &cancelledAt, &expiredAt, &r.DeclineReason, &r.QuorumRule, &r.QuorumCount, &appointmentID, &r.Requester.Name, &r.Requester.Email, &r.Target.Name, &r.Target.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if groupID.Valid {
+		r.GroupID = int(groupID.Int64)
+	}
+	if appointmentID.Valid {
+		r.AppointmentID = int(appointmentID.Int64)
+	}
+
+	r.AcceptedAt = acceptedAt.Time
+	r.DeclinedAt = declinedAt.Time
+	r.CancelledAt = cancelledAt.Time
+	r.ExpiredAt = expiredAt.Time
+
+	return r, nil
+}
+
+// Inserts the appointment request along with its participants, setting the
+// RequestID of the request to the ID of the new record.
 func (m *AppointmentRequestModel) Insert(request *AppointmentRequest) error {
 	query := `
-        INSERT INTO appointment_requests (requester_id, target_user_id, title, description, start_time, end_time, location, status, created_at, updated_at, time_zone, group_id, appointment_type)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-        ON CONFLICT (request_id)
-        DO UPDATE SET 
-            title = EXCLUDED.title, 
-            description = EXCLUDED.description, 
-            start_time = EXCLUDED.start_time, 
-            end_time = EXCLUDED.end_time, 
-            location = EXCLUDED.location, 
-            status = EXCLUDED.status, 
-            updated_at = EXCLUDED.updated_at, 
-            time_zone = EXCLUDED.time_zone,
-			group_id = EXCLUDED.group_id,
-			appointment_type = EXCLUDED.appointment_type;
+        INSERT INTO appointment_requests (requester_id, target_user_id, title, description, start_time, end_time, location, status, created_at, updated_at, time_zone, group_id, appointment_type, quorum_rule, quorum_count)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+        RETURNING request_id
     `
 
 	// We use a pointer here so that value can be null.
@@ -64,47 +153,172 @@ func (m *AppointmentRequestModel) Insert(request *AppointmentRequest) error {
 		groupID = &request.GroupID
 	}
 
-	_, err := m.DB.Exec(query, request.RequesterID, request.TargetUserID, request.Title, request.Description, request.StartTime, request.EndTime, request.Location, request.Status, request.CreatedAt, request.UpdatedAt, request.TimeZone, groupID, request.AppointmentType)
+	if request.Status == "" {
+		request.Status = RequestStatusPending
+	}
+	if request.QuorumRule == "" {
+		request.QuorumRule = QuorumAll
+	}
 
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	err = tx.QueryRow(query, request.RequesterID, request.TargetUserID, request.Title, request.Description, request.StartTime, request.EndTime, request.Location, request.Status, request.CreatedAt, request.UpdatedAt, request.TimeZone, groupID, request.AppointmentType, request.QuorumRule, request.QuorumCount).Scan(&request.RequestID)
+	if err != nil {
+		return err
+	}
+
+	err = insertParticipants(tx, request.RequestID, request.Participants)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range request.Resources {
+		_, err = tx.Exec(`
+			INSERT INTO appointment_request_resources (request_id, resource_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, request.RequestID, r.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
+// Get the requests the user has been invited to, in the order they were made.
 func (m *AppointmentRequestModel) GetForUser(userID int) ([]*AppointmentRequest, error) {
 	query := `
-        SELECT ar.request_id, ar.requester_id, ar.target_user_id, ar.title, ar.description, ar.start_time, ar.end_time, ar.location, ar.status, ar.created_at, ar.updated_at, ar.time_zone, ar.group_id, ar.appointment_type, u.name, u.email
+        SELECT ` + appointmentRequestColumns + `
+        FROM appointment_requests ar
+        JOIN users u ON ar.requester_id = u.id
+        JOIN users t ON ar.target_user_id = t.id
+        JOIN appointment_request_participants p ON p.request_id = ar.request_id
+        WHERE p.user_id = $1
+        ORDER BY ar.request_id
+    `
+
+	return m.query(query, userID)
+}
+
+// Get the requests the user has sent to others, newest first.
+func (m *AppointmentRequestModel) GetOutgoingForUser(userID int) ([]*AppointmentRequest, error) {
+	query := `
+        SELECT ` + appointmentRequestColumns + `
+        FROM appointment_requests ar
+        JOIN users u ON ar.requester_id = u.id
+        JOIN users t ON ar.target_user_id = t.id
+        WHERE ar.requester_id = $1
+        ORDER BY ar.request_id DESC
+    `
+
+	return m.query(query, userID)
+}
+
+// Count the pending requests still waiting for the user's response.
+func (m *AppointmentRequestModel) CountPendingForUser(userID int) (int, error) {
+	query := `
+        SELECT count(*)
+        FROM appointment_requests ar
+        JOIN appointment_request_participants p ON p.request_id = ar.request_id
+        WHERE p.user_id = $1 AND ar.status = 'pending' AND p.status = 'pending'
+    `
+
+	var count int
+	err := m.DB.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
+// Get one page of the requests the user has been invited to, in order of
+// start time, along with the pagination metadata.
+func (m *AppointmentRequestModel) GetAllForUser(userID int, filters Filters) ([]*AppointmentRequest, Metadata, error) {
+	query := `
+        SELECT count(*) OVER(), ` + appointmentRequestColumns + `
         FROM appointment_requests ar
         JOIN users u ON ar.requester_id = u.id
-        WHERE ar.target_user_id = $1
+        JOIN users t ON ar.target_user_id = t.id
+        JOIN appointment_request_participants p ON p.request_id = ar.request_id
+        WHERE p.user_id = $1
+        AND ($2::timestamptz IS NULL OR ar.end_time > $2)
+        AND ($3::timestamptz IS NULL OR ar.start_time < $3)
+        ORDER BY ar.start_time, ar.request_id
+        LIMIT $4 OFFSET $5
     `
 
-	rows, err := m.DB.Query(query, userID)
+	return m.queryPage(query, userID, filters)
+}
+
+// Get one page of the requests the user has sent, in order of start time,
+// along with the pagination metadata.
+func (m *AppointmentRequestModel) GetAllOutgoingForUser(userID int, filters Filters) ([]*AppointmentRequest, Metadata, error) {
+	query := `
+        SELECT count(*) OVER(), ` + appointmentRequestColumns + `
+        FROM appointment_requests ar
+        JOIN users u ON ar.requester_id = u.id
+        JOIN users t ON ar.target_user_id = t.id
+        WHERE ar.requester_id = $1
+        AND ($2::timestamptz IS NULL OR ar.end_time > $2)
+        AND ($3::timestamptz IS NULL OR ar.start_time < $3)
+        ORDER BY ar.start_time, ar.request_id
+        LIMIT $4 OFFSET $5
+    `
+
+	return m.queryPage(query, userID, filters)
+}
+
+func (m *AppointmentRequestModel) queryPage(query string, userID int, filters Filters) ([]*AppointmentRequest, Metadata, error) {
+	rows, err := m.DB.Query(query, userID, filters.from(), filters.to(), filters.limit(), filters.offset())
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	requests := []*AppointmentRequest{}
 
 	for rows.Next() {
-		r := &AppointmentRequest{}
-		var requesterName, requesterEmail string
-		var groupID sql.NullInt64
-
-		err := rows.Scan(&r.RequestID, &r.RequesterID, &r.TargetUserID, &r.Title, &r.Description, &r.StartTime, &r.EndTime, &r.Location, &r.Status, &r.CreatedAt, &r.UpdatedAt, &r.TimeZone, &groupID, &r.AppointmentType, &requesterName, &requesterEmail)
+		r, err := scanAppointmentRequest(countingScanner{rows, &totalRecords})
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
-		if groupID.Valid {
-			r.GroupID = int(groupID.Int64)
-		}
+		requests = append(requests, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
 
-		r.Requester = &Requester{
-			Name:  requesterName,
-			Email: requesterEmail,
+	err = m.attachParticipants(requests...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = m.attachResources(requests...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return requests, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m *AppointmentRequestModel) query(query string, args ...any) ([]*AppointmentRequest, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []*AppointmentRequest{}
+
+	for rows.Next() {
+		r, err := scanAppointmentRequest(rows)
+		if err != nil {
+			return nil, err
 		}
 
 		requests = append(requests, r)
@@ -114,38 +328,75 @@ func (m *AppointmentRequestModel) GetForUser(userID int) ([]*AppointmentRequest,
 		return nil, err
 	}
 
+	err = m.attachParticipants(requests...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.attachResources(requests...)
+	if err != nil {
+		return nil, err
+	}
+
 	return requests, nil
 }
 
 func (m *AppointmentRequestModel) Get(requestID int) (*AppointmentRequest, error) {
 	query := `
-		SELECT ar.request_id, ar.requester_id, ar.target_user_id, ar.title, ar.description, ar.start_time, ar.end_time, ar.location, ar.status, ar.created_at, ar.updated_at, ar.time_zone, ar.group_id, ar.appointment_type, u.name, u.email
+		SELECT ` + appointmentRequestColumns + `
 		FROM appointment_requests ar
 		JOIN users u ON ar.requester_id = u.id
+		JOIN users t ON ar.target_user_id = t.id
 		WHERE ar.request_id = $1
 	`
 
-	row := m.DB.QueryRow(query, requestID)
+	r, err := scanAppointmentRequest(m.DB.QueryRow(query, requestID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
 
-	r := &AppointmentRequest{}
-	var requesterName, requesterEmail string
-	var groupID sql.NullInt64
+	err = m.attachParticipants(r)
+	if err != nil {
+		return nil, err
+	}
 
-	err := row.Scan(&r.RequestID, &r.RequesterID, &r.TargetUserID, &r.Title, &r.Description, &r.StartTime, &r.EndTime, &r.Location, &r.Status, &r.CreatedAt, &r.UpdatedAt, &r.TimeZone, &groupID, &r.AppointmentType, &requesterName, &requesterEmail)
+	err = m.attachResources(r)
 	if err != nil {
 		return nil, err
 	}
 
-	if groupID.Valid {
-		r.GroupID = int(groupID.Int64)
+	return r, nil
+}
+
+// attachResources loads the resources requested for all the requests in one
+// query.
+func (m *AppointmentRequestModel) attachResources(requests ...*AppointmentRequest) error {
+	ids := make([]int64, 0, len(requests))
+	for _, r := range requests {
+		ids = append(ids, int64(r.RequestID))
 	}
 
-	r.Requester = &Requester{
-		Name:  requesterName,
-		Email: requesterEmail,
+	query := `
+		SELECT rr.request_id, ` + resourceColumns + `
+		FROM appointment_request_resources rr
+		JOIN resources r ON rr.resource_id = r.id
+		WHERE rr.request_id = ANY($1)
+		ORDER BY r.name
+	`
+
+	byRequest, err := resourcesByOwner(m.DB, query, ids)
+	if err != nil {
+		return err
 	}
 
-	return r, nil
+	for _, r := range requests {
+		r.Resources = byRequest[r.RequestID]
+	}
+
+	return nil
 }
 
 func (m *AppointmentRequestModel) Delete(requestID int) error {
@@ -158,3 +409,191 @@ func (m *AppointmentRequestModel) Delete(requestID int) error {
 	}
 	return nil
 }
+
+// Accept marks a pending request as accepted. Requests whose start time has
+// already passed can't be accepted any more.
+func (m *AppointmentRequestModel) Accept(requestID int) error {
+	query := `
+		UPDATE appointment_requests
+		SET status = 'accepted', accepted_at = NOW(), updated_at = NOW()
+		WHERE request_id = $1 AND status = 'pending' AND start_time > NOW()
+	`
+
+	return m.transition(query, requestID)
+}
+
+// Confirm accepts a pending request and creates its appointment in a single
+// transaction, queueing a provider operation to create an event for each
+// calendar the users have linked. The operations are carried out later by the
+// outbox worker. It returns the ID of the new appointment.
+//
+// Because the request has to be pending, confirming the same request twice
+// fails with ErrInvalidTransition rather than creating a second appointment.
+func (m *AppointmentRequestModel) Confirm(requestID int, a *Appointment, userIDs []int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	appointmentID, err := confirm(tx, requestID, a, userIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return appointmentID, nil
+}
+
+// confirm does the work of Confirm in the transaction.
+func confirm(tx *sql.Tx, requestID int, a *Appointment, userIDs []int) (int, error) {
+	result, err := tx.Exec(`
+		UPDATE appointment_requests
+		SET status = 'accepted', accepted_at = NOW(), updated_at = NOW()
+		WHERE request_id = $1 AND status = 'pending' AND start_time > NOW()
+	`, requestID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrInvalidTransition
+	}
+
+	a.Status = AppointmentConfirming
+	appointmentID, err := insertAppointment(tx, a)
+	if err != nil {
+		return 0, err
+	}
+	a.ID = appointmentID
+
+	_, err = tx.Exec("UPDATE appointment_requests SET appointment_id = $2 WHERE request_id = $1", requestID, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Book the resources that were asked for. If one was taken in the
+	// meantime, ErrResourceUnavailable is returned.
+	var resourceIDs []int
+	rows, err := tx.Query("SELECT resource_id FROM appointment_request_resources WHERE request_id = $1", requestID)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		resourceIDs = append(resourceIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	err = bookResources(tx, appointmentID, resourceIDs, a.StartTime, a.EndTime)
+	if err != nil {
+		return 0, err
+	}
+
+	err = enqueueCreates(tx, appointmentID, userIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nobody may have a calendar linked, in which case there is nothing left
+	// to wait for.
+	err = markConfirmedIfDone(tx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+
+	return appointmentID, nil
+}
+
+// Decline marks a pending request as declined, recording the optional reason
+// given by the target user.
+func (m *AppointmentRequestModel) Decline(requestID int, reason string) error {
+	return m.transition(declineQuery, requestID, reason)
+}
+
+const declineQuery = `
+	UPDATE appointment_requests
+	SET status = 'declined', declined_at = NOW(), decline_reason = $2, updated_at = NOW()
+	WHERE request_id = $1 AND status = 'pending'
+`
+
+// decline does the work of Decline in the transaction.
+func decline(tx *sql.Tx, requestID int, reason string) error {
+	return expectOneRow(tx.Exec(declineQuery, requestID, reason))
+}
+
+// Cancel withdraws a pending request on behalf of its requester.
+func (m *AppointmentRequestModel) Cancel(requestID int) error {
+	query := `
+		UPDATE appointment_requests
+		SET status = 'cancelled', cancelled_at = NOW(), updated_at = NOW()
+		WHERE request_id = $1 AND status = 'pending'
+	`
+
+	return m.transition(query, requestID)
+}
+
+// ExpirePast moves every pending request whose start time has passed to the
+// expired status and returns how many were changed.
+func (m *AppointmentRequestModel) ExpirePast() (int, error) {
+	query := `
+		UPDATE appointment_requests
+		SET status = 'expired', expired_at = NOW(), updated_at = NOW()
+		WHERE status = 'pending' AND start_time <= NOW()
+	`
+
+	result, err := m.DB.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// transition runs a status update guarded on the current status. If no row was
+// changed we work out whether the request is missing or just not pending.
+func (m *AppointmentRequestModel) transition(query string, args ...any) error {
+	result, err := m.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		var exists bool
+		err := m.DB.QueryRow("SELECT EXISTS(SELECT true FROM appointment_requests WHERE request_id = $1)", args[0]).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRecordNotFound
+		}
+		return ErrInvalidTransition
+	}
+
+	return nil
+}
@@ -23,10 +23,15 @@ func TestAppointmentRequestModelInsert(t *testing.T) {
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 		TimeZone:     "UTC",
+		Participants: []*RequestParticipant{
+			{UserID: 2, Required: true},
+			{UserID: 3, Required: false},
+		},
 	}
 
 	err := m.Insert(request)
 	assert.NilError(t, err)
+	assert.Greater(t, request.RequestID, 2)
 
 	// Check if the request record is inserted correctly
 	var count int
@@ -34,6 +39,10 @@ func TestAppointmentRequestModelInsert(t *testing.T) {
 	err = db.QueryRow("SELECT COUNT(*) FROM appointment_requests WHERE title = $1", "Test Request From Test").Scan(&count)
 	assert.NilError(t, err)
 	assert.Equal(t, count, 1)
+
+	err = db.QueryRow("SELECT COUNT(*) FROM appointment_request_participants WHERE request_id = $1", request.RequestID).Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 2)
 }
 
 func TestAppointmentRequestModelGetForUser(t *testing.T) {
@@ -61,6 +70,19 @@ func TestAppointmentRequestModelGetForUser(t *testing.T) {
 	assert.Equal(t, requests[1].Requester.Email, "alice@example.com")
 }
 
+func TestAppointmentRequestModelCountPendingForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+
+	count, err := m.CountPendingForUser(2)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+
+	count, err = m.CountPendingForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 0)
+}
+
 func TestAppointmentRequestModelGet(t *testing.T) {
 	db := newTestDB(t)
 	m := AppointmentRequestModel{DB: db}
@@ -94,3 +116,72 @@ func TestAppointmentRequestModelDelete(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, count, 0)
 }
+
+func TestAppointmentRequestModelGetOutgoingForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+
+	requests, err := m.GetOutgoingForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(requests), 2)
+
+	assert.Equal(t, requests[0].RequestID, 2)
+	assert.Equal(t, requests[0].Target.Name, "Bob")
+	assert.Equal(t, requests[1].RequestID, 1)
+	assert.Equal(t, requests[1].Target.Email, "bob@example.com")
+}
+
+func TestAppointmentRequestModelDecline(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+
+	err := m.Decline(1, "Busy that day")
+	assert.NilError(t, err)
+
+	request, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Status, RequestStatusDeclined)
+	assert.Equal(t, request.DeclineReason, "Busy that day")
+	assert.WithinDuration(t, request.DeclinedAt, time.Now(), time.Minute)
+
+	// Request 2 has already been accepted.
+	err = m.Decline(2, "")
+	assert.Equal(t, err, ErrInvalidTransition)
+
+	err = m.Decline(999, "")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestAppointmentRequestModelCancel(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+
+	err := m.Cancel(1)
+	assert.NilError(t, err)
+
+	request, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Status, RequestStatusCancelled)
+
+	// Cancelling twice isn't allowed.
+	err = m.Cancel(1)
+	assert.Equal(t, err, ErrInvalidTransition)
+}
+
+func TestAppointmentRequestModelExpirePast(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+
+	// Only request 1 is pending, and its start time is in the past.
+	n, err := m.ExpirePast()
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	request, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Status, RequestStatusExpired)
+
+	// An expired request can't be accepted.
+	err = m.Accept(1)
+	assert.Equal(t, err, ErrInvalidTransition)
+}
@@ -2,9 +2,18 @@ package data
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 )
 
+// Statuses of an appointment. An appointment is confirming while its calendar
+// events are being created, and failed if that couldn't be done.
+const (
+	AppointmentConfirming = "confirming"
+	AppointmentConfirmed  = "confirmed"
+	AppointmentFailed     = "failed"
+)
+
 type Appointment struct {
 	ID              int
 	CreatorID       int
@@ -22,6 +31,7 @@ type Appointment struct {
 	Recurrence      string
 	AppointmentType string
 	GroupID         int
+	Resources       []*Resource
 }
 
 type AppointmentModel struct {
@@ -31,11 +41,24 @@ type AppointmentModel struct {
 type AppointmentModelInterface interface {
 	Insert(a *Appointment) (int, error)
 	GetForUser(userID int) ([]*Appointment, error)
+	GetAllForUser(userID int, filters Filters) ([]*Appointment, Metadata, error)
+	GetForFeed(userID int, includeGroups bool) ([]*Appointment, error)
+	GetForGroup(groupID int, from time.Time) ([]*Appointment, error)
 	Delete(id int) error
 	Get(id int) (*Appointment, error)
 }
 
 func (m *AppointmentModel) Insert(a *Appointment) (int, error) {
+	return insertAppointment(m.DB, a)
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx, so inserts can be
+// shared between plain calls and transactions.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func insertAppointment(q queryRower, a *Appointment) (int, error) {
 	var id int64
 	query := `
 		INSERT INTO appointments (creator_id, target_id, title, description, start_time, end_time, location, status, created_at, updated_at, time_zone, visibility, recurrence, appointment_type, group_id)
@@ -48,7 +71,7 @@ func (m *AppointmentModel) Insert(a *Appointment) (int, error) {
 		groupID = &a.GroupID
 	}
 
-	err := m.DB.QueryRow(query, a.CreatorID, a.TargetID, a.Title, a.Description, a.StartTime, a.EndTime, a.Location, a.Status, a.CreatedAt, a.UpdatedAt, a.TimeZone, a.Visibility, a.Recurrence, a.AppointmentType, groupID).Scan(&id)
+	err := q.QueryRow(query, a.CreatorID, a.TargetID, a.Title, a.Description, a.StartTime, a.EndTime, a.Location, a.Status, a.CreatedAt, a.UpdatedAt, a.TimeZone, a.Visibility, a.Recurrence, a.AppointmentType, groupID).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -72,16 +95,176 @@ func (m *AppointmentModel) GetForUser(userID int) ([]*Appointment, error) {
 	appointments := []*Appointment{}
 
 	for rows.Next() {
-		a := &Appointment{}
-		var groupID sql.NullInt64
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		appointments = append(appointments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.attachResources(appointments...)
+	if err != nil {
+		return nil, err
+	}
+
+	return appointments, nil
+}
+
+func scanAppointment(row rowScanner) (*Appointment, error) {
+	a := &Appointment{}
+	var groupID sql.NullInt64
+
+	err := row.Scan(&a.ID, &a.CreatorID, &a.TargetID, &a.Title, &a.Description, &a.StartTime, &a.EndTime, &a.Location, &a.Status, &a.CreatedAt, &a.UpdatedAt, &a.TimeZone, &a.Visibility, &a.Recurrence, &a.AppointmentType, &groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if groupID.Valid {
+		a.GroupID = int(groupID.Int64)
+	}
 
-		err := rows.Scan(&a.ID, &a.CreatorID, &a.TargetID, &a.Title, &a.Description, &a.StartTime, &a.EndTime, &a.Location, &a.Status, &a.CreatedAt, &a.UpdatedAt, &a.TimeZone, &a.Visibility, &a.Recurrence, &a.AppointmentType, &groupID)
+	return a, nil
+}
+
+// Get one page of the user's appointments in order of start time, along with
+// the pagination metadata.
+func (m *AppointmentModel) GetAllForUser(userID int, filters Filters) ([]*Appointment, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, creator_id, target_id, title, description, start_time, end_time, location, status, created_at, updated_at, time_zone, visibility, recurrence, appointment_type, group_id
+		FROM appointments
+		WHERE (creator_id = $1 OR target_id = $1)
+		AND ($2::timestamptz IS NULL OR end_time > $2)
+		AND ($3::timestamptz IS NULL OR start_time < $3)
+		ORDER BY start_time, id
+		LIMIT $4 OFFSET $5
+	`
+
+	rows, err := m.DB.Query(query, userID, filters.from(), filters.to(), filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	appointments := []*Appointment{}
+
+	for rows.Next() {
+		a, err := scanAppointment(countingScanner{rows, &totalRecords})
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		appointments = append(appointments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = m.attachResources(appointments...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return appointments, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// attachResources loads the resources booked for all the appointments in one
+// query.
+func (m *AppointmentModel) attachResources(appointments ...*Appointment) error {
+	ids := make([]int64, 0, len(appointments))
+	for _, a := range appointments {
+		ids = append(ids, int64(a.ID))
+	}
+
+	query := `
+		SELECT ar.appointment_id, ` + resourceColumns + `
+		FROM appointment_resources ar
+		JOIN resources r ON ar.resource_id = r.id
+		WHERE ar.appointment_id = ANY($1)
+		ORDER BY r.name
+	`
+
+	byAppointment, err := resourcesByOwner(m.DB, query, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range appointments {
+		a.Resources = byAppointment[a.ID]
+	}
+
+	return nil
+}
+
+// GetForFeed returns the appointments to put in the user's calendar feed:
+// those from the last year on that have made it into people's calendars,
+// optionally along with those of the groups the user is in.
+func (m *AppointmentModel) GetForFeed(userID int, includeGroups bool) ([]*Appointment, error) {
+	query := `
+		SELECT id, creator_id, target_id, title, description, start_time, end_time, location, status, created_at, updated_at, time_zone, visibility, recurrence, appointment_type, group_id
+		FROM appointments
+		WHERE (creator_id = $1 OR target_id = $1
+			OR ($2 AND group_id IN (SELECT group_id FROM user_groups WHERE user_id = $1)))
+		AND status NOT IN ($3, $4)
+		AND end_time > now() - interval '1 year'
+		ORDER BY start_time, id
+	`
+
+	rows, err := m.DB.Query(query, userID, includeGroups, AppointmentConfirming, AppointmentFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := []*Appointment{}
+
+	for rows.Next() {
+		a, err := scanAppointment(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		if groupID.Valid {
-			a.GroupID = int(groupID.Int64)
+		appointments = append(appointments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return appointments, nil
+}
+
+// GetForGroup returns the group's appointments that end after from and have
+// made it into people's calendars, in order of start time. They make up the
+// group's shared calendar.
+func (m *AppointmentModel) GetForGroup(groupID int, from time.Time) ([]*Appointment, error) {
+	query := `
+		SELECT id, creator_id, target_id, title, description, start_time, end_time, location, status, created_at, updated_at, time_zone, visibility, recurrence, appointment_type, group_id
+		FROM appointments
+		WHERE group_id = $1
+		AND status NOT IN ($2, $3)
+		AND end_time > $4
+		ORDER BY start_time, id
+	`
+
+	rows, err := m.DB.Query(query, groupID, AppointmentConfirming, AppointmentFailed, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := []*Appointment{}
+
+	for rows.Next() {
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
 		}
 
 		appointments = append(appointments, a)
@@ -94,18 +277,31 @@ func (m *AppointmentModel) GetForUser(userID int) ([]*Appointment, error) {
 	return appointments, nil
 }
 
+// Delete the appointment. Deletes are queued for its provider events, which
+// would otherwise be left behind in people's calendars.
 func (m *AppointmentModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = removeAppointmentEvents(tx, id)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		DELETE FROM appointments
 		WHERE id = $1
 	`
 
-	_, err := m.DB.Exec(query, id)
+	_, err = tx.Exec(query, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (m *AppointmentModel) Get(id int) (*Appointment, error) {
@@ -115,16 +311,17 @@ func (m *AppointmentModel) Get(id int) (*Appointment, error) {
 		WHERE id = $1
 	`
 
-	a := &Appointment{}
-	var groupID sql.NullInt64
-
-	err := m.DB.QueryRow(query, id).Scan(&a.ID, &a.CreatorID, &a.TargetID, &a.Title, &a.Description, &a.StartTime, &a.EndTime, &a.Location, &a.Status, &a.CreatedAt, &a.UpdatedAt, &a.TimeZone, &a.Visibility, &a.Recurrence, &a.AppointmentType, &groupID)
+	a, err := scanAppointment(m.DB.QueryRow(query, id))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
 		return nil, err
 	}
 
-	if groupID.Valid {
-		a.GroupID = int(groupID.Int64)
+	err = m.attachResources(a)
+	if err != nil {
+		return nil, err
 	}
 
 	return a, nil
@@ -90,3 +90,51 @@ func TestAppointmentModelGet(t *testing.T) {
 	assert.Equal(t, appointment.TargetID, 1)
 	assert.Equal(t, appointment.Title, "Appointment 2")
 }
+
+func TestAppointmentModelGetAllForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentModel{DB: db}
+
+	tests := []struct {
+		name      string
+		filters   Filters
+		wantIDs   []int
+		wantTotal int
+	}{
+		{
+			name:      "First page",
+			filters:   Filters{Page: 1, PageSize: 1},
+			wantIDs:   []int{1},
+			wantTotal: 2,
+		},
+		{
+			name:      "Second page",
+			filters:   Filters{Page: 2, PageSize: 1},
+			wantIDs:   []int{2},
+			wantTotal: 2,
+		},
+		{
+			name: "Date range",
+			filters: Filters{
+				Page:     1,
+				PageSize: 20,
+				From:     time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC),
+				To:       time.Date(2023, 6, 3, 0, 0, 0, 0, time.UTC),
+			},
+			wantIDs:   []int{2},
+			wantTotal: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appointments, metadata, err := m.GetAllForUser(1, tt.filters)
+			assert.NilError(t, err)
+			assert.Equal(t, len(appointments), len(tt.wantIDs))
+			for i, id := range tt.wantIDs {
+				assert.Equal(t, appointments[i].ID, id)
+			}
+			assert.Equal(t, metadata.TotalRecords, tt.wantTotal)
+		})
+	}
+}
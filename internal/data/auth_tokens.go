@@ -26,6 +26,8 @@ type AuthToken struct {
 type AuthTokenModelInterface interface {
 	SaveToken(userID int, authProvider string, token *oauth2.Token) error
 	Token(userID int, authProvider string) (*oauth2.Token, error)
+	Delete(userID int, authProvider string) error
+	GetAllForUser(userID int) ([]*AuthToken, error)
 }
 
 func (m *AuthTokenModel) SaveToken(userID int, authProvider string, token *oauth2.Token) error {
@@ -79,3 +81,57 @@ func (m *AuthTokenModel) Token(userID int, authProvider string) (*oauth2.Token,
 		Expiry:       token.Expiry,
 	}, nil
 }
+
+// Delete unlinks the provider account. The calendar sync and the copy of its
+// events go with it.
+func (m *AuthTokenModel) Delete(userID int, authProvider string) error {
+	query := `DELETE FROM auth_tokens WHERE user_id = $1 AND auth_provider = $2`
+
+	result, err := m.DB.Exec(query, userID, authProvider)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser returns the provider accounts the user has linked. Only what
+// describes the link is filled in, not the tokens themselves.
+func (m *AuthTokenModel) GetAllForUser(userID int) ([]*AuthToken, error) {
+	query := `
+		SELECT user_id, auth_provider, COALESCE(token_type, ''), expiry, COALESCE(scope, '')
+		FROM auth_tokens
+		WHERE user_id = $1
+		ORDER BY auth_provider
+	`
+
+	rows, err := m.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*AuthToken{}
+	for rows.Next() {
+		token := &AuthToken{}
+		err := rows.Scan(&token.UserID, &token.AuthProvider, &token.TokenType, &token.Expiry, &token.Scope)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
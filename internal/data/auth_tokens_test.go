@@ -59,3 +59,19 @@ func TestAuthTokenModelToken(t *testing.T) {
 	token, err = m.Token(userID, authProvider)
 	assert.NilError(t, err)
 }
+
+func TestAuthTokenModelGetAllForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := AuthTokenModel{DB: db}
+
+	tokens, err := m.GetAllForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 1)
+	assert.Equal(t, tokens[0].AuthProvider, "google")
+	assert.Equal(t, tokens[0].Scope, "scope-1")
+	assert.Equal(t, tokens[0].AccessToken, "")
+
+	tokens, err = m.GetAllForUser(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tokens), 0)
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CalendarFeed is a user's secret iCalendar subscription URL. Like API
+// tokens, only a hash of the token is stored, so Token is only set when the
+// feed is created.
+type CalendarFeed struct {
+	UserID        int
+	Token         string
+	IncludeGroups bool
+	LastUsedAt    time.Time // zero if the feed has never been fetched
+	CreatedAt     time.Time
+}
+
+type CalendarFeedModel struct {
+	DB *sql.DB
+}
+
+type CalendarFeedModelInterface interface {
+	New(userID int, includeGroups bool) (*CalendarFeed, error)
+	GetForUser(userID int) (*CalendarFeed, error)
+	GetByToken(token string) (*CalendarFeed, error)
+	Delete(userID int) error
+}
+
+// New creates a feed for the user, replacing any they already have.
+func (m *CalendarFeedModel) New(userID int, includeGroups bool) (*CalendarFeed, error) {
+	token, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO calendar_feeds (user_id, hash, include_groups)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id)
+		DO UPDATE SET hash = EXCLUDED.hash, include_groups = EXCLUDED.include_groups, last_used_at = NULL, created_at = now()
+		RETURNING created_at
+	`
+
+	feed := &CalendarFeed{UserID: userID, Token: token, IncludeGroups: includeGroups}
+
+	err = m.DB.QueryRow(query, userID, hashSecret(token), includeGroups).Scan(&feed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+func (m *CalendarFeedModel) GetForUser(userID int) (*CalendarFeed, error) {
+	query := `
+		SELECT user_id, include_groups, last_used_at, created_at
+		FROM calendar_feeds
+		WHERE user_id = $1
+	`
+
+	feed, err := scanCalendarFeed(m.DB.QueryRow(query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// GetByToken returns the feed with the token and records that it has been
+// fetched.
+func (m *CalendarFeedModel) GetByToken(token string) (*CalendarFeed, error) {
+	query := `
+		UPDATE calendar_feeds
+		SET last_used_at = now()
+		WHERE hash = $1
+		RETURNING user_id, include_groups, last_used_at, created_at
+	`
+
+	feed, err := scanCalendarFeed(m.DB.QueryRow(query, hashSecret(token)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// Delete turns off the user's feed.
+func (m *CalendarFeedModel) Delete(userID int) error {
+	_, err := m.DB.Exec("DELETE FROM calendar_feeds WHERE user_id = $1", userID)
+	return err
+}
+
+func scanCalendarFeed(row rowScanner) (*CalendarFeed, error) {
+	feed := &CalendarFeed{}
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(&feed.UserID, &feed.IncludeGroups, &lastUsedAt, &feed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	feed.LastUsedAt = lastUsedAt.Time
+
+	return feed, nil
+}
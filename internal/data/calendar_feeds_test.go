@@ -0,0 +1,84 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestCalendarFeedModel(t *testing.T) {
+	db := newTestDB(t)
+	m := CalendarFeedModel{DB: db}
+
+	_, err := m.GetForUser(1)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	feed, err := m.New(1, true)
+	assert.NilError(t, err)
+
+	got, err := m.GetByToken(feed.Token)
+	assert.NilError(t, err)
+	assert.Equal(t, got.UserID, 1)
+	assert.Equal(t, got.IncludeGroups, true)
+	assert.Equal(t, got.LastUsedAt.IsZero(), false)
+
+	// Resetting the feed stops the old URL from working.
+	reset, err := m.New(1, false)
+	assert.NilError(t, err)
+
+	_, err = m.GetByToken(feed.Token)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	got, err = m.GetForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, got.IncludeGroups, false)
+	assert.Equal(t, got.LastUsedAt.IsZero(), true)
+
+	err = m.Delete(1)
+	assert.NilError(t, err)
+
+	_, err = m.GetByToken(reset.Token)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+}
+
+func TestAppointmentModelGetForFeed(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentModel{DB: db}
+
+	start := time.Now().Add(24 * time.Hour)
+	insert := func(a *Appointment) int {
+		a.StartTime, a.EndTime = start, start.Add(time.Hour)
+		a.CreatedAt, a.UpdatedAt = time.Now(), time.Now()
+		a.TimeZone, a.Visibility, a.Recurrence = "UTC", "public", "none"
+		id, err := m.Insert(a)
+		assert.NilError(t, err)
+		return id
+	}
+
+	own := insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Own", Status: AppointmentConfirmed, AppointmentType: "user"})
+	insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Failed", Status: AppointmentFailed, AppointmentType: "user"})
+	group := insert(&Appointment{CreatorID: 2, TargetID: 3, Title: "Group", Status: AppointmentConfirmed, AppointmentType: "group", GroupID: 2})
+
+	ids := func(appointments []*Appointment) map[int]bool {
+		m := map[int]bool{}
+		for _, a := range appointments {
+			m[a.ID] = true
+		}
+		return m
+	}
+
+	appointments, err := m.GetForFeed(1, false)
+	assert.NilError(t, err)
+	got := ids(appointments)
+	assert.Equal(t, got[own], true)
+	assert.Equal(t, got[group], false)
+	assert.Equal(t, len(got), 1)
+
+	appointments, err = m.GetForFeed(1, true)
+	assert.NilError(t, err)
+	got = ids(appointments)
+	assert.Equal(t, got[own], true)
+	assert.Equal(t, got[group], true)
+}
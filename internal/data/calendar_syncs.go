@@ -0,0 +1,301 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CalendarSync is the sync state of a linked calendar. Its events are kept in
+// provider_events and refreshed when the provider pushes a notification down
+// the channel, or every so often if there's no channel.
+type CalendarSync struct {
+	UserID   int
+	Provider string
+	// ChannelID is the Google channel or Microsoft Graph subscription, or ""
+	// if there isn't one. ResourceID is only used by Google.
+	ChannelID  string
+	ResourceID string
+	Expiry     time.Time
+	ChangedAt  time.Time
+	SyncedAt   time.Time
+	CreatedAt  time.Time
+	// LastError is why the last sync failed, or "" if it worked.
+	LastError string
+	FailedAt  time.Time
+}
+
+// NeedsSync reports whether the copy of the calendar is out of date: it has
+// never been synced, has changed since, or has no channel and was last synced
+// more than pollInterval ago.
+func (s *CalendarSync) NeedsSync(pollInterval time.Duration) bool {
+	if s.SyncedAt.IsZero() || s.ChangedAt.After(s.SyncedAt) {
+		return true
+	}
+	return s.ChannelID == "" && time.Since(s.SyncedAt) > pollInterval
+}
+
+type CalendarSyncModel struct {
+	DB *sql.DB
+}
+
+type CalendarSyncModelInterface interface {
+	Get(userID int, provider string) (*CalendarSync, error)
+	SaveChannel(s *CalendarSync, token string) error
+	MarkChanged(provider, channelID, token string) (int, error)
+	SaveEvents(userID int, provider string, events []Event, syncedAt time.Time) error
+	GetEvents(userID int, provider string) ([]*Event, error)
+	GetStale(limit int, pollInterval time.Duration) ([]*CalendarSync, error)
+	GetExpiring(before time.Time, limit int) ([]*CalendarSync, error)
+	RecordError(userID int, provider, message string) error
+	GetFailing(limit int) ([]*CalendarSync, error)
+	Delete(userID int, provider string) error
+}
+
+const calendarSyncColumns = `user_id, auth_provider, channel_id, resource_id, expires_at, changed_at, synced_at, created_at, last_error, failed_at`
+
+func scanCalendarSync(row rowScanner) (*CalendarSync, error) {
+	s := &CalendarSync{}
+	var expiry, syncedAt, failedAt sql.NullTime
+
+	err := row.Scan(&s.UserID, &s.Provider, &s.ChannelID, &s.ResourceID, &expiry, &s.ChangedAt, &syncedAt, &s.CreatedAt, &s.LastError, &failedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Expiry = expiry.Time
+	s.SyncedAt = syncedAt.Time
+	s.FailedAt = failedAt.Time
+
+	return s, nil
+}
+
+func (m *CalendarSyncModel) Get(userID int, provider string) (*CalendarSync, error) {
+	query := `SELECT ` + calendarSyncColumns + ` FROM calendar_syncs WHERE user_id = $1 AND auth_provider = $2`
+
+	s, err := scanCalendarSync(m.DB.QueryRow(query, userID, provider))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SaveChannel records the channel of the calendar, which is sent token with
+// every notification. Only the hash of the token is stored; an empty token
+// keeps the one already there, for a channel that was only extended.
+func (m *CalendarSyncModel) SaveChannel(s *CalendarSync, token string) error {
+	query := `
+		INSERT INTO calendar_syncs (user_id, auth_provider, channel_id, resource_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, auth_provider)
+		DO UPDATE SET channel_id = EXCLUDED.channel_id, resource_id = EXCLUDED.resource_id,
+			token_hash = COALESCE(EXCLUDED.token_hash, calendar_syncs.token_hash), expires_at = EXCLUDED.expires_at
+	`
+
+	var tokenHash []byte
+	if token != "" {
+		tokenHash = hashSecret(token)
+	}
+
+	expiry := sql.NullTime{Time: s.Expiry, Valid: !s.Expiry.IsZero()}
+
+	_, err := m.DB.Exec(query, s.UserID, s.Provider, s.ChannelID, s.ResourceID, tokenHash, expiry)
+	return err
+}
+
+// MarkChanged marks the calendar behind a channel for a resync and returns
+// its user's ID. It returns ErrRecordNotFound if there's no such channel or
+// the token doesn't match.
+func (m *CalendarSyncModel) MarkChanged(provider, channelID, token string) (int, error) {
+	query := `
+		UPDATE calendar_syncs
+		SET changed_at = NOW()
+		WHERE auth_provider = $1 AND channel_id = $2 AND channel_id <> '' AND token_hash = $3
+		RETURNING user_id
+	`
+
+	var userID int
+	err := m.DB.QueryRow(query, provider, channelID, hashSecret(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// SaveEvents replaces the copy of the calendar's events with the ones fetched
+// by a sync that started at syncedAt, clearing any error from the last one.
+// Changes notified after that time leave the calendar marked for another
+// sync.
+func (m *CalendarSyncModel) SaveEvents(userID int, provider string, events []Event, syncedAt time.Time) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO calendar_syncs (user_id, auth_provider, changed_at, synced_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (user_id, auth_provider) DO UPDATE SET synced_at = EXCLUDED.synced_at, last_error = '', failed_at = NULL
+	`, userID, provider, syncedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM provider_events WHERE user_id = $1 AND auth_provider = $2`, userID, provider)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO provider_events (user_id, auth_provider, provider, provider_event_id, title, description,
+			start_time, end_time, location, is_all_day, status, time_zone, visibility, recurrence, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`
+
+	for _, e := range events {
+		_, err = tx.Exec(query, userID, provider, e.Provider, e.ProviderEventID, e.Title, e.Description,
+			e.StartTime, e.EndTime, e.Location, e.IsAllDay, e.Status, e.TimeZone, e.Visibility, e.Recurrence,
+			e.CreatedAt, e.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetEvents returns the calendar's events as of its last sync.
+func (m *CalendarSyncModel) GetEvents(userID int, provider string) ([]*Event, error) {
+	query := `
+		SELECT id, user_id, provider, provider_event_id, title, description, start_time, end_time,
+			location, is_all_day, status, time_zone, visibility, recurrence, created_at, updated_at
+		FROM provider_events
+		WHERE user_id = $1 AND auth_provider = $2
+		ORDER BY start_time, id
+	`
+
+	rows, err := m.DB.Query(query, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+
+	for rows.Next() {
+		e := &Event{}
+		var createdAt, updatedAt sql.NullTime
+
+		err := rows.Scan(&e.ID, &e.UserID, &e.Provider, &e.ProviderEventID, &e.Title, &e.Description, &e.StartTime, &e.EndTime,
+			&e.Location, &e.IsAllDay, &e.Status, &e.TimeZone, &e.Visibility, &e.Recurrence, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		e.CreatedAt = createdAt.Time
+		e.UpdatedAt = updatedAt.Time
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (m *CalendarSyncModel) query(query string, args ...any) ([]*CalendarSync, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	syncs := []*CalendarSync{}
+
+	for rows.Next() {
+		s, err := scanCalendarSync(rows)
+		if err != nil {
+			return nil, err
+		}
+		syncs = append(syncs, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return syncs, nil
+}
+
+// GetStale returns up to limit calendars that need a sync, as defined by
+// CalendarSync.NeedsSync.
+func (m *CalendarSyncModel) GetStale(limit int, pollInterval time.Duration) ([]*CalendarSync, error) {
+	query := `
+		SELECT ` + calendarSyncColumns + `
+		FROM calendar_syncs
+		WHERE synced_at IS NULL OR changed_at > synced_at
+		OR (channel_id = '' AND synced_at < NOW() - $2 * INTERVAL '1 second')
+		ORDER BY changed_at
+		LIMIT $1
+	`
+
+	return m.query(query, limit, pollInterval.Seconds())
+}
+
+// GetExpiring returns up to limit calendars whose channel expires before the
+// given time, or that have no channel yet.
+func (m *CalendarSyncModel) GetExpiring(before time.Time, limit int) ([]*CalendarSync, error) {
+	query := `
+		SELECT ` + calendarSyncColumns + `
+		FROM calendar_syncs
+		WHERE channel_id = '' OR expires_at < $1
+		ORDER BY expires_at NULLS FIRST
+		LIMIT $2
+	`
+
+	return m.query(query, before, limit)
+}
+
+// RecordError records why a sync of the calendar failed. A calendar that has
+// never been synced is added, so the sync worker tries it again.
+func (m *CalendarSyncModel) RecordError(userID int, provider, message string) error {
+	query := `
+		INSERT INTO calendar_syncs (user_id, auth_provider, last_error, failed_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, auth_provider)
+		DO UPDATE SET last_error = EXCLUDED.last_error, failed_at = EXCLUDED.failed_at
+	`
+
+	_, err := m.DB.Exec(query, userID, provider, message)
+	return err
+}
+
+// GetFailing returns up to limit calendars whose last sync failed, most
+// recent failure first.
+func (m *CalendarSyncModel) GetFailing(limit int) ([]*CalendarSync, error) {
+	query := `
+		SELECT ` + calendarSyncColumns + `
+		FROM calendar_syncs
+		WHERE last_error <> ''
+		ORDER BY failed_at DESC
+		LIMIT $1
+	`
+
+	return m.query(query, limit)
+}
+
+// Delete forgets the calendar's channel and its events.
+func (m *CalendarSyncModel) Delete(userID int, provider string) error {
+	_, err := m.DB.Exec(`DELETE FROM calendar_syncs WHERE user_id = $1 AND auth_provider = $2`, userID, provider)
+	return err
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestCalendarSyncNeedsSync(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		sync CalendarSync
+		want bool
+	}{
+		{"Never synced", CalendarSync{ChannelID: "c", ChangedAt: now}, true},
+		{"Changed since", CalendarSync{ChannelID: "c", ChangedAt: now, SyncedAt: now.Add(-time.Minute)}, true},
+		{"Up to date", CalendarSync{ChannelID: "c", ChangedAt: now.Add(-time.Hour), SyncedAt: now.Add(-time.Hour)}, false},
+		{"Polled recently", CalendarSync{ChangedAt: now.Add(-time.Hour), SyncedAt: now.Add(-time.Minute)}, false},
+		{"Due a poll", CalendarSync{ChangedAt: now.Add(-time.Hour), SyncedAt: now.Add(-time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.sync.NeedsSync(15*time.Minute), tt.want)
+		})
+	}
+}
+
+func TestCalendarSyncModel(t *testing.T) {
+	db := newTestDB(t)
+	m := CalendarSyncModel{DB: db}
+
+	_, err := m.Get(1, "google")
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	err = m.SaveChannel(&CalendarSync{UserID: 1, Provider: "google", ChannelID: "chan", ResourceID: "res", Expiry: time.Now().Add(time.Hour)}, "secret")
+	assert.NilError(t, err)
+
+	stale, err := m.GetStale(10, time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, len(stale), 1)
+
+	started := time.Now()
+	err = m.SaveEvents(1, "google", []Event{
+		{Provider: "Google", ProviderEventID: "e1", Title: "Dentist", StartTime: started.Add(time.Hour), EndTime: started.Add(2 * time.Hour)},
+	}, started)
+	assert.NilError(t, err)
+
+	stale, err = m.GetStale(10, time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, len(stale), 0)
+
+	events, err := m.GetEvents(1, "google")
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 1)
+	assert.Equal(t, events[0].Title, "Dentist")
+
+	// Notifications need the right token.
+	_, err = m.MarkChanged("google", "chan", "guess")
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	userID, err := m.MarkChanged("google", "chan", "secret")
+	assert.NilError(t, err)
+	assert.Equal(t, userID, 1)
+
+	sync, err := m.Get(1, "google")
+	assert.NilError(t, err)
+	assert.Equal(t, sync.NeedsSync(time.Hour), true)
+
+	// Extending the channel keeps its token.
+	sync.Expiry = time.Now().Add(48 * time.Hour)
+	err = m.SaveChannel(sync, "")
+	assert.NilError(t, err)
+
+	_, err = m.MarkChanged("google", "chan", "secret")
+	assert.NilError(t, err)
+
+	expiring, err := m.GetExpiring(time.Now().Add(24*time.Hour), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(expiring), 0)
+
+	// Unlinking the account takes the sync and its events with it.
+	err = (&AuthTokenModel{DB: db}).Delete(1, "google")
+	assert.NilError(t, err)
+
+	_, err = m.Get(1, "google")
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	events, err = m.GetEvents(1, "google")
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 0)
+}
+
+func TestCalendarSyncModelRecordError(t *testing.T) {
+	db := newTestDB(t)
+	m := CalendarSyncModel{DB: db}
+
+	// A calendar that fails its first sync still shows up.
+	err := m.RecordError(1, "google", "oauth2: token expired")
+	assert.NilError(t, err)
+
+	failing, err := m.GetFailing(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(failing), 1)
+	assert.Equal(t, failing[0].LastError, "oauth2: token expired")
+
+	// A sync that works clears the error.
+	err = m.SaveEvents(1, "google", nil, time.Now())
+	assert.NilError(t, err)
+
+	failing, err = m.GetFailing(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(failing), 0)
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// Filters narrow down a list to one page of records, optionally only those
+// overlapping the time between From and To. A zero From or To leaves that end
+// of the range open.
+type Filters struct {
+	Page     int
+	PageSize int
+	From     time.Time
+	To       time.Time
+}
+
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.CheckField(f.Page > 0, "page", "must be greater than zero")
+	v.CheckField(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.CheckField(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.CheckField(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	v.CheckField(f.From.IsZero() || f.To.IsZero() || f.From.Before(f.To), "to", "must be after from")
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// from and to return the ends of the range as query arguments, NULL if open.
+func (f Filters) from() sql.NullTime {
+	return sql.NullTime{Time: f.From, Valid: !f.From.IsZero()}
+}
+
+func (f Filters) to() sql.NullTime {
+	return sql.NullTime{Time: f.To, Valid: !f.To.IsZero()}
+}
+
+// Metadata describes the page of records returned for some Filters.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records"`
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// Page returns the page of items the filters ask for, for lists that are
+// small enough to be loaded in full. Date ranges aren't applied.
+func Page[T any](items []T, f Filters) ([]T, Metadata) {
+	start := min(f.offset(), len(items))
+	end := min(start+f.limit(), len(items))
+
+	return items[start:end], calculateMetadata(len(items), f.Page, f.PageSize)
+}
+
+// countingScanner reads the total count selected with count(*) OVER() in
+// front of the other columns, so the usual scan functions can be used for
+// paginated queries.
+type countingScanner struct {
+	rows  *sql.Rows
+	total *int
+}
+
+func (s countingScanner) Scan(dest ...any) error {
+	return s.rows.Scan(append([]any{s.total}, dest...)...)
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+func TestValidateFilters(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		filters   Filters
+		wantField string
+	}{
+		{
+			name:    "Valid",
+			filters: Filters{Page: 1, PageSize: 20},
+		},
+		{
+			name:      "Zero page",
+			filters:   Filters{Page: 0, PageSize: 20},
+			wantField: "page",
+		},
+		{
+			name:      "Page size too large",
+			filters:   Filters{Page: 1, PageSize: 101},
+			wantField: "page_size",
+		},
+		{
+			name:      "Range backwards",
+			filters:   Filters{Page: 1, PageSize: 20, From: now, To: now.Add(-time.Hour)},
+			wantField: "to",
+		},
+		{
+			name:    "Open ended range",
+			filters: Filters{Page: 1, PageSize: 20, From: now},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v validator.Validator
+			ValidateFilters(&v, tt.filters)
+
+			assert.Equal(t, v.Valid(), tt.wantField == "")
+			if tt.wantField != "" {
+				_, ok := v.FieldErrors[tt.wantField]
+				assert.Equal(t, ok, true)
+			}
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	page, metadata := Page(items, Filters{Page: 2, PageSize: 2})
+	assert.Equal(t, len(page), 2)
+	assert.Equal(t, page[0], 3)
+	assert.Equal(t, metadata.LastPage, 3)
+	assert.Equal(t, metadata.TotalRecords, 5)
+
+	page, _ = Page(items, Filters{Page: 4, PageSize: 2})
+	assert.Equal(t, len(page), 0)
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GroupCalendarFeed is a member's secret iCalendar subscription URL for a
+// group's shared calendar. As with CalendarFeed, only a hash of the token is
+// stored, so Token is only set when the feed is created.
+type GroupCalendarFeed struct {
+	GroupID    int
+	UserID     int
+	Token      string
+	LastUsedAt time.Time // zero if the feed has never been fetched
+	CreatedAt  time.Time
+}
+
+type GroupCalendarFeedModel struct {
+	DB *sql.DB
+}
+
+type GroupCalendarFeedModelInterface interface {
+	New(groupID, userID int) (*GroupCalendarFeed, error)
+	GetForMember(groupID, userID int) (*GroupCalendarFeed, error)
+	GetByToken(token string) (*GroupCalendarFeed, error)
+	Delete(groupID, userID int) error
+}
+
+// New creates a feed of the group's calendar for a member, replacing any they
+// already have.
+func (m *GroupCalendarFeedModel) New(groupID, userID int) (*GroupCalendarFeed, error) {
+	token, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO group_calendar_feeds (group_id, user_id, hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id)
+		DO UPDATE SET hash = EXCLUDED.hash, last_used_at = NULL, created_at = now()
+		RETURNING created_at
+	`
+
+	feed := &GroupCalendarFeed{GroupID: groupID, UserID: userID, Token: token}
+
+	err = m.DB.QueryRow(query, groupID, userID, hashSecret(token)).Scan(&feed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+func (m *GroupCalendarFeedModel) GetForMember(groupID, userID int) (*GroupCalendarFeed, error) {
+	query := `
+		SELECT group_id, user_id, last_used_at, created_at
+		FROM group_calendar_feeds
+		WHERE group_id = $1 AND user_id = $2
+	`
+
+	feed, err := scanGroupCalendarFeed(m.DB.QueryRow(query, groupID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// GetByToken returns the feed with the token and records that it has been
+// fetched.
+func (m *GroupCalendarFeedModel) GetByToken(token string) (*GroupCalendarFeed, error) {
+	query := `
+		UPDATE group_calendar_feeds
+		SET last_used_at = now()
+		WHERE hash = $1
+		RETURNING group_id, user_id, last_used_at, created_at
+	`
+
+	feed, err := scanGroupCalendarFeed(m.DB.QueryRow(query, hashSecret(token)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// Delete turns off a member's feed of the group's calendar.
+func (m *GroupCalendarFeedModel) Delete(groupID, userID int) error {
+	_, err := m.DB.Exec("DELETE FROM group_calendar_feeds WHERE group_id = $1 AND user_id = $2", groupID, userID)
+	return err
+}
+
+func scanGroupCalendarFeed(row rowScanner) (*GroupCalendarFeed, error) {
+	feed := &GroupCalendarFeed{}
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(&feed.GroupID, &feed.UserID, &lastUsedAt, &feed.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	feed.LastUsedAt = lastUsedAt.Time
+
+	return feed, nil
+}
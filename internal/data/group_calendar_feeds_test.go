@@ -0,0 +1,91 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestGroupCalendarFeedModel(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupCalendarFeedModel{DB: db}
+	groups := GroupModel{DB: db}
+
+	// Group 1 has Alice (1) as its owner and Bob (2) as a member.
+	err := groups.SetCalendarEnabled(1, true)
+	assert.NilError(t, err)
+
+	group, err := groups.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, group.CalendarEnabled, true)
+
+	_, err = m.GetForMember(1, 2)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	feed, err := m.New(1, 2)
+	assert.NilError(t, err)
+
+	got, err := m.GetByToken(feed.Token)
+	assert.NilError(t, err)
+	assert.Equal(t, got.GroupID, 1)
+	assert.Equal(t, got.UserID, 2)
+	assert.Equal(t, got.LastUsedAt.IsZero(), false)
+
+	// Resetting the feed stops the old URL from working.
+	reset, err := m.New(1, 2)
+	assert.NilError(t, err)
+
+	_, err = m.GetByToken(feed.Token)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	// Leaving the group stops the member's feed.
+	err = groups.RemoveMember(1, 2)
+	assert.NilError(t, err)
+
+	_, err = m.GetByToken(reset.Token)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	// So does turning the calendar off.
+	owner, err := m.New(1, 1)
+	assert.NilError(t, err)
+
+	err = groups.SetCalendarEnabled(1, false)
+	assert.NilError(t, err)
+
+	_, err = m.GetByToken(owner.Token)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	// Only members can have a feed.
+	_, err = m.New(2, 2)
+	assert.NotNil(t, err)
+}
+
+func TestAppointmentModelGetForGroup(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentModel{DB: db}
+
+	insert := func(a *Appointment, start time.Time) int {
+		a.StartTime, a.EndTime = start, start.Add(time.Hour)
+		a.CreatedAt, a.UpdatedAt = time.Now(), time.Now()
+		a.TimeZone, a.Visibility, a.Recurrence = "UTC", "public", "none"
+		id, err := m.Insert(a)
+		assert.NilError(t, err)
+		return id
+	}
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	later := insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Later", Status: AppointmentConfirmed, AppointmentType: "group", GroupID: 1}, tomorrow.Add(time.Hour))
+	sooner := insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Sooner", Status: AppointmentConfirmed, AppointmentType: "group", GroupID: 1}, tomorrow)
+	insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Past", Status: AppointmentConfirmed, AppointmentType: "group", GroupID: 1}, time.Now().Add(-48*time.Hour))
+	insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Failed", Status: AppointmentFailed, AppointmentType: "group", GroupID: 1}, tomorrow)
+	insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Other group", Status: AppointmentConfirmed, AppointmentType: "group", GroupID: 2}, tomorrow)
+	insert(&Appointment{CreatorID: 1, TargetID: 2, Title: "Own", Status: AppointmentConfirmed, AppointmentType: "user"}, tomorrow)
+
+	appointments, err := m.GetForGroup(1, time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, len(appointments), 2)
+	assert.Equal(t, appointments[0].ID, sooner)
+	assert.Equal(t, appointments[1].ID, later)
+}
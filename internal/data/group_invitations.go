@@ -0,0 +1,222 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GroupInvitation is an invitation to join a group, sent to an email address
+// whether or not it has an account yet.
+type GroupInvitation struct {
+	ID          int
+	GroupID     int
+	GroupName   string
+	Email       string
+	InviterID   int
+	InviterName string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	// Plaintext is the token of the links in the invitation email. It's only
+	// set when the invitation is made.
+	Plaintext string
+}
+
+type GroupInvitationModel struct {
+	DB *sql.DB
+}
+
+type GroupInvitationModelInterface interface {
+	Insert(groupID, inviterID int, email string, ttl time.Duration) (*GroupInvitation, error)
+	Get(id int) (*GroupInvitation, error)
+	GetByToken(plaintext string) (*GroupInvitation, error)
+	GetPendingForEmail(email string) ([]*GroupInvitation, error)
+	GetPendingForGroup(groupID int) ([]*GroupInvitation, error)
+	Accept(id, userID int) error
+	AcceptAllForEmail(email string, userID int) (int, error)
+	Delete(id int) error
+}
+
+// groupInvitationSelect reads invitations with the names of their group and
+// inviter, in the order scanGroupInvitation expects.
+const groupInvitationSelect = `
+	SELECT gi.id, gi.group_id, g.name, gi.email, gi.inviter_id, u.name, gi.created_at, gi.expires_at
+	FROM group_invitations gi
+	INNER JOIN groups g ON g.id = gi.group_id
+	INNER JOIN users u ON u.id = gi.inviter_id`
+
+func scanGroupInvitation(row rowScanner) (*GroupInvitation, error) {
+	inv := &GroupInvitation{}
+	err := row.Scan(&inv.ID, &inv.GroupID, &inv.GroupName, &inv.Email, &inv.InviterID, &inv.InviterName, &inv.CreatedAt, &inv.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Insert invites the email address to the group, until ttl has passed. An
+// invitation the address already had to the group is replaced, so its old
+// links stop working.
+func (m *GroupInvitationModel) Insert(groupID, inviterID int, email string, ttl time.Duration) (*GroupInvitation, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &GroupInvitation{
+		GroupID:   groupID,
+		Email:     email,
+		InviterID: inviterID,
+		ExpiresAt: time.Now().Add(ttl),
+		Plaintext: secret,
+	}
+
+	query := `
+		INSERT INTO group_invitations (group_id, email, inviter_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (group_id, email) DO UPDATE
+		SET inviter_id = EXCLUDED.inviter_id, token_hash = EXCLUDED.token_hash,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		RETURNING id, created_at
+	`
+
+	err = m.DB.QueryRow(query, groupID, email, inviterID, hashSecret(secret), inv.ExpiresAt).Scan(&inv.ID, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// Get returns the invitation with the ID, or ErrRecordNotFound if there's no
+// such invitation or it has expired.
+func (m *GroupInvitationModel) Get(id int) (*GroupInvitation, error) {
+	query := groupInvitationSelect + ` WHERE gi.id = $1 AND gi.expires_at > NOW()`
+
+	return scanGroupInvitation(m.DB.QueryRow(query, id))
+}
+
+// GetByToken returns the invitation the token was sent with, or
+// ErrRecordNotFound if there's no such invitation or it has expired.
+func (m *GroupInvitationModel) GetByToken(plaintext string) (*GroupInvitation, error) {
+	query := groupInvitationSelect + ` WHERE gi.token_hash = $1 AND gi.expires_at > NOW()`
+
+	return scanGroupInvitation(m.DB.QueryRow(query, hashSecret(plaintext)))
+}
+
+// GetPendingForEmail returns the invitations the email address hasn't
+// answered yet, newest first.
+func (m *GroupInvitationModel) GetPendingForEmail(email string) ([]*GroupInvitation, error) {
+	query := groupInvitationSelect + `
+		WHERE gi.email = $1 AND gi.expires_at > NOW()
+		ORDER BY gi.created_at DESC, gi.id DESC
+	`
+
+	return m.query(query, email)
+}
+
+// GetPendingForGroup returns the invitations to the group that haven't been
+// answered yet, newest first.
+func (m *GroupInvitationModel) GetPendingForGroup(groupID int) ([]*GroupInvitation, error) {
+	query := groupInvitationSelect + `
+		WHERE gi.group_id = $1 AND gi.expires_at > NOW()
+		ORDER BY gi.created_at DESC, gi.id DESC
+	`
+
+	return m.query(query, groupID)
+}
+
+func (m *GroupInvitationModel) query(query string, args ...any) ([]*GroupInvitation, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*GroupInvitation{}
+	for rows.Next() {
+		inv, err := scanGroupInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// Accept uses up the invitation and adds the user to its group as a member.
+// It returns ErrRecordNotFound if there's no such invitation or it has
+// expired. A user who is already in the group stays as they are.
+func (m *GroupInvitationModel) Accept(id, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var groupID int
+	err = tx.QueryRow(`
+		DELETE FROM group_invitations
+		WHERE id = $1 AND expires_at > NOW()
+		RETURNING group_id
+	`, id).Scan(&groupID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_groups (user_id, group_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, group_id) DO NOTHING
+	`, userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AcceptAllForEmail adds the user to every group their email address has
+// been invited to, once they've shown it's theirs, and returns how many
+// groups they joined. Invitations from people who can't reach the user, as
+// they've since joined another organisation, are left alone.
+func (m *GroupInvitationModel) AcceptAllForEmail(email string, userID int) (int, error) {
+	query := `
+		WITH accepted AS (
+			DELETE FROM group_invitations
+			WHERE email = $1 AND expires_at > NOW()
+			AND ` + reachable("inviter_id", "$2") + `
+			RETURNING group_id
+		)
+		INSERT INTO user_groups (user_id, group_id)
+		SELECT $2, group_id FROM accepted
+		ON CONFLICT (user_id, group_id) DO NOTHING
+	`
+
+	result, err := m.DB.Exec(query, email, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// Delete removes the invitation, when it's declined or cancelled.
+func (m *GroupInvitationModel) Delete(id int) error {
+	return expectOneRow(m.DB.Exec(`DELETE FROM group_invitations WHERE id = $1`, id))
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestGroupInvitationModelAccept(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupInvitationModel{DB: db}
+	groups := GroupModel{DB: db}
+
+	inv, err := m.Insert(2, 1, "charlie@example.com", time.Hour)
+	assert.NilError(t, err)
+
+	// Only the hash of the token should be stored.
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM group_invitations WHERE token_hash = $1", hashSecret(inv.Plaintext)).Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+
+	got, err := m.GetByToken(inv.Plaintext)
+	assert.NilError(t, err)
+	assert.Equal(t, got.ID, inv.ID)
+	assert.Equal(t, got.GroupName, "Group 2")
+	assert.Equal(t, got.InviterName, "Alice")
+
+	// Addresses are matched whatever their case.
+	pending, err := m.GetPendingForEmail("Charlie@Example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 1)
+
+	// Inviting again replaces the invitation, and its old links.
+	again, err := m.Insert(2, 1, "charlie@example.com", time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, again.ID, inv.ID)
+
+	_, err = m.GetByToken(inv.Plaintext)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	err = m.Accept(inv.ID, 3)
+	assert.NilError(t, err)
+
+	group, err := groups.Get(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(group.Members), 2)
+	assert.Equal(t, group.Members[1].ID, 3)
+	assert.Equal(t, group.Members[1].Role, GroupRoleMember)
+
+	// An invitation can only be accepted once.
+	err = m.Accept(inv.ID, 3)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestGroupInvitationModelExpiry(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupInvitationModel{DB: db}
+
+	inv, err := m.Insert(2, 1, "dave@example.com", -time.Minute)
+	assert.NilError(t, err)
+
+	_, err = m.Get(inv.ID)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	pending, err := m.GetPendingForGroup(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+
+	err = m.Accept(inv.ID, 2)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestGroupInvitationModelAcceptAllForEmail(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupInvitationModel{DB: db}
+
+	_, err := m.Insert(1, 1, "charlie@example.com", time.Hour)
+	assert.NilError(t, err)
+	_, err = m.Insert(2, 1, "charlie@example.com", time.Hour)
+	assert.NilError(t, err)
+	// Someone else's invitation is left alone.
+	other, err := m.Insert(2, 1, "dave@example.com", time.Hour)
+	assert.NilError(t, err)
+
+	joined, err := m.AcceptAllForEmail("charlie@example.com", 3)
+	assert.NilError(t, err)
+	assert.Equal(t, joined, 2)
+
+	pending, err := m.GetPendingForEmail("charlie@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+
+	err = m.Delete(other.ID)
+	assert.NilError(t, err)
+
+	err = m.Delete(other.ID)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
@@ -4,10 +4,20 @@ import (
 	"database/sql"
 )
 
+// Roles of group members. The owner can do anything, including handing the
+// group to someone else; admins can manage the group and its members; members
+// can only see it and leave.
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleAdmin  = "admin"
+	GroupRoleMember = "member"
+)
+
 type GroupMember struct {
 	ID    int
 	Name  string
 	Email string
+	Role  string
 }
 
 type Group struct {
@@ -16,7 +26,10 @@ type Group struct {
 	Description string
 	CreatedAt   string
 	UpdatedAt   string
-	Members     []*GroupMember
+	// CalendarEnabled is whether the group has a shared calendar of its
+	// appointments.
+	CalendarEnabled bool
+	Members         []*GroupMember
 }
 
 type GroupModel struct {
@@ -28,9 +41,15 @@ type GroupModelInterface interface {
 	Get(id int) (*Group, error)
 	GetAllForUser(userID int) ([]*Group, error)
 	AddMember(groupID, userID int) error
+	Update(id int, name, description string) error
+	Delete(id int) error
+	RemoveMember(groupID, userID int) error
+	SetRole(groupID, userID int, role string) error
+	TransferOwnership(groupID, fromUserID, toUserID int) error
+	SetCalendarEnabled(id int, enabled bool) error
 }
 
-// Insert a new group. Also auto insert the creator as a member.
+// Insert a new group. Also auto insert the creator as its owner.
 func (m *GroupModel) Insert(userID int, name, description string) (int, error) {
 	query := `
 		INSERT INTO groups (name, description)
@@ -45,11 +64,11 @@ func (m *GroupModel) Insert(userID int, name, description string) (int, error) {
 	}
 
 	query = `
-		INSERT INTO user_groups (user_id, group_id)
-		VALUES ($1, $2)
+		INSERT INTO user_groups (user_id, group_id, role)
+		VALUES ($1, $2, $3)
 	`
 
-	_, err = m.DB.Exec(query, userID, newGroupID)
+	_, err = m.DB.Exec(query, userID, newGroupID, GroupRoleOwner)
 	if err != nil {
 		return 0, err
 	}
@@ -59,11 +78,12 @@ func (m *GroupModel) Insert(userID int, name, description string) (int, error) {
 
 func (m *GroupModel) Get(id int) (*Group, error) {
 	query := `
-        SELECT g.id, g.name, g.description, g.created_at, g.updated_at, u.id, u.name, u.email
+        SELECT g.id, g.name, g.description, g.created_at, g.updated_at, g.calendar_enabled, u.id, u.name, u.email, ug.role
         FROM groups g
         INNER JOIN user_groups ug ON g.id = ug.group_id
         INNER JOIN users u ON ug.user_id = u.id
         WHERE g.id = $1
+        ORDER BY CASE ug.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, u.name, u.id
     `
 
 	rows, err := m.DB.Query(query, id)
@@ -77,7 +97,7 @@ func (m *GroupModel) Get(id int) (*Group, error) {
 
 	for rows.Next() {
 		member := &GroupMember{}
-		err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt, &member.ID, &member.Name, &member.Email)
+		err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt, &group.CalendarEnabled, &member.ID, &member.Name, &member.Email, &member.Role)
 		if err != nil {
 			return nil, err
 		}
@@ -96,7 +116,7 @@ func (m *GroupModel) Get(id int) (*Group, error) {
 // Get groups user is a member of without the members.
 func (m *GroupModel) GetAllForUser(userID int) ([]*Group, error) {
 	query := `
-		SELECT g.id, g.name, g.description, g.created_at, g.updated_at
+		SELECT g.id, g.name, g.description, g.created_at, g.updated_at, g.calendar_enabled
 		FROM groups g
 		INNER JOIN user_groups ug ON g.id = ug.group_id
 		WHERE ug.user_id = $1
@@ -112,7 +132,7 @@ func (m *GroupModel) GetAllForUser(userID int) ([]*Group, error) {
 
 	for rows.Next() {
 		group := &Group{}
-		err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt)
+		err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt, &group.CalendarEnabled)
 		if err != nil {
 			return nil, err
 		}
@@ -126,7 +146,7 @@ func (m *GroupModel) GetAllForUser(userID int) ([]*Group, error) {
 	return groups, nil
 }
 
-// Add a new member to a group.
+// Add a new member to a group, with the member role.
 func (m *GroupModel) AddMember(groupID, userID int) error {
 	query := `
 		INSERT INTO user_groups (user_id, group_id)
@@ -140,3 +160,116 @@ func (m *GroupModel) AddMember(groupID, userID int) error {
 
 	return nil
 }
+
+// Update changes the name and description of a group.
+func (m *GroupModel) Update(id int, name, description string) error {
+	query := `
+		UPDATE groups
+		SET name = $2, description = $3, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	return expectOneRow(m.DB.Exec(query, id, name, description))
+}
+
+// Delete removes a group, along with its memberships and its appointments.
+func (m *GroupModel) Delete(id int) error {
+	return expectOneRow(m.DB.Exec("DELETE FROM groups WHERE id = $1", id))
+}
+
+// RemoveMember takes the user out of a group. The owner can't be removed;
+// ownership has to be transferred first.
+func (m *GroupModel) RemoveMember(groupID, userID int) error {
+	query := `
+		DELETE FROM user_groups
+		WHERE group_id = $1 AND user_id = $2 AND role <> $3
+	`
+
+	return expectOneRow(m.DB.Exec(query, groupID, userID, GroupRoleOwner))
+}
+
+// SetRole makes a member of a group an admin or a plain member. The owner's
+// role can only change by transferring ownership.
+func (m *GroupModel) SetRole(groupID, userID int, role string) error {
+	query := `
+		UPDATE user_groups
+		SET role = $3, updated_at = NOW()
+		WHERE group_id = $1 AND user_id = $2 AND role <> $4
+	`
+
+	return expectOneRow(m.DB.Exec(query, groupID, userID, role, GroupRoleOwner))
+}
+
+// TransferOwnership makes another member the owner of a group. The old owner
+// stays on as an admin.
+func (m *GroupModel) TransferOwnership(groupID, fromUserID, toUserID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only one member can be the owner at a time, so step down first.
+	err = expectOneRow(tx.Exec(`
+		UPDATE user_groups SET role = $3, updated_at = NOW()
+		WHERE group_id = $1 AND user_id = $2 AND role = $4
+	`, groupID, fromUserID, GroupRoleAdmin, GroupRoleOwner))
+	if err != nil {
+		return err
+	}
+
+	err = expectOneRow(tx.Exec(`
+		UPDATE user_groups SET role = $3, updated_at = NOW()
+		WHERE group_id = $1 AND user_id = $2
+	`, groupID, toUserID, GroupRoleOwner))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetCalendarEnabled turns a group's shared calendar on or off. Turning it off
+// also deletes its members' feeds, so their URLs stop working.
+func (m *GroupModel) SetCalendarEnabled(id int, enabled bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = expectOneRow(tx.Exec(`
+		UPDATE groups SET calendar_enabled = $2, updated_at = NOW()
+		WHERE id = $1
+	`, id, enabled))
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		_, err = tx.Exec("DELETE FROM group_calendar_feeds WHERE group_id = $1", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// expectOneRow turns the result of a statement that changed no rows into
+// ErrRecordNotFound.
+func expectOneRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -24,7 +24,7 @@ func TestGroupModelInsert(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, count, 1)
 
-	err = db.QueryRow("SELECT COUNT(*) FROM user_groups WHERE user_id = $1 AND group_id = $2", userID, groupID).Scan(&count)
+	err = db.QueryRow("SELECT COUNT(*) FROM user_groups WHERE user_id = $1 AND group_id = $2 AND role = $3", userID, groupID, GroupRoleOwner).Scan(&count)
 	assert.NilError(t, err)
 	assert.Equal(t, count, 1)
 }
@@ -45,6 +45,7 @@ func TestGroupModelGet(t *testing.T) {
 	assert.Equal(t, group.Members[0].ID, 1)
 	assert.Equal(t, group.Members[0].Name, "Alice")
 	assert.Equal(t, group.Members[0].Email, "alice@example.com")
+	assert.Equal(t, group.Members[0].Role, GroupRoleOwner)
 	assert.Equal(t, group.Members[1].ID, 2)
 	assert.Equal(t, group.Members[1].Name, "Bob")
 	assert.Equal(t, group.Members[1].Email, "bob@example.com")
@@ -83,3 +84,72 @@ func TestGroupModelAddMember(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, count, 1)
 }
+
+func TestGroupModelUpdate(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupModel{DB: db}
+
+	err := m.Update(1, "Renamed", "New description")
+	assert.NilError(t, err)
+
+	group, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, group.Name, "Renamed")
+	assert.Equal(t, group.Description, "New description")
+
+	err = m.Update(99, "Renamed", "New description")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestGroupModelRemoveMember(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupModel{DB: db}
+
+	// The owner can't be removed.
+	err := m.RemoveMember(1, 1)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	err = m.RemoveMember(1, 2)
+	assert.NilError(t, err)
+
+	group, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(group.Members), 1)
+}
+
+func TestGroupModelTransferOwnership(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupModel{DB: db}
+
+	err := m.SetRole(1, 2, GroupRoleAdmin)
+	assert.NilError(t, err)
+
+	// Only the owner can hand the group over.
+	err = m.TransferOwnership(1, 2, 1)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	err = m.TransferOwnership(1, 1, 2)
+	assert.NilError(t, err)
+
+	group, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, group.Members[0].ID, 2)
+	assert.Equal(t, group.Members[0].Role, GroupRoleOwner)
+	assert.Equal(t, group.Members[1].ID, 1)
+	assert.Equal(t, group.Members[1].Role, GroupRoleAdmin)
+}
+
+func TestGroupModelDelete(t *testing.T) {
+	db := newTestDB(t)
+	m := GroupModel{DB: db}
+
+	err := m.Delete(2)
+	assert.NilError(t, err)
+
+	group, err := m.Get(2)
+	assert.NilError(t, err)
+	assert.Equal(t, group.ID, 0)
+
+	err = m.Delete(2)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Identity is an account at an OpenID Connect provider that a user signs in
+// with. Subject is the provider's ID for the account.
+type Identity struct {
+	Provider  string
+	Subject   string
+	UserID    int
+	Email     string
+	CreatedAt time.Time
+}
+
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+type IdentityModelInterface interface {
+	GetUserID(provider, subject string) (int, error)
+	Link(identity *Identity) error
+	InsertUser(name string, identity *Identity) (int, error)
+	Claim(identity *Identity) error
+	GetAllForUser(userID int) ([]*Identity, error)
+}
+
+// GetUserID returns the ID of the user who signs in with the account, or
+// ErrRecordNotFound if nobody does yet.
+func (m *IdentityModel) GetUserID(provider, subject string) (int, error) {
+	query := `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	var userID int
+	err := m.DB.QueryRow(query, provider, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Link lets the identity's user sign in with it.
+func (m *IdentityModel) Link(identity *Identity) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)`
+
+	_, err := m.DB.Exec(query, identity.Provider, identity.Subject, identity.UserID, identity.Email)
+	return err
+}
+
+// InsertUser adds an activated user who signs in with the identity, as the
+// provider has already confirmed their email address, and returns their ID.
+// They get a random password, which they can replace by resetting it, and
+// until then don't need one to delete their account.
+func (m *IdentityModel) InsertUser(name string, identity *Identity) (int, error) {
+	password, err := randomSecret()
+	if err != nil {
+		return 0, err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (name, email, password_hash, activated, password_set)
+		VALUES ($1, $2, $3, true, false)
+		RETURNING id
+	`
+
+	var id int
+	err = tx.QueryRow(query, name, identity.Email, passwordHash).Scan(&id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return 0, ErrDuplicateEmail
+		default:
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)`,
+		identity.Provider, identity.Subject, id, identity.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	identity.UserID = id
+	return id, nil
+}
+
+// claimedUserTables hold what someone who registered an email address they
+// don't own could have set up to get back into the account or read its
+// calendar.
+var claimedUserTables = []string{
+	"user_sessions", "api_tokens", "tokens", "user_totp", "recovery_codes",
+	"user_identities", "auth_tokens", "calendar_feeds", "group_calendar_feeds", "webhooks",
+}
+
+// Claim links the identity to its user, who hasn't confirmed their email
+// address, and activates them, as the provider has confirmed it. Whoever
+// registered the address may not own it, so they're shut out: the password
+// becomes a random one and everything in claimedUserTables for the user is
+// removed. It returns ErrEditConflict if the user has been activated since.
+func (m *IdentityModel) Claim(identity *Identity) error {
+	password, err := randomSecret()
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET password_hash = $2, password_set = false, activated = true, version = version + 1
+		WHERE id = $1 AND activated = false
+	`
+
+	err = expectOneRow(tx.Exec(query, identity.UserID, passwordHash))
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	for _, table := range claimedUserTables {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = $1", identity.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAllForUser returns the accounts the user signs in with.
+func (m *IdentityModel) GetAllForUser(userID int) ([]*Identity, error) {
+	query := `
+		SELECT provider, subject, user_id, email, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at, provider
+	`
+
+	rows, err := m.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		identity := &Identity{}
+		err := rows.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestIdentityModelLink(t *testing.T) {
+	db := newTestDB(t)
+	m := IdentityModel{DB: db}
+
+	_, err := m.GetUserID("google", "1234")
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	err = m.Link(&Identity{Provider: "google", Subject: "1234", UserID: 2, Email: "bob@example.com"})
+	assert.NilError(t, err)
+
+	userID, err := m.GetUserID("google", "1234")
+	assert.NilError(t, err)
+	assert.Equal(t, userID, 2)
+
+	// The same subject at another provider is another account.
+	_, err = m.GetUserID("microsoft", "1234")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestIdentityModelInsertUser(t *testing.T) {
+	db := newTestDB(t)
+	m := IdentityModel{DB: db}
+	users := UserModel{DB: db}
+
+	identity := &Identity{Provider: "microsoft", Subject: "5678", Email: "dave@example.com"}
+
+	id, err := m.InsertUser("Dave", identity)
+	assert.NilError(t, err)
+	assert.Equal(t, identity.UserID, id)
+
+	user, err := users.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Name, "Dave")
+	assert.Equal(t, user.Activated, true)
+	assert.Equal(t, user.PasswordSet, false)
+
+	// Until they choose one of their own.
+	err = users.UpdatePassword(id, "pa55word")
+	assert.NilError(t, err)
+
+	user, err = users.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.PasswordSet, true)
+
+	userID, err := m.GetUserID("microsoft", "5678")
+	assert.NilError(t, err)
+	assert.Equal(t, userID, id)
+
+	_, err = m.InsertUser("Dave", &Identity{Provider: "google", Subject: "9999", Email: "dave@example.com"})
+	assert.Equal(t, err, ErrDuplicateEmail)
+
+	// Nothing is linked when the user can't be added.
+	_, err = m.GetUserID("google", "9999")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestIdentityModelClaim(t *testing.T) {
+	db := newTestDB(t)
+	m := IdentityModel{DB: db}
+	users := UserModel{DB: db}
+	sessions := UserSessionModel{DB: db}
+	apiTokens := APITokenModel{DB: db}
+	tokens := TokenModel{DB: db}
+
+	// Someone registers an address they don't own and sets the account up.
+	id, err := users.Insert("Mallory", "dave@example.com", "pa55word")
+	assert.NilError(t, err)
+
+	err = sessions.Insert(&UserSession{UserID: id, ExpiresAt: time.Now().Add(time.Hour)})
+	assert.NilError(t, err)
+	_, err = apiTokens.New(id, "Laptop", []string{ScopeRead}, time.Hour)
+	assert.NilError(t, err)
+	_, err = tokens.New(id, TokenScopeActivation, time.Hour)
+	assert.NilError(t, err)
+
+	identity := &Identity{Provider: "google", Subject: "5678", UserID: id, Email: "dave@example.com"}
+
+	err = m.Claim(identity)
+	assert.NilError(t, err)
+
+	user, err := users.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Activated, true)
+	assert.Equal(t, user.PasswordSet, false)
+
+	userID, err := m.GetUserID("google", "5678")
+	assert.NilError(t, err)
+	assert.Equal(t, userID, id)
+
+	// Their password no longer works, and nothing they set up is left.
+	_, err = users.Authenticate("dave@example.com", "pa55word")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	for _, table := range []string{"user_sessions", "api_tokens", "tokens"} {
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE user_id = $1", id).Scan(&count)
+		assert.NilError(t, err)
+		assert.Equal(t, count, 0)
+	}
+
+	// An account can only be claimed once.
+	err = m.Claim(&Identity{Provider: "microsoft", Subject: "9999", UserID: id, Email: "dave@example.com"})
+	assert.Equal(t, err, ErrEditConflict)
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reasons a login failed.
+const (
+	LoginFailureWrongPassword = "password"
+	LoginFailureWrongCode     = "code"
+	LoginFailureLockedOut     = "locked"
+)
+
+// LoginLimit is how many failed logins are allowed before a key is locked
+// out. Each failure past Threshold doubles the lockout, from Base up to Max.
+// Failures are forgotten once there have been none for Window.
+type LoginLimit struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+}
+
+// Lockout returns how long a key is locked out for after the number of
+// failures, or 0 if it isn't.
+func (l LoginLimit) Lockout(failures int) time.Duration {
+	if failures < l.Threshold {
+		return 0
+	}
+
+	d := l.Base
+	for i := l.Threshold; i < failures; i++ {
+		d *= 2
+		if d >= l.Max {
+			return l.Max
+		}
+	}
+
+	return d
+}
+
+// LoginFailure is an audit entry for a failed login. UserID is 0 if there's
+// no account with the email address.
+type LoginFailure struct {
+	ID        int
+	Email     string
+	UserID    int
+	IP        string
+	Reason    string
+	CreatedAt time.Time
+}
+
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+type LoginThrottleModelInterface interface {
+	LockedUntil(keys ...string) (time.Time, error)
+	Fail(key string, limit LoginLimit) (int, time.Time, error)
+	Reset(key string) error
+	LogFailure(f *LoginFailure) error
+}
+
+// LockedUntil returns when the last lockout of the keys ends, or the zero
+// time if none of them are locked out.
+func (m *LoginThrottleModel) LockedUntil(keys ...string) (time.Time, error) {
+	query := `SELECT MAX(locked_until) FROM login_throttles WHERE key = ANY($1) AND locked_until > NOW()`
+
+	var lockedUntil sql.NullTime
+	err := m.DB.QueryRow(query, pq.Array(keys)).Scan(&lockedUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return lockedUntil.Time, nil
+}
+
+// Fail counts a failed login against the key, locking it out if it has now
+// failed too often. It returns the failures counted and when the lockout
+// ends, which is the zero time if there isn't one.
+func (m *LoginThrottleModel) Fail(key string, limit LoginLimit) (int, time.Time, error) {
+	query := `
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < NOW() - $2 * INTERVAL '1 second' THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures
+	`
+
+	var failures int
+	err := m.DB.QueryRow(query, key, limit.Window.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	lockout := limit.Lockout(failures)
+	if lockout == 0 {
+		return failures, time.Time{}, nil
+	}
+
+	var lockedUntil time.Time
+	err = m.DB.QueryRow(`
+		UPDATE login_throttles SET locked_until = NOW() + $2 * INTERVAL '1 second'
+		WHERE key = $1
+		RETURNING locked_until
+	`, key, lockout.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return failures, lockedUntil, nil
+}
+
+// Reset forgets the failures counted against the key, after a successful
+// login.
+func (m *LoginThrottleModel) Reset(key string) error {
+	_, err := m.DB.Exec(`DELETE FROM login_throttles WHERE key = $1`, key)
+	return err
+}
+
+// LogFailure adds an audit entry for the failed login.
+func (m *LoginThrottleModel) LogFailure(f *LoginFailure) error {
+	query := `
+		INSERT INTO login_failures (email, user_id, ip, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	userID := sql.NullInt64{Int64: int64(f.UserID), Valid: f.UserID != 0}
+
+	return m.DB.QueryRow(query, f.Email, userID, f.IP, f.Reason).Scan(&f.ID, &f.CreatedAt)
+}
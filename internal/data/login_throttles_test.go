@@ -0,0 +1,88 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestLoginLimitLockout(t *testing.T) {
+	limit := LoginLimit{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, limit.Lockout(tt.failures), tt.want)
+	}
+}
+
+func TestLoginThrottleModelFail(t *testing.T) {
+	db := newTestDB(t)
+	m := LoginThrottleModel{DB: db}
+	limit := LoginLimit{Threshold: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour}
+
+	failures, lockedUntil, err := m.Fail("email:bob@example.com", limit)
+	assert.NilError(t, err)
+	assert.Equal(t, failures, 1)
+	assert.Equal(t, lockedUntil.IsZero(), true)
+
+	lockedUntil, err = m.LockedUntil("ip:192.0.2.1", "email:bob@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockedUntil.IsZero(), true)
+
+	failures, lockedUntil, err = m.Fail("email:bob@example.com", limit)
+	assert.NilError(t, err)
+	assert.Equal(t, failures, 2)
+	assert.Equal(t, lockedUntil.After(time.Now()), true)
+
+	got, err := m.LockedUntil("ip:192.0.2.1", "email:bob@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, got.Equal(lockedUntil), true)
+
+	err = m.Reset("email:bob@example.com")
+	assert.NilError(t, err)
+
+	got, err = m.LockedUntil("email:bob@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, got.IsZero(), true)
+
+	// Failures long ago are forgotten.
+	_, _, err = m.Fail("ip:192.0.2.1", limit)
+	assert.NilError(t, err)
+	_, err = db.Exec("UPDATE login_throttles SET last_failure_at = NOW() - INTERVAL '2 hours'")
+	assert.NilError(t, err)
+
+	failures, _, err = m.Fail("ip:192.0.2.1", limit)
+	assert.NilError(t, err)
+	assert.Equal(t, failures, 1)
+}
+
+func TestLoginThrottleModelLogFailure(t *testing.T) {
+	db := newTestDB(t)
+	m := LoginThrottleModel{DB: db}
+
+	err := m.LogFailure(&LoginFailure{Email: "nobody@example.com", IP: "192.0.2.1", Reason: LoginFailureWrongPassword})
+	assert.NilError(t, err)
+
+	f := &LoginFailure{Email: "bob@example.com", UserID: 2, IP: "192.0.2.1", Reason: LoginFailureLockedOut}
+	err = m.LogFailure(f)
+	assert.NilError(t, err)
+	assert.Greater(t, f.ID, 0)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM login_failures WHERE user_id = 2 AND reason = 'locked'").Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+}
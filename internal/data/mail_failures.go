@@ -0,0 +1,65 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MailFailure is an email the SMTP server wouldn't take.
+type MailFailure struct {
+	ID        int
+	Recipient string
+	Template  string
+	Error     string
+	CreatedAt time.Time
+}
+
+type MailFailureModel struct {
+	DB *sql.DB
+}
+
+type MailFailureModelInterface interface {
+	Insert(recipient, template, message string) error
+	GetRecent(limit int) ([]*MailFailure, error)
+}
+
+// Insert records an email that couldn't be sent.
+func (m *MailFailureModel) Insert(recipient, template, message string) error {
+	query := `INSERT INTO mail_failures (recipient, template, error) VALUES ($1, $2, $3)`
+
+	_, err := m.DB.Exec(query, recipient, template, message)
+	return err
+}
+
+// GetRecent returns up to limit failures, newest first.
+func (m *MailFailureModel) GetRecent(limit int) ([]*MailFailure, error) {
+	query := `
+		SELECT id, recipient, template, error, created_at
+		FROM mail_failures
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`
+
+	rows, err := m.DB.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []*MailFailure{}
+
+	for rows.Next() {
+		f := &MailFailure{}
+		err := rows.Scan(&f.ID, &f.Recipient, &f.Template, &f.Error, &f.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failures, nil
+}
@@ -0,0 +1,23 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestMailFailureModel(t *testing.T) {
+	db := newTestDB(t)
+	m := MailFailureModel{DB: db}
+
+	err := m.Insert("bob@example.com", "group-invitation.tmpl", "550 mailbox unavailable")
+	assert.NilError(t, err)
+	err = m.Insert("charlie@example.com", "password-reset.tmpl", "dial tcp: i/o timeout")
+	assert.NilError(t, err)
+
+	failures, err := m.GetRecent(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(failures), 1)
+	assert.Equal(t, failures[0].Recipient, "charlie@example.com")
+	assert.Equal(t, failures[0].Error, "dial tcp: i/o timeout")
+}
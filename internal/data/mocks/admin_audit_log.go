@@ -0,0 +1,37 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// AuditLogModel keeps the entries inserted so tests can check them.
+type AuditLogModel struct {
+	Entries []*data.AuditEntry
+}
+
+func (m *AuditLogModel) Insert(e *data.AuditEntry) error {
+	e.ID = len(m.Entries) + 1
+	e.CreatedAt = time.Now()
+	m.Entries = append(m.Entries, e)
+	return nil
+}
+
+func (m *AuditLogModel) GetRecent(limit int) ([]*data.AuditEntry, error) {
+	entries := []*data.AuditEntry{}
+	for i := len(m.Entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, m.Entries[i])
+	}
+	return entries, nil
+}
+
+func (m *AuditLogModel) GetForUser(userID, limit int) ([]*data.AuditEntry, error) {
+	entries := []*data.AuditEntry{}
+	for i := len(m.Entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if m.Entries[i].UserID == userID {
+			entries = append(entries, m.Entries[i])
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,74 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// Plaintexts of the mock tokens, for sending in tests.
+const (
+	MockReadToken  = "cal_readtoken"
+	MockWriteToken = "cal_writetoken"
+)
+
+var mockReadToken = &data.APIToken{
+	ID:        1,
+	UserID:    1,
+	Name:      "CI",
+	Prefix:    "cal_read",
+	Scopes:    []string{data.ScopeRead},
+	CreatedAt: time.Now(),
+}
+
+var mockWriteToken = &data.APIToken{
+	ID:        2,
+	UserID:    1,
+	Name:      "Bot",
+	Prefix:    "cal_writ",
+	Scopes:    []string{data.ScopeRead, data.ScopeWrite},
+	CreatedAt: time.Now(),
+}
+
+type APITokenModel struct{}
+
+func (m *APITokenModel) New(userID int, name string, scopes []string, ttl time.Duration) (*data.APIToken, error) {
+	token := &data.APIToken{
+		ID:        3,
+		UserID:    userID,
+		Name:      name,
+		Plaintext: "cal_newtoken",
+		Prefix:    "cal_newt",
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		token.Expiry = time.Now().Add(ttl)
+	}
+	return token, nil
+}
+
+func (m *APITokenModel) GetAllForUser(userID int) ([]*data.APIToken, error) {
+	if userID != 1 {
+		return []*data.APIToken{}, nil
+	}
+	return []*data.APIToken{mockReadToken, mockWriteToken}, nil
+}
+
+func (m *APITokenModel) Authenticate(plaintext string) (*data.APIToken, error) {
+	switch plaintext {
+	case MockReadToken:
+		return mockReadToken, nil
+	case MockWriteToken:
+		return mockWriteToken, nil
+	default:
+		return nil, data.ErrRecordNotFound
+	}
+}
+
+func (m *APITokenModel) Delete(id, userID int) error {
+	if userID == 1 && (id == mockReadToken.ID || id == mockWriteToken.ID) {
+		return nil
+	}
+	return data.ErrRecordNotFound
+}
@@ -17,3 +17,10 @@ func (m *AppointmentEventModel) Insert(a *data.AppointmentEvent) error {
 func (m *AppointmentEventModel) GetByAppointmentID(appointmentID int) ([]*data.AppointmentEvent, error) {
 	return []*data.AppointmentEvent{mockAppointmentEvent}, nil
 }
+
+func (m *AppointmentEventModel) GetForUser(userID int) ([]*data.AppointmentEvent, error) {
+	if userID != mockAppointmentEvent.UserID {
+		return []*data.AppointmentEvent{}, nil
+	}
+	return []*data.AppointmentEvent{mockAppointmentEvent}, nil
+}
@@ -6,7 +6,11 @@ import (
 	"github.com/tmgasek/calendar-app/internal/data"
 )
 
-type AppointmentRequestModel struct{}
+// AppointmentRequestModel records the reasons requests were declined for so
+// tests can check them.
+type AppointmentRequestModel struct {
+	DeclineReasons []string
+}
 
 var mockAppointmentRequest = &data.AppointmentRequest{
 	RequestID:       1,
@@ -15,7 +19,7 @@ var mockAppointmentRequest = &data.AppointmentRequest{
 	StartTime:       time.Date(2021, 1, 1, 11, 0, 0, 0, time.UTC),
 	EndTime:         time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC),
 	Location:        "Test Location",
-	Status:          "confirmed",
+	Status:          data.RequestStatusPending,
 	CreatedAt:       time.Now(),
 	UpdatedAt:       time.Now(),
 	TimeZone:        "UTC",
@@ -23,6 +27,26 @@ var mockAppointmentRequest = &data.AppointmentRequest{
 	AppointmentType: "individual",
 	GroupID:         0,
 	TargetUserID:    2,
+	Requester: &data.Requester{
+		Name:  "Alice",
+		Email: "alice@example.com",
+	},
+	Target: &data.Requester{
+		Name:  "Bob",
+		Email: "bob@example.com",
+	},
+	QuorumRule: data.QuorumAll,
+	Participants: []*data.RequestParticipant{
+		{
+			ID:        1,
+			RequestID: 1,
+			UserID:    2,
+			Name:      "Bob",
+			Email:     "bob@example.com",
+			Required:  true,
+			Status:    data.ParticipantPending,
+		},
+	},
 }
 
 func (m *AppointmentRequestModel) Insert(request *data.AppointmentRequest) error {
@@ -33,10 +57,84 @@ func (m *AppointmentRequestModel) GetForUser(userID int) ([]*data.AppointmentReq
 	return []*data.AppointmentRequest{mockAppointmentRequest}, nil
 }
 
+func (m *AppointmentRequestModel) GetOutgoingForUser(userID int) ([]*data.AppointmentRequest, error) {
+	return []*data.AppointmentRequest{mockAppointmentRequest}, nil
+}
+
+func (m *AppointmentRequestModel) CountPendingForUser(userID int) (int, error) {
+	if userID == 2 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
 func (m *AppointmentRequestModel) Get(requestID int) (*data.AppointmentRequest, error) {
-	return mockAppointmentRequest, nil
+	switch requestID {
+	case 1:
+		return mockAppointmentRequest, nil
+	default:
+		return nil, data.ErrRecordNotFound
+	}
 }
 
 func (m *AppointmentRequestModel) Delete(requestID int) error {
 	return nil
 }
+
+func (m *AppointmentRequestModel) Accept(requestID int) error {
+	return nil
+}
+
+func (m *AppointmentRequestModel) Decline(requestID int, reason string) error {
+	m.DeclineReasons = append(m.DeclineReasons, reason)
+	return nil
+}
+
+func (m *AppointmentRequestModel) Cancel(requestID int) error {
+	return nil
+}
+
+func (m *AppointmentRequestModel) ExpirePast() (int, error) {
+	return 0, nil
+}
+
+// Respond works out the quorum of the mock request as if the user had given
+// the response, without saving it, and records the decline reason if the
+// quorum fails.
+func (m *AppointmentRequestModel) Respond(requestID, userID int, status, reason string, a *data.Appointment, declineReason string) (data.QuorumOutcome, error) {
+	if requestID != mockAppointmentRequest.RequestID || mockAppointmentRequest.Participant(userID) == nil {
+		return data.QuorumUndecided, data.ErrInvalidTransition
+	}
+
+	request := *mockAppointmentRequest
+	request.Participants = nil
+	for _, p := range mockAppointmentRequest.Participants {
+		p := *p
+		if p.UserID == userID {
+			p.Status = status
+			p.Reason = reason
+		}
+		request.Participants = append(request.Participants, &p)
+	}
+
+	outcome := request.QuorumOutcome()
+	if outcome == data.QuorumFailed {
+		m.DeclineReasons = append(m.DeclineReasons, declineReason)
+	}
+
+	return outcome, nil
+}
+
+func (m *AppointmentRequestModel) Confirm(requestID int, a *data.Appointment, userIDs []int) (int, error) {
+	return 1, nil
+}
+
+func (m *AppointmentRequestModel) GetAllForUser(userID int, filters data.Filters) ([]*data.AppointmentRequest, data.Metadata, error) {
+	requests, metadata := data.Page([]*data.AppointmentRequest{mockAppointmentRequest}, filters)
+	return requests, metadata, nil
+}
+
+func (m *AppointmentRequestModel) GetAllOutgoingForUser(userID int, filters data.Filters) ([]*data.AppointmentRequest, data.Metadata, error) {
+	requests, metadata := data.Page([]*data.AppointmentRequest{mockAppointmentRequest}, filters)
+	return requests, metadata, nil
+}
@@ -23,6 +23,26 @@ var mockAppointment = &data.Appointment{
 	AppointmentType: "test",
 }
 
+// mockGroupAppointment is an appointment of group 3, the Team.
+var mockGroupAppointment = &data.Appointment{
+	ID:              2,
+	CreatorID:       1,
+	TargetID:        2,
+	Title:           "Team Standup",
+	Description:     "Weekly catch-up",
+	StartTime:       time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC),
+	EndTime:         time.Date(2030, 1, 7, 9, 30, 0, 0, time.UTC),
+	Location:        "Meeting Room",
+	Status:          "confirmed",
+	CreatedAt:       time.Now(),
+	UpdatedAt:       time.Now(),
+	TimeZone:        "UTC",
+	Visibility:      "public",
+	Recurrence:      "none",
+	AppointmentType: "group",
+	GroupID:         3,
+}
+
 type AppointmentModel struct{}
 
 func (m *AppointmentModel) Insert(a *data.Appointment) (int, error) {
@@ -37,6 +57,8 @@ func (m *AppointmentModel) Get(id int) (*data.Appointment, error) {
 	switch id {
 	case 1:
 		return mockAppointment, nil
+	case 2:
+		return mockGroupAppointment, nil
 	default:
 		return nil, data.ErrRecordNotFound
 	}
@@ -49,3 +71,19 @@ func (m *AppointmentModel) Update(a *data.Appointment) error {
 func (m *AppointmentModel) Delete(id int) error {
 	return nil
 }
+
+func (m *AppointmentModel) GetAllForUser(userID int, filters data.Filters) ([]*data.Appointment, data.Metadata, error) {
+	appointments, metadata := data.Page([]*data.Appointment{mockAppointment}, filters)
+	return appointments, metadata, nil
+}
+
+func (m *AppointmentModel) GetForFeed(userID int, includeGroups bool) ([]*data.Appointment, error) {
+	return []*data.Appointment{mockAppointment}, nil
+}
+
+func (m *AppointmentModel) GetForGroup(groupID int, from time.Time) ([]*data.Appointment, error) {
+	if groupID == mockGroupAppointment.GroupID {
+		return []*data.Appointment{mockGroupAppointment}, nil
+	}
+	return []*data.Appointment{}, nil
+}
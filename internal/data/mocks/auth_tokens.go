@@ -17,12 +17,60 @@ var mockAuthToken = &data.AuthToken{
 	AuthProvider: "google",
 }
 
-type AuthTokenModel struct{}
+// AuthTokenModel has no linked accounts unless a test lists providers in
+// Linked, which are then linked for user 1.
+type AuthTokenModel struct {
+	Linked []string
+}
 
 func (m *AuthTokenModel) SaveToken(userID int, authProvider string, token *oauth2.Token) error {
 	return nil
 }
 
 func (m *AuthTokenModel) Token(userID int, authProvider string) (*oauth2.Token, error) {
-	return nil, nil
+	if !m.linked(userID, authProvider) {
+		return nil, nil
+	}
+	return &oauth2.Token{
+		AccessToken:  mockAuthToken.AccessToken,
+		RefreshToken: mockAuthToken.RefreshToken,
+		TokenType:    mockAuthToken.TokenType,
+		Expiry:       mockAuthToken.Expiry,
+	}, nil
+}
+
+func (m *AuthTokenModel) Delete(userID int, authProvider string) error {
+	if !m.linked(userID, authProvider) {
+		return data.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m *AuthTokenModel) linked(userID int, authProvider string) bool {
+	if userID != mockAuthToken.UserID {
+		return false
+	}
+	for _, p := range m.Linked {
+		if p == authProvider {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *AuthTokenModel) GetAllForUser(userID int) ([]*data.AuthToken, error) {
+	tokens := []*data.AuthToken{}
+	for _, p := range m.Linked {
+		if !m.linked(userID, p) {
+			continue
+		}
+		tokens = append(tokens, &data.AuthToken{
+			UserID:       userID,
+			AuthProvider: p,
+			TokenType:    mockAuthToken.TokenType,
+			Expiry:       mockAuthToken.Expiry,
+			Scope:        mockAuthToken.Scope,
+		})
+	}
+	return tokens, nil
 }
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// MockFeedToken is the token of user 1's calendar feed.
+const MockFeedToken = "feedtoken"
+
+var mockCalendarFeed = &data.CalendarFeed{
+	UserID:    1,
+	CreatedAt: time.Now(),
+}
+
+type CalendarFeedModel struct{}
+
+func (m *CalendarFeedModel) New(userID int, includeGroups bool) (*data.CalendarFeed, error) {
+	return &data.CalendarFeed{
+		UserID:        userID,
+		Token:         "newfeedtoken",
+		IncludeGroups: includeGroups,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+func (m *CalendarFeedModel) GetForUser(userID int) (*data.CalendarFeed, error) {
+	if userID == mockCalendarFeed.UserID {
+		return mockCalendarFeed, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *CalendarFeedModel) GetByToken(token string) (*data.CalendarFeed, error) {
+	if token == MockFeedToken {
+		return mockCalendarFeed, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *CalendarFeedModel) Delete(userID int) error {
+	return nil
+}
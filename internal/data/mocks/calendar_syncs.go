@@ -0,0 +1,81 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// Channels of the mock calendar syncs, for sending notifications in tests.
+const (
+	MockGoogleChannel      = "mock-channel"
+	MockGoogleChannelToken = "mock-channel-token"
+	MockGraphSubscription  = "mock-subscription"
+	MockGraphClientState   = "mock-client-state"
+)
+
+// CalendarSyncModel accepts notifications down the mock channels for user 1.
+// It records the calendars marked as changed and deleted, and the sync
+// errors, so tests can check the notification receiver, unlinking and the
+// sync worker. Bob's Google calendar is failing to sync.
+type CalendarSyncModel struct {
+	Changed []string
+	Deleted []string
+	Errors  []string
+}
+
+func (m *CalendarSyncModel) Get(userID int, provider string) (*data.CalendarSync, error) {
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *CalendarSyncModel) SaveChannel(s *data.CalendarSync, token string) error {
+	return nil
+}
+
+func (m *CalendarSyncModel) MarkChanged(provider, channelID, token string) (int, error) {
+	switch {
+	case provider == "google" && channelID == MockGoogleChannel && token == MockGoogleChannelToken,
+		provider == "microsoft" && channelID == MockGraphSubscription && token == MockGraphClientState:
+		m.Changed = append(m.Changed, provider)
+		return 1, nil
+	default:
+		return 0, data.ErrRecordNotFound
+	}
+}
+
+func (m *CalendarSyncModel) SaveEvents(userID int, provider string, events []data.Event, syncedAt time.Time) error {
+	return nil
+}
+
+func (m *CalendarSyncModel) GetEvents(userID int, provider string) ([]*data.Event, error) {
+	return []*data.Event{}, nil
+}
+
+func (m *CalendarSyncModel) GetStale(limit int, pollInterval time.Duration) ([]*data.CalendarSync, error) {
+	return []*data.CalendarSync{}, nil
+}
+
+func (m *CalendarSyncModel) GetExpiring(before time.Time, limit int) ([]*data.CalendarSync, error) {
+	return []*data.CalendarSync{}, nil
+}
+
+func (m *CalendarSyncModel) RecordError(userID int, provider, message string) error {
+	m.Errors = append(m.Errors, message)
+	return nil
+}
+
+func (m *CalendarSyncModel) GetFailing(limit int) ([]*data.CalendarSync, error) {
+	return []*data.CalendarSync{
+		{
+			UserID:    2,
+			Provider:  "google",
+			LastError: "oauth2: token expired and refresh token is not set",
+			FailedAt:  time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *CalendarSyncModel) Delete(userID int, provider string) error {
+	m.Deleted = append(m.Deleted, provider)
+	return nil
+}
@@ -0,0 +1,50 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// MockGroupFeedToken is the token of Alice's feed of the Team's calendar.
+const MockGroupFeedToken = "groupfeedtoken"
+
+var mockGroupCalendarFeed = &data.GroupCalendarFeed{
+	GroupID:   3,
+	UserID:    1,
+	CreatedAt: time.Now(),
+}
+
+// GroupCalendarFeedModel records the feeds turned off so tests can check
+// them.
+type GroupCalendarFeedModel struct {
+	Deleted []int
+}
+
+func (m *GroupCalendarFeedModel) New(groupID, userID int) (*data.GroupCalendarFeed, error) {
+	return &data.GroupCalendarFeed{
+		GroupID:   groupID,
+		UserID:    userID,
+		Token:     "newgroupfeedtoken",
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (m *GroupCalendarFeedModel) GetForMember(groupID, userID int) (*data.GroupCalendarFeed, error) {
+	if groupID == mockGroupCalendarFeed.GroupID && userID == mockGroupCalendarFeed.UserID {
+		return mockGroupCalendarFeed, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *GroupCalendarFeedModel) GetByToken(token string) (*data.GroupCalendarFeed, error) {
+	if token == MockGroupFeedToken {
+		return mockGroupCalendarFeed, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *GroupCalendarFeedModel) Delete(groupID, userID int) error {
+	m.Deleted = append(m.Deleted, groupID)
+	return nil
+}
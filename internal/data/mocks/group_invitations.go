@@ -0,0 +1,134 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// Plaintexts of the tokens of the mock invitations: one for Bob, and one for
+// an address without an account.
+const (
+	MockGroupInvitationToken       = "mock-group-invitation-token"
+	MockGroupInvitationTokenNoUser = "mock-group-invitation-token-no-user"
+)
+
+// GroupInvitationModel records the invitations made and answered so tests
+// can check them.
+type GroupInvitationModel struct {
+	Inserted []*data.GroupInvitation
+	Accepted []int
+	Deleted  []int
+	// AcceptedEmails holds the addresses whose invitations were all accepted.
+	AcceptedEmails []string
+}
+
+var mockGroupInvitations = []*data.GroupInvitation{
+	{
+		ID:          1,
+		GroupID:     1,
+		GroupName:   "Test Group",
+		Email:       "bob@example.com",
+		InviterID:   1,
+		InviterName: "Alice",
+		CreatedAt:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:   time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:          2,
+		GroupID:     1,
+		GroupName:   "Test Group",
+		Email:       "dave@example.com",
+		InviterID:   1,
+		InviterName: "Alice",
+		CreatedAt:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:   time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC),
+	},
+	// Carol hasn't confirmed her email address yet.
+	{
+		ID:          3,
+		GroupID:     1,
+		GroupName:   "Test Group",
+		Email:       "carol@example.com",
+		InviterID:   1,
+		InviterName: "Alice",
+		CreatedAt:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:   time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+func (m *GroupInvitationModel) Insert(groupID, inviterID int, email string, ttl time.Duration) (*data.GroupInvitation, error) {
+	inv := &data.GroupInvitation{
+		ID:        len(mockGroupInvitations) + len(m.Inserted) + 1,
+		GroupID:   groupID,
+		Email:     email,
+		InviterID: inviterID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(ttl),
+		Plaintext: "mock-new-group-invitation-token",
+	}
+	m.Inserted = append(m.Inserted, inv)
+	return inv, nil
+}
+
+func (m *GroupInvitationModel) Get(id int) (*data.GroupInvitation, error) {
+	for _, inv := range mockGroupInvitations {
+		if inv.ID == id {
+			return inv, nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *GroupInvitationModel) GetByToken(plaintext string) (*data.GroupInvitation, error) {
+	switch plaintext {
+	case MockGroupInvitationToken:
+		return mockGroupInvitations[0], nil
+	case MockGroupInvitationTokenNoUser:
+		return mockGroupInvitations[1], nil
+	default:
+		return nil, data.ErrRecordNotFound
+	}
+}
+
+func (m *GroupInvitationModel) GetPendingForEmail(email string) ([]*data.GroupInvitation, error) {
+	invitations := []*data.GroupInvitation{}
+	for _, inv := range mockGroupInvitations {
+		if inv.Email == email {
+			invitations = append(invitations, inv)
+		}
+	}
+	return invitations, nil
+}
+
+func (m *GroupInvitationModel) GetPendingForGroup(groupID int) ([]*data.GroupInvitation, error) {
+	invitations := []*data.GroupInvitation{}
+	for _, inv := range mockGroupInvitations {
+		if inv.GroupID == groupID {
+			invitations = append(invitations, inv)
+		}
+	}
+	return invitations, nil
+}
+
+func (m *GroupInvitationModel) Accept(id, userID int) error {
+	if _, err := m.Get(id); err != nil {
+		return err
+	}
+	m.Accepted = append(m.Accepted, id)
+	return nil
+}
+
+func (m *GroupInvitationModel) AcceptAllForEmail(email string, userID int) (int, error) {
+	m.AcceptedEmails = append(m.AcceptedEmails, email)
+	invitations, err := m.GetPendingForEmail(email)
+	return len(invitations), err
+}
+
+func (m *GroupInvitationModel) Delete(id int) error {
+	if _, err := m.Get(id); err != nil {
+		return err
+	}
+	m.Deleted = append(m.Deleted, id)
+	return nil
+}
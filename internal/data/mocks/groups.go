@@ -2,7 +2,16 @@ package mocks
 
 import "github.com/tmgasek/calendar-app/internal/data"
 
-type GroupModel struct{}
+// GroupModel records the changes made to groups so tests can check them.
+type GroupModel struct {
+	Updated     []int
+	Deleted     []int
+	Removed     []int
+	Roles       map[int]string
+	Transferred []int
+	// Calendars holds whether each group's calendar was turned on or off.
+	Calendars map[int]bool
+}
 
 var mockGroup = &data.Group{
 	ID:          1,
@@ -15,10 +24,27 @@ var mockGroup = &data.Group{
 			ID:    1,
 			Name:  "Alice",
 			Email: "alice@example.com",
+			Role:  data.GroupRoleOwner,
 		},
 	},
 }
 
+// mockTeam has a member of each role: Alice owns it, Bob is an admin and
+// Carol a member. It has a shared calendar.
+var mockTeam = &data.Group{
+	ID:              3,
+	Name:            "Team",
+	Description:     "Everyone",
+	CreatedAt:       "2021-01-01T00:00:00Z",
+	UpdatedAt:       "2021-01-01T00:00:00Z",
+	CalendarEnabled: true,
+	Members: []*data.GroupMember{
+		{ID: 1, Name: "Alice", Email: "alice@example.com", Role: data.GroupRoleOwner},
+		{ID: 2, Name: "Bob", Email: "bob@example.com", Role: data.GroupRoleAdmin},
+		{ID: 3, Name: "Carol", Email: "carol@example.com", Role: data.GroupRoleMember},
+	},
+}
+
 func (m *GroupModel) Insert(userID int, name, description string) (int, error) {
 	return 1, nil
 }
@@ -27,6 +53,8 @@ func (m *GroupModel) Get(id int) (*data.Group, error) {
 	switch id {
 	case 1:
 		return mockGroup, nil
+	case 3:
+		return mockTeam, nil
 	default:
 		return nil, data.ErrRecordNotFound
 	}
@@ -39,3 +67,39 @@ func (m *GroupModel) GetAllForUser(userID int) ([]*data.Group, error) {
 func (m *GroupModel) AddMember(groupID, userID int) error {
 	return nil
 }
+
+func (m *GroupModel) Update(id int, name, description string) error {
+	m.Updated = append(m.Updated, id)
+	return nil
+}
+
+func (m *GroupModel) Delete(id int) error {
+	m.Deleted = append(m.Deleted, id)
+	return nil
+}
+
+func (m *GroupModel) RemoveMember(groupID, userID int) error {
+	m.Removed = append(m.Removed, userID)
+	return nil
+}
+
+func (m *GroupModel) SetRole(groupID, userID int, role string) error {
+	if m.Roles == nil {
+		m.Roles = map[int]string{}
+	}
+	m.Roles[userID] = role
+	return nil
+}
+
+func (m *GroupModel) TransferOwnership(groupID, fromUserID, toUserID int) error {
+	m.Transferred = append(m.Transferred, toUserID)
+	return nil
+}
+
+func (m *GroupModel) SetCalendarEnabled(id int, enabled bool) error {
+	if m.Calendars == nil {
+		m.Calendars = map[int]bool{}
+	}
+	m.Calendars[id] = enabled
+	return nil
+}
@@ -0,0 +1,59 @@
+package mocks
+
+import "github.com/tmgasek/calendar-app/internal/data"
+
+// MockIdentitySubject is the subject of the Google account Bob signs in with.
+const MockIdentitySubject = "mock-google-subject"
+
+type IdentityModel struct {
+	// Linked records the identities linked or added with a user, for
+	// checking in tests.
+	Linked []*data.Identity
+	// Claimed records the users whose accounts were claimed.
+	Claimed []int
+}
+
+func (m *IdentityModel) GetUserID(provider, subject string) (int, error) {
+	if provider == "google" && subject == MockIdentitySubject {
+		return 2, nil
+	}
+	for _, identity := range m.Linked {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity.UserID, nil
+		}
+	}
+	return 0, data.ErrRecordNotFound
+}
+
+func (m *IdentityModel) Link(identity *data.Identity) error {
+	m.Linked = append(m.Linked, identity)
+	return nil
+}
+
+func (m *IdentityModel) InsertUser(name string, identity *data.Identity) (int, error) {
+	if identity.Email == "dupe@example.com" {
+		return 0, data.ErrDuplicateEmail
+	}
+	identity.UserID = 4
+	m.Linked = append(m.Linked, identity)
+	return 4, nil
+}
+
+func (m *IdentityModel) Claim(identity *data.Identity) error {
+	m.Linked = append(m.Linked, identity)
+	m.Claimed = append(m.Claimed, identity.UserID)
+	return nil
+}
+
+func (m *IdentityModel) GetAllForUser(userID int) ([]*data.Identity, error) {
+	identities := []*data.Identity{}
+	if userID == 2 {
+		identities = append(identities, &data.Identity{Provider: "google", Subject: MockIdentitySubject, UserID: 2, Email: "bob@example.com"})
+	}
+	for _, identity := range m.Linked {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
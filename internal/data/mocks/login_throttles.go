@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// LoginThrottleModel counts failures in memory, locking keys out as the real
+// one does.
+type LoginThrottleModel struct {
+	failures    map[string]int
+	lockedUntil map[string]time.Time
+	// Logged records the audit entries, for checking in tests.
+	Logged []*data.LoginFailure
+}
+
+func (m *LoginThrottleModel) LockedUntil(keys ...string) (time.Time, error) {
+	var until time.Time
+	for _, key := range keys {
+		if t := m.lockedUntil[key]; t.After(time.Now()) && t.After(until) {
+			until = t
+		}
+	}
+	return until, nil
+}
+
+func (m *LoginThrottleModel) Fail(key string, limit data.LoginLimit) (int, time.Time, error) {
+	if m.failures == nil {
+		m.failures = map[string]int{}
+		m.lockedUntil = map[string]time.Time{}
+	}
+
+	m.failures[key]++
+	failures := m.failures[key]
+
+	lockout := limit.Lockout(failures)
+	if lockout == 0 {
+		return failures, time.Time{}, nil
+	}
+
+	m.lockedUntil[key] = time.Now().Add(lockout)
+	return failures, m.lockedUntil[key], nil
+}
+
+func (m *LoginThrottleModel) Reset(key string) error {
+	delete(m.failures, key)
+	delete(m.lockedUntil, key)
+	return nil
+}
+
+func (m *LoginThrottleModel) LogFailure(f *data.LoginFailure) error {
+	f.ID = len(m.Logged) + 1
+	f.CreatedAt = time.Now()
+	m.Logged = append(m.Logged, f)
+	return nil
+}
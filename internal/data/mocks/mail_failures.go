@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// MailFailureModel records the failures inserted so tests can check them. An
+// invitation to Bob bounced before any were.
+type MailFailureModel struct {
+	Inserted []string
+}
+
+func (m *MailFailureModel) Insert(recipient, template, message string) error {
+	m.Inserted = append(m.Inserted, recipient)
+	return nil
+}
+
+func (m *MailFailureModel) GetRecent(limit int) ([]*data.MailFailure, error) {
+	return []*data.MailFailure{
+		{
+			ID:        1,
+			Recipient: "bob@example.com",
+			Template:  "group-invitation.tmpl",
+			Error:     "550 mailbox unavailable",
+			CreatedAt: time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
@@ -22,6 +22,23 @@ func NewMockModels() data.Models {
 		Events:              &EventModel{},
 		AppointmentEvents:   &AppointmentEventModel{},
 		Groups:              &GroupModel{},
+		ProviderOperations:  &ProviderOperationModel{},
+		Polls:               &PollModel{},
+		Resources:           &ResourceModel{},
+		APITokens:           &APITokenModel{},
+		CalendarFeeds:       &CalendarFeedModel{},
+		Webhooks:            &WebhookModel{},
+		CalendarSyncs:       &CalendarSyncModel{},
+		Tokens:              &TokenModel{},
+		TwoFactor:           &TwoFactorModel{},
+		Identities:          &IdentityModel{},
+		LoginThrottles:      &LoginThrottleModel{},
+		UserSessions:        &UserSessionModel{},
+		GroupInvitations:    &GroupInvitationModel{},
+		GroupCalendarFeeds:  &GroupCalendarFeedModel{},
+		Organisations:       &OrganisationModel{},
+		AuditLog:            &AuditLogModel{},
+		MailFailures:        &MailFailureModel{},
 	}
 }
 
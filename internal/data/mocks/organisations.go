@@ -0,0 +1,95 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// OrganisationModel records the changes made to organisations so tests can
+// check them.
+type OrganisationModel struct {
+	Inserted []string
+	Added    []int
+	Removed  []int
+	Roles    map[int]string
+	Shared   []int
+	Unshared []int
+	// Joined holds the users who were looked up to join by their domain.
+	Joined []int
+}
+
+// Example has Alice as its admin, with Bob and Carol as members. Globex has
+// Oscar.
+var mockOrganisations = []*data.Organisation{
+	{ID: 1, Name: "Example", Domain: "example.com", MemberCount: 3, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{ID: 2, Name: "Globex", Domain: "globex.example", MemberCount: 1, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func (m *OrganisationModel) Insert(name, domain string) (int, error) {
+	if domain == "example.com" || domain == "globex.example" {
+		return 0, data.ErrDuplicateDomain
+	}
+	m.Inserted = append(m.Inserted, name)
+	return len(mockOrganisations) + len(m.Inserted), nil
+}
+
+func (m *OrganisationModel) Get(id int) (*data.Organisation, error) {
+	for _, org := range mockOrganisations {
+		if org.ID == id {
+			return org, nil
+		}
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *OrganisationModel) GetAll() ([]*data.Organisation, error) {
+	return mockOrganisations, nil
+}
+
+func (m *OrganisationModel) GetMembers(id int) ([]*data.OrganisationMember, error) {
+	members := []*data.OrganisationMember{}
+	for _, u := range mockUsers {
+		if u.OrganisationID == id {
+			members = append(members, &data.OrganisationMember{ID: u.ID, Name: u.Name, Email: u.Email, Role: u.OrganisationRole})
+		}
+	}
+	return members, nil
+}
+
+func (m *OrganisationModel) AddMember(id, userID int, role string) error {
+	m.Added = append(m.Added, userID)
+	return nil
+}
+
+func (m *OrganisationModel) RemoveMember(id, userID int) error {
+	m.Removed = append(m.Removed, userID)
+	return nil
+}
+
+func (m *OrganisationModel) SetRole(id, userID int, role string) error {
+	if m.Roles == nil {
+		m.Roles = map[int]string{}
+	}
+	m.Roles[userID] = role
+	return nil
+}
+
+func (m *OrganisationModel) JoinByDomain(userID int) (int, error) {
+	m.Joined = append(m.Joined, userID)
+	return 0, nil
+}
+
+func (m *OrganisationModel) GetShares(id int) ([]*data.Organisation, error) {
+	return []*data.Organisation{}, nil
+}
+
+func (m *OrganisationModel) Share(id, sharedWithID int) error {
+	m.Shared = append(m.Shared, sharedWithID)
+	return nil
+}
+
+func (m *OrganisationModel) Unshare(id, sharedWithID int) error {
+	m.Unshared = append(m.Unshared, sharedWithID)
+	return nil
+}
@@ -0,0 +1,69 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+type PollModel struct{}
+
+var mockPoll = &data.Poll{
+	ID:          1,
+	OrganizerID: 1,
+	Title:       "Test Poll",
+	Description: "Test Description",
+	Location:    "Test Location",
+	Status:      data.PollOpen,
+	CreatedAt:   time.Now(),
+	UpdatedAt:   time.Now(),
+	Organizer: &data.Requester{
+		Name:  "Alice",
+		Email: "alice@example.com",
+	},
+	Options: []*data.PollOption{
+		{
+			ID:        1,
+			PollID:    1,
+			StartTime: time.Date(2021, 1, 1, 11, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC),
+			Votes:     map[int]string{2: data.VoteYes},
+		},
+		{
+			ID:        2,
+			PollID:    1,
+			StartTime: time.Date(2021, 1, 2, 11, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC),
+			Votes:     map[int]string{2: data.VoteNo},
+		},
+	},
+	Participants: []*data.PollParticipant{
+		{UserID: 1, Name: "Alice", Email: "alice@example.com"},
+		{UserID: 2, Name: "Bob", Email: "bob@example.com"},
+	},
+}
+
+func (m *PollModel) Insert(poll *data.Poll) (int, error) {
+	return 1, nil
+}
+
+func (m *PollModel) Get(id int) (*data.Poll, error) {
+	switch id {
+	case 1:
+		return mockPoll, nil
+	default:
+		return nil, data.ErrRecordNotFound
+	}
+}
+
+func (m *PollModel) GetForUser(userID int) ([]*data.Poll, error) {
+	return []*data.Poll{mockPoll}, nil
+}
+
+func (m *PollModel) Vote(pollID, userID int, votes map[int]string) error {
+	return nil
+}
+
+func (m *PollModel) Finalise(pollID, optionID int, a *data.Appointment, userIDs []int) (int, error) {
+	return 1, nil
+}
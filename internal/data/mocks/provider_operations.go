@@ -0,0 +1,87 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// ProviderOperationModel records the operations that were failed or skipped,
+// the appointments that were compensated and the users whose events were
+// removed so tests can check the worker.
+type ProviderOperationModel struct {
+	Failed      []int
+	Retried     []int
+	Skipped     []int
+	Compensated []int
+	Removed     []int
+}
+
+func (m *ProviderOperationModel) ClaimDue(limit int) ([]*data.ProviderOperation, error) {
+	return []*data.ProviderOperation{}, nil
+}
+
+func (m *ProviderOperationModel) ReleaseStale(olderThan time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (m *ProviderOperationModel) CompleteCreate(op *data.ProviderOperation, providerEventID string) error {
+	return nil
+}
+
+func (m *ProviderOperationModel) Complete(id int) error {
+	return nil
+}
+
+func (m *ProviderOperationModel) Cancel(id int) error {
+	return nil
+}
+
+func (m *ProviderOperationModel) Retry(id int, lastError string, nextAttemptAt time.Time) error {
+	m.Retried = append(m.Retried, id)
+	return nil
+}
+
+func (m *ProviderOperationModel) Fail(id int, lastError string) error {
+	m.Failed = append(m.Failed, id)
+	return nil
+}
+
+func (m *ProviderOperationModel) Skip(op *data.ProviderOperation, reason string) error {
+	m.Skipped = append(m.Skipped, op.ID)
+	return nil
+}
+
+// Compensate declines request 1, which appointment 1 came from.
+func (m *ProviderOperationModel) Compensate(appointmentID int) (int, error) {
+	m.Compensated = append(m.Compensated, appointmentID)
+	if appointmentID == 1 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *ProviderOperationModel) GetForAppointment(appointmentID int) ([]*data.ProviderOperation, error) {
+	return []*data.ProviderOperation{}, nil
+}
+
+func (m *ProviderOperationModel) GetFailed(limit int) ([]*data.ProviderOperation, error) {
+	return []*data.ProviderOperation{
+		{
+			ID:            7,
+			Operation:     "create_event",
+			AppointmentID: 1,
+			UserID:        2,
+			ProviderName:  "microsoft",
+			Status:        "failed",
+			Attempts:      5,
+			MaxAttempts:   5,
+			LastError:     "graph: 403 Forbidden",
+		},
+	}, nil
+}
+
+func (m *ProviderOperationModel) RemoveUserEvents(userID int) ([]*data.ProviderOperation, error) {
+	m.Removed = append(m.Removed, userID)
+	return []*data.ProviderOperation{}, nil
+}
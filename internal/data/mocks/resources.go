@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+type ResourceModel struct{}
+
+var mockResource = &data.Resource{
+	ID:             1,
+	Name:           "Test Room",
+	Kind:           data.ResourceRoom,
+	Capacity:       8,
+	Location:       "First Floor",
+	Attributes:     []string{"projector", "whiteboard"},
+	AvailableFrom:  8,
+	AvailableUntil: 18,
+	CreatedAt:      time.Now(),
+	UpdatedAt:      time.Now(),
+}
+
+func (m *ResourceModel) Insert(r *data.Resource) (int, error) {
+	return 2, nil
+}
+
+func (m *ResourceModel) Get(id int) (*data.Resource, error) {
+	switch id {
+	case 1:
+		return mockResource, nil
+	default:
+		return nil, data.ErrRecordNotFound
+	}
+}
+
+func (m *ResourceModel) GetAll() ([]*data.Resource, error) {
+	return []*data.Resource{mockResource}, nil
+}
+
+func (m *ResourceModel) Update(r *data.Resource) error {
+	if r.ID != 1 {
+		return data.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m *ResourceModel) Delete(id int) error {
+	if id != 1 {
+		return data.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m *ResourceModel) GetBookings(resourceID int, from, to time.Time) ([]*data.Event, error) {
+	return []*data.Event{}, nil
+}
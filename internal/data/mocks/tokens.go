@@ -0,0 +1,45 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// Plaintexts of the mock tokens: an activation token for Carol, who hasn't
+// activated her account yet, and a password reset token for Alice.
+const (
+	MockActivationToken    = "mock-activation-token"
+	MockPasswordResetToken = "mock-password-reset-token"
+)
+
+type TokenModel struct {
+	// Created records the tokens made, for checking in tests.
+	Created []*data.Token
+}
+
+func (m *TokenModel) New(userID int, scope string, ttl time.Duration) (*data.Token, error) {
+	token := &data.Token{
+		Plaintext: "mock-new-" + scope + "-token",
+		UserID:    userID,
+		Scope:     scope,
+		Expiry:    time.Now().Add(ttl),
+	}
+	m.Created = append(m.Created, token)
+	return token, nil
+}
+
+func (m *TokenModel) Use(scope, plaintext string) (int, error) {
+	switch {
+	case scope == data.TokenScopeActivation && plaintext == MockActivationToken:
+		return 3, nil
+	case scope == data.TokenScopePasswordReset && plaintext == MockPasswordResetToken:
+		return 1, nil
+	default:
+		return 0, data.ErrRecordNotFound
+	}
+}
+
+func (m *TokenModel) DeleteAllForUser(scope string, userID int) error {
+	return nil
+}
@@ -0,0 +1,94 @@
+package mocks
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// The secret and one of the recovery codes of Alice's authenticator, when
+// it's enabled.
+const (
+	MockTOTPSecret   = "JBSWY3DPEHPK3PXP"
+	MockRecoveryCode = "abcde-fghij"
+)
+
+type TwoFactorModel struct {
+	// Enabled turns on two-factor authentication for Alice.
+	Enabled bool
+	// Begun is the secret of an authenticator Alice is setting up, if any.
+	Begun        string
+	LastCounter  int64
+	RecoveryUsed bool
+}
+
+func (m *TwoFactorModel) Get(userID int) (*data.TwoFactor, error) {
+	if userID != 1 {
+		return nil, data.ErrRecordNotFound
+	}
+
+	switch {
+	case m.Enabled:
+		return &data.TwoFactor{UserID: 1, Secret: MockTOTPSecret, ConfirmedAt: time.Now(), LastCounter: m.LastCounter}, nil
+	case m.Begun != "":
+		return &data.TwoFactor{UserID: 1, Secret: m.Begun}, nil
+	default:
+		return nil, data.ErrRecordNotFound
+	}
+}
+
+func (m *TwoFactorModel) Begin(userID int, secret string) error {
+	if m.Enabled {
+		return data.ErrEditConflict
+	}
+	m.Begun = secret
+	return nil
+}
+
+func (m *TwoFactorModel) Confirm(userID int, counter int64) error {
+	if m.Begun == "" || m.Enabled {
+		return data.ErrRecordNotFound
+	}
+	m.Enabled = true
+	m.LastCounter = counter
+	return nil
+}
+
+func (m *TwoFactorModel) UseCounter(userID int, counter int64) error {
+	if counter <= m.LastCounter {
+		return data.ErrRecordNotFound
+	}
+	m.LastCounter = counter
+	return nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	m.Enabled = false
+	m.Begun = ""
+	return nil
+}
+
+func (m *TwoFactorModel) NewRecoveryCodes(userID int) ([]string, error) {
+	codes := []string{MockRecoveryCode}
+	for len(codes) < data.RecoveryCodeCount {
+		codes = append(codes, "zzzzz-zzzzz")
+	}
+	m.RecoveryUsed = false
+	return codes, nil
+}
+
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	if userID != 1 || m.RecoveryUsed || strings.ToLower(strings.TrimSpace(code)) != MockRecoveryCode {
+		return data.ErrRecordNotFound
+	}
+	m.RecoveryUsed = true
+	return nil
+}
+
+func (m *TwoFactorModel) CountRecoveryCodes(userID int) (int, error) {
+	if m.RecoveryUsed {
+		return data.RecoveryCodeCount - 1, nil
+	}
+	return data.RecoveryCodeCount, nil
+}
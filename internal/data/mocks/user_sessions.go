@@ -0,0 +1,68 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// UserSessionModel keeps the sessions made by logging in. Sessions it
+// doesn't know of, like those of mockAuthentication, are taken to be active
+// until they're deleted.
+type UserSessionModel struct {
+	sessions []*data.UserSession
+	deleted  map[int]bool
+}
+
+func (m *UserSessionModel) Insert(s *data.UserSession) error {
+	s.ID = 100 + len(m.sessions)
+	s.CreatedAt = time.Now()
+	s.LastSeenAt = s.CreatedAt
+	m.sessions = append(m.sessions, s)
+	return nil
+}
+
+func (m *UserSessionModel) Touch(id, userID int) (bool, error) {
+	switch userID {
+	case 1, 2, 3, 5:
+		return !m.deleted[id], nil
+	default:
+		return false, nil
+	}
+}
+
+func (m *UserSessionModel) GetAllForUser(userID int) ([]*data.UserSession, error) {
+	sessions := []*data.UserSession{}
+	for _, s := range m.sessions {
+		if s.UserID == userID && !m.deleted[s.ID] {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *UserSessionModel) Delete(id, userID int) error {
+	for _, s := range m.sessions {
+		if s.ID == id && s.UserID == userID && !m.deleted[id] {
+			m.delete(id)
+			return nil
+		}
+	}
+	return data.ErrRecordNotFound
+}
+
+func (m *UserSessionModel) DeleteAllForUser(userID, exceptID int) error {
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.ID != exceptID {
+			m.delete(s.ID)
+		}
+	}
+	return nil
+}
+
+func (m *UserSessionModel) delete(id int) {
+	if m.deleted == nil {
+		m.deleted = map[int]bool{}
+	}
+	m.deleted[id] = true
+}
@@ -2,31 +2,96 @@ package mocks
 
 import "github.com/tmgasek/calendar-app/internal/data"
 
-type UserModel struct{}
+// UserModel records the users that were deleted, disabled and enabled so
+// tests can check them.
+type UserModel struct {
+	Deleted  []int
+	Disabled map[int]bool
+}
 
+// Alice, Bob and Carol are in the Example organisation, of which Alice is an
+// admin.
 var mockUser1 = &data.User{
 	ID:    1,
 	Name:  "Alice",
 	Email: "alice@example.com",
+	// Alice looks after the instance.
+	IsAdmin:          true,
+	Activated:        true,
+	PasswordSet:      true,
+	OrganisationID:   1,
+	OrganisationRole: data.OrganisationRoleAdmin,
 }
+
+// Bob signs in with Google and has never set a password.
 var mockUser2 = &data.User{
-	ID:    2,
-	Name:  "Bob",
-	Email: "bob@example.com",
+	ID:               2,
+	Name:             "Bob",
+	Email:            "bob@example.com",
+	Activated:        true,
+	OrganisationID:   1,
+	OrganisationRole: data.OrganisationRoleMember,
+}
+
+// Carol has signed up but not confirmed her email address yet.
+var mockUser3 = &data.User{
+	ID:               3,
+	Name:             "Carol",
+	Email:            "carol@example.com",
+	PasswordSet:      true,
+	OrganisationID:   1,
+	OrganisationRole: data.OrganisationRoleMember,
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
+// Oscar is in another organisation, Globex, which doesn't share with
+// Example.
+var mockUser5 = &data.User{
+	ID:               5,
+	Name:             "Oscar",
+	Email:            "oscar@globex.example",
+	Activated:        true,
+	PasswordSet:      true,
+	OrganisationID:   2,
+	OrganisationRole: data.OrganisationRoleAdmin,
+}
+
+var mockUsers = []*data.User{mockUser1, mockUser2, mockUser3, mockUser5}
+
+func (m *UserModel) Insert(name, email, password string) (int, error) {
 	switch email {
 	case "dupe@example.com":
-		return data.ErrDuplicateEmail
+		return 0, data.ErrDuplicateEmail
 	default:
+		return 4, nil
+	}
+}
+
+func (m *UserModel) Activate(id int) error {
+	switch id {
+	case 1, 2, 3, 5:
+		return nil
+	default:
+		return data.ErrRecordNotFound
+	}
+}
+
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	switch id {
+	case 1, 2, 3, 5:
 		return nil
+	default:
+		return data.ErrRecordNotFound
 	}
 }
+
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	if email == mockUser1.Email && password == "pa$$word" {
 		return 1, nil
 	}
+	// Dave's account has been disabled.
+	if email == "dave@example.com" && password == "pa$$word" {
+		return 0, data.ErrUserDisabled
+	}
 	return 0, data.ErrInvalidCredentials
 }
 func (m *UserModel) Exists(id int) (bool, error) {
@@ -35,6 +100,10 @@ func (m *UserModel) Exists(id int) (bool, error) {
 		return true, nil
 	case 2:
 		return true, nil
+	case 3:
+		return true, nil
+	case 5:
+		return true, nil
 	default:
 		return false, nil
 	}
@@ -43,27 +112,133 @@ func (m *UserModel) Exists(id int) (bool, error) {
 func (m *UserModel) Get(id int) (*data.User, error) {
 	switch id {
 	case 1:
-		return mockUser1, nil
+		return m.withDisabled(mockUser1), nil
 	case 2:
-		return mockUser2, nil
+		return m.withDisabled(mockUser2), nil
+	case 3:
+		return m.withDisabled(mockUser3), nil
+	case 5:
+		return m.withDisabled(mockUser5), nil
 	default:
 		return nil, data.ErrRecordNotFound
 	}
 }
 
-func (m *UserModel) SearchUsers(query string) ([]*data.User, error) {
-	return []*data.User{
-		mockUser1,
-		mockUser2,
-	}, nil
+// withDisabled returns the user as disabled if they've been disabled, and
+// otherwise as they are.
+func (m *UserModel) withDisabled(u *data.User) *data.User {
+	if !m.Disabled[u.ID] {
+		return u
+	}
+	disabled := *u
+	disabled.Disabled = true
+	return &disabled
 }
 
-func (m *UserModel) GetByEmail(email string) (*data.User, error) {
-	if email == mockUser1.Email {
-		return mockUser1, nil
+// SearchUsers ignores the query, and finds the activated users in the
+// viewer's organisation.
+func (m *UserModel) SearchUsers(viewerID int, query string) ([]*data.User, error) {
+	users := []*data.User{}
+	for _, u := range mockUsers {
+		if ok, _ := m.Reachable(viewerID, u.ID); ok && u.Activated {
+			users = append(users, u)
+		}
 	}
-	if email == mockUser2.Email {
-		return mockUser2, nil
+	return users, nil
+}
+
+// Reachable holds for users in the same organisation, as none of the mock
+// organisations share with each other.
+func (m *UserModel) Reachable(viewerID, userID int) (bool, error) {
+	viewer, err := m.Get(viewerID)
+	if err != nil {
+		return false, nil
+	}
+	user, err := m.Get(userID)
+	if err != nil {
+		return false, nil
+	}
+	return viewer.OrganisationID == user.OrganisationID, nil
+}
+
+func (m *UserModel) Reachers(userID int, viewerIDs []int) ([]int, error) {
+	reachers := []int{}
+	for _, viewerID := range viewerIDs {
+		if ok, _ := m.Reachable(viewerID, userID); ok {
+			reachers = append(reachers, viewerID)
+		}
+	}
+	return reachers, nil
+}
+
+func (m *UserModel) GetByEmail(email string) (*data.User, error) {
+	for _, u := range mockUsers {
+		if u.Email == email {
+			return m.withDisabled(u), nil
+		}
 	}
 	return nil, data.ErrRecordNotFound
 }
+
+func (m *UserModel) GetAll(viewerID int, query string, filters data.Filters) ([]*data.User, data.Metadata, error) {
+	users, _ := m.SearchUsers(viewerID, query)
+	users, metadata := data.Page(users, filters)
+	return users, metadata, nil
+}
+
+// GetAllForAdmin ignores the query, and lists every user. Bob has linked
+// his Google calendar.
+func (m *UserModel) GetAllForAdmin(query string, filters data.Filters) ([]*data.User, data.Metadata, error) {
+	users := []*data.User{}
+	for _, u := range mockUsers {
+		u := *u
+		if u.ID == 2 {
+			u.LinkedProviders = []string{"google"}
+		}
+		users = append(users, &u)
+	}
+	users, metadata := data.Page(users, filters)
+	return users, metadata, nil
+}
+
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	if _, err := m.Get(id); err != nil {
+		return err
+	}
+	if m.Disabled == nil {
+		m.Disabled = map[int]bool{}
+	}
+	m.Disabled[id] = disabled
+	return nil
+}
+
+// ResetPassword resets Alice's password with the mock password reset token.
+func (m *UserModel) ResetPassword(tokenPlaintext, password string) (int, error) {
+	if tokenPlaintext != MockPasswordResetToken {
+		return 0, data.ErrRecordNotFound
+	}
+	return 1, nil
+}
+
+func (m *UserModel) GrantAdmin(email string) error {
+	_, err := m.GetByEmail(email)
+	return err
+}
+
+// GetCounterparts has Bob as the only other person in Alice's appointments.
+func (m *UserModel) GetCounterparts(id int) ([]*data.User, error) {
+	if id == 1 {
+		return []*data.User{mockUser2}, nil
+	}
+	return []*data.User{}, nil
+}
+
+func (m *UserModel) Delete(id int) error {
+	switch id {
+	case 1, 2, 3, 5:
+		m.Deleted = append(m.Deleted, id)
+		return nil
+	default:
+		return data.ErrRecordNotFound
+	}
+}
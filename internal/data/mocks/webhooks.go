@@ -0,0 +1,113 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+var mockWebhook = &data.Webhook{
+	ID:        1,
+	UserID:    1,
+	URL:       "https://hooks.example.com/calendar",
+	Secret:    "whsec_mocksecret",
+	Events:    []string{data.EventRequestCreated, data.EventAppointmentDeleted},
+	CreatedAt: time.Now(),
+}
+
+var mockDelivery = &data.WebhookDelivery{
+	ID:            1,
+	WebhookID:     1,
+	Event:         data.EventRequestCreated,
+	Payload:       `{"event":"appointment_request.created","data":{}}`,
+	Status:        data.DeliveryFailed,
+	Attempts:      6,
+	MaxAttempts:   6,
+	NextAttemptAt: time.Now(),
+	ResponseCode:  500,
+	ResponseBody:  "Internal Server Error",
+	LastError:     "unexpected status 500",
+	CreatedAt:     time.Now(),
+	UpdatedAt:     time.Now(),
+	URL:           mockWebhook.URL,
+	Secret:        mockWebhook.Secret,
+}
+
+// WebhookModel records the events queued and the outcome of deliveries so
+// tests can check the handlers and the worker.
+type WebhookModel struct {
+	Enqueued  []string
+	Completed []int
+	Retried   []int
+	Failed    []int
+}
+
+func (m *WebhookModel) Insert(w *data.Webhook) (int, error) {
+	w.ID = 2
+	w.Secret = "whsec_newsecret"
+	w.CreatedAt = time.Now()
+	return w.ID, nil
+}
+
+func (m *WebhookModel) Get(id int) (*data.Webhook, error) {
+	if id == mockWebhook.ID {
+		return mockWebhook, nil
+	}
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *WebhookModel) GetAllForUser(userID int) ([]*data.Webhook, error) {
+	if userID != mockWebhook.UserID {
+		return []*data.Webhook{}, nil
+	}
+	return []*data.Webhook{mockWebhook}, nil
+}
+
+func (m *WebhookModel) Delete(id int) error {
+	if id == mockWebhook.ID {
+		return nil
+	}
+	return data.ErrRecordNotFound
+}
+
+func (m *WebhookModel) Enqueue(event string, payload []byte, userIDs []int, groupID int) (int, error) {
+	m.Enqueued = append(m.Enqueued, event)
+	return 1, nil
+}
+
+func (m *WebhookModel) GetDeliveries(webhookID, limit int) ([]*data.WebhookDelivery, error) {
+	if webhookID != mockWebhook.ID {
+		return []*data.WebhookDelivery{}, nil
+	}
+	return []*data.WebhookDelivery{mockDelivery}, nil
+}
+
+func (m *WebhookModel) Redeliver(webhookID, deliveryID int) (int, error) {
+	if webhookID == mockDelivery.WebhookID && deliveryID == mockDelivery.ID {
+		return 2, nil
+	}
+	return 0, data.ErrRecordNotFound
+}
+
+func (m *WebhookModel) ClaimDue(limit int) ([]*data.WebhookDelivery, error) {
+	return []*data.WebhookDelivery{}, nil
+}
+
+func (m *WebhookModel) ReleaseStale(olderThan time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (m *WebhookModel) Complete(id, responseCode int, responseBody string) error {
+	m.Completed = append(m.Completed, id)
+	return nil
+}
+
+func (m *WebhookModel) Retry(id, responseCode int, responseBody, lastError string, nextAttemptAt time.Time) error {
+	m.Retried = append(m.Retried, id)
+	return nil
+}
+
+func (m *WebhookModel) Fail(id, responseCode int, responseBody, lastError string) error {
+	m.Failed = append(m.Failed, id)
+	return nil
+}
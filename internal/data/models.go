@@ -10,6 +10,8 @@ var (
 	ErrEditConflict       = errors.New("edit conflict")
 	ErrDuplicateEmail     = errors.New("duplicate email")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrDuplicateDomain    = errors.New("duplicate domain")
+	ErrUserDisabled       = errors.New("user disabled")
 )
 
 type Models struct {
@@ -20,6 +22,23 @@ type Models struct {
 	Events              EventModelInterface
 	AppointmentEvents   AppointmentEventModelInterface
 	Groups              GroupModelInterface
+	ProviderOperations  ProviderOperationModelInterface
+	Polls               PollModelInterface
+	Resources           ResourceModelInterface
+	APITokens           APITokenModelInterface
+	CalendarFeeds       CalendarFeedModelInterface
+	Webhooks            WebhookModelInterface
+	CalendarSyncs       CalendarSyncModelInterface
+	Tokens              TokenModelInterface
+	TwoFactor           TwoFactorModelInterface
+	Identities          IdentityModelInterface
+	LoginThrottles      LoginThrottleModelInterface
+	UserSessions        UserSessionModelInterface
+	GroupInvitations    GroupInvitationModelInterface
+	GroupCalendarFeeds  GroupCalendarFeedModelInterface
+	Organisations       OrganisationModelInterface
+	AuditLog            AuditLogModelInterface
+	MailFailures        MailFailureModelInterface
 }
 
 // For ease of use
@@ -32,5 +51,22 @@ func NewModels(db *sql.DB) Models {
 		Events:              &EventModel{DB: db},
 		AppointmentEvents:   &AppointmentEventModel{DB: db},
 		Groups:              &GroupModel{DB: db},
+		ProviderOperations:  &ProviderOperationModel{DB: db},
+		Polls:               &PollModel{DB: db},
+		Resources:           &ResourceModel{DB: db},
+		APITokens:           &APITokenModel{DB: db},
+		CalendarFeeds:       &CalendarFeedModel{DB: db},
+		Webhooks:            &WebhookModel{DB: db},
+		CalendarSyncs:       &CalendarSyncModel{DB: db},
+		Tokens:              &TokenModel{DB: db},
+		TwoFactor:           &TwoFactorModel{DB: db},
+		Identities:          &IdentityModel{DB: db},
+		LoginThrottles:      &LoginThrottleModel{DB: db},
+		UserSessions:        &UserSessionModel{DB: db},
+		GroupInvitations:    &GroupInvitationModel{DB: db},
+		GroupCalendarFeeds:  &GroupCalendarFeedModel{DB: db},
+		Organisations:       &OrganisationModel{DB: db},
+		AuditLog:            &AuditLogModel{DB: db},
+		MailFailures:        &MailFailureModel{DB: db},
 	}
 }
@@ -0,0 +1,269 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Roles of organisation members. Admins manage its members and who it
+// shares with; members can only see it.
+const (
+	OrganisationRoleAdmin  = "admin"
+	OrganisationRoleMember = "member"
+)
+
+// Organisation is a tenant of the instance. Its members can only find and
+// send requests to each other, and to the members of organisations that
+// share with theirs.
+type Organisation struct {
+	ID   int
+	Name string
+	// Domain is the email domain whose users join the organisation once
+	// they've confirmed their address, or "" if nobody joins that way.
+	Domain      string
+	MemberCount int
+	CreatedAt   time.Time
+}
+
+type OrganisationMember struct {
+	ID    int
+	Name  string
+	Email string
+	Role  string
+}
+
+type OrganisationModel struct {
+	DB *sql.DB
+}
+
+type OrganisationModelInterface interface {
+	Insert(name, domain string) (int, error)
+	Get(id int) (*Organisation, error)
+	GetAll() ([]*Organisation, error)
+	GetMembers(id int) ([]*OrganisationMember, error)
+	AddMember(id, userID int, role string) error
+	RemoveMember(id, userID int) error
+	SetRole(id, userID int, role string) error
+	JoinByDomain(userID int) (int, error)
+	GetShares(id int) ([]*Organisation, error)
+	Share(id, sharedWithID int) error
+	Unshare(id, sharedWithID int) error
+}
+
+const organisationSelect = `
+	SELECT o.id, o.name, COALESCE(o.domain, ''), o.created_at,
+		(SELECT count(*) FROM users WHERE organisation_id = o.id)
+	FROM organisations o`
+
+func scanOrganisation(row rowScanner) (*Organisation, error) {
+	org := &Organisation{}
+	err := row.Scan(&org.ID, &org.Name, &org.Domain, &org.CreatedAt, &org.MemberCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return org, nil
+}
+
+// Insert creates an organisation and returns its ID. The activated users
+// already at its domain who aren't in an organisation join it.
+func (m *OrganisationModel) Insert(name, domain string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// We use a pointer here so that the domain can be null, as only one
+	// organisation can have each.
+	var domainArg *string
+	if domain != "" {
+		domainArg = &domain
+	}
+
+	var id int
+	err = tx.QueryRow("INSERT INTO organisations (name, domain) VALUES ($1, $2) RETURNING id", name, domainArg).Scan(&id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organisations_domain_key"`:
+			return 0, ErrDuplicateDomain
+		default:
+			return 0, err
+		}
+	}
+
+	if domain != "" {
+		_, err = tx.Exec(`
+			UPDATE users SET organisation_id = $1, organisation_role = $3
+			WHERE organisation_id IS NULL AND activated
+			AND split_part(email::text, '@', 2)::citext = $2
+		`, id, domain, OrganisationRoleMember)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *OrganisationModel) Get(id int) (*Organisation, error) {
+	return scanOrganisation(m.DB.QueryRow(organisationSelect+" WHERE o.id = $1", id))
+}
+
+// GetAll returns every organisation, by name.
+func (m *OrganisationModel) GetAll() ([]*Organisation, error) {
+	return m.query(organisationSelect + " ORDER BY o.name, o.id")
+}
+
+// GetShares returns the organisations whose members the organisation has
+// let find its own, by name.
+func (m *OrganisationModel) GetShares(id int) ([]*Organisation, error) {
+	query := organisationSelect + `
+		INNER JOIN organisation_shares s ON s.shared_with_id = o.id
+		WHERE s.organisation_id = $1
+		ORDER BY o.name, o.id
+	`
+
+	return m.query(query, id)
+}
+
+func (m *OrganisationModel) query(query string, args ...any) ([]*Organisation, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organisation{}
+	for rows.Next() {
+		org, err := scanOrganisation(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// GetMembers returns the members of the organisation, admins first.
+func (m *OrganisationModel) GetMembers(id int) ([]*OrganisationMember, error) {
+	query := `
+		SELECT id, name, email, organisation_role
+		FROM users
+		WHERE organisation_id = $1
+		ORDER BY CASE organisation_role WHEN 'admin' THEN 0 ELSE 1 END, name, id
+	`
+
+	rows, err := m.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*OrganisationMember{}
+	for rows.Next() {
+		member := &OrganisationMember{}
+		err := rows.Scan(&member.ID, &member.Name, &member.Email, &member.Role)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// AddMember puts the user in the organisation with the role, taking them out
+// of any other.
+func (m *OrganisationModel) AddMember(id, userID int, role string) error {
+	query := `
+		UPDATE users SET organisation_id = $1, organisation_role = $3
+		WHERE id = $2
+	`
+
+	return expectOneRow(m.DB.Exec(query, id, userID, role))
+}
+
+// RemoveMember takes the user out of the organisation.
+func (m *OrganisationModel) RemoveMember(id, userID int) error {
+	query := `
+		UPDATE users SET organisation_id = NULL, organisation_role = $3
+		WHERE id = $2 AND organisation_id = $1
+	`
+
+	return expectOneRow(m.DB.Exec(query, id, userID, OrganisationRoleMember))
+}
+
+// SetRole makes a member of the organisation an admin or a plain member.
+func (m *OrganisationModel) SetRole(id, userID int, role string) error {
+	query := `
+		UPDATE users SET organisation_role = $3
+		WHERE id = $2 AND organisation_id = $1
+	`
+
+	return expectOneRow(m.DB.Exec(query, id, userID, role))
+}
+
+// JoinByDomain puts an activated user who isn't in an organisation in the
+// one at their email domain, if there is one, and returns its ID, or 0 if
+// they didn't join one.
+func (m *OrganisationModel) JoinByDomain(userID int) (int, error) {
+	query := `
+		UPDATE users u SET organisation_id = o.id, organisation_role = $2
+		FROM organisations o
+		WHERE u.id = $1 AND u.organisation_id IS NULL AND u.activated
+		AND o.domain = split_part(u.email::text, '@', 2)::citext
+		RETURNING o.id
+	`
+
+	var id int
+	err := m.DB.QueryRow(query, userID, OrganisationRoleMember).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Share lets the members of another organisation find and send requests to
+// the organisation's own. Sharing again changes nothing.
+func (m *OrganisationModel) Share(id, sharedWithID int) error {
+	query := `
+		INSERT INTO organisation_shares (organisation_id, shared_with_id)
+		VALUES ($1, $2)
+		ON CONFLICT (organisation_id, shared_with_id) DO NOTHING
+	`
+
+	_, err := m.DB.Exec(query, id, sharedWithID)
+	return err
+}
+
+// Unshare stops sharing the organisation with another.
+func (m *OrganisationModel) Unshare(id, sharedWithID int) error {
+	query := `
+		DELETE FROM organisation_shares
+		WHERE organisation_id = $1 AND shared_with_id = $2
+	`
+
+	return expectOneRow(m.DB.Exec(query, id, sharedWithID))
+}
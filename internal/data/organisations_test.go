@@ -0,0 +1,114 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestOrganisationModel(t *testing.T) {
+	db := newTestDB(t)
+	m := OrganisationModel{DB: db}
+	users := UserModel{DB: db}
+
+	// Alice (1), Bob (2) and Charlie (3) are all at example.com, so they
+	// join Example when it's created.
+	example, err := m.Insert("Example", "example.com")
+	assert.NilError(t, err)
+
+	_, err = m.Insert("Example Again", "EXAMPLE.com")
+	assert.Equal(t, errors.Is(err, ErrDuplicateDomain), true)
+
+	org, err := m.Get(example)
+	assert.NilError(t, err)
+	assert.Equal(t, org.Domain, "example.com")
+	assert.Equal(t, org.MemberCount, 3)
+
+	// Organisations without a domain don't clash with each other.
+	other, err := m.Insert("Other", "")
+	assert.NilError(t, err)
+	_, err = m.Insert("Another", "")
+	assert.NilError(t, err)
+
+	// Moving Charlie to Other puts him out of Alice's reach.
+	err = m.AddMember(other, 3, OrganisationRoleAdmin)
+	assert.NilError(t, err)
+	err = m.SetRole(example, 1, OrganisationRoleAdmin)
+	assert.NilError(t, err)
+
+	members, err := m.GetMembers(example)
+	assert.NilError(t, err)
+	assert.Equal(t, len(members), 2)
+	assert.Equal(t, members[0].ID, 1)
+	assert.Equal(t, members[0].Role, OrganisationRoleAdmin)
+
+	user, err := users.Get(3)
+	assert.NilError(t, err)
+	assert.Equal(t, user.OrganisationID, other)
+
+	ok, err := users.Reachable(1, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+
+	ok, err = users.Reachable(1, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, ok, false)
+
+	reachers, err := users.Reachers(3, []int{1, 2, 3})
+	assert.NilError(t, err)
+	assert.Equal(t, len(reachers), 1)
+	assert.Equal(t, reachers[0], 3)
+
+	found, err := users.SearchUsers(1, "example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, len(found), 2)
+
+	// Other sharing with Example lets Alice reach Charlie, but not the
+	// other way round.
+	err = m.Share(other, example)
+	assert.NilError(t, err)
+	err = m.Share(other, example)
+	assert.NilError(t, err)
+
+	shares, err := m.GetShares(other)
+	assert.NilError(t, err)
+	assert.Equal(t, len(shares), 1)
+	assert.Equal(t, shares[0].ID, example)
+
+	ok, err = users.Reachable(1, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, ok, true)
+
+	ok, err = users.Reachable(3, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, ok, false)
+
+	reachers, err = users.Reachers(3, []int{1, 2, 3})
+	assert.NilError(t, err)
+	assert.Equal(t, len(reachers), 3)
+
+	found, err = users.SearchUsers(1, "example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, len(found), 3)
+
+	err = m.Unshare(other, example)
+	assert.NilError(t, err)
+	err = m.Unshare(other, example)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	// Bob rejoins Example by his domain once he's out of it.
+	err = m.RemoveMember(example, 2)
+	assert.NilError(t, err)
+	err = m.RemoveMember(example, 2)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	joined, err := m.JoinByDomain(2)
+	assert.NilError(t, err)
+	assert.Equal(t, joined, example)
+
+	// Nobody already in an organisation moves by their domain.
+	joined, err = m.JoinByDomain(3)
+	assert.NilError(t, err)
+	assert.Equal(t, joined, 0)
+}
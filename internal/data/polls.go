@@ -0,0 +1,422 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	PollOpen      = "open"
+	PollFinalised = "finalised"
+)
+
+// Answers a participant can give for each option of a poll.
+const (
+	VoteYes      = "yes"
+	VoteIfNeedBe = "if_need_be"
+	VoteNo       = "no"
+)
+
+type Poll struct {
+	ID                int
+	OrganizerID       int
+	GroupID           int
+	Title             string
+	Description       string
+	Location          string
+	Status            string
+	FinalisedOptionID int
+	AppointmentID     int
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Organizer         *Requester
+	Options           []*PollOption
+	Participants      []*PollParticipant
+}
+
+type PollOption struct {
+	ID        int
+	PollID    int
+	StartTime time.Time
+	EndTime   time.Time
+	// Votes maps participant user IDs to their answer for this option.
+	Votes map[int]string
+	// Conflicts holds the names of participants whose synced calendars are
+	// busy at this time. It isn't stored, handlers fill it in.
+	Conflicts []string
+}
+
+type PollParticipant struct {
+	UserID int
+	Name   string
+	Email  string
+}
+
+// Count returns how many participants gave the answer for this option.
+func (o *PollOption) Count(vote string) int {
+	n := 0
+	for _, v := range o.Votes {
+		if v == vote {
+			n++
+		}
+	}
+	return n
+}
+
+// IsOpen reports whether participants can still vote.
+func (p *Poll) IsOpen() bool {
+	return p.Status == PollOpen
+}
+
+// IsParticipant reports whether the user was invited to vote on the poll.
+func (p *Poll) IsParticipant(userID int) bool {
+	for _, participant := range p.Participants {
+		if participant.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Option returns the poll option with the ID, or nil if it isn't one of the
+// poll's options.
+func (p *Poll) Option(optionID int) *PollOption {
+	for _, o := range p.Options {
+		if o.ID == optionID {
+			return o
+		}
+	}
+	return nil
+}
+
+type PollModel struct {
+	DB *sql.DB
+}
+
+type PollModelInterface interface {
+	Insert(poll *Poll) (int, error)
+	Get(id int) (*Poll, error)
+	GetForUser(userID int) ([]*Poll, error)
+	Vote(pollID, userID int, votes map[int]string) error
+	Finalise(pollID, optionID int, a *Appointment, userIDs []int) (int, error)
+}
+
+// Insert the poll together with its options and participants.
+func (m *PollModel) Insert(poll *Poll) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// We use a pointer here so that value can be null.
+	var groupID *int
+	if poll.GroupID != 0 {
+		groupID = &poll.GroupID
+	}
+
+	query := `
+		INSERT INTO polls (organizer_id, group_id, title, description, location)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at, updated_at
+	`
+
+	err = tx.QueryRow(query, poll.OrganizerID, groupID, poll.Title, poll.Description, poll.Location).Scan(&poll.ID, &poll.Status, &poll.CreatedAt, &poll.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, o := range poll.Options {
+		err = tx.QueryRow(`
+			INSERT INTO poll_options (poll_id, start_time, end_time)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, poll.ID, o.StartTime, o.EndTime).Scan(&o.ID)
+		if err != nil {
+			return 0, err
+		}
+		o.PollID = poll.ID
+	}
+
+	for _, p := range poll.Participants {
+		_, err = tx.Exec(`
+			INSERT INTO poll_participants (poll_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, poll.ID, p.UserID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return poll.ID, nil
+}
+
+const pollColumns = `
+	p.id, p.organizer_id, p.group_id, p.title, p.description, p.location,
+	p.status, p.finalised_option_id, p.appointment_id, p.created_at,
+	p.updated_at, u.name, u.email`
+
+func scanPoll(row rowScanner) (*Poll, error) {
+	p := &Poll{Organizer: &Requester{}}
+	var groupID, finalisedOptionID, appointmentID sql.NullInt64
+
+	err := row.Scan(&p.ID, &p.OrganizerID, &groupID, &p.Title, &p.Description, &p.Location, &p.Status, &finalisedOptionID, &appointmentID, &p.CreatedAt, &p.UpdatedAt, &p.Organizer.Name, &p.Organizer.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	p.GroupID = int(groupID.Int64)
+	p.FinalisedOptionID = int(finalisedOptionID.Int64)
+	p.AppointmentID = int(appointmentID.Int64)
+
+	return p, nil
+}
+
+// Get the poll with its options, votes and participants.
+func (m *PollModel) Get(id int) (*Poll, error) {
+	query := `
+		SELECT ` + pollColumns + `
+		FROM polls p
+		JOIN users u ON p.organizer_id = u.id
+		WHERE p.id = $1
+	`
+
+	poll, err := scanPoll(m.DB.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	err = m.loadOptions(poll)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadParticipants(poll)
+	if err != nil {
+		return nil, err
+	}
+
+	return poll, nil
+}
+
+func (m *PollModel) loadOptions(poll *Poll) error {
+	rows, err := m.DB.Query(`
+		SELECT id, poll_id, start_time, end_time
+		FROM poll_options
+		WHERE poll_id = $1
+		ORDER BY start_time, id
+	`, poll.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	poll.Options = []*PollOption{}
+	for rows.Next() {
+		o := &PollOption{Votes: map[int]string{}}
+		err := rows.Scan(&o.ID, &o.PollID, &o.StartTime, &o.EndTime)
+		if err != nil {
+			return err
+		}
+		poll.Options = append(poll.Options, o)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	votes, err := m.DB.Query(`
+		SELECT v.option_id, v.user_id, v.vote
+		FROM poll_votes v
+		JOIN poll_options o ON v.option_id = o.id
+		WHERE o.poll_id = $1
+	`, poll.ID)
+	if err != nil {
+		return err
+	}
+	defer votes.Close()
+
+	for votes.Next() {
+		var optionID, userID int
+		var vote string
+		err := votes.Scan(&optionID, &userID, &vote)
+		if err != nil {
+			return err
+		}
+		if o := poll.Option(optionID); o != nil {
+			o.Votes[userID] = vote
+		}
+	}
+
+	return votes.Err()
+}
+
+func (m *PollModel) loadParticipants(poll *Poll) error {
+	rows, err := m.DB.Query(`
+		SELECT u.id, u.name, u.email
+		FROM poll_participants pp
+		JOIN users u ON pp.user_id = u.id
+		WHERE pp.poll_id = $1
+		ORDER BY u.name
+	`, poll.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	poll.Participants = []*PollParticipant{}
+	for rows.Next() {
+		p := &PollParticipant{}
+		err := rows.Scan(&p.UserID, &p.Name, &p.Email)
+		if err != nil {
+			return err
+		}
+		poll.Participants = append(poll.Participants, p)
+	}
+
+	return rows.Err()
+}
+
+// Get the polls the user organised or was invited to, without their options
+// and participants.
+func (m *PollModel) GetForUser(userID int) ([]*Poll, error) {
+	query := `
+		SELECT ` + pollColumns + `
+		FROM polls p
+		JOIN users u ON p.organizer_id = u.id
+		WHERE p.organizer_id = $1
+		OR EXISTS (SELECT true FROM poll_participants pp WHERE pp.poll_id = p.id AND pp.user_id = $1)
+		ORDER BY p.id DESC
+	`
+
+	rows, err := m.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	polls := []*Poll{}
+	for rows.Next() {
+		poll, err := scanPoll(rows)
+		if err != nil {
+			return nil, err
+		}
+		polls = append(polls, poll)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return polls, nil
+}
+
+// Vote records the user's answers, keyed by option ID. Votes are only taken
+// while the poll is open, from its participants, for its own options.
+func (m *PollModel) Vote(pollID, userID int, votes map[int]string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow(`
+		SELECT p.status FROM polls p
+		JOIN poll_participants pp ON pp.poll_id = p.id
+		WHERE p.id = $1 AND pp.user_id = $2
+		FOR UPDATE OF p
+	`, pollID, userID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	if status != PollOpen {
+		return ErrInvalidTransition
+	}
+
+	query := `
+		INSERT INTO poll_votes (option_id, user_id, vote)
+		SELECT id, $3::int, $4::text FROM poll_options WHERE id = $1 AND poll_id = $2
+		ON CONFLICT (option_id, user_id)
+		DO UPDATE SET vote = EXCLUDED.vote, updated_at = NOW()
+	`
+
+	for optionID, vote := range votes {
+		_, err = tx.Exec(query, optionID, pollID, userID, vote)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Finalise closes the poll on the chosen option and turns it into an
+// appointment, queueing calendar events for the users in the same way as a
+// confirmed appointment request. It returns the ID of the new appointment.
+func (m *PollModel) Finalise(pollID, optionID int, a *Appointment, userIDs []int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE polls
+		SET status = 'finalised', finalised_option_id = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'open'
+		AND EXISTS (SELECT true FROM poll_options WHERE id = $2 AND poll_id = $1)
+	`, pollID, optionID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrInvalidTransition
+	}
+
+	a.Status = AppointmentConfirming
+	appointmentID, err := insertAppointment(tx, a)
+	if err != nil {
+		return 0, err
+	}
+	a.ID = appointmentID
+
+	_, err = tx.Exec("UPDATE polls SET appointment_id = $2 WHERE id = $1", pollID, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = enqueueCreates(tx, appointmentID, userIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	err = markConfirmedIfDone(tx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return appointmentID, nil
+}
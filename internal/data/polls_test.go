@@ -0,0 +1,131 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+// insertTestPoll adds an open poll from Alice to Bob with two options.
+func insertTestPoll(t *testing.T, m PollModel) *Poll {
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+
+	poll := &Poll{
+		OrganizerID: 1,
+		Title:       "Test Poll",
+		Options: []*PollOption{
+			{StartTime: start, EndTime: start.Add(time.Hour)},
+			{StartTime: start.Add(24 * time.Hour), EndTime: start.Add(25 * time.Hour)},
+		},
+		Participants: []*PollParticipant{{UserID: 1}, {UserID: 2}},
+	}
+
+	_, err := m.Insert(poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return poll
+}
+
+func TestPollModelInsert(t *testing.T) {
+	db := newTestDB(t)
+	m := PollModel{DB: db}
+
+	poll := insertTestPoll(t, m)
+	assert.Greater(t, poll.ID, 0)
+	assert.Equal(t, poll.Status, PollOpen)
+
+	got, err := m.Get(poll.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Title, "Test Poll")
+	assert.Equal(t, got.Organizer.Name, "Alice")
+	assert.Equal(t, len(got.Options), 2)
+	assert.Equal(t, len(got.Participants), 2)
+
+	_, err = m.Get(poll.ID + 1)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestPollModelGetForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := PollModel{DB: db}
+
+	poll := insertTestPoll(t, m)
+
+	polls, err := m.GetForUser(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(polls), 1)
+	assert.Equal(t, polls[0].ID, poll.ID)
+
+	polls, err = m.GetForUser(3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(polls), 0)
+}
+
+func TestPollModelVote(t *testing.T) {
+	db := newTestDB(t)
+	m := PollModel{DB: db}
+
+	poll := insertTestPoll(t, m)
+	first, second := poll.Options[0].ID, poll.Options[1].ID
+
+	err := m.Vote(poll.ID, 2, map[int]string{first: VoteYes, second: VoteNo})
+	assert.NilError(t, err)
+
+	// Voting again replaces the earlier answer.
+	err = m.Vote(poll.ID, 2, map[int]string{second: VoteIfNeedBe})
+	assert.NilError(t, err)
+
+	got, err := m.Get(poll.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Option(first).Votes[2], VoteYes)
+	assert.Equal(t, got.Option(second).Votes[2], VoteIfNeedBe)
+	assert.Equal(t, got.Option(second).Count(VoteIfNeedBe), 1)
+
+	// Only participants can vote.
+	err = m.Vote(poll.ID, 3, map[int]string{first: VoteYes})
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestPollModelFinalise(t *testing.T) {
+	db := newTestDB(t)
+	m := PollModel{DB: db}
+	ops := ProviderOperationModel{DB: db}
+
+	poll := insertTestPoll(t, m)
+	option := poll.Options[0]
+
+	appointment := &Appointment{
+		CreatorID:       1,
+		TargetID:        2,
+		Title:           poll.Title,
+		StartTime:       option.StartTime,
+		EndTime:         option.EndTime,
+		AppointmentType: "individual",
+	}
+
+	appointmentID, err := m.Finalise(poll.ID, option.ID, appointment, []int{1, 2})
+	assert.NilError(t, err)
+	assert.Greater(t, appointmentID, 0)
+
+	got, err := m.Get(poll.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, PollFinalised)
+	assert.Equal(t, got.FinalisedOptionID, option.ID)
+	assert.Equal(t, got.AppointmentID, appointmentID)
+
+	// Only Alice has a calendar linked.
+	queued, err := ops.GetForAppointment(appointmentID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(queued), 1)
+	assert.Equal(t, queued[0].UserID, 1)
+
+	// A finalised poll can't be finalised again or voted on.
+	_, err = m.Finalise(poll.ID, option.ID, appointment, []int{1, 2})
+	assert.Equal(t, err, ErrInvalidTransition)
+
+	err = m.Vote(poll.ID, 2, map[int]string{option.ID: VoteYes})
+	assert.Equal(t, err, ErrInvalidTransition)
+}
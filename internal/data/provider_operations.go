@@ -0,0 +1,479 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of calls the outbox worker makes to calendar providers.
+const (
+	OperationCreateEvent = "create_event"
+	OperationDeleteEvent = "delete_event"
+)
+
+// Statuses of a provider operation. Operations are claimed by moving them from
+// pending to processing, and end up done, failed or cancelled.
+const (
+	OperationPending    = "pending"
+	OperationProcessing = "processing"
+	OperationDone       = "done"
+	OperationFailed     = "failed"
+	OperationCancelled  = "cancelled"
+)
+
+type ProviderOperation struct {
+	ID              int
+	IdempotencyKey  string
+	Operation       string
+	AppointmentID   int
+	UserID          int
+	ProviderName    string
+	ProviderEventID string
+	Status          string
+	Attempts        int
+	MaxAttempts     int
+	NextAttemptAt   time.Time
+	LastError       string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+type ProviderOperationModel struct {
+	DB *sql.DB
+}
+
+type ProviderOperationModelInterface interface {
+	ClaimDue(limit int) ([]*ProviderOperation, error)
+	ReleaseStale(olderThan time.Duration) (int, error)
+	CompleteCreate(op *ProviderOperation, providerEventID string) error
+	Complete(id int) error
+	Cancel(id int) error
+	Retry(id int, lastError string, nextAttemptAt time.Time) error
+	Fail(id int, lastError string) error
+	Skip(op *ProviderOperation, reason string) error
+	Compensate(appointmentID int) (int, error)
+	GetForAppointment(appointmentID int) ([]*ProviderOperation, error)
+	GetFailed(limit int) ([]*ProviderOperation, error)
+	RemoveUserEvents(userID int) ([]*ProviderOperation, error)
+}
+
+const providerOperationColumns = `
+	id, idempotency_key, operation, appointment_id, user_id, provider_name,
+	provider_event_id, status, attempts, max_attempts, next_attempt_at,
+	last_error, created_at, updated_at`
+
+func scanProviderOperations(rows *sql.Rows) ([]*ProviderOperation, error) {
+	defer rows.Close()
+
+	ops := []*ProviderOperation{}
+
+	for rows.Next() {
+		op := &ProviderOperation{}
+		err := rows.Scan(&op.ID, &op.IdempotencyKey, &op.Operation, &op.AppointmentID, &op.UserID, &op.ProviderName, &op.ProviderEventID, &op.Status, &op.Attempts, &op.MaxAttempts, &op.NextAttemptAt, &op.LastError, &op.CreatedAt, &op.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// ClaimDue moves up to limit pending operations that are due to processing and
+// returns them. SKIP LOCKED lets several instances run the worker at once
+// without picking up the same operation.
+func (m *ProviderOperationModel) ClaimDue(limit int) ([]*ProviderOperation, error) {
+	query := `
+		UPDATE provider_operations
+		SET status = 'processing', attempts = attempts + 1, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM provider_operations
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + providerOperationColumns
+
+	rows, err := m.DB.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanProviderOperations(rows)
+}
+
+// ReleaseStale puts operations that have been processing for longer than
+// olderThan back in the queue, e.g. because the instance running them died.
+func (m *ProviderOperationModel) ReleaseStale(olderThan time.Duration) (int, error) {
+	query := `
+		UPDATE provider_operations
+		SET status = 'pending', updated_at = NOW()
+		WHERE status = 'processing' AND updated_at < NOW() - $1 * INTERVAL '1 second'
+	`
+
+	result, err := m.DB.Exec(query, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// CompleteCreate records the event a create operation made. If the
+// appointment was deleted or compensated in the meantime, a delete operation
+// is queued for the new event instead. Once the last create operation of an
+// appointment is done the appointment is marked as confirmed.
+func (m *ProviderOperationModel) CompleteCreate(op *ProviderOperation, providerEventID string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE provider_operations
+		SET status = 'done', provider_event_id = $2, last_error = '', updated_at = NOW()
+		WHERE id = $1
+	`, op.ID, providerEventID)
+	if err != nil {
+		return err
+	}
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM appointments WHERE id = $1 FOR UPDATE", op.AppointmentID).Scan(&status)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) || status == AppointmentFailed {
+		err = enqueueDelete(tx, op.AppointmentID, op.UserID, op.ProviderName, providerEventID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO appointment_events (appointment_id, user_id, provider_name, provider_event_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (appointment_id, user_id, provider_name) DO NOTHING
+	`, op.AppointmentID, op.UserID, op.ProviderName, providerEventID)
+	if err != nil {
+		return err
+	}
+
+	err = markConfirmedIfDone(tx, op.AppointmentID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *ProviderOperationModel) Complete(id int) error {
+	return m.setStatus(id, OperationDone, "")
+}
+
+func (m *ProviderOperationModel) Cancel(id int) error {
+	return m.setStatus(id, OperationCancelled, "")
+}
+
+func (m *ProviderOperationModel) Fail(id int, lastError string) error {
+	return m.setStatus(id, OperationFailed, lastError)
+}
+
+func (m *ProviderOperationModel) setStatus(id int, status, lastError string) error {
+	query := `
+		UPDATE provider_operations
+		SET status = $2, last_error = $3, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := m.DB.Exec(query, id, status, lastError)
+	return err
+}
+
+// Retry puts the operation back in the queue to be attempted again later.
+func (m *ProviderOperationModel) Retry(id int, lastError string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE provider_operations
+		SET status = 'pending', last_error = $2, next_attempt_at = $3, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := m.DB.Exec(query, id, lastError, nextAttemptAt)
+	return err
+}
+
+// Skip gives up on a create operation without rolling the appointment back,
+// e.g. as the user has unlinked the calendar since it was queued. If it was
+// the last one outstanding the appointment is marked as confirmed.
+func (m *ProviderOperationModel) Skip(op *ProviderOperation, reason string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE provider_operations
+		SET status = 'cancelled', last_error = $2, updated_at = NOW()
+		WHERE id = $1
+	`, op.ID, reason)
+	if err != nil {
+		return err
+	}
+
+	err = markConfirmedIfDone(tx, op.AppointmentID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Compensate undoes a confirmation that can't be completed: the appointment is
+// marked as failed, outstanding creates are cancelled and every event that was
+// already created is queued for deletion. The request the appointment came
+// from is declined, and its ID returned so everyone on it can be told, or 0
+// if there's none or it was already compensated.
+func (m *ProviderOperationModel) Compensate(appointmentID int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE appointments SET status = $2, updated_at = NOW() WHERE id = $1
+	`, appointmentID, AppointmentFailed)
+	if err != nil {
+		return 0, err
+	}
+
+	err = removeAppointmentEvents(tx, appointmentID)
+	if err != nil {
+		return 0, err
+	}
+
+	var requestID int
+	err = tx.QueryRow(`
+		UPDATE appointment_requests
+		SET status = 'declined', declined_at = NOW(), updated_at = NOW(),
+			decline_reason = 'The appointment couldn''t be added to everyone''s calendars'
+		WHERE appointment_id = $1 AND status = 'accepted'
+		RETURNING request_id
+	`, appointmentID).Scan(&requestID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return requestID, nil
+}
+
+func (m *ProviderOperationModel) GetForAppointment(appointmentID int) ([]*ProviderOperation, error) {
+	query := `SELECT ` + providerOperationColumns + `
+		FROM provider_operations
+		WHERE appointment_id = $1
+		ORDER BY id
+	`
+
+	rows, err := m.DB.Query(query, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanProviderOperations(rows)
+}
+
+// GetFailed returns up to limit operations that ran out of attempts, most
+// recently failed first.
+func (m *ProviderOperationModel) GetFailed(limit int) ([]*ProviderOperation, error) {
+	query := `SELECT ` + providerOperationColumns + `
+		FROM provider_operations
+		WHERE status = 'failed'
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $1
+	`
+
+	rows, err := m.DB.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanProviderOperations(rows)
+}
+
+// RemoveUserEvents is the first step of deleting a user. Their appointments
+// go with them, so the events of those are queued for deletion for everyone.
+// So are the events in the user's own calendars, and their outstanding
+// creates are cancelled. The user's own deletes are claimed and returned, to
+// be carried out straight away: they can't wait for the worker, as they go
+// along with the user's tokens.
+func (m *ProviderOperationModel) RemoveUserEvents(userID int) ([]*ProviderOperation, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM appointments WHERE creator_id = $1 OR target_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var appointmentIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		appointmentIDs = append(appointmentIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range appointmentIDs {
+		err = removeAppointmentEvents(tx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE provider_operations
+		SET status = 'cancelled', updated_at = NOW()
+		WHERE user_id = $1 AND operation = 'create_event' AND status = 'pending'
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO provider_operations (idempotency_key, operation, appointment_id, user_id, provider_name, provider_event_id)
+		SELECT 'delete:' || provider_name || ':' || provider_event_id, 'delete_event', appointment_id, user_id, provider_name, provider_event_id
+		FROM appointment_events
+		WHERE user_id = $1
+		ON CONFLICT (idempotency_key) DO NOTHING
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM appointment_events WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := tx.Query(`
+		UPDATE provider_operations
+		SET status = 'processing', attempts = attempts + 1, updated_at = NOW()
+		WHERE user_id = $1 AND operation = 'delete_event' AND status = 'pending'
+		RETURNING `+providerOperationColumns, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := scanProviderOperations(claimed)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// enqueueCreates queues a create operation for every provider each of the
+// users has linked.
+func enqueueCreates(tx *sql.Tx, appointmentID int, userIDs []int) error {
+	query := `
+		INSERT INTO provider_operations (idempotency_key, operation, appointment_id, user_id, provider_name)
+		SELECT 'create:' || $1::int || ':' || user_id || ':' || auth_provider, 'create_event', $1::int, user_id, auth_provider
+		FROM auth_tokens
+		WHERE user_id = ANY($2)
+		ON CONFLICT (idempotency_key) DO NOTHING
+	`
+
+	ids := make([]int64, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = int64(id)
+	}
+
+	_, err := tx.Exec(query, appointmentID, pq.Array(ids))
+	return err
+}
+
+func enqueueDelete(tx *sql.Tx, appointmentID, userID int, providerName, providerEventID string) error {
+	query := `
+		INSERT INTO provider_operations (idempotency_key, operation, appointment_id, user_id, provider_name, provider_event_id)
+		VALUES ('delete:' || $3::text || ':' || $4::text, 'delete_event', $1, $2, $3::text, $4::text)
+		ON CONFLICT (idempotency_key) DO NOTHING
+	`
+
+	_, err := tx.Exec(query, appointmentID, userID, providerName, providerEventID)
+	return err
+}
+
+// removeAppointmentEvents cancels the appointment's outstanding creates and
+// queues deletes for the provider events it already has.
+func removeAppointmentEvents(tx *sql.Tx, appointmentID int) error {
+	_, err := tx.Exec(`
+		UPDATE provider_operations
+		SET status = 'cancelled', updated_at = NOW()
+		WHERE appointment_id = $1 AND operation = 'create_event' AND status = 'pending'
+	`, appointmentID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO provider_operations (idempotency_key, operation, appointment_id, user_id, provider_name, provider_event_id)
+		SELECT 'delete:' || provider_name || ':' || provider_event_id, 'delete_event', appointment_id, user_id, provider_name, provider_event_id
+		FROM appointment_events
+		WHERE appointment_id = $1
+		ON CONFLICT (idempotency_key) DO NOTHING
+	`, appointmentID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM appointment_events WHERE appointment_id = $1", appointmentID)
+	return err
+}
+
+// markConfirmedIfDone marks a confirming appointment as confirmed once none of
+// its create operations are outstanding.
+func markConfirmedIfDone(tx *sql.Tx, appointmentID int) error {
+	query := `
+		UPDATE appointments SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = $3 AND NOT EXISTS (
+			SELECT true FROM provider_operations
+			WHERE appointment_id = $1 AND operation = 'create_event'
+			AND status IN ('pending', 'processing')
+		)
+	`
+
+	_, err := tx.Exec(query, appointmentID, AppointmentConfirmed, AppointmentConfirming)
+	return err
+}
@@ -0,0 +1,195 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+// insertFutureRequest adds a pending request from Alice to Bob that can still
+// be confirmed.
+func insertFutureRequest(t *testing.T, m AppointmentRequestModel) *AppointmentRequest {
+	request := &AppointmentRequest{
+		RequesterID:  1,
+		TargetUserID: 2,
+		Title:        "Future Request",
+		StartTime:    time.Now().Add(24 * time.Hour),
+		EndTime:      time.Now().Add(25 * time.Hour),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		Participants: []*RequestParticipant{
+			{UserID: 2, Required: true, Status: ParticipantAccepted},
+		},
+	}
+
+	err := m.Insert(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return request
+}
+
+func TestAppointmentRequestModelConfirm(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+	ops := ProviderOperationModel{DB: db}
+
+	request := insertFutureRequest(t, m)
+
+	appointment := &Appointment{
+		CreatorID:       1,
+		TargetID:        2,
+		Title:           request.Title,
+		StartTime:       request.StartTime,
+		EndTime:         request.EndTime,
+		AppointmentType: "individual",
+	}
+
+	appointmentID, err := m.Confirm(request.RequestID, appointment, []int{1, 2})
+	assert.NilError(t, err)
+	assert.Greater(t, appointmentID, 0)
+
+	request, err = m.Get(request.RequestID)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Status, RequestStatusAccepted)
+	assert.Equal(t, request.AppointmentID, appointmentID)
+
+	// Only Alice has a calendar linked.
+	queued, err := ops.GetForAppointment(appointmentID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(queued), 1)
+	assert.Equal(t, queued[0].UserID, 1)
+	assert.Equal(t, queued[0].Operation, OperationCreateEvent)
+	assert.Equal(t, queued[0].Status, OperationPending)
+
+	// Confirming again must not create a second appointment.
+	_, err = m.Confirm(request.RequestID, appointment, []int{1, 2})
+	assert.Equal(t, err, ErrInvalidTransition)
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM appointments WHERE title = $1", request.Title).Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+}
+
+func TestProviderOperationModelCompleteCreate(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+	ops := ProviderOperationModel{DB: db}
+	appointments := AppointmentModel{DB: db}
+
+	request := insertFutureRequest(t, m)
+	appointmentID, err := m.Confirm(request.RequestID, &Appointment{CreatorID: 1, TargetID: 2, Title: request.Title, StartTime: request.StartTime, EndTime: request.EndTime}, []int{1})
+	assert.NilError(t, err)
+
+	claimed, err := ops.ClaimDue(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(claimed), 1)
+	assert.Equal(t, claimed[0].Status, OperationProcessing)
+	assert.Equal(t, claimed[0].Attempts, 1)
+
+	err = ops.CompleteCreate(claimed[0], "google-event")
+	assert.NilError(t, err)
+
+	appointment, err := appointments.Get(appointmentID)
+	assert.NilError(t, err)
+	assert.Equal(t, appointment.Status, AppointmentConfirmed)
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM appointment_events WHERE appointment_id = $1", appointmentID).Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+}
+
+func TestProviderOperationModelSkip(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+	ops := ProviderOperationModel{DB: db}
+	appointments := AppointmentModel{DB: db}
+
+	request := insertFutureRequest(t, m)
+	appointmentID, err := m.Confirm(request.RequestID, &Appointment{CreatorID: 1, TargetID: 2, Title: request.Title, StartTime: request.StartTime, EndTime: request.EndTime}, []int{1})
+	assert.NilError(t, err)
+
+	claimed, err := ops.ClaimDue(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(claimed), 1)
+
+	// The appointment goes ahead without the event.
+	err = ops.Skip(claimed[0], "google account is no longer linked")
+	assert.NilError(t, err)
+
+	appointment, err := appointments.Get(appointmentID)
+	assert.NilError(t, err)
+	assert.Equal(t, appointment.Status, AppointmentConfirmed)
+
+	request, err = m.Get(request.RequestID)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Status, RequestStatusAccepted)
+}
+
+func TestProviderOperationModelCompensate(t *testing.T) {
+	db := newTestDB(t)
+	ops := ProviderOperationModel{DB: db}
+	appointments := AppointmentModel{DB: db}
+
+	requests := AppointmentRequestModel{DB: db}
+
+	// Appointment 1 has two events in the seed data. Say it came from the
+	// accepted request 2.
+	_, err := db.Exec("UPDATE appointment_requests SET appointment_id = 1 WHERE request_id = 2")
+	assert.NilError(t, err)
+
+	requestID, err := ops.Compensate(1)
+	assert.NilError(t, err)
+	assert.Equal(t, requestID, 2)
+
+	request, err := requests.Get(2)
+	assert.NilError(t, err)
+	assert.Equal(t, request.Status, RequestStatusDeclined)
+
+	appointment, err := appointments.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, appointment.Status, AppointmentFailed)
+
+	queued, err := ops.GetForAppointment(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(queued), 2)
+	assert.Equal(t, queued[0].Operation, OperationDeleteEvent)
+	assert.Equal(t, queued[0].ProviderEventID, "event_1")
+
+	// Compensating twice doesn't queue the deletes again, nor tell anyone.
+	requestID, err = ops.Compensate(1)
+	assert.NilError(t, err)
+	assert.Equal(t, requestID, 0)
+
+	queued, err = ops.GetForAppointment(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(queued), 2)
+}
+
+func TestProviderOperationModelRemoveUserEvents(t *testing.T) {
+	db := newTestDB(t)
+	ops := ProviderOperationModel{DB: db}
+	users := UserModel{DB: db}
+
+	// Alice's appointment 1 has an event in her calendar and one in Bob's.
+	claimed, err := ops.RemoveUserEvents(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(claimed), 1)
+	assert.Equal(t, claimed[0].UserID, 1)
+	assert.Equal(t, claimed[0].ProviderEventID, "event_1")
+	assert.Equal(t, claimed[0].Status, OperationProcessing)
+
+	// Bob's delete is left for the worker, and outlives Alice.
+	err = users.Delete(1)
+	assert.NilError(t, err)
+
+	queued, err := ops.GetForAppointment(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(queued), 1)
+	assert.Equal(t, queued[0].UserID, 2)
+	assert.Equal(t, queued[0].Status, OperationPending)
+}
@@ -0,0 +1,337 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of resource that can be booked.
+const (
+	ResourceRoom      = "room"
+	ResourceEquipment = "equipment"
+	ResourceDesk      = "desk"
+)
+
+// ErrResourceUnavailable is returned when booking a resource that is already
+// booked, or closed, at the requested time.
+var ErrResourceUnavailable = errors.New("resource unavailable")
+
+// Resource is something other than a person that can take part in an
+// appointment, like a meeting room or a projector.
+type Resource struct {
+	ID         int
+	Name       string
+	Kind       string
+	Capacity   int
+	Location   string
+	Attributes []string
+	// AvailableFrom and AvailableUntil are the hours of the day (UTC) between
+	// which the resource can be booked.
+	AvailableFrom  int
+	AvailableUntil int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// IsOpen reports whether the resource can be booked for the whole of the
+// time between start and end.
+func (r *Resource) IsOpen(start, end time.Time) bool {
+	if r.AvailableFrom == 0 && r.AvailableUntil == 24 {
+		return true
+	}
+
+	start, end = start.UTC(), end.UTC()
+	dayStart := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	opens := dayStart.Add(time.Duration(r.AvailableFrom) * time.Hour)
+	closes := dayStart.Add(time.Duration(r.AvailableUntil) * time.Hour)
+
+	return !start.Before(opens) && !end.After(closes)
+}
+
+// ClosedEvents returns the times between start and end when the resource
+// can't be booked as events, so they can be shown and checked in the same way
+// as the events from a user's calendar.
+func (r *Resource) ClosedEvents(start, end time.Time) []*Event {
+	events := []*Event{}
+	if r.AvailableFrom == 0 && r.AvailableUntil == 24 {
+		return events
+	}
+
+	start = start.UTC()
+	for d := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC); d.Before(end); d = d.AddDate(0, 0, 1) {
+		if r.AvailableFrom > 0 {
+			events = append(events, &Event{
+				Title:     "Closed",
+				StartTime: d,
+				EndTime:   d.Add(time.Duration(r.AvailableFrom)*time.Hour - time.Minute),
+				Status:    "closed",
+			})
+		}
+		if r.AvailableUntil < 24 {
+			events = append(events, &Event{
+				Title:     "Closed",
+				StartTime: d.Add(time.Duration(r.AvailableUntil) * time.Hour),
+				EndTime:   d.AddDate(0, 0, 1).Add(-time.Minute),
+				Status:    "closed",
+			})
+		}
+	}
+
+	return events
+}
+
+type ResourceModel struct {
+	DB *sql.DB
+}
+
+type ResourceModelInterface interface {
+	Insert(r *Resource) (int, error)
+	Get(id int) (*Resource, error)
+	GetAll() ([]*Resource, error)
+	Update(r *Resource) error
+	Delete(id int) error
+	GetBookings(resourceID int, from, to time.Time) ([]*Event, error)
+}
+
+const resourceColumns = `
+	r.id, r.name, r.kind, r.capacity, r.location, r.attributes,
+	r.available_from, r.available_until, r.created_at, r.updated_at`
+
+func scanResource(row rowScanner, dest ...any) (*Resource, error) {
+	r := &Resource{}
+	dest = append(dest, &r.ID, &r.Name, &r.Kind, &r.Capacity, &r.Location, pq.Array(&r.Attributes), &r.AvailableFrom, &r.AvailableUntil, &r.CreatedAt, &r.UpdatedAt)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (m *ResourceModel) Insert(r *Resource) (int, error) {
+	query := `
+		INSERT INTO resources (name, kind, capacity, location, attributes, available_from, available_until)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+
+	if r.Attributes == nil {
+		r.Attributes = []string{}
+	}
+
+	err := m.DB.QueryRow(query, r.Name, r.Kind, r.Capacity, r.Location, pq.Array(r.Attributes), r.AvailableFrom, r.AvailableUntil).Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.ID, nil
+}
+
+func (m *ResourceModel) Get(id int) (*Resource, error) {
+	query := `
+		SELECT ` + resourceColumns + `
+		FROM resources r
+		WHERE r.id = $1
+	`
+
+	r, err := scanResource(m.DB.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Get all the resources, ordered by name.
+func (m *ResourceModel) GetAll() ([]*Resource, error) {
+	query := `
+		SELECT ` + resourceColumns + `
+		FROM resources r
+		ORDER BY r.name, r.id
+	`
+
+	rows, err := m.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []*Resource{}
+	for rows.Next() {
+		r, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+func (m *ResourceModel) Update(r *Resource) error {
+	query := `
+		UPDATE resources
+		SET name = $2, kind = $3, capacity = $4, location = $5, attributes = $6,
+		available_from = $7, available_until = $8, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	if r.Attributes == nil {
+		r.Attributes = []string{}
+	}
+
+	err := m.DB.QueryRow(query, r.ID, r.Name, r.Kind, r.Capacity, r.Location, pq.Array(r.Attributes), r.AvailableFrom, r.AvailableUntil).Scan(&r.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete the resource. Appointments it was booked for are kept.
+func (m *ResourceModel) Delete(id int) error {
+	result, err := m.DB.Exec("DELETE FROM resources WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetBookings returns the appointments the resource is booked for between
+// from and to as events, so the resource's calendar can be treated like a
+// user's.
+func (m *ResourceModel) GetBookings(resourceID int, from, to time.Time) ([]*Event, error) {
+	query := `
+		SELECT a.id, a.title, a.start_time, a.end_time, a.location, a.status, a.time_zone
+		FROM appointment_resources ar
+		JOIN appointments a ON ar.appointment_id = a.id
+		WHERE ar.resource_id = $1 AND a.status <> $4
+		AND a.start_time < $3 AND a.end_time > $2
+		ORDER BY a.start_time
+	`
+
+	rows, err := m.DB.Query(query, resourceID, from, to, AppointmentFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		e := &Event{}
+		err := rows.Scan(&e.ID, &e.Title, &e.StartTime, &e.EndTime, &e.Location, &e.Status, &e.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// bookResources books the resources for an appointment inside the
+// transaction creating it. The resources are locked first, so two
+// appointments being confirmed at the same time can't both get the same
+// resource.
+func bookResources(tx *sql.Tx, appointmentID int, resourceIDs []int, start, end time.Time) error {
+	for _, resourceID := range resourceIDs {
+		r, err := scanResource(tx.QueryRow(`
+			SELECT `+resourceColumns+`
+			FROM resources r
+			WHERE r.id = $1
+			FOR UPDATE
+		`, resourceID))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrResourceUnavailable
+			}
+			return err
+		}
+
+		if !r.IsOpen(start, end) {
+			return ErrResourceUnavailable
+		}
+
+		var booked bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT true FROM appointment_resources ar
+				JOIN appointments a ON ar.appointment_id = a.id
+				WHERE ar.resource_id = $1 AND a.id <> $2 AND a.status <> $5
+				AND a.start_time < $4 AND a.end_time > $3
+			)
+		`, resourceID, appointmentID, start, end, AppointmentFailed).Scan(&booked)
+		if err != nil {
+			return err
+		}
+		if booked {
+			return ErrResourceUnavailable
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO appointment_resources (appointment_id, resource_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, appointmentID, resourceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resourcesByOwner runs a query selecting an owner ID, like the ID of an
+// appointment, followed by the resource columns for each of the IDs, and
+// groups the resources by owner.
+func resourcesByOwner(db *sql.DB, query string, ids []int64) (map[int][]*Resource, error) {
+	byOwner := map[int][]*Resource{}
+	if len(ids) == 0 {
+		return byOwner, nil
+	}
+
+	rows, err := db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ownerID int
+		r, err := scanResource(rows, &ownerID)
+		if err != nil {
+			return nil, err
+		}
+		byOwner[ownerID] = append(byOwner[ownerID], r)
+	}
+
+	return byOwner, rows.Err()
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestResourceIsOpen(t *testing.T) {
+	room := &Resource{AvailableFrom: 8, AvailableUntil: 18}
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		want  bool
+	}{
+		{
+			name:  "During opening hours",
+			start: day.Add(9 * time.Hour),
+			end:   day.Add(10 * time.Hour),
+			want:  true,
+		},
+		{
+			name:  "Whole day",
+			start: day.Add(8 * time.Hour),
+			end:   day.Add(18 * time.Hour),
+			want:  true,
+		},
+		{
+			name:  "Starts too early",
+			start: day.Add(7 * time.Hour),
+			end:   day.Add(9 * time.Hour),
+			want:  false,
+		},
+		{
+			name:  "Ends too late",
+			start: day.Add(17 * time.Hour),
+			end:   day.Add(19 * time.Hour),
+			want:  false,
+		},
+		{
+			name:  "Overnight",
+			start: day.Add(17 * time.Hour),
+			end:   day.Add(33 * time.Hour),
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, room.IsOpen(tt.start, tt.end), tt.want)
+		})
+	}
+
+	alwaysOpen := &Resource{AvailableFrom: 0, AvailableUntil: 24}
+	assert.Equal(t, alwaysOpen.IsOpen(day.Add(22*time.Hour), day.Add(26*time.Hour)), true)
+	assert.Equal(t, len(alwaysOpen.ClosedEvents(day, day.AddDate(0, 0, 2))), 0)
+	assert.Equal(t, len(room.ClosedEvents(day, day.AddDate(0, 0, 2))), 4)
+}
+
+func TestResourceModelInsert(t *testing.T) {
+	db := newTestDB(t)
+	m := ResourceModel{DB: db}
+
+	r := &Resource{
+		Name:           "Desk 4",
+		Kind:           ResourceDesk,
+		Capacity:       1,
+		Attributes:     []string{"monitor"},
+		AvailableFrom:  7,
+		AvailableUntil: 19,
+	}
+
+	id, err := m.Insert(r)
+	assert.NilError(t, err)
+	assert.Greater(t, id, 2)
+
+	got, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Name, "Desk 4")
+	assert.Equal(t, len(got.Attributes), 1)
+	assert.Equal(t, got.AvailableUntil, 19)
+
+	got.Capacity = 2
+	err = m.Update(got)
+	assert.NilError(t, err)
+
+	got, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Capacity, 2)
+
+	err = m.Delete(id)
+	assert.NilError(t, err)
+
+	_, err = m.Get(id)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestResourceModelGetBookings(t *testing.T) {
+	db := newTestDB(t)
+	m := ResourceModel{DB: db}
+
+	from := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	bookings, err := m.GetBookings(1, from, from.AddDate(0, 0, 1))
+	assert.NilError(t, err)
+	assert.Equal(t, len(bookings), 1)
+	assert.Equal(t, bookings[0].Title, "Appointment 1")
+
+	bookings, err = m.GetBookings(2, from, from.AddDate(0, 0, 1))
+	assert.NilError(t, err)
+	assert.Equal(t, len(bookings), 0)
+}
+
+func TestAppointmentRequestModelConfirmBooksResources(t *testing.T) {
+	db := newTestDB(t)
+	m := AppointmentRequestModel{DB: db}
+	appointments := AppointmentModel{DB: db}
+
+	// Two requests for the projector at the same time.
+	first := insertFutureRequest(t, m)
+	second := insertFutureRequest(t, m)
+	for _, request := range []*AppointmentRequest{first, second} {
+		_, err := db.Exec("INSERT INTO appointment_request_resources (request_id, resource_id) VALUES ($1, 2)", request.RequestID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newAppointment := func(r *AppointmentRequest) *Appointment {
+		return &Appointment{
+			CreatorID:       1,
+			TargetID:        2,
+			Title:           r.Title,
+			StartTime:       r.StartTime,
+			EndTime:         r.EndTime,
+			AppointmentType: "individual",
+		}
+	}
+
+	appointmentID, err := m.Confirm(first.RequestID, newAppointment(first), []int{1, 2})
+	assert.NilError(t, err)
+
+	a, err := appointments.Get(appointmentID)
+	assert.NilError(t, err)
+	assert.Equal(t, len(a.Resources), 1)
+	assert.Equal(t, a.Resources[0].Name, "Projector")
+
+	// The second one can't be confirmed, and is left untouched.
+	_, err = m.Confirm(second.RequestID, newAppointment(second), []int{1, 2})
+	assert.Equal(t, err, ErrResourceUnavailable)
+
+	second, err = m.Get(second.RequestID)
+	assert.NilError(t, err)
+	assert.Equal(t, second.Status, RequestStatusPending)
+	assert.Equal(t, len(second.Resources), 1)
+}
@@ -11,10 +11,10 @@ INSERT INTO groups (id, name, description, created_at, updated_at) VALUES
 (2, 'Group 2', 'Description for Group 2', '2023-06-01 14:00:00', '2023-06-01 14:00:00');
 
 -- Seed data for user_groups
-INSERT INTO user_groups (user_id, group_id) VALUES
-(1, 1),
-(2, 1),
-(1, 2);
+INSERT INTO user_groups (user_id, group_id, role) VALUES
+(1, 1, 'owner'),
+(2, 1, 'member'),
+(1, 2, 'owner');
 
 INSERT INTO auth_tokens (user_id, auth_provider, access_token, refresh_token, token_type, expiry, scope) VALUES
 (1, 'google', 'access-token-1', 'refresh-token-1', 'Bearer', NOW() + INTERVAL '1 hour', 'scope-1');
@@ -30,17 +30,32 @@ INSERT INTO appointment_requests (request_id, requester_id, target_user_id, titl
 (1, 1, 2, 'Request 1', 'Description 1', '2023-06-01 12:00:00', '2023-06-01 13:00:00', 'Location 1', 'pending', '2023-06-01 10:00:00', '2023-06-01 10:00:00', 'UTC'),
 (2, 1, 2, 'Request 2', 'Description 2', '2023-06-02 14:00:00', '2023-06-02 15:00:00', 'Location 2', 'accepted', '2023-06-02 10:00:00', '2023-06-02 10:00:00', 'UTC');
 
+-- Seed data for appointment_request_participants
+INSERT INTO appointment_request_participants (id, request_id, user_id, required, status) VALUES
+(1, 1, 2, true, 'pending'),
+(2, 2, 2, true, 'accepted');
+
 -- Seed data for appointment_events
 INSERT INTO appointment_events (id, appointment_id, user_id, provider_name, provider_event_id) VALUES
 (1, 1, 1, 'google', 'event_1'),
 (2, 1, 2, 'outlook', 'event_2');
 
+-- Seed data for resources
+INSERT INTO resources (id, name, kind, capacity, location, attributes, available_from, available_until) VALUES
+(1, 'Room 1', 'room', 4, 'Floor 1', '{projector}', 8, 18),
+(2, 'Projector', 'equipment', 1, 'Floor 1', '{}', 0, 24);
+
+INSERT INTO appointment_resources (appointment_id, resource_id) VALUES
+(1, 1);
+
 -- Adjust the sequences for all my tables
 SELECT setval('users_id_seq', (SELECT MAX(id) FROM users) + 1);
 SELECT setval('groups_id_seq', (SELECT MAX(id) FROM groups) + 1);
 SELECT setval('user_groups_id_seq', (SELECT MAX(id) FROM user_groups) + 1);
 SELECT setval('appointments_id_seq', (SELECT MAX(id) FROM appointments) + 1);
 SELECT setval('appointment_requests_request_id_seq', (SELECT MAX(request_id) FROM appointment_requests) + 1);
+SELECT setval('appointment_request_participants_id_seq', (SELECT MAX(id) FROM appointment_request_participants) + 1);
 SELECT setval('appointment_events_id_seq', (SELECT MAX(id) FROM appointment_events) + 1);
+SELECT setval('resources_id_seq', (SELECT MAX(id) FROM resources) + 1);
 
 
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Scopes of the one-time tokens emailed to users.
+const (
+	TokenScopeActivation    = "activation"
+	TokenScopePasswordReset = "password-reset"
+)
+
+// Token is a one-time token emailed to a user. Plaintext is only set when
+// the token is created; after that only its hash is known.
+type Token struct {
+	Plaintext string
+	UserID    int
+	Scope     string
+	Expiry    time.Time
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+type TokenModelInterface interface {
+	New(userID int, scope string, ttl time.Duration) (*Token, error)
+	Use(scope, plaintext string) (int, error)
+	DeleteAllForUser(scope string, userID int) error
+}
+
+// New creates a token with the scope for the user, which expires after ttl.
+func (m *TokenModel) New(userID int, scope string, ttl time.Duration) (*Token, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{
+		Plaintext: secret,
+		UserID:    userID,
+		Scope:     scope,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	query := `INSERT INTO tokens (hash, user_id, scope, expiry) VALUES ($1, $2, $3, $4)`
+
+	_, err = m.DB.Exec(query, hashSecret(token.Plaintext), userID, scope, token.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Use deletes the token, so it can't be used again, and returns the ID of
+// its user. It returns ErrRecordNotFound if there's no such token with the
+// scope or it has expired.
+func (m *TokenModel) Use(scope, plaintext string) (int, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > NOW()
+		RETURNING user_id
+	`
+
+	var userID int
+	err := m.DB.QueryRow(query, hashSecret(plaintext), scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// DeleteAllForUser deletes the user's tokens with the scope, e.g. once a new
+// one has been sent or they're no longer needed.
+func (m *TokenModel) DeleteAllForUser(scope string, userID int) error {
+	_, err := m.DB.Exec(`DELETE FROM tokens WHERE scope = $1 AND user_id = $2`, scope, userID)
+	return err
+}
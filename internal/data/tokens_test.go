@@ -0,0 +1,53 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestTokenModelUse(t *testing.T) {
+	db := newTestDB(t)
+	m := TokenModel{DB: db}
+
+	token, err := m.New(2, TokenScopeActivation, time.Hour)
+	assert.NilError(t, err)
+
+	// Only the hash should be stored.
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM tokens WHERE hash = $1", hashSecret(token.Plaintext)).Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+
+	_, err = m.Use("other", token.Plaintext)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	userID, err := m.Use(TokenScopeActivation, token.Plaintext)
+	assert.NilError(t, err)
+	assert.Equal(t, userID, 2)
+
+	// A token can only be used once.
+	_, err = m.Use(TokenScopeActivation, token.Plaintext)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	expired, err := m.New(2, TokenScopeActivation, -time.Minute)
+	assert.NilError(t, err)
+
+	_, err = m.Use(TokenScopeActivation, expired.Plaintext)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestTokenModelDeleteAllForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := TokenModel{DB: db}
+
+	token, err := m.New(2, TokenScopeActivation, time.Hour)
+	assert.NilError(t, err)
+
+	err = m.DeleteAllForUser(TokenScopeActivation, 2)
+	assert.NilError(t, err)
+
+	_, err = m.Use(TokenScopeActivation, token.Plaintext)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
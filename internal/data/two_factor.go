@@ -0,0 +1,249 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is how many recovery codes a user is given at a time.
+const RecoveryCodeCount = 10
+
+// TwoFactor is a user's TOTP authenticator. It's only used at login once
+// ConfirmedAt is set, i.e. the user has shown their app has the secret.
+type TwoFactor struct {
+	UserID      int
+	Secret      string
+	ConfirmedAt time.Time // zero until confirmed
+	LastCounter int64
+	CreatedAt   time.Time
+}
+
+// Enabled reports whether the user has to enter a code at login.
+func (tf *TwoFactor) Enabled() bool {
+	return !tf.ConfirmedAt.IsZero()
+}
+
+// normalizeRecoveryCode strips what people tend to type differently, so
+// "ABCDE-FGHIJ" and "abcde fghij" are the same code.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// generateRecoveryCode returns a new random code, like "abcde-fghij".
+func generateRecoveryCode() (string, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	return secret[:5] + "-" + secret[5:10], nil
+}
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+type TwoFactorModelInterface interface {
+	Get(userID int) (*TwoFactor, error)
+	Begin(userID int, secret string) error
+	Confirm(userID int, counter int64) error
+	UseCounter(userID int, counter int64) error
+	Disable(userID int) error
+	NewRecoveryCodes(userID int) ([]string, error)
+	UseRecoveryCode(userID int, code string) error
+	CountRecoveryCodes(userID int) (int, error)
+}
+
+func (m *TwoFactorModel) Get(userID int) (*TwoFactor, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_counter, created_at
+		FROM user_totp
+		WHERE user_id = $1
+	`
+
+	tf := &TwoFactor{}
+	var confirmedAt sql.NullTime
+
+	err := m.DB.QueryRow(query, userID).Scan(&tf.UserID, &tf.Secret, &confirmedAt, &tf.LastCounter, &tf.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	tf.ConfirmedAt = confirmedAt.Time
+
+	return tf, nil
+}
+
+// Begin starts setting up an authenticator with the secret, replacing one
+// that was never confirmed. It returns ErrEditConflict if the user already
+// has a confirmed one.
+func (m *TwoFactorModel) Begin(userID int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_counter = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL
+	`
+
+	result, err := m.DB.Exec(query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Confirm turns on the authenticator once the user has entered the code for
+// the period counter.
+func (m *TwoFactorModel) Confirm(userID int, counter int64) error {
+	query := `
+		UPDATE user_totp
+		SET confirmed_at = NOW(), last_counter = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+
+	result, err := m.DB.Exec(query, userID, counter)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// UseCounter records that the code for the period counter has been used.
+// It returns ErrRecordNotFound if that code, or a later one, already has.
+func (m *TwoFactorModel) UseCounter(userID int, counter int64) error {
+	query := `
+		UPDATE user_totp
+		SET last_counter = $2
+		WHERE user_id = $1 AND last_counter < $2
+	`
+
+	result, err := m.DB.Exec(query, userID, counter)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Disable removes the user's authenticator and recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NewRecoveryCodes replaces the user's recovery codes with new ones. The
+// returned codes are the only place their plaintext can be read.
+func (m *TwoFactorModel) NewRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hashSecret(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+}
+
+// UseRecoveryCode marks one of the user's recovery codes as used. It returns
+// ErrRecordNotFound if there's no such code or it has been used already.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+	`
+
+	result, err := m.DB.Exec(query, userID, hashSecret(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CountRecoveryCodes returns how many of the user's recovery codes are left.
+func (m *TwoFactorModel) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := m.DB.QueryRow(`SELECT count(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestTwoFactorModelConfirm(t *testing.T) {
+	db := newTestDB(t)
+	m := TwoFactorModel{DB: db}
+
+	_, err := m.Get(1)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	err = m.Begin(1, "JBSWY3DPEHPK3PXP")
+	assert.NilError(t, err)
+
+	tf, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, tf.Secret, "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, tf.Enabled(), false)
+
+	// Starting again before confirming replaces the secret.
+	err = m.Begin(1, "KRSXG5CTMVRXEZLU")
+	assert.NilError(t, err)
+
+	err = m.Confirm(1, 100)
+	assert.NilError(t, err)
+
+	tf, err = m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, tf.Secret, "KRSXG5CTMVRXEZLU")
+	assert.Equal(t, tf.Enabled(), true)
+
+	err = m.Begin(1, "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, err, ErrEditConflict)
+
+	// A code can't be used again, nor one from before it.
+	err = m.UseCounter(1, 100)
+	assert.Equal(t, err, ErrRecordNotFound)
+	err = m.UseCounter(1, 101)
+	assert.NilError(t, err)
+
+	err = m.Disable(1)
+	assert.NilError(t, err)
+
+	_, err = m.Get(1)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestTwoFactorModelRecoveryCodes(t *testing.T) {
+	db := newTestDB(t)
+	m := TwoFactorModel{DB: db}
+
+	codes, err := m.NewRecoveryCodes(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(codes), RecoveryCodeCount)
+
+	err = m.UseRecoveryCode(1, strings.ToUpper(codes[0]))
+	assert.NilError(t, err)
+
+	err = m.UseRecoveryCode(1, codes[0])
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	err = m.UseRecoveryCode(2, codes[1])
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	count, err := m.CountRecoveryCodes(1)
+	assert.NilError(t, err)
+	assert.Equal(t, count, RecoveryCodeCount-1)
+
+	// New codes replace the old ones.
+	_, err = m.NewRecoveryCodes(1)
+	assert.NilError(t, err)
+
+	err = m.UseRecoveryCode(1, codes[1])
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	assert.Equal(t, normalizeRecoveryCode("ABCDE-FGHIJ"), "abcdefghij")
+	assert.Equal(t, normalizeRecoveryCode(" abcde fghij "), "abcdefghij")
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserSession is where and when a user logged in. The session itself is
+// kept by the session manager, and holds the ID of this record.
+type UserSession struct {
+	ID         int
+	UserID     int
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// maxUserAgent is how much of a user agent is kept.
+const maxUserAgent = 512
+
+// touchInterval is how often the last seen time of a session is updated, so
+// not every request writes to the database.
+const touchInterval = time.Minute
+
+type UserSessionModel struct {
+	DB *sql.DB
+}
+
+type UserSessionModelInterface interface {
+	Insert(s *UserSession) error
+	Touch(id, userID int) (bool, error)
+	GetAllForUser(userID int) ([]*UserSession, error)
+	Delete(id, userID int) error
+	DeleteAllForUser(userID, exceptID int) error
+}
+
+// Insert records a login. The user's sessions that have expired are cleared
+// out at the same time.
+func (m *UserSessionModel) Insert(s *UserSession) error {
+	if len(s.UserAgent) > maxUserAgent {
+		s.UserAgent = s.UserAgent[:maxUserAgent]
+	}
+
+	_, err := m.DB.Exec(`DELETE FROM user_sessions WHERE user_id = $1 AND expires_at < NOW()`, s.UserID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_sessions (user_id, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_seen_at
+	`
+
+	return m.DB.QueryRow(query, s.UserID, s.IP, s.UserAgent, s.ExpiresAt).Scan(&s.ID, &s.CreatedAt, &s.LastSeenAt)
+}
+
+// Touch reports whether the user's session is still active, and notes that
+// it has been seen.
+func (m *UserSessionModel) Touch(id, userID int) (bool, error) {
+	query := `
+		WITH s AS (
+			SELECT id FROM user_sessions WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+		), touched AS (
+			UPDATE user_sessions SET last_seen_at = NOW()
+			WHERE id IN (SELECT id FROM s) AND last_seen_at < NOW() - $3 * INTERVAL '1 second'
+		)
+		SELECT EXISTS (SELECT true FROM s)
+	`
+
+	var active bool
+	err := m.DB.QueryRow(query, id, userID, touchInterval.Seconds()).Scan(&active)
+	return active, err
+}
+
+// GetAllForUser returns the user's active sessions, most recently seen
+// first.
+func (m *UserSessionModel) GetAllForUser(userID int) ([]*UserSession, error) {
+	query := `
+		SELECT id, user_id, ip, user_agent, created_at, last_seen_at, expires_at
+		FROM user_sessions
+		WHERE user_id = $1 AND expires_at > NOW()
+		ORDER BY last_seen_at DESC, id DESC
+	`
+
+	rows, err := m.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*UserSession{}
+
+	for rows.Next() {
+		s := &UserSession{}
+
+		err := rows.Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Delete ends one of the user's sessions. It returns ErrRecordNotFound if
+// the user has no such session.
+func (m *UserSessionModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM user_sessions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser ends every session of the user but the one with
+// exceptID, which can be 0 to end them all.
+func (m *UserSessionModel) DeleteAllForUser(userID, exceptID int) error {
+	_, err := m.DB.Exec(`DELETE FROM user_sessions WHERE user_id = $1 AND id <> $2`, userID, exceptID)
+	return err
+}
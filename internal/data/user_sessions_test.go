@@ -0,0 +1,82 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestUserSessionModel(t *testing.T) {
+	db := newTestDB(t)
+	m := UserSessionModel{DB: db}
+
+	laptop := &UserSession{UserID: 1, IP: "192.0.2.1", UserAgent: "Firefox", ExpiresAt: time.Now().Add(time.Hour)}
+	err := m.Insert(laptop)
+	assert.NilError(t, err)
+	assert.Greater(t, laptop.ID, 0)
+
+	phone := &UserSession{UserID: 1, IP: "192.0.2.2", UserAgent: "Safari", ExpiresAt: time.Now().Add(time.Hour)}
+	err = m.Insert(phone)
+	assert.NilError(t, err)
+
+	expired := &UserSession{UserID: 1, IP: "192.0.2.3", UserAgent: "Chrome", ExpiresAt: time.Now().Add(-time.Hour)}
+	err = m.Insert(expired)
+	assert.NilError(t, err)
+
+	active, err := m.Touch(laptop.ID, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, active, true)
+
+	// Sessions only belong to their own user.
+	active, err = m.Touch(laptop.ID, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, active, false)
+
+	active, err = m.Touch(expired.ID, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, active, false)
+
+	sessions, err := m.GetAllForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(sessions), 2)
+
+	err = m.Delete(phone.ID, 2)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	err = m.Delete(phone.ID, 1)
+	assert.NilError(t, err)
+
+	active, err = m.Touch(phone.ID, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, active, false)
+}
+
+func TestUserSessionModelDeleteAllForUser(t *testing.T) {
+	db := newTestDB(t)
+	m := UserSessionModel{DB: db}
+
+	var sessions []*UserSession
+	for _, userID := range []int{1, 1, 2} {
+		s := &UserSession{UserID: userID, IP: "192.0.2.1", UserAgent: "Firefox", ExpiresAt: time.Now().Add(time.Hour)}
+		err := m.Insert(s)
+		assert.NilError(t, err)
+		sessions = append(sessions, s)
+	}
+
+	err := m.DeleteAllForUser(1, sessions[0].ID)
+	assert.NilError(t, err)
+
+	for i, want := range []bool{true, false, true} {
+		active, err := m.Touch(sessions[i].ID, sessions[i].UserID)
+		assert.NilError(t, err)
+		assert.Equal(t, active, want)
+	}
+
+	err = m.DeleteAllForUser(1, 0)
+	assert.NilError(t, err)
+
+	active, err := m.Touch(sessions[0].ID, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, active, false)
+}
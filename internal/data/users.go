@@ -7,6 +7,7 @@ import (
 
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,12 +16,23 @@ type UserModel struct {
 }
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, email, password string) (int, error)
+	Activate(id int) error
+	UpdatePassword(id int, password string) error
+	ResetPassword(tokenPlaintext, password string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (*User, error)
-	SearchUsers(query string) ([]*User, error)
+	SearchUsers(viewerID int, query string) ([]*User, error)
+	GetAll(viewerID int, query string, filters Filters) ([]*User, Metadata, error)
+	Reachable(viewerID, userID int) (bool, error)
+	Reachers(userID int, viewerIDs []int) ([]int, error)
+	GetAllForAdmin(query string, filters Filters) ([]*User, Metadata, error)
+	SetDisabled(id int, disabled bool) error
+	GrantAdmin(email string) error
 	GetByEmail(email string) (*User, error)
+	GetCounterparts(id int) ([]*User, error)
+	Delete(id int) error
 }
 
 type User struct {
@@ -29,18 +41,52 @@ type User struct {
 	Email        string
 	PasswordHash []byte
 	Created      time.Time
+	IsAdmin      bool
+	// Activated is set once the user has confirmed their email address.
+	Activated bool
+	// OrganisationID is the organisation the user is in, or 0 if none.
+	OrganisationID   int
+	OrganisationRole string
+	// Disabled users can't log in.
+	Disabled bool
+	// PasswordSet is false for users who signed up with a provider and
+	// haven't chosen a password since.
+	PasswordSet bool
+	// LinkedProviders are the calendar providers the user has linked. Only
+	// GetAllForAdmin fills them in.
+	LinkedProviders []string
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
+// reachable is an SQL condition that holds when the user with the ID viewer
+// may find and send requests to the user with the ID other: when they're in
+// the same organisation, or neither is in one, or other's organisation
+// shares with viewer's. Both are SQL expressions, such as parameters or
+// columns of the enclosing query.
+func reachable(viewer, other string) string {
+	return `EXISTS (
+		SELECT 1 FROM users rv, users ro
+		WHERE rv.id = ` + viewer + ` AND ro.id = ` + other + `
+		AND (rv.organisation_id IS NOT DISTINCT FROM ro.organisation_id
+			OR EXISTS (
+				SELECT 1 FROM organisation_shares os
+				WHERE os.organisation_id = ro.organisation_id AND os.shared_with_id = rv.organisation_id
+			))
+	)`
+}
+
+// Insert adds a user, who isn't activated until they confirm their email
+// address, and returns their ID.
+func (m *UserModel) Insert(name, email, password string) (int, error) {
 	// Create a bcrypt hash of the plain text password.
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	query := `
 		INSERT INTO users (name, email, password_hash, activated)
 		VALUES($1, $2, $3, $4)
+		RETURNING id
 	`
 
 	args := []any{name, email, passwordHash, false}
@@ -48,31 +94,123 @@ func (m *UserModel) Insert(name, email, password string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err = m.DB.ExecContext(ctx, query, args...)
+	var id int
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&id)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
+			return 0, ErrDuplicateEmail
 		default:
-			return err
+			return 0, err
 		}
 	}
 
+	return id, nil
+}
+
+// Activate marks the user's email address as confirmed.
+func (m *UserModel) Activate(id int) error {
+	query := "UPDATE users SET activated = true, version = version + 1 WHERE id = $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
 }
 
+// UpdatePassword replaces the user's password.
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE users SET password_hash = $1, password_set = true, version = version + 1 WHERE id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, passwordHash, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a password reset
+// email, and returns the ID of its user. The token is used up in the same
+// transaction, so it's only gone once the password has changed. It returns
+// ErrRecordNotFound if there's no such token or it has expired.
+func (m *UserModel) ResetPassword(tokenPlaintext, password string) (int, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > NOW()
+		RETURNING user_id
+	`
+
+	var userID int
+	err = tx.QueryRow(query, hashSecret(tokenPlaintext), TokenScopePasswordReset).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE users SET password_hash = $1, password_set = true, version = version + 1 WHERE id = $2", passwordHash, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	// Retrieve the id and hashed password associated with the given email. If
 	// no matching email exists we return the ErrInvalidCredentials error.
 	var id int
 	var passwordHash []byte
+	var disabled bool
 
-	query := "SELECT id, password_hash FROM users WHERE email = $1"
+	query := "SELECT id, password_hash, disabled FROM users WHERE email = $1"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(&id, &passwordHash)
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&id, &passwordHash, &disabled)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -90,7 +228,12 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 			return 0, err
 		}
 	}
-	// Otherwise, the password is correct. Return the user ID.
+	// The password is correct, but disabled users still can't log in. This is
+	// only checked now so it doesn't give away which accounts exist.
+	if disabled {
+		return 0, ErrUserDisabled
+	}
+	// Otherwise, return the user ID.
 	return id, nil
 }
 
@@ -108,12 +251,12 @@ func (m *UserModel) Exists(id int) (bool, error) {
 func (m *UserModel) Get(id int) (*User, error) {
 	user := &User{}
 
-	query := "SELECT id, name, email, created_at FROM users WHERE id = $1"
+	query := "SELECT id, name, email, created_at, is_admin, activated, COALESCE(organisation_id, 0), organisation_role, disabled, password_set FROM users WHERE id = $1"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.IsAdmin, &user.Activated, &user.OrganisationID, &user.OrganisationRole, &user.Disabled, &user.PasswordSet)
 	if err != nil {
 		return nil, err
 	}
@@ -121,14 +264,17 @@ func (m *UserModel) Get(id int) (*User, error) {
 	return user, nil
 }
 
-func (m *UserModel) SearchUsers(query string) ([]*User, error) {
+// SearchUsers returns the activated users the viewer can reach whose name or
+// email contains the query. Users who haven't confirmed their email can't be
+// found, so nobody can pose as someone else to receive their requests.
+func (m *UserModel) SearchUsers(viewerID int, query string) ([]*User, error) {
 	query = "%" + query + "%"
 	stmt := `
-        SELECT id, name, email
-        FROM users
-        WHERE email ILIKE $1 OR name ILIKE $1
-    `
-	rows, err := m.DB.Query(stmt, query)
+        SELECT u.id, u.name, u.email
+        FROM users u
+        WHERE u.activated AND (u.email ILIKE $1 OR u.name ILIKE $1)
+        AND ` + reachable("$2", "u.id")
+	rows, err := m.DB.Query(stmt, query, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -151,19 +297,244 @@ func (m *UserModel) SearchUsers(query string) ([]*User, error) {
 	return users, nil
 }
 
+// Get one page of the activated users the viewer can reach whose name or
+// email contains the query, ordered by name, along with the pagination
+// metadata.
+func (m *UserModel) GetAll(viewerID int, query string, filters Filters) ([]*User, Metadata, error) {
+	stmt := `
+		SELECT count(*) OVER(), u.id, u.name, u.email, u.created_at
+		FROM users u
+		WHERE u.activated AND (u.email ILIKE $1 OR u.name ILIKE $1)
+		AND ` + reachable("$4", "u.id") + `
+		ORDER BY u.name, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := m.DB.Query(stmt, "%"+query+"%", filters.limit(), filters.offset(), viewerID)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err := rows.Scan(&totalRecords, &u.ID, &u.Name, &u.Email, &u.Created)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// GetAllForAdmin returns a page of every user whose name or email address
+// matches the query, activated or not, with the calendar providers they've
+// linked.
+func (m *UserModel) GetAllForAdmin(query string, filters Filters) ([]*User, Metadata, error) {
+	stmt := `
+		SELECT count(*) OVER(), u.id, u.name, u.email, u.created_at, u.is_admin, u.activated, u.disabled,
+			ARRAY(SELECT t.auth_provider FROM auth_tokens t WHERE t.user_id = u.id ORDER BY t.auth_provider)
+		FROM users u
+		WHERE u.email ILIKE $1 OR u.name ILIKE $1
+		ORDER BY u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := m.DB.Query(stmt, "%"+query+"%", filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err := rows.Scan(&totalRecords, &u.ID, &u.Name, &u.Email, &u.Created, &u.IsAdmin, &u.Activated, &u.Disabled, pq.Array(&u.LinkedProviders))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// SetDisabled disables or enables the user.
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	return expectOneRow(m.DB.Exec("UPDATE users SET disabled = $2 WHERE id = $1", id, disabled))
+}
+
+// GrantAdmin makes the user with the email address an instance admin.
+func (m *UserModel) GrantAdmin(email string) error {
+	return expectOneRow(m.DB.Exec("UPDATE users SET is_admin = true WHERE email = $1", email))
+}
+
+// Reachable reports whether the viewer may find and send requests to the
+// user, as they're in the same organisation or the user's shares with the
+// viewer's.
+func (m *UserModel) Reachable(viewerID, userID int) (bool, error) {
+	var ok bool
+	err := m.DB.QueryRow("SELECT "+reachable("$1", "$2"), viewerID, userID).Scan(&ok)
+	return ok, err
+}
+
+// Reachers returns those of the viewers who may find the user.
+func (m *UserModel) Reachers(userID int, viewerIDs []int) ([]int, error) {
+	ids := make([]int64, len(viewerIDs))
+	for i, id := range viewerIDs {
+		ids[i] = int64(id)
+	}
+
+	query := "SELECT u.id FROM users u WHERE u.id = ANY($2) AND " + reachable("u.id", "$1") + " ORDER BY u.id"
+
+	rows, err := m.DB.Query(query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reachers := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		reachers = append(reachers, id)
+	}
+
+	return reachers, rows.Err()
+}
+
 // Get user by email.
 func (m *UserModel) GetByEmail(email string) (*User, error) {
 	user := &User{}
 
-	query := "SELECT id, name, email, created_at FROM users WHERE email = $1"
+	query := "SELECT id, name, email, created_at, activated, COALESCE(organisation_id, 0), organisation_role, disabled FROM users WHERE email = $1"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Activated, &user.OrganisationID, &user.OrganisationRole, &user.Disabled)
 	if err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
+
+// GetCounterparts returns the other people in the user's upcoming
+// appointments and pending requests, who lose them if the user goes.
+func (m *UserModel) GetCounterparts(id int) ([]*User, error) {
+	query := `
+		SELECT id, name, email
+		FROM users
+		WHERE id <> $1 AND id IN (
+			SELECT creator_id FROM appointments WHERE target_id = $1 AND end_time > NOW()
+			UNION
+			SELECT target_id FROM appointments WHERE creator_id = $1 AND end_time > NOW()
+			UNION
+			SELECT ug.user_id FROM appointments a
+			JOIN user_groups ug ON ug.group_id = a.group_id
+			WHERE a.creator_id = $1 AND a.end_time > NOW()
+			UNION
+			SELECT requester_id FROM appointment_requests ar
+			JOIN appointment_request_participants p ON p.request_id = ar.request_id
+			WHERE p.user_id = $1 AND ar.status = 'pending'
+			UNION
+			SELECT p.user_id FROM appointment_requests ar
+			JOIN appointment_request_participants p ON p.request_id = ar.request_id
+			WHERE ar.requester_id = $1 AND ar.status = 'pending'
+		)
+		ORDER BY id
+	`
+
+	rows, err := m.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err := rows.Scan(&u.ID, &u.Name, &u.Email)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Delete removes the user and, through the foreign keys, everything of
+// theirs. Their provider events have to be removed first, with
+// ProviderOperationModel.RemoveUserEvents, while their tokens are still here.
+// Groups they own are handed to their longest-standing admin, or failing that
+// member, and deleted if nobody else is in them.
+func (m *UserModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("DELETE FROM user_groups WHERE user_id = $1 AND role = $2 RETURNING group_id", id, GroupRoleOwner)
+	if err != nil {
+		return err
+	}
+
+	var groupIDs []int
+	for rows.Next() {
+		var groupID int
+		if err := rows.Scan(&groupID); err != nil {
+			rows.Close()
+			return err
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, groupID := range groupIDs {
+		err = expectOneRow(tx.Exec(`
+			UPDATE user_groups SET role = $2, updated_at = NOW()
+			WHERE id = (
+				SELECT id FROM user_groups WHERE group_id = $1
+				ORDER BY CASE role WHEN 'admin' THEN 0 ELSE 1 END, id
+				LIMIT 1
+			)
+		`, groupID, GroupRoleOwner))
+		if errors.Is(err, ErrRecordNotFound) {
+			_, err = tx.Exec("DELETE FROM groups WHERE id = $1", groupID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = expectOneRow(tx.Exec("DELETE FROM users WHERE id = $1", id))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/tmgasek/calendar-app/internal/assert"
@@ -77,7 +78,7 @@ func TestUserModelInsert(t *testing.T) {
 			db := newTestDB(t)
 			m := UserModel{db}
 
-			err := m.Insert(tt.userName, tt.email, tt.password)
+			_, err := m.Insert(tt.userName, tt.email, tt.password)
 			assert.Equal(t, err, tt.wantErr)
 		})
 	}
@@ -196,7 +197,7 @@ func TestUserModelSearchUsers(t *testing.T) {
 			db := newTestDB(t)
 			m := UserModel{db}
 
-			users, err := m.SearchUsers(tt.query)
+			users, err := m.SearchUsers(1, tt.query)
 
 			if err != tt.wantErr {
 				t.Errorf("got error %v; want error %v", err, tt.wantErr)
@@ -217,6 +218,82 @@ func TestUserModelSearchUsers(t *testing.T) {
 	}
 }
 
+func TestUserModelActivate(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	id, err := m.Insert("Dave", "dave@example.com", "password123")
+	assert.NilError(t, err)
+
+	user, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Activated, false)
+
+	// Nobody can find the user until they've confirmed their email.
+	users, err := m.SearchUsers(1, "dave")
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 0)
+
+	err = m.Activate(id)
+	assert.NilError(t, err)
+
+	user, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Activated, true)
+
+	users, err = m.SearchUsers(1, "dave")
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 1)
+
+	err = m.Activate(999)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestUserModelUpdatePassword(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	err := m.UpdatePassword(1, "new-password")
+	assert.NilError(t, err)
+
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	id, err := m.Authenticate("alice@example.com", "new-password")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	err = m.UpdatePassword(999, "new-password")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestUserModelResetPassword(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+	tokens := TokenModel{DB: db}
+
+	activation, err := tokens.New(1, TokenScopeActivation, time.Hour)
+	assert.NilError(t, err)
+
+	_, err = m.ResetPassword(activation.Plaintext, "new-password")
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	token, err := tokens.New(1, TokenScopePasswordReset, time.Hour)
+	assert.NilError(t, err)
+
+	id, err := m.ResetPassword(token.Plaintext, "new-password")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	id, err = m.Authenticate("alice@example.com", "new-password")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	// A token can only be used once.
+	_, err = m.ResetPassword(token.Plaintext, "other-password")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
 func TestUserModelGetByEmail(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -259,3 +336,125 @@ func TestUserModelGetByEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelGetCounterparts(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	// Alice's appointments are in the past, but Bob has a pending request
+	// from her.
+	users, err := m.GetCounterparts(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 1)
+	assert.Equal(t, users[0].ID, 2)
+
+	users, err = m.GetCounterparts(3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 0)
+}
+
+func TestUserModelDelete(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	err := m.Delete(1)
+	assert.NilError(t, err)
+
+	exists, err := m.Exists(1)
+	assert.NilError(t, err)
+	assert.Equal(t, exists, false)
+
+	// Everything of hers goes too.
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM appointments WHERE creator_id = 1 OR target_id = 1").Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 0)
+
+	// Bob takes over the group Alice shared with him, and the one she had
+	// to herself goes.
+	var role string
+	err = db.QueryRow("SELECT role FROM user_groups WHERE group_id = 1 AND user_id = 2").Scan(&role)
+	assert.NilError(t, err)
+	assert.Equal(t, role, GroupRoleOwner)
+
+	err = db.QueryRow("SELECT COUNT(*) FROM groups WHERE id = 2").Scan(&count)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 0)
+
+	err = m.Delete(1)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestUserModelSetDisabled(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	err := m.SetDisabled(1, true)
+	assert.NilError(t, err)
+
+	user, err := m.Get(1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Disabled, true)
+
+	user, err = m.GetByEmail("alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, user.Disabled, true)
+
+	// The password is checked first, so it isn't given away whether an
+	// account is disabled.
+	_, err = m.Authenticate("alice@example.com", "invalidpassword")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.Equal(t, err, ErrUserDisabled)
+
+	err = m.SetDisabled(1, false)
+	assert.NilError(t, err)
+
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	err = m.SetDisabled(999, true)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestUserModelGrantAdmin(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	user, err := m.Get(2)
+	assert.NilError(t, err)
+	assert.Equal(t, user.IsAdmin, false)
+
+	err = m.GrantAdmin("bob@example.com")
+	assert.NilError(t, err)
+
+	user, err = m.Get(2)
+	assert.NilError(t, err)
+	assert.Equal(t, user.IsAdmin, true)
+
+	err = m.GrantAdmin("nobody@example.com")
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestUserModelGetAllForAdmin(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	users, metadata, err := m.GetAllForAdmin("", Filters{Page: 1, PageSize: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 2)
+	assert.Equal(t, metadata.TotalRecords, 3)
+	assert.Equal(t, metadata.LastPage, 2)
+
+	users, _, err = m.GetAllForAdmin("alice", Filters{Page: 1, PageSize: 10})
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 1)
+	assert.Equal(t, len(users[0].LinkedProviders), 1)
+	assert.Equal(t, users[0].LinkedProviders[0], "google")
+
+	users, _, err = m.GetAllForAdmin("bob", Filters{Page: 1, PageSize: 10})
+	assert.NilError(t, err)
+	assert.Equal(t, len(users), 1)
+	assert.Equal(t, len(users[0].LinkedProviders), 0)
+}
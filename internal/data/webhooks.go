@@ -0,0 +1,394 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// Events a webhook can be sent.
+const (
+	EventRequestCreated     = "appointment_request.created"
+	EventRequestConfirmed   = "appointment_request.confirmed"
+	EventRequestDeclined    = "appointment_request.declined"
+	EventRequestCancelled   = "appointment_request.cancelled"
+	EventAppointmentDeleted = "appointment.deleted"
+)
+
+// WebhookEvents lists every event, in the order they're shown in.
+var WebhookEvents = []string{
+	EventRequestCreated,
+	EventRequestConfirmed,
+	EventRequestDeclined,
+	EventRequestCancelled,
+	EventAppointmentDeleted,
+}
+
+// Statuses of a webhook delivery. Like provider operations, deliveries are
+// claimed by moving them from pending to processing.
+const (
+	DeliveryPending    = "pending"
+	DeliveryProcessing = "processing"
+	DeliverySucceeded  = "succeeded"
+	DeliveryFailed     = "failed"
+)
+
+// webhookSecretPrefix starts every signing secret, like apiTokenPrefix.
+const webhookSecretPrefix = "whsec_"
+
+type Webhook struct {
+	ID     int
+	UserID int
+	// GroupID is the group whose appointments the webhook is sent, or zero
+	// for the appointments of the user who registered it.
+	GroupID   int
+	URL       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+}
+
+// Wants reports whether the webhook is sent the event.
+func (w *Webhook) Wants(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	ID            int
+	WebhookID     int
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	MaxAttempts   int
+	NextAttemptAt time.Time
+	ResponseCode  int // zero if there was no response
+	ResponseBody  string
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	// URL and Secret are copied from the webhook when a delivery is
+	// claimed, so it can be sent without loading the webhook.
+	URL    string
+	Secret string
+}
+
+// ValidateWebhook checks the address and events of a new webhook.
+func ValidateWebhook(v *validator.Validator, address string, events []string) {
+	v.CheckField(validator.NotBlank(address), "url", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(address, 2000), "url", "This field is too long")
+	if u, err := url.Parse(address); address != "" && (err != nil || u.Scheme != "https" || u.Host == "") {
+		v.AddFieldError("url", "Must be an https URL")
+	}
+	v.CheckField(len(events) > 0, "events", "Choose at least one event")
+	for _, event := range events {
+		v.CheckField(validator.PermittedValue(event, WebhookEvents...), "events", "Invalid event")
+	}
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+type WebhookModelInterface interface {
+	Insert(w *Webhook) (int, error)
+	Get(id int) (*Webhook, error)
+	GetAllForUser(userID int) ([]*Webhook, error)
+	Delete(id int) error
+	Enqueue(event string, payload []byte, userIDs []int, groupID int) (int, error)
+	GetDeliveries(webhookID, limit int) ([]*WebhookDelivery, error)
+	Redeliver(webhookID, deliveryID int) (int, error)
+	ClaimDue(limit int) ([]*WebhookDelivery, error)
+	ReleaseStale(olderThan time.Duration) (int, error)
+	Complete(id, responseCode int, responseBody string) error
+	Retry(id, responseCode int, responseBody, lastError string, nextAttemptAt time.Time) error
+	Fail(id, responseCode int, responseBody, lastError string) error
+}
+
+const webhookColumns = `id, user_id, group_id, url, secret, events, created_at`
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	w := &Webhook{}
+	var groupID sql.NullInt64
+
+	err := row.Scan(&w.ID, &w.UserID, &groupID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	w.GroupID = int(groupID.Int64)
+
+	return w, nil
+}
+
+// Insert registers the webhook, giving it a new signing secret.
+func (m *WebhookModel) Insert(w *Webhook) (int, error) {
+	secret, err := randomSecret()
+	if err != nil {
+		return 0, err
+	}
+	w.Secret = webhookSecretPrefix + secret
+
+	query := `
+		INSERT INTO webhooks (user_id, group_id, url, secret, events)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	groupID := sql.NullInt64{Int64: int64(w.GroupID), Valid: w.GroupID != 0}
+
+	err = m.DB.QueryRow(query, w.UserID, groupID, w.URL, w.Secret, pq.Array(w.Events)).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return w.ID, nil
+}
+
+func (m *WebhookModel) Get(id int) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	w, err := scanWebhook(m.DB.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// GetAllForUser returns the webhooks the user registered and those of the
+// groups they're in.
+func (m *WebhookModel) GetAllForUser(userID int) ([]*Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE user_id = $1 OR group_id IN (SELECT group_id FROM user_groups WHERE user_id = $1)
+		ORDER BY id
+	`
+
+	rows, err := m.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes the webhook along with its delivery log.
+func (m *WebhookModel) Delete(id int) error {
+	result, err := m.DB.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Enqueue queues a delivery of the payload to every webhook that wants the
+// event and belongs to one of the users or to the group. A group's webhooks
+// only get deliveries while whoever added them is still in it. It returns
+// the number of deliveries queued.
+func (m *WebhookModel) Enqueue(event string, payload []byte, userIDs []int, groupID int) (int, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT w.id, $1::text, $2::text
+		FROM webhooks w
+		LEFT JOIN user_groups ug ON ug.group_id = w.group_id AND ug.user_id = w.user_id
+		WHERE $1::text = ANY(w.events)
+		AND ((w.group_id IS NULL AND w.user_id = ANY($3)) OR (w.group_id = $4::int AND ug.id IS NOT NULL))
+	`
+
+	ids := make([]int64, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = int64(id)
+	}
+
+	result, err := m.DB.Exec(query, event, string(payload), pq.Array(ids), groupID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.max_attempts,
+	d.next_attempt_at, d.response_code, d.response_body, d.last_error,
+	d.created_at, d.updated_at, w.url, w.secret`
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		var responseCode sql.NullInt64
+
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.MaxAttempts, &d.NextAttemptAt, &responseCode, &d.ResponseBody, &d.LastError, &d.CreatedAt, &d.UpdatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		d.ResponseCode = int(responseCode.Int64)
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetDeliveries returns the webhook's latest deliveries, newest first.
+func (m *WebhookModel) GetDeliveries(webhookID, limit int) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id
+		WHERE d.webhook_id = $1
+		ORDER BY d.id DESC
+		LIMIT $2
+	`
+
+	rows, err := m.DB.Query(query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWebhookDeliveries(rows)
+}
+
+// Redeliver queues a new delivery of one of the webhook's past payloads,
+// leaving the old delivery in the log as it was.
+func (m *WebhookModel) Redeliver(webhookID, deliveryID int) (int, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT webhook_id, event, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING id
+	`
+
+	var id int
+	err := m.DB.QueryRow(query, deliveryID, webhookID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// ClaimDue moves up to limit pending deliveries that are due to processing
+// and returns them.
+func (m *WebhookModel) ClaimDue(limit int) ([]*WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET status = 'processing', attempts = attempts + 1, updated_at = NOW()
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at, id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT ` + webhookDeliveryColumns + `
+		FROM claimed d
+		JOIN webhooks w ON d.webhook_id = w.id
+		ORDER BY d.id
+	`
+
+	rows, err := m.DB.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWebhookDeliveries(rows)
+}
+
+// ReleaseStale puts deliveries that have been processing for longer than
+// olderThan back in the queue.
+func (m *WebhookModel) ReleaseStale(olderThan time.Duration) (int, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', updated_at = NOW()
+		WHERE status = 'processing' AND updated_at < NOW() - $1 * INTERVAL '1 second'
+	`
+
+	result, err := m.DB.Exec(query, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (m *WebhookModel) Complete(id, responseCode int, responseBody string) error {
+	return m.record(id, DeliverySucceeded, responseCode, responseBody, "", time.Now())
+}
+
+// Retry records a failed attempt and puts the delivery back in the queue.
+func (m *WebhookModel) Retry(id, responseCode int, responseBody, lastError string, nextAttemptAt time.Time) error {
+	return m.record(id, DeliveryPending, responseCode, responseBody, lastError, nextAttemptAt)
+}
+
+func (m *WebhookModel) Fail(id, responseCode int, responseBody, lastError string) error {
+	return m.record(id, DeliveryFailed, responseCode, responseBody, lastError, time.Now())
+}
+
+func (m *WebhookModel) record(id int, status string, responseCode int, responseBody, lastError string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, response_code = $3, response_body = $4, last_error = $5, next_attempt_at = $6, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	code := sql.NullInt64{Int64: int64(responseCode), Valid: responseCode != 0}
+
+	_, err := m.DB.Exec(query, id, status, code, responseBody, lastError, nextAttemptAt)
+	return err
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestWebhookModelDeliveries(t *testing.T) {
+	db := newTestDB(t)
+	m := WebhookModel{DB: db}
+
+	insert := func(w *Webhook) int {
+		w.URL = "https://hooks.example.com"
+		id, err := m.Insert(w)
+		assert.NilError(t, err)
+		assert.StringContains(t, w.Secret, webhookSecretPrefix)
+		return id
+	}
+
+	alice := insert(&Webhook{UserID: 1, Events: []string{EventRequestCreated}})
+	insert(&Webhook{UserID: 2, Events: []string{EventAppointmentDeleted}})
+	insert(&Webhook{UserID: 3, Events: []string{EventRequestCreated}})
+	group := insert(&Webhook{UserID: 2, GroupID: 1, Events: []string{EventRequestCreated}})
+
+	// Only Alice's own webhook wants the event; Bob's doesn't and the
+	// third user isn't involved.
+	n, err := m.Enqueue(EventRequestCreated, []byte(`{"n":1}`), []int{1, 2}, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = m.Enqueue(EventRequestCreated, []byte(`{"n":2}`), []int{2}, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	webhooks, err := m.GetAllForUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(webhooks), 2)
+
+	claimed, err := m.ClaimDue(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(claimed), 2)
+	assert.Equal(t, claimed[0].WebhookID, alice)
+	assert.Equal(t, claimed[0].Attempts, 1)
+	assert.Equal(t, claimed[0].URL, "https://hooks.example.com")
+	assert.Equal(t, claimed[1].WebhookID, group)
+
+	// Claimed deliveries aren't claimed twice.
+	again, err := m.ClaimDue(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(again), 0)
+
+	err = m.Retry(claimed[0].ID, 500, "oops", "unexpected status 500", time.Now().Add(time.Hour))
+	assert.NilError(t, err)
+	err = m.Complete(claimed[1].ID, 200, "ok")
+	assert.NilError(t, err)
+
+	deliveries, err := m.GetDeliveries(alice, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deliveries), 1)
+	assert.Equal(t, deliveries[0].Status, DeliveryPending)
+	assert.Equal(t, deliveries[0].ResponseCode, 500)
+	assert.Equal(t, deliveries[0].LastError, "unexpected status 500")
+
+	// Redelivering queues a copy that is due straight away.
+	id, err := m.Redeliver(alice, claimed[0].ID)
+	assert.NilError(t, err)
+
+	claimed, err = m.ClaimDue(10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(claimed), 1)
+	assert.Equal(t, claimed[0].ID, id)
+	assert.Equal(t, claimed[0].Payload, `{"n":1}`)
+
+	_, err = m.Redeliver(group, deliveries[0].ID)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	err = m.Delete(alice)
+	assert.NilError(t, err)
+
+	deliveries, err = m.GetDeliveries(alice, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deliveries), 0)
+}
+
+func TestWebhookModelEnqueueAfterLeavingGroup(t *testing.T) {
+	db := newTestDB(t)
+	m := WebhookModel{DB: db}
+
+	_, err := m.Insert(&Webhook{UserID: 2, GroupID: 1, URL: "https://hooks.example.com", Events: []string{EventRequestCreated}})
+	assert.NilError(t, err)
+
+	n, err := m.Enqueue(EventRequestCreated, []byte(`{"n":1}`), nil, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	// Once Bob has left the group, its events aren't sent to his webhook.
+	_, err = db.Exec("DELETE FROM user_groups WHERE user_id = 2 AND group_id = 1")
+	assert.NilError(t, err)
+
+	n, err = m.Enqueue(EventRequestCreated, []byte(`{"n":2}`), nil, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+}
@@ -0,0 +1,139 @@
+// Package ical writes calendars in the iCalendar format (RFC 5545), so
+// appointments can be imported into or subscribed to from other calendar
+// apps.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event is one VEVENT in a calendar.
+type Event struct {
+	// UID must stay the same for as long as the event exists, so calendar
+	// apps update their copy instead of adding a new one.
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	Created     time.Time
+	Modified    time.Time
+	// Status is CONFIRMED, TENTATIVE or CANCELLED, or blank if unknown.
+	Status string
+}
+
+// Calendar is a VCALENDAR containing events.
+type Calendar struct {
+	// Name is shown by calendar apps for a subscribed calendar.
+	Name   string
+	Events []Event
+}
+
+const timeFormat = "20060102T150405Z"
+
+// Write writes the calendar to w. Times are written in UTC.
+func (c Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	lw := &lineWriter{w: bw}
+
+	lw.line("BEGIN", "VCALENDAR")
+	lw.line("VERSION", "2.0")
+	lw.line("PRODID", "-//calendar-app//calendar-app//EN")
+	lw.line("CALSCALE", "GREGORIAN")
+	lw.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	now := time.Now()
+	for _, e := range c.Events {
+		lw.line("BEGIN", "VEVENT")
+		lw.line("UID", escape(e.UID))
+		lw.line("DTSTAMP", formatTime(now))
+		lw.line("DTSTART", formatTime(e.Start))
+		lw.line("DTEND", formatTime(e.End))
+		lw.line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			lw.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			lw.line("LOCATION", escape(e.Location))
+		}
+		if !e.Created.IsZero() {
+			lw.line("CREATED", formatTime(e.Created))
+		}
+		if !e.Modified.IsZero() {
+			lw.line("LAST-MODIFIED", formatTime(e.Modified))
+		}
+		if e.Status != "" {
+			lw.line("STATUS", e.Status)
+		}
+		lw.line("END", "VEVENT")
+	}
+
+	lw.line("END", "VCALENDAR")
+
+	if lw.err != nil {
+		return lw.err
+	}
+	return bw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// escaper escapes the characters that have a meaning in TEXT values.
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// lineWriter writes content lines, folding them so that no line is longer
+// than 75 octets, as the RFC asks. It remembers the first error so callers
+// only need to check once.
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (lw *lineWriter) line(name, value string) {
+	if lw.err != nil {
+		return
+	}
+
+	line := name + ":" + value
+	// Continuation lines start with a space, which counts towards the limit.
+	limit := 75
+
+	var b strings.Builder
+	for len(line) > limit {
+		// Don't split a multi-byte character across lines.
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+
+	_, lw.err = lw.w.WriteString(b.String())
+}
@@ -0,0 +1,66 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "Plain", input: "Team meeting", want: "Team meeting"},
+		{name: "Comma and semicolon", input: "Room 1, Floor 2; East", want: `Room 1\, Floor 2\; East`},
+		{name: "Backslash", input: `C:\agenda`, want: `C:\\agenda`},
+		{name: "Newlines", input: "Line 1\r\nLine 2\nLine 3", want: `Line 1\nLine 2\nLine 3`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, escape(tt.input), tt.want)
+		})
+	}
+}
+
+func TestCalendarWrite(t *testing.T) {
+	start := time.Date(2024, 5, 11, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	c := Calendar{
+		Name: "Alice's appointments",
+		Events: []Event{{
+			UID:         "appointment-1@calendar-app",
+			Summary:     "Planning",
+			Description: strings.Repeat("Lots to discuss — ", 10),
+			Location:    "Room 1, Floor 2",
+			Start:       start,
+			End:         start.Add(time.Hour),
+			Status:      "CONFIRMED",
+		}},
+	}
+
+	var buf bytes.Buffer
+	err := c.Write(&buf)
+	assert.NilError(t, err)
+
+	out := buf.String()
+	assert.StringContains(t, out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n")
+	assert.StringContains(t, out, "DTSTART:20240511T080000Z\r\n")
+	assert.StringContains(t, out, "DTEND:20240511T090000Z\r\n")
+	assert.StringContains(t, out, `LOCATION:Room 1\, Floor 2`)
+	assert.StringContains(t, out, "END:VCALENDAR\r\n")
+
+	// Long lines are folded, without splitting characters.
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is %d octets long: %q", len(line), line)
+		}
+	}
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	assert.StringContains(t, unfolded, "DESCRIPTION:"+strings.Repeat(`Lots to discuss — `, 10))
+}
@@ -0,0 +1,308 @@
+// Package oidc verifies the ID tokens of OpenID Connect providers: JWTs
+// signed with RS256 by one of the keys the provider publishes as a JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantPlaceholder stands for the tenant in the issuer of a multi-tenant
+// provider, such as Microsoft's common endpoint. It's replaced with the tid
+// claim of each token before the issuer is checked.
+const TenantPlaceholder = "{tenantid}"
+
+const (
+	// leeway allows for clocks that are a little off.
+	leeway = time.Minute
+	// refreshInterval is the least time between fetches of the key set, so
+	// tokens with made up key IDs can't make us hammer the provider.
+	refreshInterval = time.Minute
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+	ErrUnknownKey   = errors.New("oidc: ID token signed with an unknown key")
+)
+
+// Claims are the claims of an ID token that we use.
+type Claims struct {
+	Issuer   string
+	Subject  string
+	TenantID string
+	Email    string
+	Name     string
+	// EmailVerified is set if the provider vouches for the email address:
+	// Google's email_verified claim, or the xms_edov optional claim that
+	// Microsoft sends when the domain of the address is verified.
+	EmailVerified bool
+}
+
+// rawClaims is the payload of an ID token.
+type rawClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	TenantID      string   `json:"tid"`
+	Email         string   `json:"email"`
+	Name          string   `json:"name"`
+	EmailVerified any      `json:"email_verified"`
+	EDOV          any      `json:"xms_edov"`
+}
+
+// audience is the aud claim, which is either a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var list []string
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrue reports whether a claim is true. Some providers send booleans as
+// strings.
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
+
+// Verifier checks ID tokens issued to a client by a provider.
+type Verifier struct {
+	issuer   string
+	jwksURL  string
+	clientID string
+	client   *http.Client
+	// now returns the current time; tests replace it.
+	now func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewVerifier returns a Verifier for tokens issued by issuer to clientID,
+// signed with the keys published at jwksURL.
+func NewVerifier(issuer, jwksURL, clientID string) *Verifier {
+	return &Verifier{
+		issuer:   issuer,
+		jwksURL:  jwksURL,
+		clientID: clientID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+	}
+}
+
+// Verify checks the signature and claims of the ID token and returns the
+// claims. The nonce must be the one sent with the authentication request.
+func (v *Verifier) Verify(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	claims := &rawClaims{}
+	err = decodeSegment(parts[1], claims)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := v.issuer
+	if strings.Contains(issuer, TenantPlaceholder) {
+		if claims.TenantID == "" {
+			return nil, fmt.Errorf("%w: no tenant", ErrInvalidToken)
+		}
+		issuer = strings.ReplaceAll(issuer, TenantPlaceholder, claims.TenantID)
+	}
+
+	now := v.now()
+
+	switch {
+	case claims.Issuer != issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	case !claims.Audience.contains(v.clientID):
+		return nil, fmt.Errorf("%w: issued to another client", ErrInvalidToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case claims.IssuedAt != 0 && now.Add(leeway).Before(time.Unix(claims.IssuedAt, 0)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case nonce == "" || claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	return &Claims{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		TenantID:      claims.TenantID,
+		Email:         claims.Email,
+		Name:          claims.Name,
+		EmailVerified: claims.Email != "" && (isTrue(claims.EmailVerified) || isTrue(claims.EDOV)),
+	}, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+// key returns the provider's key with the ID, fetching the key set again if
+// it's not one we know of, as providers rotate their keys.
+func (v *Verifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+
+	if !v.fetchedAt.IsZero() && v.now().Sub(v.fetchedAt) < refreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+	v.fetchedAt = v.now()
+
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// fetchKeys fetches the RSA signing keys in the provider's key set.
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: fetching keys: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetching keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,196 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+// testProvider publishes a key set and signs tokens with its keys.
+type testProvider struct {
+	keys    map[string]*rsa.PrivateKey
+	fetches int
+	server  *httptest.Server
+}
+
+func newTestProvider(t *testing.T, kids ...string) *testProvider {
+	p := &testProvider{keys: map[string]*rsa.PrivateKey{}}
+
+	for _, kid := range kids {
+		p.addKey(t, kid)
+	}
+
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.fetches++
+
+		keys := []map[string]string{}
+		for kid, key := range p.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *testProvider) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.keys[kid] = key
+}
+
+func (p *testProvider) sign(t *testing.T, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.keys[kid], crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":            "https://accounts.example.com",
+		"aud":            "client-id",
+		"sub":            "1234",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "nonce",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p := newTestProvider(t, "key-1")
+	v := NewVerifier("https://accounts.example.com", p.server.URL, "client-id")
+
+	claims, err := v.Verify(context.Background(), p.sign(t, "key-1", validClaims()), "nonce")
+	assert.NilError(t, err)
+	assert.Equal(t, claims.Subject, "1234")
+	assert.Equal(t, claims.Email, "alice@example.com")
+	assert.Equal(t, claims.EmailVerified, true)
+	assert.Equal(t, claims.Name, "Alice")
+
+	tests := []struct {
+		name   string
+		change func(map[string]any)
+	}{
+		{"Wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }},
+		{"Wrong audience", func(c map[string]any) { c["aud"] = "another-client" }},
+		{"Expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"Issued in the future", func(c map[string]any) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"Wrong nonce", func(c map[string]any) { c["nonce"] = "another-nonce" }},
+		{"No subject", func(c map[string]any) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.change(claims)
+
+			_, err := v.Verify(context.Background(), p.sign(t, "key-1", claims), "nonce")
+			assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+		})
+	}
+
+	t.Run("Bad signature", func(t *testing.T) {
+		token := p.sign(t, "key-1", validClaims())
+		other := p.sign(t, "key-1", map[string]any{"sub": "5678"})
+
+		_, err := v.Verify(context.Background(), token[:len(token)-10]+other[len(other)-10:], "nonce")
+		assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+	})
+
+	t.Run("Audience list", func(t *testing.T) {
+		claims := validClaims()
+		claims["aud"] = []string{"another-client", "client-id"}
+
+		_, err := v.Verify(context.Background(), p.sign(t, "key-1", claims), "nonce")
+		assert.NilError(t, err)
+	})
+
+	t.Run("Unverified email", func(t *testing.T) {
+		claims := validClaims()
+		claims["email_verified"] = "false"
+
+		got, err := v.Verify(context.Background(), p.sign(t, "key-1", claims), "nonce")
+		assert.NilError(t, err)
+		assert.Equal(t, got.EmailVerified, false)
+	})
+}
+
+func TestVerifyRotatedKey(t *testing.T) {
+	p := newTestProvider(t, "key-1")
+	v := NewVerifier("https://accounts.example.com", p.server.URL, "client-id")
+
+	_, err := v.Verify(context.Background(), p.sign(t, "key-1", validClaims()), "nonce")
+	assert.NilError(t, err)
+	assert.Equal(t, p.fetches, 1)
+
+	// A token with a key we haven't seen fetches the key set again, but not
+	// more than once a minute.
+	p.addKey(t, "key-2")
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	_, err = v.Verify(context.Background(), p.sign(t, "key-2", validClaims()), "nonce")
+	assert.Equal(t, errors.Is(err, ErrUnknownKey), true)
+	assert.Equal(t, p.fetches, 1)
+
+	v.now = func() time.Time { return now.Add(2 * refreshInterval) }
+	claims := validClaims()
+	claims["exp"] = now.Add(time.Hour).Unix()
+
+	_, err = v.Verify(context.Background(), p.sign(t, "key-2", claims), "nonce")
+	assert.NilError(t, err)
+	assert.Equal(t, p.fetches, 2)
+}
+
+func TestVerifyTenantIssuer(t *testing.T) {
+	p := newTestProvider(t, "key-1")
+	v := NewVerifier("https://login.example.com/"+TenantPlaceholder+"/v2.0", p.server.URL, "client-id")
+
+	claims := validClaims()
+	claims["iss"] = "https://login.example.com/tenant-1/v2.0"
+	claims["tid"] = "tenant-1"
+	delete(claims, "email_verified")
+	claims["xms_edov"] = true
+
+	got, err := v.Verify(context.Background(), p.sign(t, "key-1", claims), "nonce")
+	assert.NilError(t, err)
+	assert.Equal(t, got.TenantID, "tenant-1")
+	assert.Equal(t, got.EmailVerified, true)
+
+	claims["tid"] = "tenant-2"
+	_, err = v.Verify(context.Background(), p.sign(t, "key-1", claims), "nonce")
+	assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+}
@@ -2,14 +2,20 @@ package providers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/tmgasek/calendar-app/internal/data"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -52,6 +58,13 @@ func (p *GoogleCalendarProvider) CreateEvent(userID int, client *http.Client, ne
 		End: &calendar.EventDateTime{
 			DateTime: newEventData.EndTime.Format(time.RFC3339),
 		},
+		Location: newEventData.Location,
+	}
+
+	// Google lets us pick the event ID, so derive it from the idempotency key.
+	// A retried insert then fails with a conflict instead of duplicating.
+	if newEventData.IdempotencyKey != "" {
+		event.Id = googleEventID(newEventData.IdempotencyKey)
 	}
 
 	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
@@ -61,6 +74,10 @@ func (p *GoogleCalendarProvider) CreateEvent(userID int, client *http.Client, ne
 
 	googleEvent, err := srv.Events.Insert("primary", event).Do()
 	if err != nil {
+		var apiErr *googleapi.Error
+		if event.Id != "" && errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+			return event.Id, nil
+		}
 		return "", err
 	}
 
@@ -97,6 +114,13 @@ func (p *GoogleCalendarProvider) FetchEvents(userID int, client *http.Client) ([
 	return dbEvents, nil
 }
 
+// googleEventID turns an idempotency key into a valid Google event ID, which
+// may only use the characters a-v and 0-9. Hex encoding satisfies that.
+func googleEventID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
 func convertGoogleEventToEvent(userID int, googleEvent *calendar.Event) *data.Event {
 	event := &data.Event{
 		UserID:          userID,
@@ -140,3 +164,82 @@ func parseTime(dateTime, date string) time.Time {
 	}
 	return time.Time{}
 }
+
+// Watch opens an events.watch channel on the user's primary calendar. Google
+// picks the expiry, which is at most a week away.
+func (p *GoogleCalendarProvider) Watch(client *http.Client, channel *Channel) error {
+	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+	if err != nil {
+		return err
+	}
+
+	res, err := srv.Events.Watch("primary", &calendar.Channel{
+		Id:      channel.ID,
+		Type:    "web_hook",
+		Address: channel.Address,
+		Token:   channel.Token,
+	}).Do()
+	if err != nil {
+		return err
+	}
+
+	channel.ResourceID = res.ResourceId
+	channel.Expiry = time.UnixMilli(res.Expiration)
+
+	return nil
+}
+
+// Renew always fails, as Google channels can't be extended.
+func (p *GoogleCalendarProvider) Renew(client *http.Client, channel *Channel) error {
+	return ErrRenewUnsupported
+}
+
+func (p *GoogleCalendarProvider) StopWatch(client *http.Client, channel *Channel) error {
+	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+	if err != nil {
+		return err
+	}
+
+	err = srv.Channels.Stop(&calendar.Channel{Id: channel.ID, ResourceId: channel.ResourceID}).Do()
+	if err != nil {
+		// The channel has already expired or been stopped.
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// googleRevokeURL is Google's OAuth 2.0 revocation endpoint. Tests point it
+// at a stand-in.
+var googleRevokeURL = "https://oauth2.googleapis.com/revoke"
+
+// Revoke gives up the access the user granted. Revoking the refresh token
+// revokes the access tokens made from it too. A token Google no longer knows
+// has already been revoked, so that isn't an error.
+func (p *GoogleCalendarProvider) Revoke(client *http.Client, token *oauth2.Token) error {
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+
+	resp, err := client.PostForm(googleRevokeURL, url.Values{"token": {value}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "invalid_token"):
+		return nil
+	default:
+		return fmt.Errorf("google token revocation failed: %s: %s", resp.Status, body)
+	}
+}
@@ -0,0 +1,54 @@
+package providers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestGoogleRevoke(t *testing.T) {
+	var got []string
+
+	// A stand-in for Google's revocation endpoint, which has already revoked
+	// "gone".
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.PostFormValue("token")
+		got = append(got, token)
+
+		switch token {
+		case "gone":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_token"}`))
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer google.Close()
+
+	defer func(u string) { googleRevokeURL = u }(googleRevokeURL)
+	googleRevokeURL = google.URL
+
+	p := &GoogleCalendarProvider{}
+
+	// The refresh token is revoked if there is one.
+	err := p.Revoke(google.Client(), &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})
+	assert.NilError(t, err)
+
+	err = p.Revoke(google.Client(), &oauth2.Token{AccessToken: "access"})
+	assert.NilError(t, err)
+
+	err = p.Revoke(google.Client(), &oauth2.Token{RefreshToken: "gone"})
+	assert.NilError(t, err)
+
+	err = p.Revoke(google.Client(), &oauth2.Token{RefreshToken: "broken"})
+	if err == nil {
+		t.Error("got nil; want an error")
+	}
+
+	assert.Equal(t, len(got), 4)
+	assert.Equal(t, got[0], "refresh")
+	assert.Equal(t, got[1], "access")
+}
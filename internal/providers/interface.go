@@ -23,4 +23,14 @@ type NewEventData struct {
 	StartTime   time.Time
 	EndTime     time.Time
 	Location    string
+	// IdempotencyKey identifies the operation creating the event. Providers
+	// use it so that retrying a create never results in two events.
+	IdempotencyKey string
+}
+
+// Revoker is implemented by providers that let us give up the access a user
+// granted us. Microsoft has no way to revoke a single app's tokens, so those
+// are only forgotten; the user can remove the app from their account.
+type Revoker interface {
+	Revoke(client *http.Client, token *oauth2.Token) error
 }
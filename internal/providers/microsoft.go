@@ -81,6 +81,7 @@ func (p *MicrosoftCalendarProvider) CreateEvent(userID int, client *http.Client,
 		}{
 			DisplayName: newEventData.Location,
 		},
+		TransactionID: newEventData.IdempotencyKey,
 	}
 
 	// Send the event to Microsoft
@@ -265,4 +266,113 @@ type CreateGraphEventPayload struct {
 	Location struct {
 		DisplayName string `json:"displayName"`
 	} `json:"location"`
+	// Graph returns the existing event for a transactionId it has seen before.
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// graphBaseURL is where Microsoft Graph subscriptions are managed. It's a
+// variable so tests can point it at a stand-in server.
+var graphBaseURL = "https://graph.microsoft.com/v1.0"
+
+// graphSubscriptionLifetime is how long subscriptions are opened or extended
+// for. Graph allows at most 4230 minutes for events.
+const graphSubscriptionLifetime = 70 * time.Hour
+
+type graphSubscription struct {
+	ID                 string `json:"id,omitempty"`
+	ChangeType         string `json:"changeType,omitempty"`
+	NotificationURL    string `json:"notificationUrl,omitempty"`
+	Resource           string `json:"resource,omitempty"`
+	ExpirationDateTime string `json:"expirationDateTime"`
+	ClientState        string `json:"clientState,omitempty"`
+}
+
+// graphSubscriptionRequest sends a request about a subscription to Graph and
+// decodes the subscription it returns into out, if that isn't nil.
+func (p *MicrosoftCalendarProvider) graphSubscriptionRequest(client *http.Client, method, path string, in *graphSubscription, out *graphSubscription) (int, error) {
+	var body io.Reader
+	if in != nil {
+		js, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, graphBaseURL+path, body)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.token.AccessToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("graph subscription request failed: %s: %s", resp.Status, responseBody)
+	}
+
+	if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			return resp.StatusCode, err
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Watch creates a Graph subscription to changes to the user's events. Graph
+// checks the notification URL answers its validation request before it
+// replies.
+func (p *MicrosoftCalendarProvider) Watch(client *http.Client, channel *Channel) error {
+	var sub graphSubscription
+
+	_, err := p.graphSubscriptionRequest(client, http.MethodPost, "/subscriptions", &graphSubscription{
+		ChangeType:         "created,updated,deleted",
+		NotificationURL:    channel.Address,
+		Resource:           "me/events",
+		ExpirationDateTime: time.Now().Add(graphSubscriptionLifetime).UTC().Format(time.RFC3339),
+		ClientState:        channel.Token,
+	}, &sub)
+	if err != nil {
+		return err
+	}
+
+	channel.ID = sub.ID
+	channel.Expiry = parseRFC3339Time(sub.ExpirationDateTime)
+
+	return nil
+}
+
+func (p *MicrosoftCalendarProvider) Renew(client *http.Client, channel *Channel) error {
+	var sub graphSubscription
+
+	_, err := p.graphSubscriptionRequest(client, http.MethodPatch, "/subscriptions/"+url.PathEscape(channel.ID), &graphSubscription{
+		ExpirationDateTime: time.Now().Add(graphSubscriptionLifetime).UTC().Format(time.RFC3339),
+	}, &sub)
+	if err != nil {
+		return err
+	}
+
+	channel.Expiry = parseRFC3339Time(sub.ExpirationDateTime)
+
+	return nil
+}
+
+func (p *MicrosoftCalendarProvider) StopWatch(client *http.Client, channel *Channel) error {
+	status, err := p.graphSubscriptionRequest(client, http.MethodDelete, "/subscriptions/"+url.PathEscape(channel.ID), nil, nil)
+	// The subscription has already expired or been deleted.
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,64 @@
+package providers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestMicrosoftSubscriptions(t *testing.T) {
+	expiry := time.Now().Add(graphSubscriptionLifetime).UTC().Truncate(time.Second)
+	var got []string
+
+	// A stand-in for Graph's subscription endpoints.
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Method+" "+r.URL.Path)
+		assert.Equal(t, r.Header.Get("Authorization"), "Bearer access-token")
+
+		switch r.Method {
+		case http.MethodPost:
+			var sub graphSubscription
+			err := json.NewDecoder(r.Body).Decode(&sub)
+			assert.NilError(t, err)
+			assert.Equal(t, sub.Resource, "me/events")
+			assert.Equal(t, sub.NotificationURL, "https://calendar.example.com/notifications/microsoft")
+			assert.Equal(t, sub.ClientState, "state")
+			sub.ID = "sub-1"
+			sub.ExpirationDateTime = expiry.Format(time.RFC3339)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(sub)
+		case http.MethodPatch:
+			json.NewEncoder(w).Encode(graphSubscription{ID: "sub-1", ExpirationDateTime: expiry.Add(time.Hour).Format(time.RFC3339)})
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer graph.Close()
+
+	defer func(u string) { graphBaseURL = u }(graphBaseURL)
+	graphBaseURL = graph.URL
+
+	p := &MicrosoftCalendarProvider{token: &oauth2.Token{AccessToken: "access-token"}}
+	channel := &Channel{ID: "ours", Token: "state", Address: "https://calendar.example.com/notifications/microsoft"}
+
+	err := p.Watch(graph.Client(), channel)
+	assert.NilError(t, err)
+	assert.Equal(t, channel.ID, "sub-1")
+	assert.Equal(t, channel.Expiry.Equal(expiry), true)
+
+	err = p.Renew(graph.Client(), channel)
+	assert.NilError(t, err)
+	assert.Equal(t, channel.Expiry.Equal(expiry.Add(time.Hour)), true)
+
+	// Stopping a subscription Graph no longer has isn't an error.
+	err = p.StopWatch(graph.Client(), channel)
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(got), 3)
+	assert.Equal(t, got[1], "PATCH /subscriptions/sub-1")
+}
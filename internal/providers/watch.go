@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrRenewUnsupported is returned by Watcher.Renew for channels that can't
+// be extended. Watch a new channel and stop the old one instead.
+var ErrRenewUnsupported = errors.New("channel can't be renewed")
+
+// Channel is a subscription to change notifications for a user's calendar:
+// a Google Calendar events.watch channel or a Microsoft Graph subscription.
+type Channel struct {
+	// ID identifies the channel in notifications. Google uses the ID we pick;
+	// Microsoft Graph replaces it with the ID of the subscription.
+	ID string
+	// ResourceID is Google's ID for the watched calendar, needed to stop the
+	// channel.
+	ResourceID string
+	// Token is sent back with every notification, as X-Goog-Channel-Token by
+	// Google and as clientState by Microsoft Graph.
+	Token   string
+	Address string
+	Expiry  time.Time
+}
+
+// NewChannel returns a channel with a random ID and token that notifies the
+// address.
+func NewChannel(address string) (*Channel, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Channel{ID: id, Token: token, Address: address}, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Watcher is implemented by providers that can push a notification when a
+// calendar changes.
+type Watcher interface {
+	// Watch opens the channel, filling in its ID, resource ID and expiry.
+	Watch(client *http.Client, channel *Channel) error
+	// Renew pushes back the expiry of the channel.
+	Renew(client *http.Client, channel *Channel) error
+	// StopWatch closes the channel.
+	StopWatch(client *http.Client, channel *Channel) error
+}
@@ -0,0 +1,90 @@
+package service
+
+import "github.com/tmgasek/calendar-app/internal/data"
+
+// getAdmin returns the user if they're an instance admin.
+func (s *Service) getAdmin(adminID int) (*data.User, error) {
+	admin, err := s.GetUser(adminID)
+	if err != nil {
+		return nil, err
+	}
+	if !admin.IsAdmin {
+		return nil, forbidden("Only administrators can do that")
+	}
+	return admin, nil
+}
+
+// getAdminTarget returns a user other than the admin for them to act on.
+func (s *Service) getAdminTarget(adminID, userID int) (*data.User, error) {
+	_, err := s.getAdmin(adminID)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID == adminID {
+		return nil, invalid("You can't do that to your own account")
+	}
+
+	return s.GetUser(userID)
+}
+
+// RecordAdminAction adds an entry to the audit log of what admins have done
+// to users' accounts.
+func (s *Service) RecordAdminAction(adminID, userID int, action, details string) error {
+	return s.models.AuditLog.Insert(&data.AuditEntry{
+		AdminID: adminID,
+		UserID:  userID,
+		Action:  action,
+		Details: details,
+	})
+}
+
+// SetUserDisabled disables or enables another user's account. Disabling it
+// also logs the user out everywhere.
+func (s *Service) SetUserDisabled(adminID, userID int, disabled bool) error {
+	user, err := s.getAdminTarget(adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.models.Users.SetDisabled(user.ID, disabled)
+	if err != nil {
+		return err
+	}
+
+	action := data.AuditEnable
+	if disabled {
+		action = data.AuditDisable
+
+		err = s.models.UserSessions.DeleteAllForUser(user.ID, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.RecordAdminAction(adminID, user.ID, action, "")
+}
+
+// StartImpersonation checks the admin may act as another user and records
+// that they are. Other admins can't be impersonated, so it doesn't give an
+// admin more power than they have, nor can disabled users.
+func (s *Service) StartImpersonation(adminID, userID int) (*data.User, error) {
+	user, err := s.getAdminTarget(adminID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsAdmin {
+		return nil, forbidden("Other administrators can't be impersonated")
+	}
+	if user.Disabled {
+		return nil, invalid("Enable this account before impersonating it")
+	}
+
+	err = s.RecordAdminAction(adminID, user.ID, data.AuditImpersonate, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
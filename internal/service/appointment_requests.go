@@ -0,0 +1,324 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// NewAppointmentRequest holds what's needed to ask someone, and optionally
+// the rest of a group, for an appointment.
+type NewAppointmentRequest struct {
+	TargetUserID int
+	GroupID      int
+	Title        string
+	Description  string
+	Location     string
+	StartTime    time.Time
+	EndTime      time.Time
+	QuorumRule   string
+	QuorumCount  int
+	// OptionalUserIDs are group members who don't have to accept.
+	OptionalUserIDs []int
+	ResourceIDs     []int
+}
+
+// CreateAppointmentRequest checks that everyone involved, people and
+// resources, is free at the requested time and sends the request to them.
+func (s *Service) CreateAppointmentRequest(requesterID int, in NewAppointmentRequest) (*data.AppointmentRequest, error) {
+	var v validator.Validator
+	v.CheckField(validator.NotBlank(in.Title), "title", "This field cannot be blank")
+	v.CheckField(validator.NotBlank(in.Description), "description", "This field cannot be blank")
+	v.CheckField(!in.StartTime.IsZero(), "start_time", "This field cannot be blank")
+	v.CheckField(!in.EndTime.IsZero(), "end_time", "This field cannot be blank")
+	v.CheckField(in.EndTime.IsZero() || in.EndTime.After(in.StartTime), "end_time", "This must be after the start time")
+	if in.QuorumRule == "" {
+		in.QuorumRule = data.QuorumAll
+	}
+	v.CheckField(validator.PermittedValue(in.QuorumRule, data.QuorumAll, data.QuorumMajority, data.QuorumCount), "quorum_rule", "Invalid quorum rule")
+
+	if !v.Valid() {
+		return nil, failedValidation(v)
+	}
+
+	// Determine if dealing with a group or individual appointment.
+	var appointmentType string
+	if in.GroupID == 0 {
+		appointmentType = "individual"
+	} else {
+		appointmentType = "group"
+	}
+
+	requester, err := s.models.Users.Get(requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !requester.Activated {
+		return nil, forbidden("Please confirm your email address before sending requests")
+	}
+
+	// Users who haven't confirmed their email address can't be sent requests,
+	// as they may not own it.
+	targetUser, err := s.models.Users.Get(in.TargetUserID)
+	if err != nil || !targetUser.Activated {
+		if err == nil || isNotFound(err) {
+			return nil, notFound("User not found")
+		}
+		return nil, err
+	}
+
+	// Nor can people outside the requester's organisation, unless theirs
+	// shares with it.
+	err = s.checkReachable(requesterID, targetUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &data.AppointmentRequest{
+		RequesterID:     requesterID,
+		TargetUserID:    targetUser.ID,
+		GroupID:         in.GroupID,
+		AppointmentType: appointmentType,
+		Title:           in.Title,
+		Description:     in.Description,
+		StartTime:       in.StartTime,
+		EndTime:         in.EndTime,
+		Location:        in.Location,
+		Status:          data.RequestStatusPending,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+		QuorumRule:      in.QuorumRule,
+		QuorumCount:     in.QuorumCount,
+	}
+
+	type EmailData struct {
+		RequesteeName string
+		GroupName     string
+	}
+
+	emailData := EmailData{
+		RequesteeName: requester.Name,
+	}
+
+	// Everyone invited gets to respond to the request. The target user is
+	// always required, other group members only if not marked as optional.
+	participants := []*data.RequestParticipant{
+		{UserID: targetUser.ID, Email: targetUser.Email, Required: true},
+	}
+	// Only those who have to come need to be free.
+	userIDs := []int{requesterID, targetUser.ID}
+
+	if appointmentType == "group" {
+		group, err := s.GetGroup(requesterID, in.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		emailData.GroupName = group.Name
+
+		for _, member := range group.Members {
+			if member.ID == requesterID || member.ID == targetUser.ID {
+				continue
+			}
+			required := !slices.Contains(in.OptionalUserIDs, member.ID)
+			if required {
+				userIDs = append(userIDs, member.ID)
+			}
+			participants = append(participants, &data.RequestParticipant{
+				UserID:   member.ID,
+				Email:    member.Email,
+				Required: required,
+			})
+		}
+	}
+
+	if in.QuorumRule == data.QuorumCount && (in.QuorumCount < 1 || in.QuorumCount > len(participants)) {
+		return nil, invalid("The number of acceptances needed must be between 1 and the number of participants")
+	}
+
+	// Check if all the involved users are available at the requested time.
+	for _, userID := range userIDs {
+		events, err := s.fetchEvents(userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isAvailable(events, in.StartTime, in.EndTime) {
+			return nil, conflict("One or more users are not available at the requested time")
+		}
+	}
+
+	// Resources are checked for conflicts just like the people taking part.
+	for _, resourceID := range in.ResourceIDs {
+		resource, err := s.models.Resources.Get(resourceID)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, invalid("Resource not found")
+			}
+			return nil, err
+		}
+
+		// Everyone invited plus the requester has to fit in a room.
+		if resource.Kind == data.ResourceRoom && resource.Capacity > 0 && len(participants)+1 > resource.Capacity {
+			return nil, invalid(fmt.Sprintf("%s only fits %d people", resource.Name, resource.Capacity))
+		}
+
+		events, err := s.ResourceEvents(resource, in.StartTime, in.EndTime)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isAvailable(events, in.StartTime, in.EndTime) {
+			return nil, conflict("One or more resources are not available at the requested time")
+		}
+
+		request.Resources = append(request.Resources, resource)
+	}
+
+	request.Participants = participants
+
+	err = s.models.AppointmentRequests.Insert(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send an email to everyone invited.
+	for _, p := range participants {
+		err = s.mailer.Send(p.Email, "confirm-appointment.tmpl", emailData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return request, nil
+}
+
+// GetAppointmentRequest returns the request if the user sent it or was
+// invited to it.
+func (s *Service) GetAppointmentRequest(userID, requestID int) (*data.AppointmentRequest, error) {
+	request, err := s.models.AppointmentRequests.Get(requestID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Appointment request not found")
+		}
+		return nil, err
+	}
+
+	if request.RequesterID != userID && request.Participant(userID) == nil {
+		return nil, forbidden("You can only see requests you have sent or received")
+	}
+
+	return request, nil
+}
+
+// Outcome says what happened to a request after someone responded to it.
+type Outcome string
+
+const (
+	OutcomeRecorded  Outcome = "recorded"
+	OutcomeConfirmed Outcome = "confirmed"
+	OutcomeDeclined  Outcome = "declined"
+	// OutcomeResourceTaken means the quorum was met, but a requested resource
+	// had been booked in the meantime so the request was declined.
+	OutcomeResourceTaken Outcome = "resource_unavailable"
+)
+
+// RespondToAppointmentRequest records the user's response, then confirms or
+// declines the request if that settles its quorum. A request that is no
+// longer pending gives data.ErrInvalidTransition.
+func (s *Service) RespondToAppointmentRequest(userID, requestID int, response, reason string) (Outcome, error) {
+	if !validator.PermittedValue(response, data.ParticipantAccepted, data.ParticipantDeclined, data.ParticipantTentative) {
+		return "", invalid("Invalid action")
+	}
+
+	request, err := s.models.AppointmentRequests.Get(requestID)
+	if err != nil {
+		if isNotFound(err) {
+			return "", notFound("Appointment request not found")
+		}
+		return "", err
+	}
+
+	if request.Participant(userID) == nil {
+		return "", forbidden("You can only respond to requests sent to you")
+	}
+
+	if !validator.MaxChars(reason, 500) {
+		return "", invalid("Decline reason is too long")
+	}
+
+	// Only a decline needs a reason.
+	if response != data.ParticipantDeclined {
+		reason = ""
+	}
+
+	// The decliner's own reason stays on their response. It's only the
+	// request's reason if they were the one person asked.
+	requestReason := "Not enough participants accepted"
+	if len(request.Participants) == 1 && reason != "" {
+		requestReason = reason
+	}
+
+	// The quorum is worked out as the response is saved, against everyone's
+	// latest responses, and the request is confirmed or declined in the same
+	// transaction if that settles it.
+	outcome, err := s.models.AppointmentRequests.Respond(request.RequestID, userID, response, reason, newAppointment(request), requestReason)
+	if errors.Is(err, data.ErrResourceUnavailable) {
+		// Someone else booked a room or piece of equipment first, so the
+		// appointment can't go ahead as requested.
+		return OutcomeResourceTaken, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch outcome {
+	case data.QuorumMet:
+		return OutcomeConfirmed, nil
+	case data.QuorumFailed:
+		return OutcomeDeclined, nil
+	default:
+		return OutcomeRecorded, nil
+	}
+}
+
+// newAppointment is the appointment a request becomes once its quorum is met.
+// It's confirmed in the calendars of the requester and everyone who accepted;
+// the outbox worker then creates the events.
+func newAppointment(request *data.AppointmentRequest) *data.Appointment {
+	return &data.Appointment{
+		CreatorID:       request.RequesterID,
+		AppointmentType: request.AppointmentType,
+		GroupID:         request.GroupID,
+		TargetID:        request.TargetUserID,
+		Title:           request.Title,
+		Description:     request.Description,
+		StartTime:       request.StartTime,
+		EndTime:         request.EndTime,
+		Location:        request.Location,
+		TimeZone:        request.TimeZone,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+}
+
+// CancelAppointmentRequest withdraws a pending request the user has sent.
+func (s *Service) CancelAppointmentRequest(userID, requestID int) error {
+	request, err := s.models.AppointmentRequests.Get(requestID)
+	if err != nil {
+		if isNotFound(err) {
+			return notFound("Appointment request not found")
+		}
+		return err
+	}
+
+	if request.RequesterID != userID {
+		return forbidden("You can only cancel requests you have sent")
+	}
+
+	return s.models.AppointmentRequests.Cancel(request.RequestID)
+}
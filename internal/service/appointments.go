@@ -0,0 +1,69 @@
+package service
+
+import "github.com/tmgasek/calendar-app/internal/data"
+
+// GetAppointment returns the appointment if the user created it or is its
+// target.
+func (s *Service) GetAppointment(userID, appointmentID int) (*data.Appointment, error) {
+	appointment, err := s.models.Appointments.Get(appointmentID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Appointment not found")
+		}
+		return nil, err
+	}
+
+	if appointment.CreatorID != userID && appointment.TargetID != userID {
+		// The rest of a group can see its appointments in its calendar.
+		shared, err := s.inGroupCalendar(userID, appointment)
+		if err != nil {
+			return nil, err
+		}
+		if !shared {
+			return nil, forbidden("You do not have permission to see this appointment.")
+		}
+	}
+
+	return appointment, nil
+}
+
+// inGroupCalendar reports whether the appointment is in the shared calendar
+// of a group the user is in.
+func (s *Service) inGroupCalendar(userID int, appointment *data.Appointment) (bool, error) {
+	if appointment.GroupID == 0 {
+		return false, nil
+	}
+
+	group, err := s.models.Groups.Get(appointment.GroupID)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return group.CalendarEnabled && memberRole(group, userID) != "", nil
+}
+
+// DeleteAppointment deletes one of the user's appointments and returns it as
+// it was. This queues the removal of its events from everyone's calendars.
+func (s *Service) DeleteAppointment(userID, appointmentID int) (*data.Appointment, error) {
+	appointment, err := s.models.Appointments.Get(appointmentID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Appointment not found")
+		}
+		return nil, err
+	}
+
+	if appointment.CreatorID != userID && appointment.TargetID != userID {
+		return nil, forbidden("You do not have permission to delete this appointment.")
+	}
+
+	err = s.models.Appointments.Delete(appointment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return appointment, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// isAvailable reports whether none of the events overlap the time between
+// start and end.
+func isAvailable(events []*data.Event, start, end time.Time) bool {
+	for _, event := range events {
+		if event.StartTime.Before(end) && event.EndTime.After(start) {
+			return false
+		}
+	}
+	return true
+}
+
+// Busy returns the events keeping the user busy between from and to, if the
+// viewer can reach them.
+func (s *Service) Busy(viewerID, userID int, from, to time.Time) ([]*data.Event, error) {
+	_, err := s.GetVisibleUser(viewerID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.fetchEvents(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	busy := []*data.Event{}
+	for _, event := range events {
+		if event.StartTime.Before(to) && event.EndTime.After(from) {
+			busy = append(busy, event)
+		}
+	}
+
+	return busy, nil
+}
+
+// ResourceEvents returns the bookings of the resource between start and end,
+// along with the hours it is closed, so it can be checked for conflicts and
+// shown in the same way as a user's calendar.
+func (s *Service) ResourceEvents(resource *data.Resource, start, end time.Time) ([]*data.Event, error) {
+	events, err := s.models.Resources.GetBookings(resource.ID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(events, resource.ClosedEvents(start, end)...), nil
+}
+
+// MaxGroupAvailabilityDays is how many days of a group's availability can be
+// shown at once.
+const MaxGroupAvailabilityDays = 28
+
+// GroupAvailabilityQuery picks the days, the hours of each day and the
+// members of a group to combine the availability of.
+type GroupAvailabilityQuery struct {
+	From      time.Time
+	Days      int
+	StartHour int
+	EndHour   int
+	// MemberIDs are the members to include, or all of them if empty.
+	MemberIDs []int
+	// OptionalIDs are included members who don't have to be free.
+	OptionalIDs []int
+}
+
+// GroupSlot is an hour of a group's combined availability.
+type GroupSlot struct {
+	Start time.Time
+	End   time.Time
+	// Free is how many of the Total included members are free.
+	Free  int
+	Total int
+	// RequiredFree is whether every included member who isn't optional is
+	// free.
+	RequiredFree bool
+}
+
+// GroupAvailability is how many members of a group are free in each hour of
+// a range of days.
+type GroupAvailability struct {
+	Group *data.Group
+	// Members are the included members, in the order of the group's.
+	Members  []*data.GroupMember
+	Optional map[int]bool
+	// Slots holds a row of hours for each day.
+	Slots [][]GroupSlot
+}
+
+// GroupAvailability combines the busy times of the members of a group the
+// user is in, for each hour from StartHour to EndHour of the days from From.
+func (s *Service) GroupAvailability(userID, groupID int, q GroupAvailabilityQuery) (*GroupAvailability, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var v validator.Validator
+	if q.Days < 1 || q.Days > MaxGroupAvailabilityDays {
+		v.AddNonFieldError(fmt.Sprintf("Days must be between 1 and %d", MaxGroupAvailabilityDays))
+	}
+	if q.StartHour < 0 || q.EndHour > 24 || q.StartHour >= q.EndHour {
+		v.AddNonFieldError("Hours must be between 0 and 24, with the start before the end")
+	}
+	for _, id := range append(slices.Clone(q.MemberIDs), q.OptionalIDs...) {
+		if memberRole(group, id) == "" {
+			v.AddNonFieldError("Only members of the group can be included")
+			break
+		}
+	}
+	if !v.Valid() {
+		return nil, failedValidation(v)
+	}
+
+	from := time.Date(q.From.Year(), q.From.Month(), q.From.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, q.Days)
+
+	availability := &GroupAvailability{Group: group, Optional: map[int]bool{}}
+
+	busy := map[int][]*data.Event{}
+	for _, member := range group.Members {
+		if len(q.MemberIDs) > 0 && !slices.Contains(q.MemberIDs, member.ID) {
+			continue
+		}
+		availability.Members = append(availability.Members, member)
+		// The one asking is the one arranging, so can't be optional.
+		if member.ID != userID && slices.Contains(q.OptionalIDs, member.ID) {
+			availability.Optional[member.ID] = true
+		}
+
+		events, err := s.fetchEvents(member.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if event.StartTime.Before(to) && event.EndTime.After(from) {
+				busy[member.ID] = append(busy[member.ID], event)
+			}
+		}
+	}
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		var slots []GroupSlot
+		for hour := q.StartHour; hour < q.EndHour; hour++ {
+			slot := GroupSlot{
+				Start:        day.Add(time.Duration(hour) * time.Hour),
+				End:          day.Add(time.Duration(hour+1) * time.Hour),
+				Total:        len(availability.Members),
+				RequiredFree: true,
+			}
+			for _, member := range availability.Members {
+				if isAvailable(busy[member.ID], slot.Start, slot.End) {
+					slot.Free++
+				} else if !availability.Optional[member.ID] {
+					slot.RequiredFree = false
+				}
+			}
+			slots = append(slots, slot)
+		}
+		availability.Slots = append(availability.Slots, slots)
+	}
+
+	return availability, nil
+}
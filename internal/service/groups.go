@@ -0,0 +1,497 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// CreateGroup creates a group with the user as its owner.
+func (s *Service) CreateGroup(userID int, name, description string) (int, error) {
+	v := checkGroup(name, description)
+	if !v.Valid() {
+		return 0, failedValidation(v)
+	}
+
+	return s.models.Groups.Insert(userID, name, description)
+}
+
+func checkGroup(name, description string) validator.Validator {
+	var v validator.Validator
+	v.CheckField(validator.NotBlank(name), "name", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(name, 50), "name", "This field is too long")
+	v.CheckField(validator.NotBlank(description), "description", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(description, 1000), "description", "This field is too long")
+	return v
+}
+
+// GetGroup returns the group with its members if the user is one of them.
+func (s *Service) GetGroup(userID, groupID int) (*data.Group, error) {
+	group, err := s.models.Groups.Get(groupID)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	// A group without members doesn't exist, as its creator is added to it.
+	if group == nil || group.ID == 0 {
+		return nil, notFound("Group not found")
+	}
+
+	for _, member := range group.Members {
+		if member.ID == userID {
+			return group, nil
+		}
+	}
+
+	return nil, forbidden("You are not a member of this group")
+}
+
+// memberRole returns the role of the user in the group, or "" if they aren't
+// a member.
+func memberRole(group *data.Group, userID int) string {
+	for _, member := range group.Members {
+		if member.ID == userID {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// canManage reports whether a role lets its member manage the group.
+func canManage(role string) bool {
+	return role == data.GroupRoleOwner || role == data.GroupRoleAdmin
+}
+
+// getManagedGroup returns the group if the user is its owner or an admin.
+func (s *Service) getManagedGroup(userID, groupID int) (*data.Group, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManage(memberRole(group, userID)) {
+		return nil, forbidden("Only the owner and admins of this group can do that")
+	}
+
+	return group, nil
+}
+
+// getOwnedGroup returns the group if the user is its owner.
+func (s *Service) getOwnedGroup(userID, groupID int) (*data.Group, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if memberRole(group, userID) != data.GroupRoleOwner {
+		return nil, forbidden("Only the owner of this group can do that")
+	}
+
+	return group, nil
+}
+
+// GroupInvitationTTL is how long an invitation to a group can be answered
+// for.
+const GroupInvitationTTL = 14 * 24 * time.Hour
+
+// InviteToGroup invites the email address to a group the user is the owner
+// or an admin of. The address doesn't need an account yet: its owner joins
+// when they sign up with it. Inviting an address again sends new links in
+// place of the old ones.
+//
+// Whether the invitee is in an organisation the user can reach is only
+// checked when they accept, so the answer doesn't give away who has an
+// account.
+func (s *Service) InviteToGroup(userID, groupID int, email string) (*data.GroupInvitation, error) {
+	group, err := s.getManagedGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	email = strings.TrimSpace(email)
+
+	var v validator.Validator
+	v.CheckField(validator.NotBlank(email), "email", "This field cannot be blank")
+	v.CheckField(validator.Matches(email, validator.EmailRX), "email", "This field must be a valid email address")
+	if !v.Valid() {
+		return nil, failedValidation(v)
+	}
+
+	for _, member := range group.Members {
+		if strings.EqualFold(member.Email, email) {
+			return nil, conflict("That user is already a member of this group")
+		}
+	}
+
+	inv, err := s.models.GroupInvitations.Insert(group.ID, userID, email, GroupInvitationTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	// The invitation email names the group and who sent it.
+	inv.GroupName = group.Name
+	for _, member := range group.Members {
+		if member.ID == userID {
+			inv.InviterName = member.Name
+		}
+	}
+
+	return inv, nil
+}
+
+// GetGroupInvitations returns the unanswered invitations to a group the user
+// is the owner or an admin of.
+func (s *Service) GetGroupInvitations(userID, groupID int) ([]*data.GroupInvitation, error) {
+	group, err := s.getManagedGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.models.GroupInvitations.GetPendingForGroup(group.ID)
+}
+
+// CancelGroupInvitation withdraws an unanswered invitation to a group the
+// user is the owner or an admin of.
+func (s *Service) CancelGroupInvitation(userID, groupID, invitationID int) error {
+	group, err := s.getManagedGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	inv, err := s.models.GroupInvitations.Get(invitationID)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if inv == nil || inv.GroupID != group.ID {
+		return notFound("Invitation not found")
+	}
+
+	return s.models.GroupInvitations.Delete(inv.ID)
+}
+
+// GetMyGroupInvitations returns the unanswered invitations to the user's
+// email address. Users who haven't confirmed it yet get none, as they may
+// not own it; theirs are accepted when they confirm it.
+func (s *Service) GetMyGroupInvitations(userID int) ([]*data.GroupInvitation, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Activated {
+		return []*data.GroupInvitation{}, nil
+	}
+
+	return s.models.GroupInvitations.GetPendingForEmail(user.Email)
+}
+
+// getMyGroupInvitation returns the invitation if it was sent to the user's
+// email address and they've confirmed it. Anyone else's looks like it
+// doesn't exist.
+func (s *Service) getMyGroupInvitation(userID, invitationID int) (*data.GroupInvitation, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := s.models.GroupInvitations.Get(invitationID)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	if inv == nil || !user.Activated || !strings.EqualFold(inv.Email, user.Email) {
+		return nil, notFound("This invitation doesn't exist or has expired")
+	}
+
+	return inv, nil
+}
+
+// AcceptGroupInvitation adds the user to the group of an invitation to their
+// email address, and returns the invitation.
+func (s *Service) AcceptGroupInvitation(userID, invitationID int) (*data.GroupInvitation, error) {
+	inv, err := s.getMyGroupInvitation(userID, invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, s.acceptGroupInvitation(inv, userID)
+}
+
+// DeclineGroupInvitation turns down an invitation to the user's email
+// address.
+func (s *Service) DeclineGroupInvitation(userID, invitationID int) error {
+	inv, err := s.getMyGroupInvitation(userID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	return s.declineGroupInvitation(inv)
+}
+
+// GetGroupInvitationByToken returns the invitation an emailed link is for.
+func (s *Service) GetGroupInvitationByToken(token string) (*data.GroupInvitation, error) {
+	inv, err := s.models.GroupInvitations.GetByToken(token)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("This invitation doesn't exist or has expired")
+		}
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// Responses to an invitation to a group.
+const (
+	InvitationAccept  = "accept"
+	InvitationDecline = "decline"
+)
+
+// RespondToGroupInvitationByToken accepts or declines the invitation an
+// emailed link is for, without the need to log in, as having the link shows
+// the address is the invitee's. An address without an account can only
+// decline: it joins the group when it signs up instead.
+func (s *Service) RespondToGroupInvitationByToken(token, response string) (*data.GroupInvitation, error) {
+	if !validator.PermittedValue(response, InvitationAccept, InvitationDecline) {
+		return nil, invalid("Invalid action")
+	}
+
+	inv, err := s.GetGroupInvitationByToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if response == InvitationDecline {
+		return inv, s.declineGroupInvitation(inv)
+	}
+
+	user, err := s.models.Users.GetByEmail(inv.Email)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, invalid("Sign up with " + inv.Email + " to join the group")
+		}
+		return nil, err
+	}
+
+	return inv, s.acceptGroupInvitation(inv, user.ID)
+}
+
+func (s *Service) acceptGroupInvitation(inv *data.GroupInvitation, userID int) error {
+	// The invitee may have joined another organisation since it was sent.
+	ok, err := s.models.Users.Reachable(inv.InviterID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return forbidden("This invitation is from outside your organisation")
+	}
+
+	err = s.models.GroupInvitations.Accept(inv.ID, userID)
+	if isNotFound(err) {
+		return notFound("This invitation doesn't exist or has expired")
+	}
+	return err
+}
+
+func (s *Service) declineGroupInvitation(inv *data.GroupInvitation) error {
+	err := s.models.GroupInvitations.Delete(inv.ID)
+	if isNotFound(err) {
+		return notFound("This invitation doesn't exist or has expired")
+	}
+	return err
+}
+
+// JoinInvitedGroups adds the user to every group their email address was
+// invited to, once they've confirmed the address is theirs, and returns how
+// many they joined.
+func (s *Service) JoinInvitedGroups(userID int) (int, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.models.GroupInvitations.AcceptAllForEmail(user.Email, user.ID)
+}
+
+// UpdateGroup changes the name and description of a group the user is the
+// owner or an admin of.
+func (s *Service) UpdateGroup(userID, groupID int, name, description string) error {
+	group, err := s.getManagedGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	v := checkGroup(name, description)
+	if !v.Valid() {
+		return failedValidation(v)
+	}
+
+	return s.models.Groups.Update(group.ID, name, description)
+}
+
+// DeleteGroup deletes a group the user owns.
+func (s *Service) DeleteGroup(userID, groupID int) error {
+	group, err := s.getOwnedGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	return s.models.Groups.Delete(group.ID)
+}
+
+// RemoveGroupMember takes someone else out of a group. The owner can remove
+// anyone; admins can only remove plain members.
+func (s *Service) RemoveGroupMember(userID, groupID, memberID int) error {
+	group, err := s.getManagedGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	if memberID == userID {
+		return invalid("Leave the group to remove yourself from it")
+	}
+
+	switch memberRole(group, memberID) {
+	case "":
+		return notFound("That user isn't a member of this group")
+	case data.GroupRoleOwner:
+		return forbidden("The owner of a group can't be removed")
+	case data.GroupRoleAdmin:
+		if memberRole(group, userID) != data.GroupRoleOwner {
+			return forbidden("Only the owner of this group can remove its admins")
+		}
+	}
+
+	return s.models.Groups.RemoveMember(group.ID, memberID)
+}
+
+// LeaveGroup takes the user out of a group. The owner has to hand the group
+// to someone else, or delete it, first.
+func (s *Service) LeaveGroup(userID, groupID int) error {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	if memberRole(group, userID) == data.GroupRoleOwner {
+		return conflict("Transfer ownership of the group or delete it before leaving")
+	}
+
+	return s.models.Groups.RemoveMember(group.ID, userID)
+}
+
+// SetGroupMemberRole makes another member of a group the user owns an admin
+// or a plain member.
+func (s *Service) SetGroupMemberRole(userID, groupID, memberID int, role string) error {
+	group, err := s.getOwnedGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	if role != data.GroupRoleAdmin && role != data.GroupRoleMember {
+		return invalid("Role must be admin or member")
+	}
+
+	switch memberRole(group, memberID) {
+	case "":
+		return notFound("That user isn't a member of this group")
+	case data.GroupRoleOwner:
+		return invalid("Transfer ownership of the group to give up being its owner")
+	}
+
+	return s.models.Groups.SetRole(group.ID, memberID, role)
+}
+
+// TransferGroupOwnership hands a group the user owns to another of its
+// members. The user stays on as an admin.
+func (s *Service) TransferGroupOwnership(userID, groupID, newOwnerID int) error {
+	group, err := s.getOwnedGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	if newOwnerID == userID {
+		return invalid("You already own this group")
+	}
+
+	if memberRole(group, newOwnerID) == "" {
+		return notFound("That user isn't a member of this group")
+	}
+
+	return s.models.Groups.TransferOwnership(group.ID, userID, newOwnerID)
+}
+
+// SetGroupCalendar turns the shared calendar of a group the user is the owner
+// or an admin of on or off. Turning it off stops the members' feeds of it.
+func (s *Service) SetGroupCalendar(userID, groupID int, enabled bool) error {
+	group, err := s.getManagedGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	return s.models.Groups.SetCalendarEnabled(group.ID, enabled)
+}
+
+// getGroupWithCalendar returns the group if the user is a member and it has a
+// shared calendar.
+func (s *Service) getGroupWithCalendar(userID, groupID int) (*data.Group, error) {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !group.CalendarEnabled {
+		return nil, notFound("This group doesn't have a calendar")
+	}
+
+	return group, nil
+}
+
+// GetUpcomingGroupAppointments returns the appointments in the shared
+// calendar of a group the user is in that haven't ended yet.
+func (s *Service) GetUpcomingGroupAppointments(userID, groupID int) ([]*data.Appointment, error) {
+	group, err := s.getGroupWithCalendar(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.models.Appointments.GetForGroup(group.ID, time.Now())
+}
+
+// GetGroupCalendarFeed returns the user's feed of a group's calendar, or nil
+// if they haven't got one.
+func (s *Service) GetGroupCalendarFeed(userID, groupID int) (*data.GroupCalendarFeed, error) {
+	group, err := s.getGroupWithCalendar(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := s.models.GroupCalendarFeeds.GetForMember(group.ID, userID)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// CreateGroupCalendarFeed gives the user a feed of the shared calendar of a
+// group they're in, or a new URL for the one they have.
+func (s *Service) CreateGroupCalendarFeed(userID, groupID int) (*data.GroupCalendarFeed, error) {
+	group, err := s.getGroupWithCalendar(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.models.GroupCalendarFeeds.New(group.ID, userID)
+}
+
+// DeleteGroupCalendarFeed turns off the user's feed of a group's calendar.
+func (s *Service) DeleteGroupCalendarFeed(userID, groupID int) error {
+	group, err := s.GetGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	return s.models.GroupCalendarFeeds.Delete(group.ID, userID)
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// GetVisibleUser returns a user the viewer can reach: one in their
+// organisation, or in one that shares with it. Anyone else looks like they
+// don't exist.
+func (s *Service) GetVisibleUser(viewerID, userID int) (*data.User, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkReachable(viewerID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// checkReachable returns a not found error unless the viewer can reach the
+// user.
+func (s *Service) checkReachable(viewerID, userID int) error {
+	ok, err := s.models.Users.Reachable(viewerID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound("User not found")
+	}
+	return nil
+}
+
+// GetOrganisation returns an organisation the user is in. Instance admins
+// can see any of them; to everyone else, other organisations don't exist.
+func (s *Service) GetOrganisation(userID, orgID int) (*data.Organisation, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.OrganisationID != orgID && !user.IsAdmin {
+		return nil, notFound("Organisation not found")
+	}
+
+	org, err := s.models.Organisations.Get(orgID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Organisation not found")
+		}
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// CanManageOrganisation reports whether the user is an admin of the
+// organisation, or of the instance.
+func CanManageOrganisation(user *data.User, orgID int) bool {
+	return user.IsAdmin || (user.OrganisationID == orgID && user.OrganisationRole == data.OrganisationRoleAdmin)
+}
+
+// getManagedOrganisation returns the organisation if the user can manage it.
+func (s *Service) getManagedOrganisation(userID, orgID int) (*data.Organisation, error) {
+	org, err := s.GetOrganisation(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanManageOrganisation(user, org.ID) {
+		return nil, forbidden("Only the admins of this organisation can do that")
+	}
+
+	return org, nil
+}
+
+// GetOrganisationMembers returns the members of an organisation the user can
+// see.
+func (s *Service) GetOrganisationMembers(userID, orgID int) ([]*data.OrganisationMember, error) {
+	org, err := s.GetOrganisation(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.models.Organisations.GetMembers(org.ID)
+}
+
+// GetOrganisationShares returns the organisations an organisation the user
+// can see has let find its members.
+func (s *Service) GetOrganisationShares(userID, orgID int) ([]*data.Organisation, error) {
+	org, err := s.GetOrganisation(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.models.Organisations.GetShares(org.ID)
+}
+
+// NewOrganisation holds what's needed to set up an organisation.
+type NewOrganisation struct {
+	Name string
+	// Domain is the email domain whose users join the organisation, if any.
+	Domain string
+	// AdminEmail is the address of an existing user who becomes its first
+	// admin, if any.
+	AdminEmail string
+}
+
+// CreateOrganisation sets up an organisation, which only instance admins can
+// do, and returns its ID. Users already at its domain join it straight away.
+func (s *Service) CreateOrganisation(userID int, in NewOrganisation) (int, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	if !user.IsAdmin {
+		return 0, forbidden("Only instance admins can create organisations")
+	}
+
+	in.Name = strings.TrimSpace(in.Name)
+	in.Domain = strings.ToLower(strings.TrimSpace(in.Domain))
+	in.AdminEmail = strings.TrimSpace(in.AdminEmail)
+
+	var v validator.Validator
+	v.CheckField(validator.NotBlank(in.Name), "name", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(in.Name, 100), "name", "This field is too long")
+	if in.Domain != "" {
+		v.CheckField(validator.Matches(in.Domain, validator.DomainRX), "domain", "This field must be a domain, e.g. example.com")
+	}
+
+	var admin *data.User
+	if in.AdminEmail != "" {
+		admin, err = s.models.Users.GetByEmail(in.AdminEmail)
+		if err != nil && !isNotFound(err) {
+			return 0, err
+		}
+		v.CheckField(admin != nil, "admin_email", "No user with this email address")
+	}
+
+	if !v.Valid() {
+		return 0, failedValidation(v)
+	}
+
+	orgID, err := s.models.Organisations.Insert(in.Name, in.Domain)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateDomain) {
+			v.AddFieldError("domain", "Another organisation already has this domain")
+			return 0, failedValidation(v)
+		}
+		return 0, err
+	}
+
+	if admin != nil {
+		err = s.models.Organisations.AddMember(orgID, admin.ID, data.OrganisationRoleAdmin)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return orgID, nil
+}
+
+// AddOrganisationMember moves the user with the email address into an
+// organisation. Only instance admins can do that, as it takes the user out
+// of any organisation they were in.
+func (s *Service) AddOrganisationMember(userID, orgID int, email string) error {
+	org, err := s.GetOrganisation(userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return forbidden("Only instance admins can add people to organisations")
+	}
+
+	member, err := s.models.Users.GetByEmail(strings.TrimSpace(email))
+	if err != nil {
+		if isNotFound(err) {
+			var v validator.Validator
+			v.AddFieldError("email", "No user with this email address")
+			return failedValidation(v)
+		}
+		return err
+	}
+
+	if member.OrganisationID == org.ID {
+		return conflict("That user is already a member of this organisation")
+	}
+
+	return s.models.Organisations.AddMember(org.ID, member.ID, data.OrganisationRoleMember)
+}
+
+// getOrganisationMember returns a user other than the acting one who is in
+// the organisation.
+func (s *Service) getOrganisationMember(userID, orgID, memberID int) (*data.User, error) {
+	if memberID == userID {
+		return nil, invalid("Ask another admin to change your own membership")
+	}
+
+	member, err := s.models.Users.Get(memberID)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	if member == nil || member.OrganisationID != orgID {
+		return nil, notFound("That user isn't a member of this organisation")
+	}
+
+	return member, nil
+}
+
+// RemoveOrganisationMember takes someone out of an organisation the user
+// manages. They can then only reach people outside any organisation.
+func (s *Service) RemoveOrganisationMember(userID, orgID, memberID int) error {
+	org, err := s.getManagedOrganisation(userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	member, err := s.getOrganisationMember(userID, org.ID, memberID)
+	if err != nil {
+		return err
+	}
+
+	return s.models.Organisations.RemoveMember(org.ID, member.ID)
+}
+
+// SetOrganisationMemberRole makes another member of an organisation the user
+// manages an admin or a plain member.
+func (s *Service) SetOrganisationMemberRole(userID, orgID, memberID int, role string) error {
+	org, err := s.getManagedOrganisation(userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	if !validator.PermittedValue(role, data.OrganisationRoleAdmin, data.OrganisationRoleMember) {
+		return invalid("Role must be admin or member")
+	}
+
+	member, err := s.getOrganisationMember(userID, org.ID, memberID)
+	if err != nil {
+		return err
+	}
+
+	return s.models.Organisations.SetRole(org.ID, member.ID, role)
+}
+
+// ShareOrganisation lets the members of another organisation find and send
+// requests to the members of one the user manages.
+func (s *Service) ShareOrganisation(userID, orgID, sharedWithID int) error {
+	org, err := s.getManagedOrganisation(userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	if sharedWithID == org.ID {
+		return invalid("An organisation can't be shared with itself")
+	}
+
+	_, err = s.models.Organisations.Get(sharedWithID)
+	if err != nil {
+		if isNotFound(err) {
+			return notFound("Organisation not found")
+		}
+		return err
+	}
+
+	return s.models.Organisations.Share(org.ID, sharedWithID)
+}
+
+// UnshareOrganisation stops sharing an organisation the user manages with
+// another. Requests already sent between them stay as they are.
+func (s *Service) UnshareOrganisation(userID, orgID, sharedWithID int) error {
+	org, err := s.getManagedOrganisation(userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	err = s.models.Organisations.Unshare(org.ID, sharedWithID)
+	if isNotFound(err) {
+		return notFound("This organisation isn't shared with that one")
+	}
+	return err
+}
+
+// JoinOrganisationByDomain puts a user who has confirmed their email address
+// in the organisation at its domain, if there is one and they aren't in one
+// already. It returns the ID of the organisation they joined, or 0.
+func (s *Service) JoinOrganisationByDomain(userID int) (int, error) {
+	return s.models.Organisations.JoinByDomain(userID)
+}
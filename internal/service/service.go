@@ -0,0 +1,85 @@
+// Package service holds the application logic shared by the HTML and JSON
+// handlers, so both check and do things in exactly the same way.
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/mailer"
+	"github.com/tmgasek/calendar-app/internal/validator"
+)
+
+// Kinds of Error. Not found errors use data.ErrRecordNotFound.
+var (
+	ErrInvalid   = errors.New("invalid input")
+	ErrForbidden = errors.New("forbidden")
+	ErrConflict  = errors.New("conflict")
+)
+
+// Error is an error caused by the caller rather than by the server, with a
+// message that is safe to show them. Use errors.Is with the kinds above to
+// tell them apart.
+type Error struct {
+	Kind    error
+	Message string
+	// Fields holds a message for each invalid input field, if any.
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func invalid(message string) error {
+	return &Error{Kind: ErrInvalid, Message: message}
+}
+
+func forbidden(message string) error {
+	return &Error{Kind: ErrForbidden, Message: message}
+}
+
+func conflict(message string) error {
+	return &Error{Kind: ErrConflict, Message: message}
+}
+
+func notFound(message string) error {
+	return &Error{Kind: data.ErrRecordNotFound, Message: message}
+}
+
+// failedValidation turns the field errors of the validator into an Error.
+func failedValidation(v validator.Validator) error {
+	message := "Invalid form data"
+	if len(v.NonFieldErrors) > 0 {
+		message = v.NonFieldErrors[0]
+	}
+	return &Error{Kind: ErrInvalid, Message: message, Fields: v.FieldErrors}
+}
+
+// isNotFound reports whether a model couldn't find a record. Some models
+// still return sql.ErrNoRows for that.
+func isNotFound(err error) bool {
+	return errors.Is(err, data.ErrRecordNotFound) || errors.Is(err, sql.ErrNoRows)
+}
+
+// EventFetcher returns the events in the calendars a user has linked.
+type EventFetcher func(userID int) ([]*data.Event, error)
+
+type Service struct {
+	models      data.Models
+	mailer      mailer.MailerInterface
+	fetchEvents EventFetcher
+}
+
+func New(models data.Models, mailer mailer.MailerInterface, fetchEvents EventFetcher) *Service {
+	return &Service{
+		models:      models,
+		mailer:      mailer,
+		fetchEvents: fetchEvents,
+	}
+}
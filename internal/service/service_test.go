@@ -0,0 +1,717 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+	"github.com/tmgasek/calendar-app/internal/data"
+	"github.com/tmgasek/calendar-app/internal/data/mocks"
+)
+
+func newTestService(events ...*data.Event) *Service {
+	return New(mocks.NewMockModels(), mocks.NewMockMailer(), func(userID int) ([]*data.Event, error) {
+		return events, nil
+	})
+}
+
+func TestServiceErrorKinds(t *testing.T) {
+	s := newTestService()
+
+	tests := []struct {
+		name     string
+		call     func() error
+		wantKind error
+	}{
+		{
+			name: "Missing appointment",
+			call: func() error {
+				_, err := s.GetAppointment(1, 99)
+				return err
+			},
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Someone else's request",
+			call: func() error {
+				_, err := s.RespondToAppointmentRequest(1, 1, data.ParticipantAccepted, "")
+				return err
+			},
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Request from an unconfirmed user",
+			call: func() error {
+				_, err := s.CreateAppointmentRequest(3, NewAppointmentRequest{
+					TargetUserID: 2,
+					Title:        "Catch up",
+					Description:  "Coffee",
+					StartTime:    time.Date(2030, 5, 11, 10, 0, 0, 0, time.UTC),
+					EndTime:      time.Date(2030, 5, 11, 11, 0, 0, 0, time.UTC),
+				})
+				return err
+			},
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Request to an unconfirmed user",
+			call: func() error {
+				_, err := s.CreateAppointmentRequest(1, NewAppointmentRequest{
+					TargetUserID: 3,
+					Title:        "Catch up",
+					Description:  "Coffee",
+					StartTime:    time.Date(2030, 5, 11, 10, 0, 0, 0, time.UTC),
+					EndTime:      time.Date(2030, 5, 11, 11, 0, 0, 0, time.UTC),
+				})
+				return err
+			},
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Blank group name",
+			call: func() error {
+				_, err := s.CreateGroup(1, "", "")
+				return err
+			},
+			wantKind: ErrInvalid,
+		},
+		{
+			name: "Existing group member",
+			call: func() error {
+				_, err := s.InviteToGroup(1, 1, "alice@example.com")
+				return err
+			},
+			wantKind: ErrConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+
+			var serviceErr *Error
+			assert.Equal(t, errors.As(err, &serviceErr), true)
+			assert.Equal(t, errors.Is(err, tt.wantKind), true)
+		})
+	}
+}
+
+func TestCreateAppointmentRequestConflict(t *testing.T) {
+	start := time.Date(2030, 5, 11, 10, 0, 0, 0, time.UTC)
+	s := newTestService(&data.Event{StartTime: start, EndTime: start.Add(time.Hour)})
+
+	_, err := s.CreateAppointmentRequest(1, NewAppointmentRequest{
+		TargetUserID: 2,
+		Title:        "Catch up",
+		Description:  "Coffee",
+		StartTime:    start.Add(30 * time.Minute),
+		EndTime:      start.Add(90 * time.Minute),
+	})
+	assert.Equal(t, errors.Is(err, ErrConflict), true)
+}
+
+func TestRespondToAppointmentRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    string
+		reason      string
+		want        Outcome
+		wantReasons []string
+	}{
+		{"Accept", data.ParticipantAccepted, "", OutcomeConfirmed, nil},
+		{"Tentative", data.ParticipantTentative, "", OutcomeRecorded, nil},
+		{"Decline with a reason", data.ParticipantDeclined, "Away that week", OutcomeDeclined, []string{"Away that week"}},
+		{"Decline", data.ParticipantDeclined, "", OutcomeDeclined, []string{"Not enough participants accepted"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService()
+
+			// Bob is the only one asked to request 1.
+			outcome, err := s.RespondToAppointmentRequest(2, 1, tt.response, tt.reason)
+			assert.NilError(t, err)
+			assert.Equal(t, outcome, tt.want)
+
+			reasons := s.models.AppointmentRequests.(*mocks.AppointmentRequestModel).DeclineReasons
+			assert.Equal(t, len(reasons), len(tt.wantReasons))
+			for i := range tt.wantReasons {
+				assert.Equal(t, reasons[i], tt.wantReasons[i])
+			}
+		})
+	}
+}
+
+func TestGroupRoles(t *testing.T) {
+	// In group 3 Alice (1) is the owner, Bob (2) an admin and Carol (3) a
+	// member.
+	const team = 3
+
+	tests := []struct {
+		name     string
+		call     func(s *Service) error
+		wantKind error
+	}{
+		{
+			name: "Member invites",
+			call: func(s *Service) error {
+				_, err := s.InviteToGroup(3, team, "dupe@example.com")
+				return err
+			},
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Admin invites",
+			call: func(s *Service) error {
+				_, err := s.InviteToGroup(2, team, "carol@example.com")
+				return err
+			},
+			// Carol is already in, so getting past the role check conflicts.
+			wantKind: ErrConflict,
+		},
+		{
+			name:     "Member edits",
+			call:     func(s *Service) error { return s.UpdateGroup(3, team, "New name", "New description") },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Admin edits",
+			call: func(s *Service) error { return s.UpdateGroup(2, team, "New name", "New description") },
+		},
+		{
+			name:     "Admin deletes",
+			call:     func(s *Service) error { return s.DeleteGroup(2, team) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Owner deletes",
+			call: func(s *Service) error { return s.DeleteGroup(1, team) },
+		},
+		{
+			name: "Admin removes member",
+			call: func(s *Service) error { return s.RemoveGroupMember(2, team, 3) },
+		},
+		{
+			name:     "Admin removes owner",
+			call:     func(s *Service) error { return s.RemoveGroupMember(2, team, 1) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name:     "Member removes member",
+			call:     func(s *Service) error { return s.RemoveGroupMember(3, team, 2) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Owner removes admin",
+			call: func(s *Service) error { return s.RemoveGroupMember(1, team, 2) },
+		},
+		{
+			name:     "Remove non-member",
+			call:     func(s *Service) error { return s.RemoveGroupMember(1, team, 4) },
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Member leaves",
+			call: func(s *Service) error { return s.LeaveGroup(3, team) },
+		},
+		{
+			name:     "Owner leaves",
+			call:     func(s *Service) error { return s.LeaveGroup(1, team) },
+			wantKind: ErrConflict,
+		},
+		{
+			name:     "Admin promotes",
+			call:     func(s *Service) error { return s.SetGroupMemberRole(2, team, 3, data.GroupRoleAdmin) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Owner promotes",
+			call: func(s *Service) error { return s.SetGroupMemberRole(1, team, 3, data.GroupRoleAdmin) },
+		},
+		{
+			name:     "Owner makes another owner",
+			call:     func(s *Service) error { return s.SetGroupMemberRole(1, team, 3, data.GroupRoleOwner) },
+			wantKind: ErrInvalid,
+		},
+		{
+			name:     "Admin transfers",
+			call:     func(s *Service) error { return s.TransferGroupOwnership(2, team, 3) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Owner transfers",
+			call: func(s *Service) error { return s.TransferGroupOwnership(1, team, 3) },
+		},
+		{
+			name:     "Owner transfers to non-member",
+			call:     func(s *Service) error { return s.TransferGroupOwnership(1, team, 4) },
+			wantKind: data.ErrRecordNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newTestService())
+			if tt.wantKind == nil {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Equal(t, errors.Is(err, tt.wantKind), true)
+		})
+	}
+}
+
+func TestGroupInvitations(t *testing.T) {
+	// Invitation 1 to group 1 is for Bob (2), invitation 2 for an address
+	// without an account and invitation 3 for Carol (3), who hasn't
+	// confirmed her address. Carol is a plain member of group 3.
+	const team = 3
+
+	tests := []struct {
+		name     string
+		call     func(s *Service) error
+		wantKind error
+	}{
+		{
+			name: "Owner invites an address without an account",
+			call: func(s *Service) error {
+				_, err := s.InviteToGroup(1, team, "dave@example.com")
+				return err
+			},
+		},
+		{
+			// Oscar's organisation doesn't share with Alice's, but that's
+			// only checked when he accepts.
+			name: "Owner invites someone in another organisation",
+			call: func(s *Service) error {
+				_, err := s.InviteToGroup(1, team, "oscar@globex.example")
+				return err
+			},
+		},
+		{
+			name: "Invite an invalid address",
+			call: func(s *Service) error {
+				_, err := s.InviteToGroup(1, team, "dave")
+				return err
+			},
+			wantKind: ErrInvalid,
+		},
+		{
+			name:     "Member cancels",
+			call:     func(s *Service) error { return s.CancelGroupInvitation(3, team, 1) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name:     "Cancel another group's invitation",
+			call:     func(s *Service) error { return s.CancelGroupInvitation(1, team, 1) },
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Owner cancels",
+			call: func(s *Service) error { return s.CancelGroupInvitation(1, 1, 1) },
+		},
+		{
+			name: "Invitee accepts",
+			call: func(s *Service) error {
+				_, err := s.AcceptGroupInvitation(2, 1)
+				return err
+			},
+		},
+		{
+			name: "Someone else accepts",
+			call: func(s *Service) error {
+				_, err := s.AcceptGroupInvitation(3, 1)
+				return err
+			},
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Invitee who hasn't confirmed their address accepts",
+			call: func(s *Service) error {
+				_, err := s.AcceptGroupInvitation(3, 3)
+				return err
+			},
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Invitee declines",
+			call: func(s *Service) error { return s.DeclineGroupInvitation(2, 1) },
+		},
+		{
+			name: "Accept by link",
+			call: func(s *Service) error {
+				_, err := s.RespondToGroupInvitationByToken(mocks.MockGroupInvitationToken, InvitationAccept)
+				return err
+			},
+		},
+		{
+			name: "Accept by link without an account",
+			call: func(s *Service) error {
+				_, err := s.RespondToGroupInvitationByToken(mocks.MockGroupInvitationTokenNoUser, InvitationAccept)
+				return err
+			},
+			wantKind: ErrInvalid,
+		},
+		{
+			name: "Decline by link without an account",
+			call: func(s *Service) error {
+				_, err := s.RespondToGroupInvitationByToken(mocks.MockGroupInvitationTokenNoUser, InvitationDecline)
+				return err
+			},
+		},
+		{
+			name: "Unknown link",
+			call: func(s *Service) error {
+				_, err := s.RespondToGroupInvitationByToken("nope", InvitationAccept)
+				return err
+			},
+			wantKind: data.ErrRecordNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newTestService())
+			if tt.wantKind == nil {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Equal(t, errors.Is(err, tt.wantKind), true)
+		})
+	}
+}
+
+func TestGetMyGroupInvitations(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID int
+		want   int
+	}{
+		{"Invitee", 2, 1},
+		{"Invitee who hasn't confirmed their address", 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invitations, err := newTestService().GetMyGroupInvitations(tt.userID)
+			assert.NilError(t, err)
+			assert.Equal(t, len(invitations), tt.want)
+		})
+	}
+}
+
+// newBusyService returns a service in which only the user is busy, for an
+// hour from start.
+func newBusyService(busyUserID int, start time.Time) *Service {
+	return New(mocks.NewMockModels(), mocks.NewMockMailer(), func(userID int) ([]*data.Event, error) {
+		if userID != busyUserID {
+			return nil, nil
+		}
+		return []*data.Event{{StartTime: start, EndTime: start.Add(time.Hour)}}, nil
+	})
+}
+
+func TestGroupAvailability(t *testing.T) {
+	// Bob (2) is busy from 10 to 11 on the day. Group 3 has Alice (1), Bob
+	// and Carol (3).
+	day := time.Date(2030, 5, 11, 0, 0, 0, 0, time.UTC)
+	s := newBusyService(2, day.Add(10*time.Hour))
+
+	q := GroupAvailabilityQuery{From: day, Days: 2, StartHour: 9, EndHour: 12}
+
+	availability, err := s.GroupAvailability(1, 3, q)
+	assert.NilError(t, err)
+	assert.Equal(t, len(availability.Slots), 2)
+	assert.Equal(t, len(availability.Slots[0]), 3)
+
+	nine, ten := availability.Slots[0][0], availability.Slots[0][1]
+	assert.Equal(t, nine.Start, day.Add(9*time.Hour))
+	assert.Equal(t, nine.Free, 3)
+	assert.Equal(t, nine.RequiredFree, true)
+	assert.Equal(t, ten.Free, 2)
+	assert.Equal(t, ten.Total, 3)
+	assert.Equal(t, ten.RequiredFree, false)
+
+	// Bob being busy doesn't matter if he's optional...
+	q.OptionalIDs = []int{2}
+	availability, err = s.GroupAvailability(1, 3, q)
+	assert.NilError(t, err)
+	assert.Equal(t, availability.Optional[2], true)
+	assert.Equal(t, availability.Slots[0][1].Free, 2)
+	assert.Equal(t, availability.Slots[0][1].RequiredFree, true)
+
+	// ...or left out.
+	q.OptionalIDs = nil
+	q.MemberIDs = []int{1, 3}
+	availability, err = s.GroupAvailability(1, 3, q)
+	assert.NilError(t, err)
+	assert.Equal(t, len(availability.Members), 2)
+	assert.Equal(t, availability.Slots[0][1].Free, 2)
+	assert.Equal(t, availability.Slots[0][1].Total, 2)
+
+	tests := []struct {
+		name     string
+		userID   int
+		groupID  int
+		q        GroupAvailabilityQuery
+		wantKind error
+	}{
+		{"Too many days", 1, 3, GroupAvailabilityQuery{From: day, Days: MaxGroupAvailabilityDays + 1, StartHour: 9, EndHour: 12}, ErrInvalid},
+		{"Hours backwards", 1, 3, GroupAvailabilityQuery{From: day, Days: 1, StartHour: 12, EndHour: 9}, ErrInvalid},
+		{"Non-member", 1, 3, GroupAvailabilityQuery{From: day, Days: 1, StartHour: 9, EndHour: 12, MemberIDs: []int{4}}, ErrInvalid},
+		{"Not in the group", 2, 1, GroupAvailabilityQuery{From: day, Days: 1, StartHour: 9, EndHour: 12}, ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.GroupAvailability(tt.userID, tt.groupID, tt.q)
+			assert.Equal(t, errors.Is(err, tt.wantKind), true)
+		})
+	}
+}
+
+func TestGroupCalendar(t *testing.T) {
+	s := newTestService()
+
+	// Group 3 has a calendar with appointment 2 in it, between Alice (1) and
+	// Bob (2). Carol (3) is a plain member.
+	appointments, err := s.GetUpcomingGroupAppointments(3, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(appointments), 1)
+	assert.Equal(t, appointments[0].ID, 2)
+
+	_, err = s.GetAppointment(3, 2)
+	assert.NilError(t, err)
+
+	// Appointments outside the group's calendar stay private.
+	_, err = s.GetAppointment(3, 1)
+	assert.Equal(t, errors.Is(err, ErrForbidden), true)
+
+	tests := []struct {
+		name     string
+		call     func(s *Service) error
+		wantKind error
+	}{
+		{
+			name: "Member subscribes",
+			call: func(s *Service) error {
+				_, err := s.CreateGroupCalendarFeed(3, 3)
+				return err
+			},
+		},
+		{
+			name: "Subscribe without a calendar",
+			call: func(s *Service) error {
+				_, err := s.CreateGroupCalendarFeed(1, 1)
+				return err
+			},
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Non-member subscribes",
+			call: func(s *Service) error {
+				_, err := s.CreateGroupCalendarFeed(2, 1)
+				return err
+			},
+			wantKind: ErrForbidden,
+		},
+		{
+			name:     "Member turns off calendar",
+			call:     func(s *Service) error { return s.SetGroupCalendar(3, 3, false) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Admin turns off calendar",
+			call: func(s *Service) error { return s.SetGroupCalendar(2, 3, false) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(s)
+			if tt.wantKind == nil {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Equal(t, errors.Is(err, tt.wantKind), true)
+		})
+	}
+}
+
+func TestCreateAppointmentRequestOptionalMember(t *testing.T) {
+	// Carol (3) is busy, but she's only an optional member of group 3.
+	start := time.Date(2030, 5, 11, 10, 0, 0, 0, time.UTC)
+	s := newBusyService(3, start)
+
+	in := NewAppointmentRequest{
+		TargetUserID:    2,
+		GroupID:         3,
+		Title:           "Planning",
+		Description:     "Next quarter",
+		StartTime:       start,
+		EndTime:         start.Add(time.Hour),
+		OptionalUserIDs: []int{3},
+	}
+
+	_, err := s.CreateAppointmentRequest(1, in)
+	assert.NilError(t, err)
+
+	in.OptionalUserIDs = nil
+	_, err = s.CreateAppointmentRequest(1, in)
+	assert.Equal(t, errors.Is(err, ErrConflict), true)
+}
+
+func TestOrganisations(t *testing.T) {
+	s := newTestService()
+
+	// Alice (1) and Bob (2) are both in Example, but Oscar (5) is in Globex,
+	// which doesn't share with it.
+	_, err := s.GetVisibleUser(1, 2)
+	assert.NilError(t, err)
+
+	_, err = s.GetVisibleUser(1, 5)
+	assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+
+	start := time.Date(2030, 5, 11, 10, 0, 0, 0, time.UTC)
+	_, err = s.CreateAppointmentRequest(1, NewAppointmentRequest{
+		TargetUserID: 5,
+		Title:        "Catch up",
+		Description:  "Across organisations",
+		StartTime:    start,
+		EndTime:      start.Add(time.Hour),
+	})
+	assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+
+	tests := []struct {
+		name     string
+		call     func(s *Service) error
+		wantKind error
+	}{
+		{
+			name: "Member sees own organisation",
+			call: func(s *Service) error {
+				_, err := s.GetOrganisation(2, 1)
+				return err
+			},
+		},
+		{
+			name: "Member sees another organisation",
+			call: func(s *Service) error {
+				_, err := s.GetOrganisation(2, 2)
+				return err
+			},
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name:     "Member changes a role",
+			call:     func(s *Service) error { return s.SetOrganisationMemberRole(2, 1, 3, data.OrganisationRoleAdmin) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Organisation admin changes a role",
+			call: func(s *Service) error { return s.SetOrganisationMemberRole(1, 1, 3, data.OrganisationRoleAdmin) },
+		},
+		{
+			name:     "Organisation admin removes someone else's member",
+			call:     func(s *Service) error { return s.RemoveOrganisationMember(5, 2, 2) },
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name:     "Organisation admin adds a member",
+			call:     func(s *Service) error { return s.AddOrganisationMember(5, 2, "bob@example.com") },
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Organisation admin shares",
+			call: func(s *Service) error { return s.ShareOrganisation(5, 2, 1) },
+		},
+		{
+			name: "Member creates an organisation",
+			call: func(s *Service) error {
+				_, err := s.CreateOrganisation(2, NewOrganisation{Name: "Initech"})
+				return err
+			},
+			wantKind: ErrForbidden,
+		},
+		{
+			name: "Instance admin creates an organisation with a taken domain",
+			call: func(s *Service) error {
+				_, err := s.CreateOrganisation(1, NewOrganisation{Name: "Initech", Domain: "Example.com"})
+				return err
+			},
+			wantKind: ErrInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(s)
+			if tt.wantKind == nil {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Equal(t, errors.Is(err, tt.wantKind), true)
+		})
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	tests := []struct {
+		name        string
+		call        func(s *Service) error
+		wantKind    error
+		wantEntries int
+	}{
+		{
+			name:        "Admin disables a user",
+			call:        func(s *Service) error { return s.SetUserDisabled(1, 2, true) },
+			wantEntries: 1,
+		},
+		{
+			name:     "Admin disables themselves",
+			call:     func(s *Service) error { return s.SetUserDisabled(1, 1, true) },
+			wantKind: ErrInvalid,
+		},
+		{
+			name:     "Organisation admin disables a member",
+			call:     func(s *Service) error { return s.SetUserDisabled(5, 2, true) },
+			wantKind: ErrForbidden,
+		},
+		{
+			name:     "Admin disables a missing user",
+			call:     func(s *Service) error { return s.SetUserDisabled(1, 99, true) },
+			wantKind: data.ErrRecordNotFound,
+		},
+		{
+			name: "Admin impersonates a user",
+			call: func(s *Service) error {
+				_, err := s.StartImpersonation(1, 3)
+				return err
+			},
+			wantEntries: 1,
+		},
+		{
+			name: "Member impersonates a user",
+			call: func(s *Service) error {
+				_, err := s.StartImpersonation(2, 3)
+				return err
+			},
+			wantKind: ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService()
+
+			err := tt.call(s)
+			if tt.wantKind == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.Equal(t, errors.Is(err, tt.wantKind), true)
+			}
+			assert.Equal(t, len(s.models.AuditLog.(*mocks.AuditLogModel).Entries), tt.wantEntries)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package service
+
+import "github.com/tmgasek/calendar-app/internal/data"
+
+// GetUser returns the user with the ID.
+func (s *Service) GetUser(userID int) (*data.User, error) {
+	user, err := s.models.Users.Get(userID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("User not found")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/tmgasek/calendar-app/internal/data"
+)
+
+// GetWebhook returns the webhook if the user registered it or is a member
+// of the group it belongs to.
+func (s *Service) GetWebhook(userID, webhookID int) (*data.Webhook, error) {
+	webhook, err := s.models.Webhooks.Get(webhookID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Webhook not found")
+		}
+		return nil, err
+	}
+
+	if webhook.UserID == userID {
+		return webhook, nil
+	}
+
+	if webhook.GroupID != 0 {
+		_, err = s.GetGroup(userID, webhook.GroupID)
+		if err == nil {
+			return webhook, nil
+		}
+		if !isNotFound(err) && !errors.Is(err, ErrForbidden) {
+			return nil, err
+		}
+	}
+
+	return nil, forbidden("You do not have permission to manage this webhook.")
+}
@@ -0,0 +1,161 @@
+// Package sse holds an in-process publish/subscribe hub for server-sent
+// events. The hub keeps a short history so clients that reconnect with a
+// Last-Event-ID get the events they missed.
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ResyncEvent is sent instead of the missed events when they're no longer all
+// kept, e.g. after a restart. Clients should reload whatever they show.
+const ResyncEvent = "resync"
+
+// Event is a message for one user, or for everyone if UserID is zero.
+type Event struct {
+	ID     int64
+	UserID int
+	Name   string
+	Data   []byte
+}
+
+// WriteTo writes the event in the text/event-stream format.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Name, e.Data)
+	return int64(n), err
+}
+
+type subscriber struct {
+	userID int
+	ch     chan Event
+}
+
+func (s *subscriber) wants(e Event) bool {
+	return e.UserID == 0 || e.UserID == s.userID
+}
+
+// Hub passes published events on to the subscribers they're for. A
+// subscriber that falls too far behind is dropped: its channel is closed and
+// it's expected to reconnect and replay what it missed.
+type Hub struct {
+	mu      sync.Mutex
+	lastID  int64
+	history []Event
+	size    int
+	subs    map[*subscriber]struct{}
+}
+
+// NewHub returns a hub that keeps the last historySize events for replay.
+func NewHub(historySize int) *Hub {
+	return &Hub{
+		size: historySize,
+		subs: make(map[*subscriber]struct{}),
+	}
+}
+
+// Publish sends the event, with data encoded as JSON, to the user, or to
+// everyone if userID is zero.
+func (h *Hub) Publish(userID int, name string, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e := Event{ID: h.lastID, UserID: userID, Name: name, Data: js}
+
+	if len(h.history) > 0 && len(h.history) >= h.size {
+		copy(h.history, h.history[1:])
+		h.history = h.history[:len(h.history)-1]
+	}
+	h.history = append(h.history, e)
+
+	for s := range h.subs {
+		if !s.wants(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			close(s.ch)
+			delete(h.subs, s)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns the user's events published after lastID, which is zero
+// for a new connection, and a channel of the ones published from now on. If
+// some of the missed events are no longer kept, the replay is a single
+// ResyncEvent instead. Call cancel once done with the channel.
+func (h *Hub) Subscribe(userID int, lastID int64) (replay []Event, events <-chan Event, cancel func()) {
+	s := &subscriber{userID: userID, ch: make(chan Event, 16)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if lastID > 0 {
+		replay = h.since(s, lastID)
+	}
+
+	h.subs[s] = struct{}{}
+
+	cancel = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subs[s]; ok {
+			close(s.ch)
+			delete(h.subs, s)
+		}
+	}
+
+	return replay, s.ch, cancel
+}
+
+// Subscribers returns the IDs of the users with a connection open, once
+// each.
+func (h *Hub) Subscribers() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen := make(map[int]bool)
+	userIDs := []int{}
+	for s := range h.subs {
+		if !seen[s.userID] {
+			seen[s.userID] = true
+			userIDs = append(userIDs, s.userID)
+		}
+	}
+
+	return userIDs
+}
+
+// since returns the subscriber's events after lastID. h.mu must be held.
+func (h *Hub) since(s *subscriber, lastID int64) []Event {
+	// Events before the oldest one kept, or after the newest one published,
+	// which happens when the server has restarted, can't be replayed.
+	oldest := h.lastID + 1
+	if len(h.history) > 0 {
+		oldest = h.history[0].ID
+	}
+	if lastID > h.lastID || lastID+1 < oldest {
+		return []Event{{ID: h.lastID, UserID: s.userID, Name: ResyncEvent, Data: []byte("{}")}}
+	}
+
+	var replay []Event
+	for _, e := range h.history {
+		if e.ID > lastID && s.wants(e) {
+			replay = append(replay, e)
+		}
+	}
+
+	return replay
+}
@@ -0,0 +1,114 @@
+package sse
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+func TestHubPublish(t *testing.T) {
+	h := NewHub(10)
+
+	_, alice, cancel := h.Subscribe(1, 0)
+	defer cancel()
+	_, bob, cancelBob := h.Subscribe(2, 0)
+	defer cancelBob()
+
+	err := h.Publish(1, "requests", map[string]int{"pending": 2})
+	assert.NilError(t, err)
+	err = h.Publish(0, "availability", map[string]int{"user_id": 3})
+	assert.NilError(t, err)
+
+	e := <-alice
+	assert.Equal(t, e.Name, "requests")
+	assert.Equal(t, string(e.Data), `{"pending":2}`)
+	e = <-alice
+	assert.Equal(t, e.Name, "availability")
+
+	// Bob only gets the event for everyone.
+	e = <-bob
+	assert.Equal(t, e.Name, "availability")
+	assert.Equal(t, len(bob), 0)
+}
+
+func TestHubReplay(t *testing.T) {
+	h := NewHub(3)
+
+	for i := 0; i < 4; i++ {
+		h.Publish(1, "requests", i)
+	}
+	h.Publish(2, "requests", "bob")
+
+	tests := []struct {
+		name     string
+		lastID   int64
+		wantIDs  []int64
+		wantName string
+	}{
+		{"New connection", 0, nil, ""},
+		{"Missed kept events", 2, []int64{3, 4}, "requests"},
+		{"Up to date", 5, nil, ""},
+		{"Missed dropped events", 1, []int64{5}, ResyncEvent},
+		{"After a restart", 9, []int64{5}, ResyncEvent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replay, _, cancel := h.Subscribe(1, tt.lastID)
+			defer cancel()
+
+			assert.Equal(t, len(replay), len(tt.wantIDs))
+			for i, e := range replay {
+				assert.Equal(t, e.ID, tt.wantIDs[i])
+				assert.Equal(t, e.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	h := NewHub(100)
+
+	_, events, cancel := h.Subscribe(1, 0)
+	defer cancel()
+
+	for i := 0; i < cap(events)+1; i++ {
+		h.Publish(1, "requests", i)
+	}
+
+	n := 0
+	for range events {
+		n++
+	}
+	assert.Equal(t, n, cap(events))
+}
+
+func TestHubSubscribers(t *testing.T) {
+	h := NewHub(10)
+	assert.Equal(t, len(h.Subscribers()), 0)
+
+	_, _, cancel := h.Subscribe(1, 0)
+	_, _, cancelAgain := h.Subscribe(1, 0)
+	defer cancelAgain()
+	_, _, cancelBob := h.Subscribe(2, 0)
+	defer cancelBob()
+
+	// Alice has two tabs open, but is only counted once.
+	assert.Equal(t, len(h.Subscribers()), 2)
+
+	cancel()
+	assert.Equal(t, len(h.Subscribers()), 2)
+
+	cancelBob()
+	assert.Equal(t, len(h.Subscribers()), 1)
+	assert.Equal(t, h.Subscribers()[0], 1)
+}
+
+func TestEventWriteTo(t *testing.T) {
+	var buf bytes.Buffer
+
+	_, err := Event{ID: 7, Name: "requests", Data: []byte(`{"pending":1}`)}.WriteTo(&buf)
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), "id: 7\nevent: requests\ndata: {\"pending\":1}\n\n")
+}
@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmgasek/calendar-app/internal/assert"
+)
+
+// rfcSecret is the SHA-1 key of the test vectors in RFC 6238 appendix B.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC's codes are eight digits; ours are the last six of them.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		assert.NilError(t, err)
+		assert.Equal(t, code, tt.want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	counter, ok := Validate(rfcSecret, "050471", now)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, counter, Counter(now))
+
+	// The code from the period before is still accepted.
+	_, ok = Validate(rfcSecret, "050471", now.Add(Period))
+	assert.Equal(t, ok, true)
+
+	_, ok = Validate(rfcSecret, "050471", now.Add(3*Period))
+	assert.Equal(t, ok, false)
+
+	_, ok = Validate(rfcSecret, "050 471", now)
+	assert.Equal(t, ok, true)
+
+	_, ok = Validate(rfcSecret, "123456", now)
+	assert.Equal(t, ok, false)
+
+	_, ok = Validate(rfcSecret, "12345", now)
+	assert.Equal(t, ok, false)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NilError(t, err)
+	assert.Equal(t, len(secret), 32)
+
+	_, err = Code(secret, 1)
+	assert.NilError(t, err)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Calendar Genie", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	assert.Equal(t, strings.HasPrefix(uri, "otpauth://totp/Calendar%20Genie:alice@example.com?"), true)
+	assert.StringContains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.StringContains(t, uri, "issuer=Calendar+Genie")
+}
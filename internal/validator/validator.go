@@ -64,7 +64,10 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return false
 }
 
-var EmailRX = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+var EmailRX = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}$`)
+
+// DomainRX matches the domain part of the addresses EmailRX accepts.
+var DomainRX = regexp.MustCompile(`^[a-z0-9.\-]+\.[a-z]{2,}$`)
 
 // Returns True if a value containt at least N chars.
 func MinChars(value string, n int) bool {
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS appointment_requests_pending_start_time_idx;
+
+ALTER TABLE appointment_requests
+DROP CONSTRAINT appointment_requests_status_check,
+DROP COLUMN decline_reason,
+DROP COLUMN expired_at,
+DROP COLUMN cancelled_at,
+DROP COLUMN declined_at,
+DROP COLUMN accepted_at,
+ALTER COLUMN status DROP NOT NULL;
@@ -0,0 +1,16 @@
+-- Requests are no longer deleted once answered, so keep track of when and why
+-- each one left the 'pending' state.
+UPDATE appointment_requests SET status = 'pending' WHERE status IS NULL;
+
+ALTER TABLE appointment_requests
+ALTER COLUMN status SET NOT NULL,
+ADD COLUMN accepted_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN declined_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN cancelled_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN expired_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN decline_reason TEXT NOT NULL DEFAULT '',
+ADD CONSTRAINT appointment_requests_status_check
+    CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled', 'expired'));
+
+CREATE INDEX appointment_requests_pending_start_time_idx
+    ON appointment_requests (start_time) WHERE status = 'pending';
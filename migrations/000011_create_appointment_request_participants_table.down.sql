@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS appointment_request_participants;
+
+ALTER TABLE appointment_requests
+DROP CONSTRAINT appointment_requests_quorum_rule_check,
+DROP COLUMN quorum_count,
+DROP COLUMN quorum_rule;
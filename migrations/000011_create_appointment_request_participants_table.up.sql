@@ -0,0 +1,35 @@
+-- How many participants need to accept before a request is confirmed. Can be
+-- 'all', 'majority' or 'count' (in which case quorum_count is used).
+ALTER TABLE appointment_requests
+ADD COLUMN quorum_rule VARCHAR(20) NOT NULL DEFAULT 'all',
+ADD COLUMN quorum_count INT NOT NULL DEFAULT 0,
+ADD CONSTRAINT appointment_requests_quorum_rule_check
+    CHECK (quorum_rule IN ('all', 'majority', 'count'));
+
+CREATE TABLE appointment_request_participants (
+    id SERIAL PRIMARY KEY,
+    request_id INT NOT NULL,
+    CONSTRAINT fk_participant_request_id FOREIGN KEY (request_id)
+        REFERENCES appointment_requests(request_id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    CONSTRAINT fk_participant_user_id FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    required BOOLEAN NOT NULL DEFAULT true,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- Could be 'pending', 'accepted', 'declined' or 'tentative'
+    responded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT appointment_request_participants_status_check
+        CHECK (status IN ('pending', 'accepted', 'declined', 'tentative')),
+    UNIQUE (request_id, user_id)
+);
+
+CREATE INDEX appointment_request_participants_user_id_idx
+    ON appointment_request_participants (user_id);
+
+-- Every existing request had a single target user, who becomes its only
+-- participant.
+INSERT INTO appointment_request_participants (request_id, user_id, status, responded_at)
+SELECT request_id, target_user_id,
+    CASE status WHEN 'accepted' THEN 'accepted' WHEN 'declined' THEN 'declined' ELSE 'pending' END,
+    CASE WHEN status IN ('accepted', 'declined') THEN updated_at END
+FROM appointment_requests;
@@ -0,0 +1,8 @@
+ALTER TABLE appointment_events
+DROP CONSTRAINT appointment_events_unique_event;
+
+ALTER TABLE appointment_requests
+DROP CONSTRAINT fk_request_appointment_id,
+DROP COLUMN appointment_id;
+
+DROP TABLE IF EXISTS provider_operations;
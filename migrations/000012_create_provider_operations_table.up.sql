@@ -0,0 +1,41 @@
+-- Outbox of calendar provider calls. Confirming an appointment only writes to
+-- the database; a background worker then creates (or, when compensating or
+-- deleting, removes) the events with each provider, retrying on failure.
+CREATE TABLE provider_operations (
+    id SERIAL PRIMARY KEY,
+    idempotency_key TEXT UNIQUE NOT NULL,
+    operation VARCHAR(20) NOT NULL,  -- Could be 'create_event' or 'delete_event'
+    -- No foreign key: delete operations have to outlive their appointment.
+    appointment_id INT NOT NULL,
+    user_id INT NOT NULL,
+    CONSTRAINT fk_provider_operations_user_id FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    provider_name VARCHAR(255) NOT NULL,
+    provider_event_id VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- Could be 'pending', 'processing', 'done', 'failed' or 'cancelled'
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT provider_operations_operation_check
+        CHECK (operation IN ('create_event', 'delete_event')),
+    CONSTRAINT provider_operations_status_check
+        CHECK (status IN ('pending', 'processing', 'done', 'failed', 'cancelled'))
+);
+
+CREATE INDEX provider_operations_due_idx
+    ON provider_operations (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX provider_operations_appointment_id_idx
+    ON provider_operations (appointment_id);
+
+-- Link each accepted request to the appointment it produced.
+ALTER TABLE appointment_requests
+ADD COLUMN appointment_id INT,
+ADD CONSTRAINT fk_request_appointment_id FOREIGN KEY (appointment_id)
+    REFERENCES appointments(id) ON DELETE SET NULL;
+
+-- The same provider event must never be recorded twice.
+ALTER TABLE appointment_events
+ADD CONSTRAINT appointment_events_unique_event UNIQUE (appointment_id, user_id, provider_name);
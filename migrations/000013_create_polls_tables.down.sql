@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS poll_votes;
+DROP TABLE IF EXISTS poll_participants;
+ALTER TABLE IF EXISTS polls DROP CONSTRAINT IF EXISTS fk_polls_finalised_option_id;
+DROP TABLE IF EXISTS poll_options;
+DROP TABLE IF EXISTS polls;
@@ -0,0 +1,58 @@
+CREATE TABLE polls (
+    id SERIAL PRIMARY KEY,
+    organizer_id INT NOT NULL,
+    CONSTRAINT fk_polls_organizer_id FOREIGN KEY (organizer_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    group_id INT,
+    CONSTRAINT fk_polls_group_id FOREIGN KEY (group_id)
+        REFERENCES groups(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'open',  -- Could be 'open' or 'finalised'
+    appointment_id INT,
+    CONSTRAINT fk_polls_appointment_id FOREIGN KEY (appointment_id)
+        REFERENCES appointments(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT polls_status_check CHECK (status IN ('open', 'finalised'))
+);
+
+CREATE TABLE poll_options (
+    id SERIAL PRIMARY KEY,
+    poll_id INT NOT NULL,
+    CONSTRAINT fk_poll_options_poll_id FOREIGN KEY (poll_id)
+        REFERENCES polls(id) ON DELETE CASCADE,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+ALTER TABLE polls
+ADD COLUMN finalised_option_id INT,
+ADD CONSTRAINT fk_polls_finalised_option_id FOREIGN KEY (finalised_option_id)
+    REFERENCES poll_options(id) ON DELETE SET NULL;
+
+CREATE TABLE poll_participants (
+    poll_id INT NOT NULL,
+    CONSTRAINT fk_poll_participants_poll_id FOREIGN KEY (poll_id)
+        REFERENCES polls(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    CONSTRAINT fk_poll_participants_user_id FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (poll_id, user_id)
+);
+
+CREATE INDEX poll_participants_user_id_idx ON poll_participants (user_id);
+
+CREATE TABLE poll_votes (
+    option_id INT NOT NULL,
+    CONSTRAINT fk_poll_votes_option_id FOREIGN KEY (option_id)
+        REFERENCES poll_options(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    CONSTRAINT fk_poll_votes_user_id FOREIGN KEY (user_id)
+        REFERENCES users(id) ON DELETE CASCADE,
+    vote VARCHAR(20) NOT NULL,  -- Could be 'yes', 'if_need_be' or 'no'
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT poll_votes_vote_check CHECK (vote IN ('yes', 'if_need_be', 'no')),
+    PRIMARY KEY (option_id, user_id)
+);
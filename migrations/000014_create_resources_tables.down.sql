@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS appointment_request_resources;
+DROP TABLE IF EXISTS appointment_resources;
+DROP TABLE IF EXISTS resources;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
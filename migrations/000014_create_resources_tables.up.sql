@@ -0,0 +1,42 @@
+-- Instance admins manage resources and other users' accounts. Nobody is one
+-- to begin with: start the app with -admin-email to make the first.
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE resources (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'room',  -- Could be 'room', 'equipment' or 'desk'
+    capacity INT NOT NULL DEFAULT 1,
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    attributes TEXT[] NOT NULL DEFAULT '{}',
+    -- Hours of the day (UTC) between which the resource can be booked.
+    available_from SMALLINT NOT NULL DEFAULT 0,
+    available_until SMALLINT NOT NULL DEFAULT 24,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT resources_kind_check CHECK (kind IN ('room', 'equipment', 'desk')),
+    CONSTRAINT resources_capacity_check CHECK (capacity >= 0),
+    CONSTRAINT resources_hours_check CHECK (0 <= available_from AND available_from < available_until AND available_until <= 24)
+);
+
+CREATE TABLE appointment_resources (
+    appointment_id INT NOT NULL,
+    CONSTRAINT fk_appointment_resources_appointment_id FOREIGN KEY (appointment_id)
+        REFERENCES appointments(id) ON DELETE CASCADE,
+    resource_id INT NOT NULL,
+    CONSTRAINT fk_appointment_resources_resource_id FOREIGN KEY (resource_id)
+        REFERENCES resources(id) ON DELETE CASCADE,
+    PRIMARY KEY (appointment_id, resource_id)
+);
+
+CREATE INDEX appointment_resources_resource_id_idx ON appointment_resources (resource_id);
+
+CREATE TABLE appointment_request_resources (
+    request_id INT NOT NULL,
+    CONSTRAINT fk_appointment_request_resources_request_id FOREIGN KEY (request_id)
+        REFERENCES appointment_requests(request_id) ON DELETE CASCADE,
+    resource_id INT NOT NULL,
+    CONSTRAINT fk_appointment_request_resources_resource_id FOREIGN KEY (resource_id)
+        REFERENCES resources(id) ON DELETE CASCADE,
+    PRIMARY KEY (request_id, resource_id)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    -- Only the SHA-256 hash of the token is kept; the prefix is enough of it
+    -- for the user to tell their tokens apart.
+    hash BYTEA NOT NULL UNIQUE,
+    prefix VARCHAR(12) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expiry TIMESTAMP WITH TIME ZONE,  -- NULL if the token never expires
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX api_tokens_user_id_idx ON api_tokens (user_id);
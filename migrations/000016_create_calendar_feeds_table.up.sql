@@ -0,0 +1,9 @@
+-- Each user has at most one secret feed URL. Resetting it replaces the row,
+-- which stops the old URL from working.
+CREATE TABLE calendar_feeds (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    hash BYTEA NOT NULL UNIQUE,
+    include_groups BOOLEAN NOT NULL DEFAULT false,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
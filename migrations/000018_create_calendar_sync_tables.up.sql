@@ -0,0 +1,44 @@
+-- The sync state of each linked calendar. Providers push a notification down
+-- the channel when the calendar changes, which marks it for a resync.
+CREATE TABLE calendar_syncs (
+    user_id INT NOT NULL,
+    auth_provider TEXT NOT NULL,
+    -- The Google channel or Microsoft Graph subscription, or '' if there
+    -- isn't one, in which case the calendar is polled instead.
+    channel_id TEXT NOT NULL DEFAULT '',
+    resource_id TEXT NOT NULL DEFAULT '',
+    token_hash BYTEA,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    synced_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, auth_provider),
+    FOREIGN KEY (user_id, auth_provider) REFERENCES auth_tokens(user_id, auth_provider) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX calendar_syncs_channel_idx
+    ON calendar_syncs (auth_provider, channel_id) WHERE channel_id <> '';
+
+-- The events in each linked calendar as of its last sync.
+CREATE TABLE provider_events (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    auth_provider TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    provider_event_id TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    location TEXT NOT NULL DEFAULT '',
+    is_all_day BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL DEFAULT '',
+    time_zone TEXT NOT NULL DEFAULT '',
+    visibility TEXT NOT NULL DEFAULT '',
+    recurrence TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (user_id, auth_provider) REFERENCES calendar_syncs(user_id, auth_provider) ON DELETE CASCADE
+);
+
+CREATE INDEX provider_events_user_idx ON provider_events (user_id, auth_provider);
@@ -0,0 +1,13 @@
+CREATE TABLE tokens (
+    -- Only the SHA-256 hash of the token is kept.
+    hash BYTEA PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX tokens_user_id_scope_idx ON tokens (user_id, scope);
+
+-- Accounts made before sign ups had to be confirmed are taken as they are,
+-- rather than all being locked out at once.
+UPDATE users SET activated = true;
@@ -0,0 +1,19 @@
+CREATE TABLE user_totp (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- The secret has to be kept as it is to work out the codes.
+    secret TEXT NOT NULL,
+    -- NULL until the user has entered a code from their app.
+    confirmed_at TIMESTAMP WITH TIME ZONE,
+    -- The period of the last code used, so a code can't be used twice.
+    last_counter BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Only the SHA-256 hash of the code is kept.
+    hash BYTEA NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (user_id, hash)
+);
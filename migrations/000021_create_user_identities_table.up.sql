@@ -0,0 +1,17 @@
+-- The accounts at Google or Microsoft that users sign in with. The subject is
+-- the provider's ID for the account, which unlike the email address never
+-- changes.
+CREATE TABLE user_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email CITEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- Users who signed up with a provider get a random password, so they don't
+-- have one they could confirm anything with until they set their own.
+ALTER TABLE users ADD COLUMN password_set BOOLEAN NOT NULL DEFAULT true;
@@ -0,0 +1,22 @@
+-- Failed logins counted against each IP address and account, shared by every
+-- instance of the app. Keys are "ip:<address>" or "email:<address>".
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+-- Every failed login, for auditing.
+CREATE TABLE login_failures (
+    id BIGSERIAL PRIMARY KEY,
+    email CITEXT NOT NULL,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    ip TEXT NOT NULL,
+    -- "password" for a wrong password, "code" for a wrong two-factor code,
+    -- "locked" for a try while locked out.
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX login_failures_user_id_idx ON login_failures (user_id, created_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS user_groups_one_owner_idx;
+
+ALTER TABLE user_groups
+DROP CONSTRAINT IF EXISTS user_groups_role_check,
+DROP COLUMN IF EXISTS role;
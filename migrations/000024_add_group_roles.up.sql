@@ -0,0 +1,14 @@
+-- What each member may do in a group. Can be 'owner', 'admin' or 'member'.
+-- Every group has exactly one owner.
+ALTER TABLE user_groups
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'member',
+ADD CONSTRAINT user_groups_role_check
+    CHECK (role IN ('owner', 'admin', 'member'));
+
+-- The creator of a group was added first, so the earliest member of each
+-- existing group becomes its owner.
+UPDATE user_groups SET role = 'owner'
+WHERE id IN (SELECT MIN(id) FROM user_groups GROUP BY group_id);
+
+CREATE UNIQUE INDEX user_groups_one_owner_idx
+    ON user_groups (group_id) WHERE role = 'owner';
@@ -0,0 +1,16 @@
+-- An invitation to join a group, sent to an email address that may not have
+-- an account yet. It's deleted once it's accepted or declined; inviting the
+-- same address again replaces it. Only the SHA-256 hash of the token in the
+-- emailed links is kept.
+CREATE TABLE group_invitations (
+    id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    email CITEXT NOT NULL,
+    inviter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (group_id, email)
+);
+
+CREATE INDEX group_invitations_email_idx ON group_invitations (email);
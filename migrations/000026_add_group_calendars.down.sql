@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS group_calendar_feeds;
+ALTER TABLE groups DROP COLUMN IF EXISTS calendar_enabled;
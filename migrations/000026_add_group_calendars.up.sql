@@ -0,0 +1,16 @@
+-- A group can have a shared calendar of its appointments, which its members
+-- see on the group page and can subscribe to.
+ALTER TABLE groups ADD COLUMN calendar_enabled BOOLEAN NOT NULL DEFAULT false;
+
+-- Each member has their own secret feed URL for a group's calendar, so it
+-- stops working when they leave the group. Like calendar_feeds, only a hash
+-- of the token is kept.
+CREATE TABLE group_calendar_feeds (
+    group_id INT NOT NULL,
+    user_id INT NOT NULL,
+    hash BYTEA NOT NULL UNIQUE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (user_id, group_id) REFERENCES user_groups (user_id, group_id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS organisation_shares;
+ALTER TABLE users DROP COLUMN IF EXISTS organisation_role;
+ALTER TABLE users DROP COLUMN IF EXISTS organisation_id;
+DROP TABLE IF EXISTS organisations;
@@ -0,0 +1,29 @@
+-- Organisations partition the users of an instance. Users who sign up with
+-- an address at an organisation's domain join it once they've confirmed the
+-- address.
+CREATE TABLE organisations (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    domain CITEXT UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- A user is in at most one organisation. Those outside any can only find
+-- each other.
+ALTER TABLE users
+ADD COLUMN organisation_id INT REFERENCES organisations(id) ON DELETE SET NULL,
+ADD COLUMN organisation_role TEXT NOT NULL DEFAULT 'member'
+    CONSTRAINT users_organisation_role_check CHECK (organisation_role IN ('admin', 'member'));
+
+CREATE INDEX users_organisation_id_idx ON users (organisation_id);
+
+-- An organisation sharing with another lets the other's members find and
+-- send requests to its own. It doesn't work the other way round unless the
+-- other shares back.
+CREATE TABLE organisation_shares (
+    organisation_id INT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    shared_with_id INT NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organisation_id, shared_with_id),
+    CHECK (organisation_id <> shared_with_id)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS mail_failures;
+DROP TABLE IF EXISTS admin_audit_log;
+ALTER TABLE calendar_syncs DROP COLUMN IF EXISTS failed_at;
+ALTER TABLE calendar_syncs DROP COLUMN IF EXISTS last_error;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
@@ -0,0 +1,32 @@
+-- Disabled users can't log in, and their sessions and API tokens stop
+-- working, until an admin enables them again.
+ALTER TABLE users
+ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The last error syncing each linked calendar, cleared by the next sync that
+-- works.
+ALTER TABLE calendar_syncs
+ADD COLUMN last_error TEXT NOT NULL DEFAULT '',
+ADD COLUMN failed_at TIMESTAMP WITH TIME ZONE;
+
+-- What admins have done to users' accounts. Entries outlive the accounts
+-- they're about.
+CREATE TABLE admin_audit_log (
+    id SERIAL PRIMARY KEY,
+    admin_id INT REFERENCES users(id) ON DELETE SET NULL,
+    user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX admin_audit_log_user_id_idx ON admin_audit_log (user_id);
+
+-- Emails the SMTP server wouldn't take.
+CREATE TABLE mail_failures (
+    id SERIAL PRIMARY KEY,
+    recipient TEXT NOT NULL,
+    template TEXT NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
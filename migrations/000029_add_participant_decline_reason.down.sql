@@ -0,0 +1 @@
+ALTER TABLE appointment_request_participants DROP COLUMN IF EXISTS reason;
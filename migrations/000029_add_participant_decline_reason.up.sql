@@ -0,0 +1,4 @@
+-- Why each participant declined, kept separately from the reason the request
+-- as a whole was declined for.
+ALTER TABLE appointment_request_participants
+ADD COLUMN reason TEXT NOT NULL DEFAULT '';
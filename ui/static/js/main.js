@@ -1 +1,63 @@
+// Live updates. Signed in pages have a data-live-events attribute on the body
+// with the URL of the event stream. Parts of a page that should follow along
+// are marked with data-live (the events they listen to) and an id, and
+// data-live-user if they only show one user's data; they're replaced with the
+// same element from a fresh copy of the page.
+(function () {
+  var url = document.body.dataset.liveEvents;
+  if (!url || !window.EventSource) {
+    return;
+  }
 
+  function setBadge(count) {
+    var badge = document.getElementById("pending-requests");
+    if (badge) {
+      badge.textContent = count;
+      badge.hidden = count === 0;
+    }
+  }
+
+  // refresh replaces the elements matching the selector, and the badge,
+  // with the ones from a fresh copy of the page.
+  function refresh(selector) {
+    if (!document.querySelector(selector)) {
+      return;
+    }
+
+    fetch(location.href, { credentials: "same-origin" })
+      .then(function (resp) {
+        return resp.ok ? resp.text() : Promise.reject(resp.status);
+      })
+      .then(function (html) {
+        var doc = new DOMParser().parseFromString(html, "text/html");
+        document.querySelectorAll(selector).forEach(function (el) {
+          var fresh = el.id && doc.getElementById(el.id);
+          if (fresh) {
+            el.replaceWith(document.importNode(fresh, true));
+          }
+        });
+        var badge = doc.getElementById("pending-requests");
+        if (badge) {
+          setBadge(Number(badge.textContent));
+        }
+      })
+      .catch(function () {});
+  }
+
+  var source = new EventSource(url);
+
+  source.addEventListener("requests", function (e) {
+    setBadge(JSON.parse(e.data).pending);
+    refresh("[data-live~='requests']");
+  });
+
+  source.addEventListener("availability", function (e) {
+    var userID = JSON.parse(e.data).user_id;
+    refresh("[data-live~='availability'][data-live-user='" + userID + "']");
+  });
+
+  // Some events were missed, so reload everything that follows along.
+  source.addEventListener("resync", function () {
+    refresh("[data-live], #pending-requests");
+  });
+})();